@@ -0,0 +1,397 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package cli implements the commands the provider binary runs when invoked
+// directly rather than by Terraform, which build, push and inspect charts
+// with the same pipeline the helm_chart resource uses, so a build can be
+// reproduced without writing any configuration.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// commands are the commands Run accepts, by name.
+var commands = map[string]func(ctx context.Context, args []string, stdout, stderr io.Writer) error{
+	"build":   build,
+	"push":    push,
+	"inspect": inspect,
+}
+
+// IsCommand reports whether arg names one of the commands, rather than
+// being a flag to the provider server.
+func IsCommand(arg string) bool {
+	_, ok := commands[arg]
+	return ok
+}
+
+// Run runs the command args[0] with the rest of args, writing its output to
+// stdout and usage and warnings to stderr.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		return fmt.Errorf("expected one of %s", strings.Join(slices.Sorted(maps.Keys(commands)), ", "))
+	}
+	err := commands[args[0]](ctx, args[1:], stdout, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// listFlag is a flag that may be given several times, collecting each value.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// mapFlag is a flag that may be given several times, each as key=value,
+// collecting the values by key.
+type mapFlag map[string]string
+
+func (m *mapFlag) String() string {
+	var kvs []string
+	for _, k := range slices.Sorted(maps.Keys(*m)) {
+		kvs = append(kvs, k+"="+(*m)[k])
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (m *mapFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	if *m == nil {
+		*m = mapFlag{}
+	}
+	(*m)[k] = v
+	return nil
+}
+
+// buildFlags are the flags of the commands that build a chart, mirroring the
+// provider's and the helm_chart resource's attributes of the same names.
+type buildFlags struct {
+	version            string
+	arch               string
+	repositories       listFlag
+	buildRepositories  listFlag
+	keyrings           listFlag
+	onlyConfiguredKeys bool
+	allowUnsigned      bool
+	lockfile           string
+	revisionFormat     string
+	searchPaths        listFlag
+	normalizeModes     bool
+	debugDir           string
+	jsonPatches        mapFlag
+	images             mapFlag
+	readme             string
+	notes              string
+	license            string
+	appendFiles        bool
+	icon               string
+	iconFile           string
+	created            string
+	manifestFormat     string
+	configMediaType    string
+	chartMediaType     string
+}
+
+func (f *buildFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.version, "package-version", "", "version constraint of the package to build, e.g. 1.2.3 or >=1.2")
+	fs.StringVar(&f.arch, "package-arch", "", "architecture of the package to build, the host's by default")
+	fs.Var(&f.repositories, "extra-repositories", "APK repository to resolve the package from; may be repeated")
+	fs.Var(&f.buildRepositories, "build-repositories", "APK repository consulted only while building; may be repeated")
+	fs.Var(&f.keyrings, "extra-keyrings", "key to verify repository indexes with; may be repeated")
+	fs.BoolVar(&f.onlyConfiguredKeys, "only-configured-keys", false, "trust only -extra-keyrings to verify repository indexes")
+	fs.BoolVar(&f.allowUnsigned, "allow-unsigned", false, "skip verifying repository index signatures")
+	fs.StringVar(&f.lockfile, "lockfile", "", "apko lock file pinning the package")
+	fs.StringVar(&f.revisionFormat, "chart-version-revision", "", "how the package revision is carried into the chart version: none, metadata or suffix")
+	fs.Var(&f.searchPaths, "chart-search-paths", "directory of the package searched for the chart; may be repeated")
+	fs.BoolVar(&f.normalizeModes, "normalize-file-modes", false, "write the chart's files with modes 0755 and 0644")
+	fs.StringVar(&f.debugDir, "debug-dir", "", "directory to write the build's intermediate artifacts to")
+	fs.Var(&f.jsonPatches, "json-patch", "`path=file`: RFC 6902 JSON patch in file to apply to the chart file at path; may be repeated")
+	fs.Var(&f.images, "image", "`id=ref`: image reference to resolve the cg.json image id to; may be repeated")
+	fs.StringVar(&f.readme, "readme", "", "file whose content replaces the chart's README.md")
+	fs.StringVar(&f.notes, "notes", "", "file whose content replaces the chart's templates/NOTES.txt")
+	fs.StringVar(&f.license, "license", "", "file whose content replaces the chart's LICENSE")
+	fs.BoolVar(&f.appendFiles, "append-files", false, "append -readme, -notes and -license to the chart's files instead of replacing them")
+	fs.StringVar(&f.icon, "icon", "", "URL to set as the chart's icon")
+	fs.StringVar(&f.iconFile, "icon-file", "", "image file to embed as the chart's icon, as a data URI")
+	fs.StringVar(&f.created, "created", "", "creation time to annotate the manifest with: build, source_date_epoch or an RFC 3339 timestamp")
+	fs.StringVar(&f.manifestFormat, "manifest-format", "", "kind of manifest to publish the chart with: oci (the default) or docker")
+	fs.StringVar(&f.configMediaType, "config-media-type", "", "media type of the chart's config blob, Helm's by default")
+	fs.StringVar(&f.chartMediaType, "chart-layer-media-type", "", "media type of the chart's content layer, Helm's by default")
+}
+
+func (f *buildFlags) config() (*chart.BuildConfig, error) {
+	if f.revisionFormat != "" && !slices.Contains(chart.RevisionFormats, chart.RevisionFormat(f.revisionFormat)) {
+		return nil, fmt.Errorf("-chart-version-revision must be one of %v, got %q", chart.RevisionFormats, f.revisionFormat)
+	}
+	if f.manifestFormat != "" && !slices.Contains(chart.ManifestFormats, chart.ManifestFormat(f.manifestFormat)) {
+		return nil, fmt.Errorf("-manifest-format must be one of %v, got %q", chart.ManifestFormats, f.manifestFormat)
+	}
+	if f.icon != "" && f.iconFile != "" {
+		return nil, errors.New("only one of -icon and -icon-file may be set")
+	}
+
+	patches := map[string][]byte{}
+	for p, file := range f.jsonPatches {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading -json-patch: %w", err)
+		}
+		if _, err := jsonpatch.DecodePatch(b); err != nil {
+			return nil, fmt.Errorf("decoding -json-patch %s: %w", file, err)
+		}
+		patches[p] = b
+	}
+	files := map[string]chart.File{}
+	for p, file := range map[string]string{"README.md": f.readme, "templates/NOTES.txt": f.notes, "LICENSE": f.license} {
+		if file == "" {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		files[p] = chart.File{Content: b, Append: f.appendFiles}
+	}
+	icon := f.icon
+	if f.iconFile != "" {
+		var err error
+		if icon, err = chart.IconDataURI(f.iconFile); err != nil {
+			return nil, fmt.Errorf("reading -icon-file: %w", err)
+		}
+	}
+
+	return &chart.BuildConfig{
+		Version:            f.version,
+		Arch:               f.arch,
+		RuntimeRepos:       f.repositories,
+		BuildRepos:         f.buildRepositories,
+		Keys:               f.keyrings,
+		OnlyConfiguredKeys: f.onlyConfiguredKeys,
+		AllowUnsigned:      f.allowUnsigned,
+		Lockfile:           f.lockfile,
+		RevisionFormat:     chart.RevisionFormat(f.revisionFormat),
+		ChartRoots:         f.searchPaths,
+		NormalizeModes:     f.normalizeModes,
+		DebugDir:           f.debugDir,
+		JSONRFC6902Patches: patches,
+		Images:             f.images,
+		Files:              files,
+		Icon:               icon,
+		Created:            f.created,
+		ManifestFormat:     chart.ManifestFormat(f.manifestFormat),
+		ConfigMediaType:    f.configMediaType,
+		ChartMediaType:     f.chartMediaType,
+	}, nil
+}
+
+// flagSet returns a flag set for the command name, whose arguments are
+// described by args.
+func flagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: terraform-provider-helm %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs, and checks n positional arguments remain.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return fmt.Errorf("%s takes %d arguments, got %d", fs.Name(), n, fs.NArg())
+	}
+	return nil
+}
+
+// build builds a chart from a package, printing what was built and
+// optionally writing the chart's archive, as helm package would.
+func build(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var bf buildFlags
+	var output string
+	fs := flagSet("build", "PACKAGE", stderr)
+	bf.register(fs)
+	fs.StringVar(&output, "o", "", "file to write the chart archive to")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	c, err := buildChart(ctx, fs.Arg(0), &bf, stdout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if output == "" {
+		return nil
+	}
+	return writeArchive(c, output)
+}
+
+// push builds a chart from a package and pushes it to a repository, tagged
+// with its version as the helm_chart resource tags it.
+func push(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var bf buildFlags
+	fs := flagSet("push", "PACKAGE REPO", stderr)
+	bf.register(fs)
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	repo, err := name.NewRepository(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("parsing repository: %w", err)
+	}
+	c, err := buildChart(ctx, fs.Arg(0), &bf, stdout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	digest, err := c.Digest()
+	if err != nil {
+		return err
+	}
+	md, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+
+	opts := remoteOpts(ctx)
+	if err := remote.Write(repo.Digest(digest.String()), c, opts...); err != nil {
+		return fmt.Errorf("pushing chart: %w", err)
+	}
+	tag := repo.Tag(strings.ReplaceAll(md.Version, "+", "_"))
+	if err := remote.Tag(tag, c, opts...); err != nil {
+		return fmt.Errorf("tagging chart: %w", err)
+	}
+	fmt.Fprintf(stdout, "pushed:   %s@%s\n", tag, digest)
+	return nil
+}
+
+// inspect prints what a chart in a registry is: its metadata, manifest
+// annotations and layers.
+func inspect(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flagSet("inspect", "REF", stderr)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	ref, err := chart.ParseReference(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("parsing reference: %w", err)
+	}
+	c, err := chart.Pull(ref, remoteOpts(ctx)...)
+	if err != nil {
+		return fmt.Errorf("pulling chart: %w", err)
+	}
+	return describe(c, stdout)
+}
+
+// buildChart builds the chart of the package name with bf, and prints it. The
+// caller closes the chart.
+func buildChart(ctx context.Context, name string, bf *buildFlags, stdout io.Writer) (chart.BuiltChart, error) {
+	config, err := bf.config()
+	if err != nil {
+		return nil, err
+	}
+	c, err := chart.Build(ctx, name, config)
+	if err != nil {
+		return nil, fmt.Errorf("building chart: %w", err)
+	}
+	pkg := c.Package()
+	fmt.Fprintf(stdout, "package:  %s-%s (%s)\n", pkg.Name, pkg.Version, pkg.Arch)
+	if pkg.Repository != "" {
+		fmt.Fprintf(stdout, "from:     %s\n", pkg.Repository)
+	}
+	if err := describe(c, stdout); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// describe prints c's metadata, manifest annotations and layers.
+func describe(c chart.Chart, stdout io.Writer) error {
+	md, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+	digest, err := c.Digest()
+	if err != nil {
+		return err
+	}
+	m, err := c.Manifest()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "chart:    %s %s\n", md.Name, md.Version)
+	if md.AppVersion != "" {
+		fmt.Fprintf(stdout, "app:      %s\n", md.AppVersion)
+	}
+	fmt.Fprintf(stdout, "digest:   %s\n", digest)
+	for _, l := range m.Layers {
+		fmt.Fprintf(stdout, "layer:    %s %d %s\n", l.Digest, l.Size, l.MediaType)
+	}
+	for _, k := range slices.Sorted(maps.Keys(m.Annotations)) {
+		fmt.Fprintf(stdout, "annotation: %s=%s\n", k, m.Annotations[k])
+	}
+	return nil
+}
+
+// writeArchive writes c's chart archive, its content layer, to path.
+func writeArchive(c chart.Chart, path string) error {
+	layers, err := c.Layers()
+	if err != nil {
+		return err
+	}
+	if len(layers) == 0 {
+		return errors.New("chart has no layers")
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// remoteOpts returns the registry options the commands use, authenticating
+// as docker and gcloud are configured to, bound to ctx.
+func remoteOpts(ctx context.Context) []remote.Option {
+	kc := authn.NewMultiKeychain(google.Keychain, authn.DefaultKeychain)
+	return []remote.Option{remote.WithAuthFromKeychain(kc), remote.WithContext(ctx)}
+}
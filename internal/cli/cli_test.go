@@ -0,0 +1,118 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repoFlags := []string{
+		"-extra-repositories", "../pkg/chart/testdata/packages",
+		"-extra-keyrings", "../pkg/chart/testdata/packages/melange.rsa.pub",
+	}
+	run := func(t *testing.T, args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := Run(t.Context(), args, &stdout, &stderr); err != nil {
+			t.Fatalf("Run(%q) = %v\n%s", args, err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	t.Run("build", func(t *testing.T) {
+		tmp := t.TempDir()
+		t.Setenv("TMPDIR", tmp)
+		out := filepath.Join(t.TempDir(), "basic.tgz")
+		got := run(t, append(append([]string{"build"}, repoFlags...), "-o", out, "chart-basic")...)
+		// Run's context outlives the command, so anything left here is leaked.
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("build left %s in the temp dir", entries[0].Name())
+		}
+		if !strings.Contains(got, "package:  chart-basic-") || !strings.Contains(got, "digest:   sha256:") {
+			t.Errorf("build printed:\n%s", got)
+		}
+		c, err := loader.Load(out)
+		if err != nil {
+			t.Fatalf("loading archive: %v", err)
+		}
+		if c.Name() == "" || !strings.Contains(got, "chart:    "+c.Name()+" "+c.Metadata.Version) {
+			t.Errorf("archive is chart %s %s, build printed:\n%s", c.Name(), c.Metadata.Version, got)
+		}
+	})
+
+	t.Run("build with changes", func(t *testing.T) {
+		dir := t.TempDir()
+		patch := filepath.Join(dir, "patch.json")
+		readme := filepath.Join(dir, "README.md")
+		if err := os.WriteFile(patch, []byte(`[{"op": "replace", "path": "/image/tag", "value": "patched"}]`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(readme, []byte("# ${name}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, "basic.tgz")
+		run(t, append(append([]string{"build"}, repoFlags...), "-json-patch", "values.yaml="+patch, "-readme", readme, "-icon", "https://example.com/icon.png", "-o", out, "chart-basic")...)
+		c, err := loader.Load(out)
+		if err != nil {
+			t.Fatalf("loading archive: %v", err)
+		}
+		if tag, _ := c.Values["image"].(map[string]any)["tag"]; tag != "patched" {
+			t.Errorf("image.tag = %v, want patched", tag)
+		}
+		if c.Metadata.Icon != "https://example.com/icon.png" {
+			t.Errorf("icon = %q", c.Metadata.Icon)
+		}
+		var got string
+		for _, f := range c.Files {
+			if f.Name == "README.md" {
+				got = string(f.Data)
+			}
+		}
+		if want := "# " + c.Name() + "\n"; got != want {
+			t.Errorf("README.md = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("push and inspect", func(t *testing.T) {
+		repo := reg.Repo("charts/basic")
+		pushed := run(t, append(append([]string{"push"}, repoFlags...), "chart-basic", repo)...)
+		var ref, digest string
+		for _, line := range strings.Split(pushed, "\n") {
+			if s, ok := strings.CutPrefix(line, "pushed:   "); ok {
+				ref, digest, _ = strings.Cut(s, "@")
+			}
+		}
+		if !strings.HasPrefix(ref, repo+":") {
+			t.Fatalf("push printed:\n%s", pushed)
+		}
+		if got := run(t, "inspect", ref); !strings.Contains(got, "digest:   "+digest) {
+			t.Errorf("inspect %s printed:\n%s", ref, got)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		for _, args := range [][]string{nil, {"frobnicate"}, {"inspect"}, {"push", "chart-basic"}, {"build", "-json-patch", "values.yaml", "chart-basic"}} {
+			if err := Run(t.Context(), args, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+				t.Errorf("Run(%q) succeeded, want an error", args)
+			}
+		}
+		if err := Run(t.Context(), []string{"build", "-h"}, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			t.Errorf("Run(build -h) = %v", err)
+		}
+	})
+}
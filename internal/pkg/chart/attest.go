@@ -0,0 +1,123 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// ScanPredicateType identifies the predicate of scan attestations. It
+	// names the built-in lint, not a scanner, which the findings aren't from.
+	ScanPredicateType = "https://github.com/chainguard-dev/terraform-provider-helm/lint/v1"
+
+	inTotoMediaType     = "application/vnd.in-toto+json"
+	predicateAnnotation = "in-toto.io/predicate-type"
+	emptyMediaType      = "application/vnd.oci.empty.v1+json"
+)
+
+// ScanReport is the predicate of a scan attestation: the findings of a Scan
+// and the policy they were judged by. Linter and Checks say exactly what
+// produced them, so they aren't taken for a full scanner's.
+type ScanReport struct {
+	Linter     string    `json:"linter"`
+	Checks     []string  `json:"checks"`
+	FailOn     Severity  `json:"failOn"`
+	SkipChecks []string  `json:"skipChecks,omitempty"`
+	Findings   []Finding `json:"findings"`
+}
+
+// ScanLinter is the Linter of reports of Scan's findings.
+const ScanLinter = "terraform-provider-helm built-in lint"
+
+// artifactManifest is an OCI image manifest with an artifactType, which
+// v1.Manifest lacks.
+type artifactManifest struct {
+	v1.Manifest
+	ArtifactType string `json:"artifactType"`
+}
+
+// Attest attaches an unsigned in-toto statement about subject, with the
+// given predicate, as a referrer of subject. Attesting the same predicate
+// twice produces the same referrer. It returns the referrer's digest.
+func Attest(subject name.Digest, predicateType string, predicate any, opts ...remote.Option) (v1.Hash, error) {
+	desc, err := remote.Head(subject, opts...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("fetching %s: %w", subject, err)
+	}
+
+	algo, hex, _ := strings.Cut(subject.DigestStr(), ":")
+	statement, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []map[string]any{{"name": subject.Context().String(), "digest": map[string]string{algo: hex}}},
+		"predicateType": predicateType,
+		"predicate":     predicate,
+	})
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	config := static.NewLayer([]byte("{}"), emptyMediaType)
+	layer := static.NewLayer(statement, inTotoMediaType)
+	var descs []v1.Descriptor
+	for _, l := range []v1.Layer{config, layer} {
+		if err := remote.WriteLayer(subject.Context(), l, opts...); err != nil {
+			return v1.Hash{}, fmt.Errorf("uploading attestation: %w", err)
+		}
+		d, err := partial.Descriptor(l)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		descs = append(descs, *d)
+	}
+	descs[1].Annotations = map[string]string{predicateAnnotation: predicateType}
+
+	raw, err := json.Marshal(artifactManifest{
+		Manifest: v1.Manifest{
+			SchemaVersion: 2,
+			MediaType:     ggcrtypes.OCIManifestSchema1,
+			Config:        descs[0],
+			Layers:        descs[1:],
+			Subject:       &v1.Descriptor{MediaType: desc.MediaType, Size: desc.Size, Digest: desc.Digest},
+			// Referrers lists carry the manifest's annotations, so clients
+			// can pick out attestations without fetching each one.
+			Annotations: map[string]string{predicateAnnotation: predicateType},
+		},
+		ArtifactType: inTotoMediaType,
+	})
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, size, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if err := remote.Put(subject.Context().Digest(h.String()), rawManifest(raw), opts...); err != nil {
+		return v1.Hash{}, fmt.Errorf("pushing attestation: %w", err)
+	}
+
+	return h, addReferrers(subject, []v1.Descriptor{{
+		MediaType:    ggcrtypes.OCIManifestSchema1,
+		Size:         size,
+		Digest:       h,
+		ArtifactType: inTotoMediaType,
+		Annotations:  map[string]string{predicateAnnotation: predicateType},
+	}}, opts...)
+}
+
+// rawManifest is an OCI image manifest to put as is.
+type rawManifest []byte
+
+func (r rawManifest) RawManifest() ([]byte, error) { return r, nil }
+
+func (r rawManifest) MediaType() (ggcrtypes.MediaType, error) {
+	return ggcrtypes.OCIManifestSchema1, nil
+}
@@ -3,25 +3,37 @@ package chart
 import (
 	"archive/tar"
 	"bytes"
+	"cmp"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/expandapk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build"
 	apkotypes "chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/tarfs"
 	"chainguard.dev/sdk/helm/images"
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/scratch"
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	yamlpatch "github.com/palantir/pkg/yamlpatch"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	helmregistry "helm.sh/helm/v3/pkg/registry"
@@ -29,75 +41,385 @@ import (
 )
 
 type BuildConfig struct {
-	Version            string
-	Keys               []string
-	RuntimeRepos       []string
+	Version      string
+	Keys         []string
+	RuntimeRepos []string
+	// BuildRepos are consulted when resolving and fetching the package but,
+	// unlike RuntimeRepos, are never recorded in anything the build produces.
+	BuildRepos         []string
 	Arch               string
 	JSONRFC6902Patches map[string][]byte
 	Images             map[string]string
+	// Files replaces or appends to files in the chart, by path relative to
+	// the chart root, adding any the chart lacks. They are applied after
+	// JSONRFC6902Patches.
+	Files map[string]File
+	// Icon, if set, replaces the icon URL in Chart.yaml. It may be a data
+	// URI, and the placeholders ${name} and ${version} are replaced with the
+	// chart's name and version.
+	Icon string
+	// Maintainers, if set, replace the maintainers in Chart.yaml, or with
+	// AppendMaintainers are added after them.
+	Maintainers       []*helmchart.Maintainer
+	AppendMaintainers bool
+	// Keywords and Sources, if not nil, replace those lists in Chart.yaml;
+	// empty lists clear them. Home, if set, replaces its home URL. The
+	// placeholders in Home and Sources are replaced as for Icon.
+	Keywords []string
+	Home     string
+	Sources  []string
+	// SourceAnnotation is how Sources are carried into the manifest's
+	// SourceAnnotation: SourcesJoin (the default), SourcesFirst, or a value
+	// to use instead, with placeholders replaced as for Icon.
+	SourceAnnotation string
+	// Created, if set, adds the manifest's CreatedAnnotation:
+	// CreatedBuildTime, CreatedSourceDateEpoch, or an RFC 3339 timestamp.
+	Created string
+	// CopyAnnotations, if not nil, limits the Chart.yaml annotations copied
+	// to the manifest to those matching one of its path.Match patterns; an
+	// empty list copies none.
+	CopyAnnotations []string
+	// MaxAnnotationSize, if set, truncates manifest annotation values to at
+	// most this many bytes, for registries that limit their size.
+	// OversizedAnnotations reports which were truncated.
+	MaxAnnotationSize int
+	// Deprecated marks the chart deprecated in Chart.yaml.
+	Deprecated bool
+	// ValuesDocs generates a helm-docs style table of the chart's values
+	// from the comments in its values.yaml, after JSONRFC6902Patches and
+	// Images apply, and puts it in README.md, after Files apply.
+	ValuesDocs bool
+	// NormalizeModes writes the chart's directories with mode 0755 and
+	// everything else with 0644, whatever modes the package has.
+	NormalizeModes bool
+	// Layers are published in the chart's manifest after its content.
+	Layers []Layer
+	// ManifestFormat is the kind of manifest the chart is published with,
+	// an OCI manifest if unset.
+	ManifestFormat ManifestFormat
+	// ConfigMediaType and ChartMediaType are the media types of the chart's
+	// config blob and content layer, Helm's if unset, for registries that
+	// only accept allow-listed types. Helm only pulls charts with its own.
+	ConfigMediaType string
+	ChartMediaType  string
+	// RevisionFormat controls whether the APK revision is carried into the chart version.
+	RevisionFormat RevisionFormat
+	// Lockfile is the path of an apko lock file. When set, the package is
+	// fetched from the URL it pins instead of being resolved from an APKINDEX,
+	// and its control checksum is verified against the lock.
+	Lockfile string
+	// Cache, when set, is shared between builds to deduplicate repository
+	// index and key lookups, e.g. when building for several arches at once.
+	Cache *apk.Cache
+	// OnlyConfiguredKeys trusts only Keys to verify repository indexes,
+	// dropping the keys apko discovers from the repositories themselves,
+	// such as Wolfi's and Alpine's.
+	OnlyConfiguredKeys bool
+	// AllowUnsigned skips verifying repository index signatures, for
+	// building from local packages no key has been set up for yet.
+	AllowUnsigned bool
+	// PreferPackages and BlockPackages steer which package is built when
+	// several are named or provide the package asked for: the first of
+	// PreferPackages that does is built, and BlockPackages never are.
+	PreferPackages []string
+	BlockPackages  []string
+	// BundlePattern, when set, vendors the charts of the packages in the
+	// package's dependency closure whose names match it, as understood by
+	// path.Match, into the chart's charts/ directory, so the chart installs
+	// with them. It can't be used with Lockfile.
+	BundlePattern string
+	// ChartRoots are the directories of the package, relative to its root,
+	// whose subdirectories are searched for the chart, most preferred
+	// first. "" or "." is the top level. When empty, DefaultChartRoots
+	// are searched.
+	ChartRoots []string
+	// DebugDir, if set, is where builds write their intermediate artifacts,
+	// for diagnosing what patches and other changes did: each package's
+	// are written to a directory of it named for the package, its version
+	// and arch, replacing any from before. It holds the package as
+	// fetched, package.apk, its chart before any changes, in original/,
+	// and, once built, the chart as built, in chart/, and its manifest,
+	// manifest.json.
+	DebugDir string
 }
 
-func Build(ctx context.Context, name string, config *BuildConfig) (Chart, error) {
-	cd, err := config.fetch(ctx, name)
+// DefaultChartRoots are where charts are searched for in packages when
+// BuildConfig.ChartRoots is empty: a top-level directory, then the
+// directory some packages install charts to.
+var DefaultChartRoots = []string{"", "usr/share/helm/charts"}
+
+// created returns the CreatedAnnotation value for config.Created, in UTC.
+func (config *BuildConfig) created() (string, error) {
+	var t time.Time
+	switch config.Created {
+	case "":
+		return "", nil
+	case CreatedBuildTime:
+		t = time.Now()
+	case CreatedSourceDateEpoch:
+		epoch := os.Getenv("SOURCE_DATE_EPOCH")
+		if epoch == "" {
+			return "", errors.New("SOURCE_DATE_EPOCH is not set")
+		}
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parsing SOURCE_DATE_EPOCH: %w", err)
+		}
+		t = time.Unix(sec, 0)
+	default:
+		var err error
+		if t, err = time.Parse(time.RFC3339, config.Created); err != nil {
+			return "", fmt.Errorf("parsing created time: %w", err)
+		}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// File is content to put in a chart when it is built. The placeholders
+// ${name} and ${version} in Content are replaced as for BuildConfig.Icon.
+type File struct {
+	Content []byte
+	// Append adds Content to the end of the file, instead of replacing it.
+	Append bool
+}
+
+// Package describes the APK package a chart was built from.
+type Package struct {
+	Name    string
+	Version string
+	Arch    string
+	// Checksum is the APKINDEX checksum of the package's control section, in
+	// APK's "Q1" + base64(SHA-1) form. It changes whenever the package is
+	// rebuilt, even at the same version.
+	Checksum string
+	// URL is where the package was fetched from.
+	URL string
+	// Repository is the repository the package was resolved from, for its
+	// arch, e.g. "https://packages.wolfi.dev/os/x86_64". For packages pinned
+	// by a lockfile, it is the directory of URL. It is empty for packages
+	// from BuildRepos, which are never recorded.
+	Repository string
+	// RepositoryUpdated is when Repository's index last changed, as far as
+	// can be told: the build time of the newest package it lists. It is zero
+	// for packages pinned by a lockfile or from BuildRepos.
+	RepositoryUpdated time.Time
+	// BuildTime is when the package was built, according to the APKINDEX.
+	// It is zero for packages pinned by a lockfile.
+	BuildTime time.Time
+	// Dependencies are the names of the other packages in the package's
+	// dependency closure, sorted. They are nil for packages pinned by a
+	// lockfile, which are fetched alone.
+	Dependencies []string
+	// IndexDigest identifies the contents of the repository indexes the
+	// package was resolved from, changing whenever any package is added,
+	// removed or rebuilt. It is empty for packages pinned by a lockfile.
+	IndexDigest string
+}
+
+// BuiltChart is a Chart built from an APK package.
+type BuiltChart interface {
+	Chart
+	// Package returns the package the chart was built from.
+	Package() *Package
+	// Close removes the temp dir the chart's content layer is read from.
+	// The chart can't be read or pushed after.
+	Close() error
+}
+
+// Build fetches the package name and converts it to a chart. The package is
+// unpacked into an in-memory filesystem, so builds can safely run
+// concurrently. Indexes generated for local repositories and the chart's
+// compressed layer are written to a temp dir private to the build, which
+// callers remove with Close once done with the chart, and which is otherwise
+// removed once ctx is done. Nothing else is written besides apko's download
+// cache under the user cache directory.
+func Build(ctx context.Context, name string, config *BuildConfig) (_ BuiltChart, err error) {
+	extra, err := extraLayers(config.Layers, config.configMediaType(), config.chartMediaType())
 	if err != nil {
 		return nil, err
 	}
 
-	chartl, metadata, err := chartify(cd, config.JSONRFC6902Patches, config.Images)
+	tmp := scratch.New(ctx, "")
+	defer func() {
+		if err != nil {
+			tmp.Close()
+		}
+	}()
+	cd, err := config.fetch(ctx, name, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	// The inputs are written first, so they are there should the build
+	// fail.
+	var debugDir string
+	if config.DebugDir != "" {
+		if debugDir, err = config.writeDebugInputs(ctx, cd); err != nil {
+			return nil, fmt.Errorf("writing debug artifacts: %w", err)
+		}
+	}
+
+	chartl, metadata, err := chartify(ctx, cd, config, tmp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build chart layer: %w", err)
 	}
 
-	chart := &chart{
-		metadata:  metadata,
-		content:   chartl,
-		diffIDs:   make(map[v1.Hash]v1.Layer),
-		digestIDs: make(map[v1.Hash]v1.Layer),
+	created, err := config.created()
+	if err != nil {
+		return nil, err
+	}
+
+	source := config.SourceAnnotation
+	if source != SourcesJoin && source != SourcesFirst {
+		source = placeholders(metadata).Replace(source)
+	}
+
+	chart := &builtChart{
+		chart: chart{
+			metadata:          metadata,
+			content:           chartl,
+			extra:             extra,
+			format:            config.ManifestFormat,
+			configType:        config.configMediaType(),
+			source:            source,
+			created:           created,
+			copyAnnotations:   config.CopyAnnotations,
+			maxAnnotationSize: config.MaxAnnotationSize,
+			diffIDs:           make(map[v1.Hash]v1.Layer),
+			digestIDs:         make(map[v1.Hash]v1.Layer),
+		},
+		pkg: cd.pkg,
+		tmp: tmp,
+	}
+
+	if debugDir != "" {
+		if err := writeDebugOutputs(ctx, debugDir, &chart.chart, cd.name); err != nil {
+			return nil, fmt.Errorf("writing debug artifacts: %w", err)
+		}
 	}
 
 	return chart, nil
 }
 
+// Resolve resolves the package that Build would use for name, without
+// fetching it.
+func Resolve(ctx context.Context, name string, config *BuildConfig) (*Package, error) {
+	tmp := scratch.New(ctx, "")
+	defer tmp.Close()
+	_, _, pkg, _, err := config.resolve(ctx, name, tmp)
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+type builtChart struct {
+	chart
+	pkg *Package
+	tmp *scratch.Dir
+}
+
+func (c *builtChart) Close() error {
+	return c.tmp.Close()
+}
+
+func (c *builtChart) Package() *Package {
+	return c.pkg
+}
+
+func toPackage(pkg *apk.RepositoryPackage) *Package {
+	out := &Package{
+		Name:      pkg.Name,
+		Version:   pkg.Version,
+		Arch:      pkg.Arch,
+		Checksum:  pkg.ChecksumString(),
+		URL:       pkg.URL(),
+		BuildTime: pkg.BuildTime,
+	}
+	if repo := pkg.Repository(); repo != nil {
+		out.Repository = repo.URI
+		for _, p := range repo.Packages() {
+			if p.BuildTime.After(out.RepositoryUpdated) {
+				out.RepositoryUpdated = p.BuildTime
+			}
+		}
+	}
+	return out
+}
+
 // chartify takes a standard "apko" layer and mutates it to the format required by the Helm OCI format.
+// The layer is read from a file in tmp, so reading it fails once tmp is removed.
 // This essentially just "re-roots" the filesystem to the root where Chart.yaml is located.
 // If imageRefs and mapping are provided, it resolves the image values and merges into values.yaml.
-func chartify(cd *chartData, patches map[string][]byte, imageRefs map[string]string) (v1.Layer, *helmchart.Metadata, error) {
+// The chart version in Chart.yaml is rewritten to carry the APK revision according to config.RevisionFormat, and its icon, maintainers and other catalog metadata replaced per config.
+// Files are written after everything else, once the chart's name and version are known.
+// Symlinks and hardlinks are written as the regular files they resolve to, which Helm needs.
+func chartify(ctx context.Context, cd *chartData, config *BuildConfig, tmp *scratch.Dir) (v1.Layer, *helmchart.Metadata, error) {
+	patches, imageRefs, files := config.JSONRFC6902Patches, config.Images, config.Files
+	if _, ok := files[readmePath]; config.ValuesDocs && !ok {
+		// Rewrite the chart's README as is, so the values docs can be added.
+		files = maps.Clone(files)
+		if files == nil {
+			files = map[string]File{}
+		}
+		files[readmePath] = File{Append: true}
+	}
+
 	gr, err := gzip.NewReader(cd.data)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
 	}
 	defer gr.Close()
 
-	tr := tar.NewReader(gr)
+	tr := tar.NewReader(ctxReader{ctx: ctx, r: gr})
 
 	var buf bytes.Buffer
-	tw := tar.NewWriter(&buf)
+	tw := &chartWriter{Writer: tar.NewWriter(&buf), normalizeModes: config.NormalizeModes}
 
-	var metadata *helmchart.Metadata
+	var (
+		metadata *helmchart.Metadata
+		chartHdr tar.Header
+		// originals holds the content of files to be appended to.
+		originals = map[string][]byte{}
+		values    []byte
+	)
 
-	for {
+	for n := 0; ; n++ {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("error reading tar: %w", err)
+			return nil, nil, fmt.Errorf("error reading tar after %d files: %w", n, err)
 		}
 
-		if !strings.HasPrefix(hdr.Name, cd.name+"/") {
+		if !strings.HasPrefix(hdr.Name, cd.dir+"/") {
 			continue
 		}
+		var r io.Reader = tr
+		if l, ok := cd.links[hdr.Name]; ok {
+			hdr, r = l.header(hdr.Name), bytes.NewReader(l.content)
+		}
 
-		rel, err := filepath.Rel(cd.name, hdr.Name)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error getting relative path: %w", err)
+		rel := archiveRel(cd.dir, hdr.Name)
+		if cd.dir != cd.name {
+			hdr.Name = cd.name + strings.TrimPrefix(hdr.Name, cd.dir)
 		}
 
 		p, needsPatch := patches[rel]
 		needsResolve := rel == "values.yaml" && cd.mapping != nil && len(imageRefs) > 0
+		f, needsFile := files[rel]
 
-		if needsPatch || needsResolve || rel == "Chart.yaml" {
-			content, err := io.ReadAll(tr)
+		for _, b := range cd.bundled {
+			if strings.HasPrefix(rel, "charts/"+b.name+"/") || rel == "charts/"+b.name+".tgz" {
+				return nil, nil, fmt.Errorf("bundling %s: the chart already has charts/%s", b.pkg.Name, b.name)
+			}
+		}
+
+		needsValues := config.ValuesDocs && rel == "values.yaml"
+
+		if needsPatch || needsResolve || needsFile || needsValues || rel == "Chart.yaml" {
+			content, err := io.ReadAll(r)
 			if err != nil {
 				return nil, nil, fmt.Errorf("error reading file: %w", err)
 			}
@@ -120,6 +442,74 @@ func chartify(cd *chartData, patches map[string][]byte, imageRefs map[string]str
 				if err := yaml.Unmarshal(content, &metadata); err != nil {
 					return nil, nil, fmt.Errorf("error parsing Chart.yaml: %w", err)
 				}
+
+				version, err := withRevision(metadata.Version, cd.pkg.Version, config.RevisionFormat)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error applying package revision to chart version: %w", err)
+				}
+				// The YAML patcher won't add keys that exist, so the ops
+				// replace the ones that do.
+				var fields map[string]any
+				if err := yaml.Unmarshal(content, &fields); err != nil {
+					return nil, nil, fmt.Errorf("error parsing Chart.yaml: %w", err)
+				}
+				var ops []map[string]any
+				if version != metadata.Version {
+					ops = append(ops, map[string]any{"op": "replace", "path": "/version", "value": version})
+					metadata.Version = version
+				}
+				if config.Icon != "" {
+					metadata.Icon = placeholders(metadata).Replace(config.Icon)
+					ops = append(ops, setOp(fields, "icon", metadata.Icon))
+				}
+				if len(config.Maintainers) > 0 {
+					if !config.AppendMaintainers {
+						metadata.Maintainers = nil
+					}
+					metadata.Maintainers = append(metadata.Maintainers, config.Maintainers...)
+					ops = append(ops, setOp(fields, "maintainers", metadata.Maintainers))
+				}
+				if config.Keywords != nil {
+					metadata.Keywords = config.Keywords
+					ops = append(ops, setOp(fields, "keywords", metadata.Keywords))
+				}
+				if config.Home != "" {
+					metadata.Home = placeholders(metadata).Replace(config.Home)
+					ops = append(ops, setOp(fields, "home", metadata.Home))
+				}
+				if config.Sources != nil {
+					metadata.Sources = make([]string, 0, len(config.Sources))
+					for _, src := range config.Sources {
+						metadata.Sources = append(metadata.Sources, placeholders(metadata).Replace(src))
+					}
+					ops = append(ops, setOp(fields, "sources", metadata.Sources))
+				}
+				if config.Deprecated {
+					metadata.Deprecated = true
+					ops = append(ops, setOp(fields, "deprecated", true))
+				}
+				if len(ops) > 0 {
+					op, err := json.Marshal(ops)
+					if err != nil {
+						return nil, nil, fmt.Errorf("error encoding Chart.yaml patch: %w", err)
+					}
+					content, err = patchedWith(rel, content, op)
+					if err != nil {
+						return nil, nil, fmt.Errorf("error rewriting Chart.yaml: %w", err)
+					}
+				}
+				chartHdr = *hdr
+			}
+
+			if needsValues {
+				values = content
+			}
+
+			if needsFile {
+				if f.Append {
+					originals[rel] = content
+				}
+				continue
 			}
 
 			hdr.Size = int64(len(content))
@@ -133,24 +523,191 @@ func chartify(cd *chartData, patches map[string][]byte, imageRefs map[string]str
 			if err := tw.WriteHeader(hdr); err != nil {
 				return nil, nil, fmt.Errorf("error writing header: %w", err)
 			}
-			if _, err := io.CopyN(tw, tr, hdr.Size); err != nil {
+			if _, err := io.CopyN(tw, r, hdr.Size); err != nil {
 				return nil, nil, fmt.Errorf("error copying file: %w", err)
 			}
 		}
 	}
 
+	if metadata == nil {
+		return nil, nil, fmt.Errorf("could not find Chart.yaml")
+	}
+
+	for _, rel := range slices.Sorted(maps.Keys(files)) {
+		f := files[rel]
+		content := []byte(placeholders(metadata).Replace(string(f.Content)))
+		if orig := originals[rel]; len(orig) > 0 {
+			if !bytes.HasSuffix(orig, []byte("\n")) {
+				orig = append(orig, '\n')
+			}
+			content = append(orig, content...)
+		}
+		if rel == readmePath && config.ValuesDocs {
+			table, err := valuesTable(values)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error documenting values: %w", err)
+			}
+			content = withValuesDocs(content, table)
+		}
+		// Files the chart lacks are added looking like Chart.yaml.
+		hdr := chartHdr
+		hdr.Name = cd.name + "/" + rel
+		hdr.Size = int64(len(content))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			return nil, nil, fmt.Errorf("error writing header: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, nil, fmt.Errorf("error writing %s: %w", rel, err)
+		}
+	}
+
+	for _, b := range cd.bundled {
+		if err := bundle(ctx, tw, cd.name+"/charts", b); err != nil {
+			return nil, nil, fmt.Errorf("bundling %s: %w", b.pkg.Name, err)
+		}
+	}
+
 	if err := tw.Close(); err != nil {
 		return nil, nil, fmt.Errorf("error closing tar: %w", err)
 	}
 
-	if metadata == nil {
-		return nil, nil, fmt.Errorf("could not find Chart.yaml")
+	l, err := compressedLayer(tmp, buf.Bytes(), config.chartMediaType())
+	return l, metadata, err
+}
+
+// compressedLayer returns a layer of the uncompressed tar archive b, gzipped
+// once up front into a file in tmp. A layer
+// opened from uncompressed bytes is gzipped again each time it is read, once
+// for its digest and again for every push, and keeping it compressed in
+// memory holds every chart of an apply there. BestSpeed matches ggcr's
+// default, keeping digests stable.
+func compressedLayer(tmp *scratch.Dir, b []byte, mt ggcrtypes.MediaType) (_ v1.Layer, err error) {
+	dir, err := tmp.Path()
+	if err != nil {
+		return nil, fmt.Errorf("error creating chart layer: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "chart-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("error creating chart layer: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	defer f.Close()
 
-	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
-		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
-	}, tarball.WithMediaType(helmregistry.ChartLayerMediaType))
-	return l, metadata, err
+	zw, err := gzip.NewWriterLevel(f, gzip.BestSpeed)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip writer: %w", err)
+	}
+	if _, err := zw.Write(b); err != nil {
+		return nil, fmt.Errorf("error compressing chart: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing chart: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("error writing chart layer: %w", err)
+	}
+
+	l, err := tarball.LayerFromFile(f.Name(), tarball.WithMediaType(mt))
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// configMediaType returns the media type of the chart's config blob.
+func (c *BuildConfig) configMediaType() ggcrtypes.MediaType {
+	if c.ConfigMediaType != "" {
+		return ggcrtypes.MediaType(c.ConfigMediaType)
+	}
+	return helmregistry.ConfigMediaType
+}
+
+// chartMediaType returns the media type of the chart's content layer.
+func (c *BuildConfig) chartMediaType() ggcrtypes.MediaType {
+	if c.ChartMediaType != "" {
+		return ggcrtypes.MediaType(c.ChartMediaType)
+	}
+	return helmregistry.ChartLayerMediaType
+}
+
+// archiveRel returns name, a path in a package under dir, relative to dir.
+// Archive paths are slash-separated whatever the OS, so they are worked with
+// using path rather than filepath, which would use backslashes on Windows.
+func archiveRel(dir, name string) string {
+	return path.Clean(strings.TrimPrefix(name, dir+"/"))
+}
+
+// chartWriter writes the entries of a chart, normalizing their modes if
+// normalizeModes is set.
+type chartWriter struct {
+	*tar.Writer
+	normalizeModes bool
+}
+
+func (w *chartWriter) WriteHeader(hdr *tar.Header) error {
+	if w.normalizeModes {
+		hdr.Mode = 0o644
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Mode = 0o755
+		}
+	}
+	return w.Writer.WriteHeader(hdr)
+}
+
+// bundle writes the chart b to tw under dir, as is.
+func bundle(ctx context.Context, tw *chartWriter, dir string, b *chartData) error {
+	gr, err := gzip.NewReader(bytes.NewReader(b.data.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(ctxReader{ctx: ctx, r: gr})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar: %w", err)
+		}
+		if !strings.HasPrefix(hdr.Name, b.dir+"/") {
+			continue
+		}
+		var r io.Reader = tr
+		if l, ok := b.links[hdr.Name]; ok {
+			hdr, r = l.header(hdr.Name), bytes.NewReader(l.content)
+		}
+		hdr.Name = dir + "/" + b.name + strings.TrimPrefix(hdr.Name, b.dir)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("error writing header: %w", err)
+		}
+		if _, err := io.CopyN(tw, r, hdr.Size); err != nil {
+			return fmt.Errorf("error copying file: %w", err)
+		}
+	}
+}
+
+// placeholders replaces ${name} and ${version} with the chart's.
+func placeholders(md *helmchart.Metadata) *strings.Replacer {
+	return strings.NewReplacer("${name}", md.Name, "${version}", md.Version)
+}
+
+// readmePath is where the chart's README is.
+const readmePath = "README.md"
+
+// setOp returns a JSON patch op setting the top-level key of a document with
+// the given fields to value.
+func setOp(fields map[string]any, key string, value any) map[string]any {
+	op := "add"
+	if _, ok := fields[key]; ok {
+		op = "replace"
+	}
+	return map[string]any{"op": op, "path": "/" + key, "value": value}
 }
 
 func patchedWith(filename string, original []byte, patchOps []byte) ([]byte, error) {
@@ -179,52 +736,296 @@ func patchedWith(filename string, original []byte, patchOps []byte) ([]byte, err
 	return patched, nil
 }
 
+// ctxReader fails reads once ctx is done, so long copies stop promptly when
+// an apply is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 type chartData struct {
+	// name is the chart's directory in the built chart, the last element
+	// of dir, where it is in the package.
 	name    string
+	dir     string
+	pkg     *Package
 	mapping *images.Mapping
 	data    *bytes.Buffer
+	// apk is the package as fetched, kept only for DebugDir.
+	apk []byte
+	// links are the files the links in the chart resolve to, by the link's
+	// name in the package.
+	links map[string]linkedFile
+	// bundled are the charts of dependencies vendored into charts/.
+	bundled []*chartData
 }
 
-// fetch fetches the chart APK and parses its metadata.
-func (c *BuildConfig) fetch(ctx context.Context, name string) (*chartData, error) {
-	bc, err := c.bc(ctx, name)
+// resolve resolves the chart package from the lockfile if one is configured,
+// and otherwise from the configured repositories. It returns the APK client to
+// fetch the package with, and the other packages in its dependency closure,
+// sorted by name.
+func (c *BuildConfig) resolve(ctx context.Context, name string, tmp *scratch.Dir) (*apk.APK, apk.FetchablePackage, *Package, []*apk.RepositoryPackage, error) {
+	c.defaultArch()
+
+	if c.Lockfile != "" {
+		locked, pkg, err := c.fromLock(name)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		// Locked packages are fetched by URL, so no repositories are needed.
+		a, err := apk.New(ctx, apk.WithFS(tarfs.New()), apk.WithArch(apkotypes.ParseArchitecture(c.Arch).ToAPK()))
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("initializing apk: %w", err)
+		}
+		return a, locked, pkg, nil, nil
+	}
+
+	bc, err := c.bc(ctx, name, tmp)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, nil, err
+	}
+
+	indexes, err := bc.APK().GetRepositoryIndexes(ctx, c.AllowUnsigned)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("getting repository indexes: %w", err)
+	}
+
+	// Resolve the package that is built, which may provide name rather
+	// than be named it.
+	if name, err = c.choose(ctx, indexes, name); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if err := bc.APK().SetWorld(ctx, []string{c.world(name)}); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("setting world: %w", err)
 	}
 
 	pkgs, conflicts, err := bc.APK().ResolveWorld(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve package: %w for arch %q", err, c.Arch)
+		return nil, nil, nil, nil, fmt.Errorf("failed to resolve package: %w for arch %q", err, c.Arch)
 	}
 
 	if len(conflicts) > 0 {
-		return nil, fmt.Errorf("package conflicts detected: %v", conflicts)
+		return nil, nil, nil, nil, fmt.Errorf("package conflicts detected: %v", conflicts)
 	}
 
-	var chartPkg *apk.RepositoryPackage
-	for _, pkg := range pkgs {
-		if pkg.Name == name {
-			chartPkg = pkg
-			break
+	i := slices.IndexFunc(pkgs, func(p *apk.RepositoryPackage) bool { return p.Name == name })
+	if i < 0 {
+		return nil, nil, nil, nil, fmt.Errorf("package %q not found in resolved packages", name)
+	}
+	pkg := toPackage(pkgs[i])
+	pkg.IndexDigest = indexDigest(indexes)
+	if fromBuildRepo(bc.ImageConfiguration().Contents.BuildRepositories, pkg) {
+		pkg.Repository, pkg.RepositoryUpdated = "", time.Time{}
+	}
+	deps := slices.Delete(slices.Clone(pkgs), i, i+1)
+	slices.SortFunc(deps, func(a, b *apk.RepositoryPackage) int { return cmp.Compare(a.Name, b.Name) })
+	for _, dep := range deps {
+		pkg.Dependencies = append(pkg.Dependencies, dep.Name)
+	}
+	return bc.APK(), pkgs[i], pkg, deps, nil
+}
+
+// fromBuildRepo reports whether pkg was resolved from one of buildRepos,
+// which, being private to the build, mustn't be reported as its repository.
+func fromBuildRepo(buildRepos []string, pkg *Package) bool {
+	return slices.ContainsFunc(buildRepos, func(r string) bool {
+		return repoURL(r) == repoURL(parentURL(pkg.Repository))
+	})
+}
+
+// choose returns the name of the package to build for name: the first of
+// PreferPackages named or providing it, or else the one apko would pick,
+// skipping BlockPackages and any without a version Version allows.
+func (c *BuildConfig) choose(ctx context.Context, indexes []apk.NamedIndex, name string) (string, error) {
+	resolver := apk.NewPkgResolver(ctx, indexes)
+	providers, err := resolver.ResolvePackage(name, map[*apk.RepositoryPackage]string{})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve package: %w for arch %q", err, c.Arch)
+	}
+
+	var names []string
+	for _, p := range providers {
+		if !slices.Contains(names, p.Name) && !slices.Contains(c.BlockPackages, p.Name) {
+			names = append(names, p.Name)
+		}
+	}
+	// Stable, so packages not preferred keep apko's order.
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cmp.Compare(preference(c.PreferPackages, a), preference(c.PreferPackages, b))
+	})
+	for _, n := range names {
+		if pkgs, err := resolver.ResolvePackage(c.world(n), map[*apk.RepositoryPackage]string{}); err == nil && len(pkgs) > 0 {
+			return n, nil
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("every package providing %q is blocked", name)
+	}
+	return "", fmt.Errorf("no package providing %q has a version matching %q (considered %s)", name, c.Version, strings.Join(names, ", "))
+}
+
+// indexDigest returns a digest of the packages listed in indexes.
+func indexDigest(indexes []apk.NamedIndex) string {
+	h := sha256.New()
+	for _, idx := range indexes {
+		fmt.Fprintf(h, "%s\n", idx.Source())
+		for _, pkg := range idx.Packages() {
+			fmt.Fprintf(h, "%s %s %s\n", pkg.Name, pkg.Version, pkg.ChecksumString())
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// preference returns the rank of name in prefer, after every preferred
+// package if it isn't one.
+func preference(prefer []string, name string) int {
+	if i := slices.Index(prefer, name); i >= 0 {
+		return i
+	}
+	return len(prefer)
+}
+
+// chartRoots returns the cleaned ChartRoots, or DefaultChartRoots, with
+// the top level as "".
+func (c *BuildConfig) chartRoots() []string {
+	roots := c.ChartRoots
+	if len(roots) == 0 {
+		roots = DefaultChartRoots
+	}
+	out := make([]string, 0, len(roots))
+	for _, r := range roots {
+		out = append(out, strings.Trim(path.Clean("/"+r), "/"))
+	}
+	return out
+}
+
+// parentDir returns the directory dir is in within a package, "" for the
+// top level, in the form chartRoots returns.
+func parentDir(dir string) string {
+	return strings.Trim(path.Dir(path.Clean("/"+dir)), "/")
+}
+
+// MissingChartError is returned when a package has no Chart.yaml in a
+// directory under any of the roots charts are searched for in.
+type MissingChartError struct {
+	// Package is the package's name and version.
+	Package string
+	// Roots are the directories searched, "" being the top level.
+	Roots []string
+	// Contents are the package's top-level files, and directories with a
+	// trailing slash, in the order they appear.
+	Contents []string
+	// Nested are the paths of any Chart.yaml files deeper in the package.
+	Nested []string
+}
+
+// maxListed is how many contents and nested charts MissingChartError lists.
+const maxListed = 10
+
+func (e *MissingChartError) Error() string {
+	var b strings.Builder
+	roots := make([]string, 0, len(e.Roots))
+	for _, r := range e.Roots {
+		if r == "" {
+			r = "the top level"
+		}
+		roots = append(roots, r)
+	}
+	fmt.Fprintf(&b, "package %s is missing Chart.yaml: charts must be in a directory of their own under %s, but the package contains %s", e.Package, strings.Join(roots, " or "), truncatedList(e.Contents, "nothing"))
+	if len(e.Nested) > 0 {
+		// Charts are found by searching the directory above theirs.
+		fmt.Fprintf(&b, "; Chart.yaml was found nested at %s, which adding %q to the search roots would find", truncatedList(e.Nested, ""), parentDir(path.Dir(e.Nested[0])))
+	}
+	return b.String()
+}
+
+// truncatedList joins the first maxListed of items, saying how many more
+// there are, or returns none if there are none.
+func truncatedList(items []string, none string) string {
+	if len(items) == 0 {
+		return none
+	}
+	if len(items) <= maxListed {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:maxListed], ", "), len(items)-maxListed)
+}
+
+// fetch fetches the chart APK and parses its metadata, along with the charts
+// of any dependencies matching BundlePattern.
+func (c *BuildConfig) fetch(ctx context.Context, name string, tmp *scratch.Dir) (*chartData, error) {
+	if c.BundlePattern != "" && c.Lockfile != "" {
+		return nil, errors.New("dependencies can't be bundled into charts built from a lockfile")
+	}
+	a, chartPkg, pkg, deps, err := c.resolve(ctx, name, tmp)
+	if err != nil {
+		return nil, err
+	}
+	cd, err := c.read(ctx, a, chartPkg, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.BundlePattern == "" {
+		return cd, nil
+	}
+	for _, dep := range deps {
+		if ok, _ := path.Match(c.BundlePattern, dep.Name); !ok {
+			continue
+		}
+		b, err := c.read(ctx, a, dep, toPackage(dep))
+		if err != nil {
+			return nil, fmt.Errorf("bundling %s: %w", dep.Name, err)
 		}
+		cd.bundled = append(cd.bundled, b)
 	}
+	return cd, nil
+}
 
-	rc, err := bc.APK().FetchPackage(ctx, chartPkg)
+// read downloads chartPkg and parses its chart's metadata.
+func (c *BuildConfig) read(ctx context.Context, a *apk.APK, chartPkg apk.FetchablePackage, pkg *Package) (*chartData, error) {
+	rc, err := a.FetchPackage(ctx, chartPkg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download package: %w", err)
 	}
 	defer rc.Close()
 
-	parts, err := expandapk.Split(rc)
+	var r io.Reader = ctxReader{ctx: ctx, r: rc}
+	var raw bytes.Buffer
+	if c.DebugDir != "" {
+		r = io.TeeReader(r, &raw)
+	}
+	parts, err := expandapk.Split(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to split APK: %w", err)
 	}
 
+	// Locked packages bypass the APKINDEX, so nothing else has checked that
+	// what was downloaded is what the lock pinned.
+	if c.Lockfile != "" {
+		if err := verifyChecksum(parts[len(parts)-2], pkg.Checksum); err != nil {
+			return nil, fmt.Errorf("verifying %s against lockfile: %w", chartPkg.URL(), err)
+		}
+	}
+
 	datar := parts[len(parts)-1]
 
 	var databuf bytes.Buffer
-	if _, err := io.Copy(&databuf, datar); err != nil {
-		return nil, fmt.Errorf("failed to buffer data section: %w", err)
+	if n, err := io.Copy(&databuf, ctxReader{ctx: ctx, r: datar}); err != nil {
+		return nil, fmt.Errorf("failed to buffer data section after %d bytes: %w", n, err)
+	}
+	if c.DebugDir != "" {
+		// Anything after the data section is kept too.
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, fmt.Errorf("failed to read package: %w", err)
+		}
 	}
 
 	gr, err := gzip.NewReader(bytes.NewReader(databuf.Bytes()))
@@ -233,10 +1034,19 @@ func (c *BuildConfig) fetch(ctx context.Context, name string) (*chartData, error
 	}
 	defer gr.Close()
 
-	tr := tar.NewReader(gr)
+	tr := tar.NewReader(ctxReader{ctx: ctx, r: gr})
 
-	var chartName string
-	var mapping *images.Mapping
+	roots := c.chartRoots()
+	// The chart is the directory with a Chart.yaml under the most preferred
+	// root, or the last of several under the same root.
+	var chartDir string
+	rank := len(roots)
+	// The cg.json of each directory, as it may precede its Chart.yaml.
+	metadata := map[string][]byte{}
+	// Every entry, for resolving the chart's links.
+	entries := map[string]*tar.Header{}
+	// What the package holds instead, should it have no chart.
+	missing := &MissingChartError{Package: pkg.Name + "-" + pkg.Version, Roots: roots}
 
 	for {
 		hdr, err := tr.Next()
@@ -247,47 +1057,104 @@ func (c *BuildConfig) fetch(ctx context.Context, name string) (*chartData, error
 			return nil, fmt.Errorf("error reading tar: %w", err)
 		}
 
-		// Find chart name from Chart.yaml
+		entries[packagePath(hdr.Name)] = hdr
+
+		top, _, nested := strings.Cut(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if nested {
+			top += "/"
+		}
+		if top != "" && !slices.Contains(missing.Contents, top) {
+			missing.Contents = append(missing.Contents, top)
+		}
+
+		// Find the chart's directory from Chart.yaml
 		if dir, ok := strings.CutSuffix(hdr.Name, "/Chart.yaml"); ok {
-			if !strings.Contains(dir, "/") {
-				chartName = dir
+			if i := slices.Index(roots, parentDir(dir)); i >= 0 && i <= rank {
+				chartDir, rank = dir, i
+			} else if i < 0 {
+				missing.Nested = append(missing.Nested, hdr.Name)
 			}
 			continue
 		}
 
-		// Parse cg.json if present
-		if chartName != "" && hdr.Name == chartName+"/"+images.ChainguardChartMetadataFilename {
-			mapping, err = images.Parse(tr)
-			if err != nil {
-				return nil, fmt.Errorf("parsing %s: %w", images.ChainguardChartMetadataFilename, err)
+		if dir, ok := strings.CutSuffix(hdr.Name, "/"+images.ChainguardChartMetadataFilename); ok {
+			if metadata[dir], err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
 			}
 		}
 	}
 
-	if chartName == "" {
-		return nil, errors.New("package is missing Chart.yaml")
+	if chartDir == "" {
+		return nil, missing
+	}
+
+	links, err := resolveLinks(ctx, databuf.Bytes(), entries, chartDir)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := links[chartDir+"/"+images.ChainguardChartMetadataFilename]; ok {
+		metadata[chartDir] = l.content
+	}
+
+	// Parse cg.json if present
+	var mapping *images.Mapping
+	if raw, ok := metadata[chartDir]; ok {
+		if mapping, err = images.Parse(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", images.ChainguardChartMetadataFilename, err)
+		}
 	}
 
 	return &chartData{
-		name:    chartName,
+		name:    path.Base(chartDir),
+		dir:     chartDir,
+		pkg:     pkg,
 		mapping: mapping,
 		data:    &databuf,
+		apk:     raw.Bytes(),
+		links:   links,
 	}, nil
 }
 
-func (c *BuildConfig) bc(ctx context.Context, name string) (*build.Context, error) {
+// versionOperators are the APK world constraint operators, longest first so
+// prefixes match greedily.
+var versionOperators = []string{"=~", ">=", "<=", "=", "~", ">", "<"}
+
+// SplitVersionConstraint splits a package version like ">=1.2.3" into its
+// constraint operator and version. The operator is empty for a bare version.
+func SplitVersionConstraint(v string) (op, version string) {
+	for _, o := range versionOperators {
+		if rest, ok := strings.CutPrefix(v, o); ok {
+			return o, rest
+		}
+	}
+	return "", v
+}
+
+// defaultArch defaults Arch to the host architecture.
+func (c *BuildConfig) defaultArch() {
 	if c.Arch == "" {
 		c.Arch = apkotypes.ParseArchitecture(runtime.GOARCH).ToAPK()
 	}
+}
 
-	pkg := name
-	if c.Version != "" {
-		pkg = fmt.Sprintf("%s=%s", name, c.Version)
+// world returns the APK world entry for name, constrained by the configured version.
+func (c *BuildConfig) world(name string) string {
+	if c.Version == "" {
+		return name
 	}
+	op, version := SplitVersionConstraint(c.Version)
+	if op == "" {
+		op = "="
+	}
+	return name + op + version
+}
 
+// bc returns the apko build context resolving name, writing any temporary
+// files to tmp.
+func (c *BuildConfig) bc(ctx context.Context, name string, tmp *scratch.Dir) (*build.Context, error) {
 	ic := apkotypes.ImageConfiguration{
 		Contents: apkotypes.ImageContents{
-			Packages: []string{pkg},
+			Packages: []string{c.world(name)},
 		},
 		Archs: []apkotypes.Architecture{apkotypes.ParseArchitecture(c.Arch)},
 	}
@@ -296,14 +1163,60 @@ func (c *BuildConfig) bc(ctx context.Context, name string) (*build.Context, erro
 		ic.Contents.Keyring = c.Keys
 	}
 
-	if c.RuntimeRepos != nil {
-		ic.Contents.Repositories = c.RuntimeRepos
+	// Local directories of packages without an index get a generated,
+	// unsigned one when signatures aren't verified.
+	arch := apkotypes.ParseArchitecture(c.Arch).ToAPK()
+	runtimeRepos, err := localRepos(ctx, c.RuntimeRepos, arch, c.AllowUnsigned, tmp)
+	if err != nil {
+		return nil, err
+	}
+	buildRepos, err := localRepos(ctx, c.BuildRepos, arch, c.AllowUnsigned, tmp)
+	if err != nil {
+		return nil, err
 	}
+	ic.Contents.Repositories = runtimeRepos
+	ic.Contents.BuildRepositories = buildRepos
 
 	opts := []build.Option{
 		build.WithArch(apkotypes.ParseArchitecture(c.Arch)),
 		build.WithImageConfiguration(ic),
+		build.WithIgnoreSignatures(c.AllowUnsigned),
+	}
+
+	if c.Cache != nil {
+		opts = append(opts, build.WithCache("", false, c.Cache))
 	}
 
-	return build.New(ctx, tarfs.New(), opts...)
+	fsys := tarfs.New()
+	bc, err := build.New(ctx, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c.OnlyConfiguredKeys {
+		if err := removeUnconfiguredKeys(fsys, ic.Contents.Keyring); err != nil {
+			return nil, err
+		}
+	}
+	return bc, nil
+}
+
+// keysDir is where apko keeps the keys repository indexes are verified with.
+const keysDir = "etc/apk/keys"
+
+// removeUnconfiguredKeys removes the keys in fsys's keyring that aren't
+// among keys, which apko installs under their base names.
+func removeUnconfiguredKeys(fsys apkfs.FullFS, keys []string) error {
+	entries, err := fsys.ReadDir(keysDir)
+	if err != nil {
+		return fmt.Errorf("reading keyring: %w", err)
+	}
+	for _, e := range entries {
+		if slices.ContainsFunc(keys, func(k string) bool { return filepath.Base(k) == e.Name() }) {
+			continue
+		}
+		if err := fsys.Remove(filepath.Join(keysDir, e.Name())); err != nil {
+			return fmt.Errorf("removing discovered key %s: %w", e.Name(), err)
+		}
+	}
+	return nil
 }
@@ -1,6 +1,12 @@
 package chart
 
-import "testing"
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"chainguard.dev/apko/pkg/tarfs"
+)
 
 func TestPatchedWith(t *testing.T) {
 	patch := `
@@ -69,3 +75,99 @@ image:
 		})
 	}
 }
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "short", n: 10, want: "short"},
+		{s: "exact", n: 5, want: "exact"},
+		{s: "longer", n: 4, want: "long"},
+		// "é" is two bytes, so cutting in its middle drops it.
+		{s: "café", n: 4, want: "caf"},
+		{s: "café", n: 5, want: "café"},
+	} {
+		if got := truncate(tc.s, tc.n); got != tc.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestTruncatedList(t *testing.T) {
+	many := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	for _, tc := range []struct {
+		items []string
+		want  string
+	}{
+		{items: nil, want: "nothing"},
+		{items: []string{"usr/", "etc/"}, want: "usr/, etc/"},
+		{items: many[:maxListed], want: "a, b, c, d, e, f, g, h, i, j"},
+		{items: many, want: "a, b, c, d, e, f, g, h, i, j and 2 more"},
+	} {
+		if got := truncatedList(tc.items, "nothing"); got != tc.want {
+			t.Errorf("truncatedList(%q) = %q, want %q", tc.items, got, tc.want)
+		}
+	}
+}
+
+func TestRemoveUnconfiguredKeys(t *testing.T) {
+	fsys := tarfs.New()
+	if err := fsys.MkdirAll(keysDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Discovered keys are named for their IDs, configured ones for their
+	// base names.
+	for _, name := range []string{"wolfi-signing.rsa.pub", "chainguard-123.rsa.pub", "mine.rsa.pub"} {
+		if err := fsys.WriteFile(filepath.Join(keysDir, name), []byte("key"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeUnconfiguredKeys(fsys, []string{"/keys/mine.rsa.pub"}); err != nil {
+		t.Fatalf("removeUnconfiguredKeys: %v", err)
+	}
+	entries, err := fsys.ReadDir(keysDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if want := []string{"mine.rsa.pub"}; !slices.Equal(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestArchiveRel(t *testing.T) {
+	for _, tc := range []struct {
+		dir, name, want string
+	}{
+		{dir: "usr/share/chart", name: "usr/share/chart/", want: "."},
+		{dir: "usr/share/chart", name: "usr/share/chart/Chart.yaml", want: "Chart.yaml"},
+		{dir: "usr/share/chart", name: "usr/share/chart/templates/", want: "templates"},
+		{dir: "usr/share/chart", name: "usr/share/chart/templates//deployment.yaml", want: "templates/deployment.yaml"},
+	} {
+		if got := archiveRel(tc.dir, tc.name); got != tc.want {
+			t.Errorf("archiveRel(%q, %q) = %q, want %q", tc.dir, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	for _, tc := range []struct {
+		repo, want string
+	}{
+		{repo: "/srv/packages", want: "/srv/packages"},
+		{repo: "file:///srv/packages", want: "/srv/packages"},
+		{repo: "file:///C:/packages", want: "C:/packages"},
+		{repo: "C:/packages", want: "C:/packages"},
+		{repo: "packages/*.apk", want: "packages/*.apk"},
+	} {
+		if got, want := localPath(tc.repo), filepath.FromSlash(tc.want); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", tc.repo, got, want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package chart
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"maps"
+	"path"
+	"slices"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
@@ -14,6 +18,128 @@ import (
 	helmregistry "helm.sh/helm/v3/pkg/registry"
 )
 
+// DeprecatedAnnotation is set to "true" on the manifests of deprecated
+// charts. It is the annotation Artifact Hub reads to flag OCI packages as
+// deprecated.
+const DeprecatedAnnotation = "io.artifacthub.package.deprecated"
+
+// SourceAnnotation is the manifest annotation a chart's sources are carried
+// into. Registries like GHCR use it to link the chart to its repository.
+const SourceAnnotation = "org.opencontainers.image.source"
+
+// CreatedAnnotation is the manifest annotation recording when a chart was
+// built, per BuildConfig.Created.
+const CreatedAnnotation = "org.opencontainers.image.created"
+
+// When BuildConfig.Created says the chart was built. Any other value is an
+// RFC 3339 timestamp.
+const (
+	// CreatedBuildTime is the time the chart is built.
+	CreatedBuildTime = "build"
+	// CreatedSourceDateEpoch is the time in $SOURCE_DATE_EPOCH, for
+	// reproducible builds.
+	CreatedSourceDateEpoch = "source_date_epoch"
+)
+
+// How BuildConfig.SourceAnnotation carries the chart's sources into
+// SourceAnnotation. Any other value is used as the annotation as is.
+const (
+	// SourcesJoin joins all the chart's sources with commas.
+	SourcesJoin = "join"
+	// SourcesFirst uses only the first, since GHCR only links a single
+	// repository URL.
+	SourcesFirst = "first"
+)
+
+// sourceAnnotation returns the SourceAnnotation value for sources, per
+// format. Empty sources are skipped, and it is empty if there are none.
+func sourceAnnotation(sources []string, format string) string {
+	sources = slices.DeleteFunc(slices.Clone(sources), func(s string) bool { return strings.TrimSpace(s) == "" })
+	switch format {
+	case "", SourcesJoin:
+		return strings.Join(sources, ",")
+	case SourcesFirst:
+		if len(sources) == 0 {
+			return ""
+		}
+		return sources[0]
+	default:
+		return format
+	}
+}
+
+// ManifestFormat is the kind of manifest a chart is published with.
+type ManifestFormat string
+
+const (
+	// ManifestOCI publishes an OCI image manifest, as Helm does.
+	ManifestOCI ManifestFormat = "oci"
+	// ManifestDocker publishes a Docker v2 schema 2 manifest with the same
+	// config and layer, for older registries, like some Nexus versions, that
+	// reject OCI manifests.
+	ManifestDocker ManifestFormat = "docker"
+)
+
+// ManifestFormats lists the supported manifest formats.
+var ManifestFormats = []ManifestFormat{ManifestOCI, ManifestDocker}
+
+// mediaType returns the manifest media type for f, OCI if unset.
+func (f ManifestFormat) mediaType() ggcrtypes.MediaType {
+	if f == ManifestDocker {
+		return ggcrtypes.DockerManifestSchema2
+	}
+	return ggcrtypes.OCIManifestSchema1
+}
+
+// Layer is a blob published in a chart's manifest after its content, for
+// consumers that expect metadata packaged with the chart, like airgap bundle
+// manifests. Helm ignores layers of media types it doesn't know.
+type Layer struct {
+	MediaType string
+	Content   []byte
+	// Title, if set, is the layer's org.opencontainers.image.title
+	// annotation, the file name tools like oras pull it to.
+	Title string
+}
+
+// titledLayer is a layer whose descriptor carries a title annotation.
+type titledLayer struct {
+	v1.Layer
+	title string
+}
+
+func (l titledLayer) Descriptor() (*v1.Descriptor, error) {
+	d, err := partial.Descriptor(l.Layer)
+	if err != nil {
+		return nil, err
+	}
+	d.Annotations = map[string]string{"org.opencontainers.image.title": l.title}
+	return d, nil
+}
+
+// extraLayers returns the v1 layers of layers, refusing the media types Helm
+// reads charts from and those the chart's own config and content have.
+func extraLayers(layers []Layer, reserved ...ggcrtypes.MediaType) ([]v1.Layer, error) {
+	out := make([]v1.Layer, 0, len(layers))
+	for _, l := range layers {
+		switch l.MediaType {
+		case "":
+			return nil, fmt.Errorf("extra layer has no media type")
+		case helmregistry.ConfigMediaType, helmregistry.ChartLayerMediaType, helmregistry.LegacyChartLayerMediaType, helmregistry.ProvLayerMediaType:
+			return nil, fmt.Errorf("extra layer can't have media type %s, which Helm reads charts from", l.MediaType)
+		}
+		if slices.Contains(reserved, ggcrtypes.MediaType(l.MediaType)) {
+			return nil, fmt.Errorf("extra layer can't have media type %s, which the chart is published with", l.MediaType)
+		}
+		var layer v1.Layer = static.NewLayer(l.Content, ggcrtypes.MediaType(l.MediaType))
+		if l.Title != "" {
+			layer = titledLayer{Layer: layer, title: l.Title}
+		}
+		out = append(out, layer)
+	}
+	return out, nil
+}
+
 // Chart defines a compatbile Helm OCI artifact.
 type Chart interface {
 	v1.Image
@@ -23,9 +149,100 @@ type Chart interface {
 type chart struct {
 	metadata *helmchart.Metadata
 	content  v1.Layer
+	// extra are layers published after content.
+	extra  []v1.Layer
+	format ManifestFormat
+	// configType is the config blob's media type, Helm's if unset.
+	configType ggcrtypes.MediaType
+	// source is how the chart's sources are carried into SourceAnnotation.
+	source string
+	// created is the CreatedAnnotation value, if any.
+	created string
+	// copyAnnotations are the patterns of the Chart.yaml annotations copied
+	// to the manifest, or nil to copy them all.
+	copyAnnotations []string
+	// maxAnnotationSize, if set, is the length in bytes annotation values
+	// are truncated to.
+	maxAnnotationSize int
 
 	diffIDs   map[v1.Hash]v1.Layer
 	digestIDs map[v1.Hash]v1.Layer
+
+	// memo is computed from the fields above on first use, as pushing a
+	// chart, let alone a catalog of them, asks for its config, manifest and
+	// digest many times over.
+	memo struct {
+		once        sync.Once
+		config      v1.Layer
+		rawConfig   []byte
+		manifest    *v1.Manifest
+		rawManifest []byte
+		digest      v1.Hash
+		err         error
+	}
+}
+
+// memoized computes c.memo, once.
+func (c *chart) memoized() error {
+	c.memo.once.Do(func() {
+		c.memo.err = c.compute()
+	})
+	return c.memo.err
+}
+
+// compute marshals and hashes c's config and manifest into c.memo.
+func (c *chart) compute() error {
+	rawConfig, err := json.Marshal(c.metadata)
+	if err != nil {
+		return err
+	}
+	configType := c.configType
+	if configType == "" {
+		configType = helmregistry.ConfigMediaType
+	}
+	config := static.NewLayer(rawConfig, configType)
+	cfgDesc, err := partial.Descriptor(config)
+	if err != nil {
+		return err
+	}
+
+	contentDesc, err := partial.Descriptor(c.content)
+	if err != nil {
+		return err
+	}
+
+	m := &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     c.format.mediaType(),
+		Config:        *cfgDesc,
+		Layers:        []v1.Descriptor{*contentDesc},
+		Annotations:   c.annotations(),
+	}
+	for _, l := range c.extra {
+		desc, err := partial.Descriptor(l)
+		if err != nil {
+			return err
+		}
+		m.Layers = append(m.Layers, *desc)
+	}
+	if c.maxAnnotationSize > 0 {
+		for k, v := range m.Annotations {
+			m.Annotations[k] = truncate(v, c.maxAnnotationSize)
+		}
+	}
+
+	rawManifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(rawManifest))
+	if err != nil {
+		return err
+	}
+
+	c.memo.config, c.memo.rawConfig = config, rawConfig
+	c.memo.manifest, c.memo.rawManifest, c.memo.digest = m, rawManifest, digest
+	return nil
 }
 
 func (c *chart) ConfigFile() (*v1.ConfigFile, error) {
@@ -33,11 +250,26 @@ func (c *chart) ConfigFile() (*v1.ConfigFile, error) {
 }
 
 func (c *chart) ConfigName() (v1.Hash, error) {
-	return partial.ConfigName(c)
+	if err := c.memoized(); err != nil {
+		return v1.Hash{}, err
+	}
+	return c.memo.config.Digest()
+}
+
+// ConfigLayer returns the config blob as a layer, so it is pushed without
+// being hashed again.
+func (c *chart) ConfigLayer() (v1.Layer, error) {
+	if err := c.memoized(); err != nil {
+		return nil, err
+	}
+	return c.memo.config, nil
 }
 
 func (c *chart) Digest() (v1.Hash, error) {
-	return partial.Digest(c)
+	if err := c.memoized(); err != nil {
+		return v1.Hash{}, err
+	}
+	return c.memo.digest, nil
 }
 
 // TODO: This isn't actually implemented, but I don't think it needs to be?
@@ -57,65 +289,113 @@ func (c *chart) LayerByDigest(hash v1.Hash) (v1.Layer, error) {
 }
 
 func (c *chart) Layers() ([]v1.Layer, error) {
-	return []v1.Layer{c.content}, nil
+	return append([]v1.Layer{c.content}, c.extra...), nil
 }
 
 func (c *chart) MediaType() (ggcrtypes.MediaType, error) {
-	return ggcrtypes.OCIManifestSchema1, nil
+	return c.format.mediaType(), nil
 }
 
 func (c *chart) RawManifest() ([]byte, error) {
-	return partial.RawManifest(c)
+	if err := c.memoized(); err != nil {
+		return nil, err
+	}
+	return c.memo.rawManifest, nil
 }
 
 func (c *chart) Size() (int64, error) {
 	return partial.Size(c)
 }
 
+// Manifest returns a copy of c's manifest, which callers may change.
 func (c *chart) Manifest() (*v1.Manifest, error) {
-	cfgDesc, err := partial.Descriptor(c.config())
-	if err != nil {
+	if err := c.memoized(); err != nil {
 		return nil, err
 	}
+	return c.memo.manifest.DeepCopy(), nil
+}
 
-	contentDesc, err := partial.Descriptor(c.content)
-	if err != nil {
-		return nil, err
+// annotations returns the annotations of c's manifest, before they are
+// truncated to maxAnnotationSize.
+func (c *chart) annotations() map[string]string {
+	annotations := map[string]string{
+		"org.opencontainers.image.title":       c.metadata.Name,
+		"org.opencontainers.image.version":     c.metadata.Version,
+		"org.opencontainers.image.description": c.metadata.Description,
+	}
+	if src := sourceAnnotation(c.metadata.Sources, c.source); src != "" {
+		annotations[SourceAnnotation] = src
+	}
+	if c.created != "" {
+		annotations[CreatedAnnotation] = c.created
+	}
+	if c.metadata.Deprecated {
+		annotations[DeprecatedAnnotation] = "true"
 	}
 
-	m := &v1.Manifest{
-		SchemaVersion: 2,
-		MediaType:     ggcrtypes.OCIManifestSchema1,
-		Config:        *cfgDesc,
-		Layers:        []v1.Descriptor{*contentDesc},
-		Annotations: map[string]string{
-			"org.opencontainers.image.title":       c.metadata.Name,
-			"org.opencontainers.image.version":     c.metadata.Version,
-			"org.opencontainers.image.description": c.metadata.Description,
-		},
+	for k, v := range c.metadata.Annotations {
+		if c.copiesAnnotation(k) {
+			annotations[k] = v
+		}
 	}
+	return annotations
+}
 
-	if len(c.metadata.Sources) > 0 {
-		m.Annotations["org.opencontainers.image.source"] = strings.Join(c.metadata.Sources, ",")
+// OversizedAnnotations returns the keys, sorted, of the annotations on c's
+// manifest with values longer than limit bytes. For charts built with
+// BuildConfig.MaxAnnotationSize, they are the annotations it truncated.
+func OversizedAnnotations(c Chart, limit int) ([]string, error) {
+	var annotations map[string]string
+	if bc, ok := c.(*builtChart); ok {
+		annotations = bc.annotations()
+	} else {
+		m, err := c.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		annotations = m.Annotations
 	}
 
-	maps.Copy(m.Annotations, c.metadata.Annotations)
+	var keys []string
+	for k, v := range annotations {
+		if len(v) > limit {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
 
-	return m, nil
+// truncate cuts s to at most n bytes, without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// copiesAnnotation reports whether the Chart.yaml annotation key is copied
+// to the manifest.
+func (c *chart) copiesAnnotation(key string) bool {
+	if c.copyAnnotations == nil {
+		return true
+	}
+	return slices.ContainsFunc(c.copyAnnotations, func(pattern string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	})
 }
 
 func (c *chart) RawConfigFile() ([]byte, error) {
-	return json.Marshal(c.metadata)
+	if err := c.memoized(); err != nil {
+		return nil, err
+	}
+	return c.memo.rawConfig, nil
 }
 
 func (c *chart) Metadata() (*helmchart.Metadata, error) {
 	return c.metadata, nil
 }
-
-func (c *chart) config() v1.Layer {
-	raw, err := json.Marshal(c.metadata)
-	if err != nil {
-		raw = []byte("{}")
-	}
-	return static.NewLayer(raw, helmregistry.ConfigMediaType)
-}
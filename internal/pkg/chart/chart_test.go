@@ -1,16 +1,54 @@
 package chart_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math/big"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"chainguard.dev/apko/pkg/lock"
 	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
-	"github.com/chainguard-dev/terraform-provider-helm/internal/testutil"
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	helmregistry "helm.sh/helm/v3/pkg/registry"
+	"sigs.k8s.io/yaml"
 )
 
 func TestBuild(t *testing.T) {
@@ -137,7 +175,7 @@ func TestBuild(t *testing.T) {
 				ociref := fmt.Sprintf("oci://%s/%s:%s", registryAddr, chartName, chartVersion)
 
 				// Pull and template the chart using shared test utility
-				helmChart, rel, err := testutil.TestPullAndTemplateChart(ociref, chartName, false)
+				helmChart, rel, err := testkit.TestPullAndTemplateChart(t, ociref, chartName, false)
 				if err != nil {
 					t.Fatalf("Failed to pull and template chart: %v", err)
 				}
@@ -165,6 +203,121 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestBuildLeavesNoTempFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	c, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	if _, err := c.Digest(); err != nil {
+		t.Fatalf("failed to read chart: %v", err)
+	}
+	// The built layer is kept until the chart is closed.
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close chart: %v", err)
+	}
+	// A failed build must not leave anything behind either.
+	if _, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:       []string{"testdata/packages"},
+		Keys:               []string{"testdata/packages/melange.rsa.pub"},
+		JSONRFC6902Patches: map[string][]byte{"values.yaml": []byte("not a patch")},
+	}); err == nil {
+		t.Fatal("expected build with an invalid patch to fail")
+	}
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("failed to read temp dir: %v", err)
+	}
+	for _, e := range entries {
+		t.Errorf("build left %s in the temp dir", e.Name())
+	}
+}
+
+func TestBuildCanceled(t *testing.T) {
+	config := &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := chart.Build(ctx, "chart-basic", config); !errors.Is(err, context.Canceled) {
+		t.Errorf("Build() with canceled context = %v, want %v", err, context.Canceled)
+	}
+
+	// The built layer is only kept as long as the build's context, so it
+	// can't be pushed once the operation is canceled.
+	ctx, cancel = context.WithCancel(t.Context())
+	artifact, err := chart.Build(ctx, "chart-basic", config)
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get chart layers: %v", err)
+	}
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		rc, err := layers[0].Compressed()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("opening layer after cancel = %v, want %v", err, fs.ErrNotExist)
+			}
+			break
+		}
+		rc.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("layer still readable after cancel")
+		}
+	}
+}
+
+func TestBuildLayerPrecompressed(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get chart layers: %v", err)
+	}
+	l := layers[0]
+
+	digest, err := l.Digest()
+	if err != nil {
+		t.Fatalf("failed to get layer digest: %v", err)
+	}
+	size, err := l.Size()
+	if err != nil {
+		t.Fatalf("failed to get layer size: %v", err)
+	}
+
+	// The bytes pushed must be exactly those the digest was computed from.
+	for range 2 {
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatalf("failed to open compressed layer: %v", err)
+		}
+		got, n, err := v1.SHA256(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to hash compressed layer: %v", err)
+		}
+		if got != digest || n != size {
+			t.Errorf("compressed layer = %s (%d bytes), want %s (%d bytes)", got, n, digest, size)
+		}
+	}
+}
+
 // testdata ships chart-versioned at both 0.0.1-r0 and 0.0.2-r0 specifically so
 // this test can pin to the older one and prove BuildConfig.Version isn't ignored.
 func TestBuildVersionPin(t *testing.T) {
@@ -176,6 +329,9 @@ func TestBuildVersionPin(t *testing.T) {
 		{name: "pin to older version", version: "0.0.1-r0", wantChartVersion: "0.0.1"},
 		{name: "pin to newer version", version: "0.0.2-r0", wantChartVersion: "0.0.2"},
 		{name: "no pin resolves to latest", version: "", wantChartVersion: "0.0.2"},
+		{name: "tilde constraint", version: "~0.0.1", wantChartVersion: "0.0.1"},
+		{name: "less than constraint", version: "<0.0.2", wantChartVersion: "0.0.1"},
+		{name: "greater or equal constraint", version: ">=0.0.1-r0", wantChartVersion: "0.0.2"},
 	}
 
 	for _, tc := range tests {
@@ -201,3 +357,2910 @@ func TestBuildVersionPin(t *testing.T) {
 		})
 	}
 }
+
+func TestPull(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	registryAddr := strings.TrimPrefix(s.URL, "http://")
+
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	digest, err := artifact.Digest()
+	if err != nil {
+		t.Fatalf("failed to get chart digest: %v", err)
+	}
+
+	ref, err := name.ParseReference(fmt.Sprintf("%s/basic@%s", registryAddr, digest))
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+	if err := remote.Write(ref, artifact); err != nil {
+		t.Fatalf("failed to push chart to registry: %v", err)
+	}
+
+	pulled, err := chart.Pull(ref)
+	if err != nil {
+		t.Fatalf("failed to pull chart: %v", err)
+	}
+
+	pulledDigest, err := pulled.Digest()
+	if err != nil {
+		t.Fatalf("failed to get pulled chart digest: %v", err)
+	}
+	if pulledDigest != digest {
+		t.Errorf("pulled digest = %s, want %s", pulledDigest, digest)
+	}
+
+	md, err := pulled.Metadata()
+	if err != nil {
+		t.Fatalf("failed to get pulled chart metadata: %v", err)
+	}
+	if md.Name != "basic" || md.Version != "0.0.1" {
+		t.Errorf("pulled metadata = %s@%s, want basic@0.0.1", md.Name, md.Version)
+	}
+	if md.Annotations["thisshould"] != "bepreserved" {
+		t.Errorf("pulled metadata annotation = %q, want bepreserved", md.Annotations["thisshould"])
+	}
+}
+
+func TestPullSHA512(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	raw, err := artifact.RawManifest()
+	if err != nil {
+		t.Fatalf("failed to get chart manifest: %v", err)
+	}
+	digest, err := chart.ManifestDigest(raw, chart.SHA512)
+	if err != nil {
+		t.Fatalf("failed to digest chart manifest: %v", err)
+	}
+
+	repo := strings.TrimPrefix(s.URL, "http://") + "/basic"
+	ref, err := chart.ParseDigest(repo + "@" + digest)
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+	if got := ref.Identifier(); got != digest {
+		t.Errorf("identifier = %s, want %s", got, digest)
+	}
+	if err := remote.Write(ref, artifact); err != nil {
+		t.Fatalf("failed to push chart to registry: %v", err)
+	}
+	if _, err := chart.Pull(ref); err != nil {
+		t.Fatalf("failed to pull chart: %v", err)
+	}
+	want, err := artifact.Digest()
+	if err != nil {
+		t.Fatalf("failed to get chart digest: %v", err)
+	}
+	if d, err := chart.SHA256Digest(ref); err != nil || d.DigestStr() != want.String() {
+		t.Errorf("SHA256Digest = %v, %v, want %s", d, err, want)
+	}
+
+	// The registry serves whatever was pushed under a digest, so Pull checks
+	// it matches.
+	other := "sha512:" + strings.Repeat("0", 128)
+	wrong, err := chart.ParseDigest(repo + "@" + other)
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+	if err := remote.Put(wrong, artifact); err != nil {
+		t.Fatalf("failed to push chart to registry: %v", err)
+	}
+	if _, err := chart.Pull(wrong); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("pulling by the wrong digest: got error %v, want a digest mismatch", err)
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	for _, tc := range []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "example.com/charts/foo@sha256:" + strings.Repeat("a", 64)},
+		{ref: "example.com/charts/foo@sha512:" + strings.Repeat("a", 128)},
+		{ref: "example.com/charts/foo:1.2.3@sha512:" + strings.Repeat("a", 128)},
+		{ref: "example.com/charts/foo@sha512:" + strings.Repeat("a", 64), wantErr: true},
+		{ref: "example.com/charts/foo@sha512:" + strings.Repeat("A", 128), wantErr: true},
+		{ref: "example.com/charts/foo@sha384:" + strings.Repeat("a", 96), wantErr: true},
+		{ref: "example.com/charts/foo:1.2.3", wantErr: true},
+		{ref: "Example/foo@sha512:" + strings.Repeat("a", 128), wantErr: true},
+	} {
+		ref, err := chart.ParseDigest(tc.ref)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseDigest(%q) = %v, wantErr %v", tc.ref, err, tc.wantErr)
+			continue
+		}
+		if err == nil && ref.Context().String() != "example.com/charts/foo" {
+			t.Errorf("ParseDigest(%q) repository = %s, want example.com/charts/foo", tc.ref, ref.Context())
+		}
+	}
+}
+
+func TestMountFrom(t *testing.T) {
+	var mu sync.Mutex
+	var mounts []string
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The in-memory registry shares blobs between repos, so hide them
+		// from dst to make the pusher upload or mount them.
+		if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/dst/blobs/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if m := r.URL.Query().Get("mount"); r.Method == http.MethodPost && m != "" {
+			mu.Lock()
+			mounts = append(mounts, r.URL.Query().Get("from")+"@"+m)
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	registryAddr := strings.TrimPrefix(s.URL, "http://")
+
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	src, err := name.NewRepository(registryAddr + "/src")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	dst, err := name.NewRepository(registryAddr + "/dst")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	digest, err := artifact.Digest()
+	if err != nil {
+		t.Fatalf("failed to get chart digest: %v", err)
+	}
+	if err := remote.Write(src.Digest(digest.String()), artifact); err != nil {
+		t.Fatalf("failed to push chart to registry: %v", err)
+	}
+	if len(mounts) != 0 {
+		t.Fatalf("plain push requested mounts: %v", mounts)
+	}
+
+	mounted := chart.MountFrom(artifact, src)
+	mountedDigest, err := mounted.Digest()
+	if err != nil {
+		t.Fatalf("failed to get mounted chart digest: %v", err)
+	}
+	if mountedDigest != digest {
+		t.Fatalf("mounted digest = %s, want %s", mountedDigest, digest)
+	}
+	if err := remote.Write(dst.Digest(digest.String()), mounted); err != nil {
+		t.Fatalf("failed to push mounted chart to registry: %v", err)
+	}
+
+	m, err := artifact.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get chart manifest: %v", err)
+	}
+	want := []string{"src@" + m.Config.Digest.String()}
+	for _, l := range m.Layers {
+		want = append(want, "src@"+l.Digest.String())
+	}
+	slices.Sort(mounts)
+	slices.Sort(want)
+	if !slices.Equal(mounts, want) {
+		t.Errorf("mounts = %v, want %v", mounts, want)
+	}
+
+	if _, err := chart.Pull(dst.Digest(digest.String())); err != nil {
+		t.Errorf("failed to pull mounted chart: %v", err)
+	}
+}
+
+func TestBuildRevisionFormat(t *testing.T) {
+	tests := []struct {
+		format           chart.RevisionFormat
+		wantChartVersion string
+	}{
+		{format: chart.RevisionNone, wantChartVersion: "0.0.1"},
+		{format: chart.RevisionMetadata, wantChartVersion: "0.0.1+r0"},
+		{format: chart.RevisionSuffix, wantChartVersion: "0.0.1-r0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.format), func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-versioned", &chart.BuildConfig{
+				RuntimeRepos:   []string{"testdata/packages"},
+				Keys:           []string{"testdata/packages/melange.rsa.pub"},
+				Arch:           "x86_64",
+				Version:        "0.0.1-r0",
+				RevisionFormat: tc.format,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+
+			md, err := artifact.Metadata()
+			if err != nil {
+				t.Fatalf("failed to get chart metadata: %v", err)
+			}
+			if md.Version != tc.wantChartVersion {
+				t.Errorf("metadata version = %q, want %q", md.Version, tc.wantChartVersion)
+			}
+
+			// The Chart.yaml inside the chart must agree with the config blob,
+			// since Helm reads the version from the former after pulling.
+			layers, err := artifact.Layers()
+			if err != nil {
+				t.Fatalf("failed to get layers: %v", err)
+			}
+			rc, err := layers[0].Uncompressed()
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			defer rc.Close()
+
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					t.Fatal("Chart.yaml not found in chart layer")
+				}
+				if err != nil {
+					t.Fatalf("failed to read layer: %v", err)
+				}
+				if hdr.Name != "versioned/Chart.yaml" {
+					continue
+				}
+
+				var layerMD helmchart.Metadata
+				raw, err := io.ReadAll(tr)
+				if err != nil {
+					t.Fatalf("failed to read Chart.yaml: %v", err)
+				}
+				if err := yaml.Unmarshal(raw, &layerMD); err != nil {
+					t.Fatalf("failed to parse Chart.yaml: %v", err)
+				}
+				if layerMD.Version != tc.wantChartVersion {
+					t.Errorf("Chart.yaml version = %q, want %q", layerMD.Version, tc.wantChartVersion)
+				}
+				return
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "", want: "0.0.2-r0"},
+		{version: "0.0.1-r0", want: "0.0.1-r0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.version, func(t *testing.T) {
+			pkg, err := chart.Resolve(t.Context(), "chart-versioned", &chart.BuildConfig{
+				RuntimeRepos: []string{"testdata/packages"},
+				Keys:         []string{"testdata/packages/melange.rsa.pub"},
+				Arch:         "x86_64",
+				Version:      tc.version,
+			})
+			if err != nil {
+				t.Fatalf("failed to resolve package: %v", err)
+			}
+			if pkg.Name != "chart-versioned" || pkg.Version != tc.want {
+				t.Errorf("resolved %s-%s, want chart-versioned-%s", pkg.Name, pkg.Version, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveBuildRepos(t *testing.T) {
+	pkg, err := chart.Resolve(t.Context(), "chart-versioned", &chart.BuildConfig{
+		BuildRepos: []string{"testdata/packages"},
+		Keys:       []string{"testdata/packages/melange.rsa.pub"},
+		Arch:       "x86_64",
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve package from build repositories: %v", err)
+	}
+	if pkg.Version != "0.0.2-r0" {
+		t.Errorf("resolved chart-versioned-%s, want chart-versioned-0.0.2-r0", pkg.Version)
+	}
+	// Build repositories aren't to be recorded anywhere.
+	if pkg.Repository != "" || !pkg.RepositoryUpdated.IsZero() {
+		t.Errorf("package repository = %q, updated %v, want neither", pkg.Repository, pkg.RepositoryUpdated)
+	}
+}
+
+func TestResolveRepository(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+
+	var repos []*testkit.Repository
+	for _, pkgs := range [][]testkit.ChartPackage{
+		{{Name: "chart-basic", Version: "0.0.1-r0", BuildTime: older}},
+		// Shadows the first repository's chart-basic with a newer version.
+		{{Name: "chart-basic", Version: "0.0.2-r0", BuildTime: older}, {Name: "chart-other", Version: "0.0.1-r0", BuildTime: newer}},
+	} {
+		repo, err := testkit.NewRepository(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range pkgs {
+			p.Chart = os.DirFS("../../../testdata/charts/basic")
+			if err := repo.AddChart(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatal(err)
+		}
+		repos = append(repos, repo)
+	}
+
+	// Every testkit key has the same name, so only one could be trusted.
+	pkg, err := chart.Resolve(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:  []string{repos[0].Path(), repos[1].Path()},
+		Arch:          testkit.DefaultArch,
+		AllowUnsigned: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve package: %v", err)
+	}
+	if want := repos[1].Path() + "/" + testkit.DefaultArch; pkg.Repository != want {
+		t.Errorf("Repository = %q, want %q", pkg.Repository, want)
+	}
+	// The newest package in the index, not the one resolved.
+	if !pkg.RepositoryUpdated.Equal(newer) {
+		t.Errorf("RepositoryUpdated = %v, want %v", pkg.RepositoryUpdated, newer)
+	}
+}
+
+func TestBuildMissingChart(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{Name: "chart-nested", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Dir: "usr/share/charts/basic"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = chart.Build(t.Context(), "chart-nested", &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+	})
+	var missing *chart.MissingChartError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Build() = %v, want a MissingChartError", err)
+	}
+	if want := []string{"usr/"}; !slices.Equal(missing.Contents, want) {
+		t.Errorf("Contents = %q, want %q", missing.Contents, want)
+	}
+	if want := []string{"usr/share/charts/basic/Chart.yaml"}; !slices.Equal(missing.Nested, want) {
+		t.Errorf("Nested = %q, want %q", missing.Nested, want)
+	}
+	if !strings.Contains(err.Error(), "chart-nested-0.0.1-r0") || !strings.Contains(err.Error(), "usr/share/charts/basic/Chart.yaml") {
+		t.Errorf("error doesn't name the package and nested chart: %v", err)
+	}
+	if !strings.Contains(err.Error(), `"usr/share/charts"`) {
+		t.Errorf("error doesn't suggest the root that would find the chart: %v", err)
+	}
+}
+
+func TestBuildChartRoots(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-shared", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Dir: "usr/share/helm/charts/basic"},
+		{Name: "chart-custom", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Dir: "opt/charts/basic"},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		pkg   string
+		roots []string
+	}{
+		{pkg: "chart-shared"},
+		{pkg: "chart-custom", roots: []string{"/opt/charts/"}},
+	} {
+		t.Run(tc.pkg, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), tc.pkg, &chart.BuildConfig{
+				RuntimeRepos: []string{repo.Path()},
+				Keys:         []string{repo.KeyPath()},
+				Arch:         testkit.DefaultArch,
+				ChartRoots:   tc.roots,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			layers, err := artifact.Layers()
+			if err != nil {
+				t.Fatalf("failed to get layers: %v", err)
+			}
+			rc, err := layers[0].Uncompressed()
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			defer rc.Close()
+
+			// The chart is rooted at its own directory, wherever the
+			// package put it.
+			var found bool
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to read layer: %v", err)
+				}
+				if !strings.HasPrefix(hdr.Name, "basic/") {
+					t.Errorf("chart has %s, want it under basic/", hdr.Name)
+				}
+				found = found || hdr.Name == "basic/Chart.yaml"
+			}
+			if !found {
+				t.Error("basic/Chart.yaml not found in chart layer")
+			}
+		})
+	}
+
+	// Roots replace the defaults rather than add to them.
+	_, err = chart.Build(t.Context(), "chart-shared", &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+		ChartRoots:   []string{"opt/charts"},
+	})
+	var missing *chart.MissingChartError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Build() = %v, want a MissingChartError", err)
+	}
+}
+
+func TestBuildLinks(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartYAML, err := os.ReadFile("../../../testdata/charts/basic/Chart.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []byte("replicas: 3\n")
+	for _, p := range []testkit.ChartPackage{{
+		Name:      "chart-linked",
+		Version:   "0.0.1-r0",
+		Chart:     fstest.MapFS{"Chart.yaml": {Data: chartYAML}, "values/default.yaml": {Data: values}},
+		Symlinks:  map[string]string{"values.yaml": "values/default.yaml", "templates/values.yaml": "../values.yaml"},
+		Hardlinks: map[string]string{"values-copy.yaml": "values/default.yaml"},
+	}, {
+		Name:     "chart-dangling",
+		Version:  "0.0.1-r0",
+		Chart:    fstest.MapFS{"Chart.yaml": {Data: chartYAML}},
+		Symlinks: map[string]string{"values.yaml": "values/missing.yaml"},
+	}} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+	config := &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+	}
+
+	artifact, err := chart.Build(t.Context(), "chart-linked", config)
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+
+	// Links, even through other links, are replaced by the files they
+	// resolve to.
+	got := map[string]string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read layer: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			t.Errorf("%s has type %q, want a regular file", hdr.Name, hdr.Typeflag)
+		}
+		raw, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = string(raw)
+	}
+	for _, name := range []string{"basic/values.yaml", "basic/values-copy.yaml", "basic/templates/values.yaml"} {
+		if got[name] != string(values) {
+			t.Errorf("%s = %q, want %q", name, got[name], values)
+		}
+	}
+
+	if _, err := chart.Build(t.Context(), "chart-dangling", config); err == nil || !strings.Contains(err.Error(), "values/missing.yaml") {
+		t.Errorf("Build() = %v, want an error naming the missing target", err)
+	}
+}
+
+func TestBuildNormalizeModes(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{
+		Name:    "chart-basic",
+		Version: "0.0.1-r0",
+		Chart:   os.DirFS("../../../testdata/charts/basic"),
+		Modes:   map[string]fs.FileMode{"templates": 0o700, "values.yaml": 0o600, "Chart.yaml": 0o4755},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		normalize bool
+		want      map[string]int64
+	}{
+		{normalize: false, want: map[string]int64{"basic/templates": 0o700, "basic/values.yaml": 0o600, "basic/Chart.yaml": 0o4755}},
+		{normalize: true, want: map[string]int64{"basic/templates": 0o755, "basic/values.yaml": 0o644, "basic/Chart.yaml": 0o644}},
+	} {
+		t.Run(fmt.Sprint(tc.normalize), func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+				RuntimeRepos:   []string{repo.Path()},
+				Keys:           []string{repo.KeyPath()},
+				Arch:           testkit.DefaultArch,
+				NormalizeModes: tc.normalize,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			layers, err := artifact.Layers()
+			if err != nil {
+				t.Fatalf("failed to get layers: %v", err)
+			}
+			rc, err := layers[0].Uncompressed()
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			defer rc.Close()
+
+			var seen int
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to read layer: %v", err)
+				}
+				if want, ok := tc.want[hdr.Name]; ok {
+					if hdr.Mode != want {
+						t.Errorf("%s has mode %o, want %o", hdr.Name, hdr.Mode, want)
+					}
+					seen++
+				}
+				if tc.normalize && hdr.Mode != 0o644 && hdr.Mode != 0o755 {
+					t.Errorf("%s has mode %o, want it normalized", hdr.Name, hdr.Mode)
+				}
+			}
+			if seen != len(tc.want) {
+				t.Errorf("found %d of %d entries checked", seen, len(tc.want))
+			}
+		})
+	}
+}
+
+func TestSuspectFiles(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartYAML, err := os.ReadFile("../../../testdata/charts/basic/Chart.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("\x89PNG\r\n\x1a\n\x00\x00")
+	if err := repo.AddChart(testkit.ChartPackage{
+		Name:    "chart-suspect",
+		Version: "0.0.1-r0",
+		Chart: fstest.MapFS{
+			"Chart.yaml":       {Data: chartYAML},
+			"values.yaml":      {Data: bytes.Repeat([]byte("# padding\n"), 200)},
+			"files/logo.png":   {Data: binary},
+			"files/image.tar":  {Data: binary},
+			"charts/dep.tgz":   {Data: binary},
+			"templates/cm.yml": {Data: []byte("kind: ConfigMap\n")},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+	built, err := chart.Build(t.Context(), "chart-suspect", &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	got, err := chart.SuspectFiles(built, 1000, []string{"files/*.png"})
+	if err != nil {
+		t.Fatalf("SuspectFiles() = %v", err)
+	}
+	want := []chart.SuspectFile{
+		{Path: "files/image.tar", Size: int64(len(binary)), Binary: true},
+		{Path: "values.yaml", Size: 2000, Large: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SuspectFiles() (-want +got):\n%s", diff)
+	}
+
+	// Without a limit, only binary files are suspect.
+	if got, err := chart.SuspectFiles(built, 0, nil); err != nil {
+		t.Fatalf("SuspectFiles() = %v", err)
+	} else if len(got) != 2 || !got[0].Binary || !got[1].Binary {
+		t.Errorf("SuspectFiles() = %+v, want the two binary files outside charts/", got)
+	}
+}
+
+func TestResolveUnindexed(t *testing.T) {
+	// A directory of packages, as melange leaves them before they're indexed.
+	dir := t.TempDir()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	apks, err := filepath.Glob("testdata/packages/x86_64/*.apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, apk := range apks {
+		b, err := os.ReadFile(apk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(apk)), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		repo string
+		want string
+	}{
+		{name: "directory", repo: dir, want: "0.0.2-r0"},
+		{name: "file URL", repo: "file://" + dir, want: "0.0.2-r0"},
+		{name: "glob", repo: filepath.Join(dir, "chart-versioned-0.0.1-*.apk"), want: "0.0.1-r0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &chart.BuildConfig{
+				RuntimeRepos: []string{tc.repo},
+				Arch:         "x86_64",
+			}
+			// Generated indexes are unsigned, so they are only made when
+			// signatures aren't verified.
+			if _, err := chart.Resolve(t.Context(), "chart-versioned", config); err == nil || !strings.Contains(err.Error(), "has no APKINDEX.tar.gz") {
+				t.Fatalf("Resolve() without AllowUnsigned = %v, want an error about the missing index", err)
+			}
+			config.AllowUnsigned = true
+			pkg, err := chart.Resolve(t.Context(), "chart-versioned", config)
+			if err != nil {
+				t.Fatalf("failed to resolve package: %v", err)
+			}
+			if pkg.Version != tc.want {
+				t.Errorf("resolved chart-versioned-%s, want chart-versioned-%s", pkg.Version, tc.want)
+			}
+			if entries, err := os.ReadDir(tmp); err != nil {
+				t.Fatal(err)
+			} else if len(entries) != 0 {
+				t.Errorf("Resolve() left %s in the temp dir", entries[0].Name())
+			}
+			if _, err := chart.Build(t.Context(), "chart-versioned", config); err != nil {
+				t.Errorf("failed to build chart: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveIndexDigest(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(version string) {
+		if err := repo.AddChart(testkit.ChartPackage{Name: "chart-basic", Version: version, Chart: os.DirFS("../../../testdata/charts/basic")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func() *chart.Package {
+		pkg, err := chart.Resolve(t.Context(), "chart-basic", &chart.BuildConfig{
+			RuntimeRepos: []string{repo.Path()},
+			Keys:         []string{repo.KeyPath()},
+			Arch:         testkit.DefaultArch,
+			Version:      "0.0.1-r0",
+		})
+		if err != nil {
+			t.Fatalf("failed to resolve package: %v", err)
+		}
+		return pkg
+	}
+
+	add("0.0.1-r0")
+	first, again := resolve(), resolve()
+	if first.IndexDigest == "" || first.IndexDigest != again.IndexDigest {
+		t.Errorf("IndexDigest = %q, then %q; want the same, non-empty", first.IndexDigest, again.IndexDigest)
+	}
+	// Any change to the index changes the digest, even with the same
+	// package resolved.
+	add("0.0.2-r0")
+	if got := resolve(); got.IndexDigest == first.IndexDigest {
+		t.Errorf("IndexDigest unchanged after a package was added: %s", got.IndexDigest)
+	}
+}
+
+func TestResolveProvides(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-a", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Provides: []string{"chart-virtual=0.0.1"}},
+		{Name: "chart-b", Version: "0.0.2-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Provides: []string{"chart-virtual=0.0.2"}},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name          string
+		version       string
+		prefer, block []string
+		want, wantErr string
+	}{
+		{name: "default", want: "chart-b-0.0.2-r0"},
+		{name: "prefer", prefer: []string{"chart-c", "chart-a"}, want: "chart-a-0.0.1-r0"},
+		{name: "block", block: []string{"chart-b"}, want: "chart-a-0.0.1-r0"},
+		// Versions constrain the package built, not what it provides.
+		{name: "version", version: "0.0.2-r0", prefer: []string{"chart-a"}, want: "chart-b-0.0.2-r0"},
+		{name: "all blocked", block: []string{"chart-a", "chart-b"}, wantErr: "blocked"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &chart.BuildConfig{
+				RuntimeRepos:   []string{repo.Path()},
+				Keys:           []string{repo.KeyPath()},
+				Arch:           testkit.DefaultArch,
+				Version:        tc.version,
+				PreferPackages: tc.prefer,
+				BlockPackages:  tc.block,
+			}
+			pkg, err := chart.Resolve(t.Context(), "chart-virtual", config)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Resolve() = %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to resolve package: %v", err)
+			}
+			if got := pkg.Name + "-" + pkg.Version; got != tc.want {
+				t.Errorf("resolved %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-app", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Depends: []string{"chart-app-crds"}},
+		{Name: "chart-app-crds", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Depends: []string{"chart-common"}},
+		{Name: "chart-common", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic")},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := chart.Resolve(t.Context(), "chart-app", &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve package: %v", err)
+	}
+	// The whole closure, not only direct dependencies.
+	if want := []string{"chart-app-crds", "chart-common"}; !slices.Equal(pkg.Dependencies, want) {
+		t.Errorf("Dependencies = %q, want %q", pkg.Dependencies, want)
+	}
+}
+
+func TestBuildLockfile(t *testing.T) {
+	pinned, err := chart.Resolve(t.Context(), "chart-versioned", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		Version:      "0.0.1-r0",
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve package: %v", err)
+	}
+
+	url, err := filepath.Abs("testdata/packages/x86_64/chart-versioned-0.0.1-r0.apk")
+	if err != nil {
+		t.Fatalf("failed to get package path: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		checksum string
+		version  string
+		wantErr  string
+	}{
+		{name: "locked package", checksum: pinned.Checksum},
+		{name: "satisfied constraint", checksum: pinned.Checksum, version: "<0.0.2"},
+		{name: "checksum mismatch", checksum: "Q1AAAAAAAAAAAAAAAAAAAAAAAAAAA=", wantErr: "checksum mismatch"},
+		{name: "unsatisfied constraint", checksum: pinned.Checksum, version: ">=0.0.2", wantErr: "does not satisfy"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lockfile := filepath.Join(t.TempDir(), "chart.lock.json")
+			if err := (lock.Lock{
+				Version: "v1",
+				Contents: lock.LockContents{
+					Packages: []lock.LockPkg{{
+						Name:         "chart-versioned",
+						URL:          url,
+						Version:      "0.0.1-r0",
+						Architecture: "x86_64",
+						Checksum:     tc.checksum,
+					}},
+				},
+			}).SaveToFile(lockfile); err != nil {
+				t.Fatalf("failed to write lockfile: %v", err)
+			}
+
+			// No repositories are configured, so a successful build proves the
+			// APKINDEX was bypassed.
+			artifact, err := chart.Build(t.Context(), "chart-versioned", &chart.BuildConfig{
+				Arch:     "x86_64",
+				Version:  tc.version,
+				Lockfile: lockfile,
+			})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Build() error = %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+
+			md, err := artifact.Metadata()
+			if err != nil {
+				t.Fatalf("failed to get chart metadata: %v", err)
+			}
+			if md.Version != "0.0.1" {
+				t.Errorf("chart version = %q, want %q", md.Version, "0.0.1")
+			}
+			if got := artifact.Package().Checksum; got != pinned.Checksum {
+				t.Errorf("package checksum = %q, want %q", got, pinned.Checksum)
+			}
+		})
+	}
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	config := &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		JSONRFC6902Patches: map[string][]byte{
+			"Chart.yaml": []byte(`[{"op": "add", "path": "/annotations/patched", "value": "patched-value"}]`),
+		},
+	}
+	artifact, err := chart.Build(t.Context(), "chart-basic", config)
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	l := chart.NewLock(artifact.Package(), config)
+	if got := l.Contents.Repositories[0].Name; got != "testdata/packages" {
+		t.Errorf("locked repository = %q, want %q", got, "testdata/packages")
+	}
+	if _, ok := l.Patches["Chart.yaml"]; !ok {
+		t.Errorf("lock is missing the Chart.yaml patch hash: %v", l.Patches)
+	}
+
+	lockfile := filepath.Join(t.TempDir(), "chart.lock.json")
+	if err := l.SaveToFile(lockfile); err != nil {
+		t.Fatalf("failed to write lockfile: %v", err)
+	}
+
+	rebuilt, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		Arch:               "x86_64",
+		Lockfile:           lockfile,
+		JSONRFC6902Patches: config.JSONRFC6902Patches,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart from lockfile: %v", err)
+	}
+
+	want, err := artifact.Digest()
+	if err != nil {
+		t.Fatalf("failed to get chart digest: %v", err)
+	}
+	got, err := rebuilt.Digest()
+	if err != nil {
+		t.Fatalf("failed to get rebuilt chart digest: %v", err)
+	}
+	if got != want {
+		t.Errorf("chart rebuilt from lockfile has digest %s, want %s", got, want)
+	}
+}
+
+func TestLockBuildRepos(t *testing.T) {
+	config := &chart.BuildConfig{
+		BuildRepos: []string{"testdata/packages/"},
+		Keys:       []string{"testdata/packages/melange.rsa.pub"},
+		Arch:       "x86_64",
+	}
+	artifact, err := chart.Build(t.Context(), "chart-basic", config)
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	l := chart.NewLock(artifact.Package(), config)
+	if len(l.Contents.Repositories) != 0 {
+		t.Errorf("locked repositories = %v, want none", l.Contents.Repositories)
+	}
+	if len(l.Contents.BuildRepositories) != 1 || l.Contents.BuildRepositories[0].Name != "testdata/packages/" {
+		t.Errorf("locked build repositories = %v, want testdata/packages/", l.Contents.BuildRepositories)
+	}
+	if repo := artifact.Package().Repository; repo != "" {
+		t.Errorf("package repository = %q, want none", repo)
+	}
+}
+
+func TestCheckStaleness(t *testing.T) {
+	tests := []struct {
+		version    string
+		wantBehind int
+	}{
+		{version: "0.0.1-r0", wantBehind: 1},
+		{version: "0.0.2-r0", wantBehind: 0},
+		{version: "", wantBehind: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.version, func(t *testing.T) {
+			s, err := chart.CheckStaleness(t.Context(), "chart-versioned", &chart.BuildConfig{
+				RuntimeRepos: []string{"testdata/packages"},
+				Keys:         []string{"testdata/packages/melange.rsa.pub"},
+				Arch:         "x86_64",
+				Version:      tc.version,
+			})
+			if err != nil {
+				t.Fatalf("failed to check staleness: %v", err)
+			}
+			if s.VersionsBehind != tc.wantBehind {
+				t.Errorf("VersionsBehind = %d, want %d", s.VersionsBehind, tc.wantBehind)
+			}
+			if s.Latest.Version != "0.0.2-r0" {
+				t.Errorf("Latest = %s, want 0.0.2-r0", s.Latest.Version)
+			}
+		})
+	}
+}
+
+func TestListIndex(t *testing.T) {
+	entries, err := chart.ListIndex(t.Context(), &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+	})
+	if err != nil {
+		t.Fatalf("failed to list index: %v", err)
+	}
+
+	var versions []string
+	for _, e := range entries {
+		if e.Name == "chart-versioned" {
+			versions = append(versions, e.Version)
+		}
+	}
+	if want := []string{"0.0.1-r0", "0.0.2-r0"}; fmt.Sprint(versions) != fmt.Sprint(want) {
+		t.Errorf("chart-versioned versions = %v, want %v", versions, want)
+	}
+}
+
+func TestResolveWorld(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-base", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic")},
+		{Name: "chart-base", Version: "0.0.2-r0", Chart: os.DirFS("../../../testdata/charts/basic")},
+		{Name: "chart-app", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/versioned"), Depends: []string{"chart-base=0.0.1-r0"}},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := chart.ResolveWorld(t.Context(), &chart.BuildConfig{
+		RuntimeRepos: []string{repo.Path()},
+		Keys:         []string{repo.KeyPath()},
+		Arch:         testkit.DefaultArch,
+	}, []string{"chart-base", "chart-app=0.0.1-r0"})
+	if err != nil {
+		t.Fatalf("failed to resolve world: %v", err)
+	}
+
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name+"-"+e.Version)
+	}
+	// chart-base is held back to the version chart-app needs, not the newest.
+	if want := []string{"chart-base-0.0.1-r0", "chart-app-0.0.1-r0"}; !slices.Equal(got, want) {
+		t.Errorf("ResolveWorld() = %q, want %q", got, want)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	registryAddr := strings.TrimPrefix(s.URL, "http://")
+	src, err := name.NewRepository(registryAddr + "/src")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	dst, err := name.NewRepository(registryAddr + "/dst")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+
+	push := func(ref name.Reference, img v1.Image) *v1.Descriptor {
+		t.Helper()
+		desc, err := partial.Descriptor(img)
+		if err != nil {
+			t.Fatalf("failed to describe image: %v", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("failed to push %s: %v", ref, err)
+		}
+		return desc
+	}
+	fallback := func(d v1.Hash) string {
+		return strings.Replace(d.String(), ":", "-", 1)
+	}
+
+	subject, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	subjectDesc, err := partial.Descriptor(subject)
+	if err != nil {
+		t.Fatalf("failed to describe image: %v", err)
+	}
+	push(src.Digest(subjectDesc.Digest.String()), subject)
+
+	// An SBOM attached as a referrer, listed through the fallback tag since
+	// the in-memory registry has no referrers API.
+	sbom, ok := mutate.Subject(mutate.ConfigMediaType(empty.Image, "application/spdx+json"), *subjectDesc).(v1.Image)
+	if !ok {
+		t.Fatal("SBOM with a subject isn't an image")
+	}
+	sbomDesc, err := partial.Descriptor(sbom)
+	if err != nil {
+		t.Fatalf("failed to describe SBOM: %v", err)
+	}
+	push(src.Digest(sbomDesc.Digest.String()), sbom)
+	sbomDesc.ArtifactType = "application/spdx+json"
+	referrers := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: sbom, Descriptor: *sbomDesc})
+	if err := remote.Put(src.Tag(fallback(subjectDesc.Digest)), referrers); err != nil {
+		t.Fatalf("failed to push referrers: %v", err)
+	}
+
+	// A cosign signature on the SBOM.
+	sig, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	sigDesc := push(src.Tag(fallback(sbomDesc.Digest)+".sig"), sig)
+
+	copied, err := chart.Copy(src.Digest(subjectDesc.Digest.String()), dst)
+	if err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if want := []v1.Hash{sbomDesc.Digest, sigDesc.Digest}; !slices.Equal(copied, want) {
+		t.Errorf("copied = %v, want %v", copied, want)
+	}
+
+	if _, err := remote.Head(dst.Digest(subjectDesc.Digest.String())); err != nil {
+		t.Errorf("subject not copied: %v", err)
+	}
+	idx, err := remote.Referrers(dst.Digest(subjectDesc.Digest.String()))
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("failed to read referrers: %v", err)
+	}
+	if len(m.Manifests) != 1 || m.Manifests[0].Digest != sbomDesc.Digest {
+		t.Errorf("dst referrers = %v, want %s", m.Manifests, sbomDesc.Digest)
+	}
+	desc, err := remote.Head(dst.Tag(fallback(sbomDesc.Digest) + ".sig"))
+	if err != nil {
+		t.Fatalf("signature tag not copied: %v", err)
+	}
+	if desc.Digest != sigDesc.Digest {
+		t.Errorf("signature tag = %s, want %s", desc.Digest, sigDesc.Digest)
+	}
+
+	// Copying again finds everything in place.
+	if _, err := chart.Copy(src.Digest(subjectDesc.Digest.String()), dst); err != nil {
+		t.Fatalf("second Copy: %v", err)
+	}
+	if idx, err = remote.Referrers(dst.Digest(subjectDesc.Digest.String())); err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	if m, err = idx.IndexManifest(); err != nil {
+		t.Fatalf("failed to read referrers: %v", err)
+	}
+	if len(m.Manifests) != 1 {
+		t.Errorf("dst referrers after second copy = %v, want 1", m.Manifests)
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(s.URL, "http://") + "/charts")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	push := func(ref name.Reference, img v1.Image) *v1.Descriptor {
+		t.Helper()
+		desc, err := partial.Descriptor(img)
+		if err != nil {
+			t.Fatalf("failed to describe image: %v", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("failed to push %s: %v", ref, err)
+		}
+		return desc
+	}
+
+	subject, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	subjectDesc, err := partial.Descriptor(subject)
+	if err != nil {
+		t.Fatalf("failed to describe image: %v", err)
+	}
+	ref := repo.Digest(subjectDesc.Digest.String())
+	push(ref, subject)
+	fallback := strings.Replace(subjectDesc.Digest.String(), ":", "-", 1)
+
+	if got, err := chart.Referrers(ref); err != nil || len(got) != 0 {
+		t.Fatalf("Referrers() = %v, %v, want none", got, err)
+	}
+
+	sbom, ok := mutate.Subject(mutate.ConfigMediaType(empty.Image, "application/spdx+json"), *subjectDesc).(v1.Image)
+	if !ok {
+		t.Fatal("SBOM with a subject isn't an image")
+	}
+	sbomDesc, err := partial.Descriptor(sbom)
+	if err != nil {
+		t.Fatalf("failed to describe SBOM: %v", err)
+	}
+	push(repo.Digest(sbomDesc.Digest.String()), sbom)
+	sbomDesc.ArtifactType = "application/spdx+json"
+	if err := remote.Put(repo.Tag(fallback), mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: sbom, Descriptor: *sbomDesc})); err != nil {
+		t.Fatalf("failed to push referrers: %v", err)
+	}
+	sig, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	sigDesc := push(repo.Tag(fallback+".sig"), sig)
+
+	got, err := chart.Referrers(ref)
+	if err != nil {
+		t.Fatalf("Referrers() = %v", err)
+	}
+	var digests []v1.Hash
+	for _, d := range got {
+		digests = append(digests, d.Digest)
+	}
+	if want := []v1.Hash{sbomDesc.Digest, sigDesc.Digest}; !slices.Equal(digests, want) {
+		t.Errorf("Referrers() digests = %v, want %v", digests, want)
+	}
+	if got[0].ArtifactType != "application/spdx+json" {
+		t.Errorf("SBOM artifact type = %q, want %q", got[0].ArtifactType, "application/spdx+json")
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(s.URL, "http://") + "/charts")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	subject, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	subjectDesc, err := partial.Descriptor(subject)
+	if err != nil {
+		t.Fatalf("failed to describe image: %v", err)
+	}
+	ref := repo.Digest(subjectDesc.Digest.String())
+	if err := remote.Write(ref, subject); err != nil {
+		t.Fatalf("failed to push subject: %v", err)
+	}
+	fallback := strings.Replace(subjectDesc.Digest.String(), ":", "-", 1)
+
+	if got, err := chart.Attachments(ref); err != nil || *got != (chart.Attached{}) {
+		t.Fatalf("Attachments() = %+v, %v, want nothing attached", got, err)
+	}
+
+	// An SBOM and a Notary Project signature are referrers, listed in the
+	// fallback tag, and an attestation is under cosign's tag.
+	var add []mutate.IndexAddendum
+	for _, artifactType := range []string{"application/spdx+json", "application/vnd.cncf.notary.signature"} {
+		img, ok := mutate.Subject(mutate.ConfigMediaType(empty.Image, types.MediaType(artifactType)), *subjectDesc).(v1.Image)
+		if !ok {
+			t.Fatalf("%s with a subject isn't an image", artifactType)
+		}
+		desc, err := partial.Descriptor(img)
+		if err != nil {
+			t.Fatalf("failed to describe %s: %v", artifactType, err)
+		}
+		if err := remote.Write(repo.Digest(desc.Digest.String()), img); err != nil {
+			t.Fatalf("failed to push %s: %v", artifactType, err)
+		}
+		desc.ArtifactType = artifactType
+		add = append(add, mutate.IndexAddendum{Add: img, Descriptor: *desc})
+	}
+	if err := remote.Put(repo.Tag(fallback), mutate.AppendManifests(empty.Index, add...)); err != nil {
+		t.Fatalf("failed to push referrers: %v", err)
+	}
+	att, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	if err := remote.Write(repo.Tag(fallback+".att"), att); err != nil {
+		t.Fatalf("failed to push attestation: %v", err)
+	}
+
+	got, err := chart.Attachments(ref)
+	if err != nil {
+		t.Fatalf("Attachments() = %v", err)
+	}
+	if want := (chart.Attached{Signed: true, SBOM: true, Attested: true}); *got != want {
+		t.Errorf("Attachments() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	newKey := func() *ecdsa.PrivateKey {
+		t.Helper()
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		return k
+	}
+	push := func(repo string) name.Digest {
+		t.Helper()
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatalf("failed to create image: %v", err)
+		}
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatalf("failed to get digest: %v", err)
+		}
+		ref, err := name.NewDigest(strings.TrimPrefix(s.URL, "http://") + "/" + repo + "@" + d.String())
+		if err != nil {
+			t.Fatalf("failed to parse reference: %v", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("failed to push image: %v", err)
+		}
+		return ref
+	}
+
+	key := newKey()
+	signer := testkit.Signer{Key: key}
+
+	// A keyless signing certificate for a workflow identity, issued by a CA
+	// standing in for Fulcio.
+	caKey := newKey()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("failed to parse CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	identity, _ := url.Parse("https://github.com/example/repo/.github/workflows/release.yaml@refs/heads/main")
+	issuer, err := asn1.Marshal("https://token.actions.githubusercontent.com")
+	if err != nil {
+		t.Fatalf("failed to encode issuer: %v", err)
+	}
+	leafKey := newKey()
+	leafTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{identity},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuer}},
+	}
+	// Fulcio logs its certificates to a certificate transparency log.
+	ctKey := newKey()
+	ctKeys := []crypto.PublicKey{&ctKey.PublicKey}
+	leaf, err := testkit.LoggedCertificate(leafTmpl, ca, &leafKey.PublicKey, caKey, ctKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyless := testkit.Signer{Key: leafKey, Cert: leaf}
+	// One issued without being logged, and one logged to another log.
+	unloggedDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	unlogged, err := x509.ParseCertificate(unloggedDER)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	otherLogged, err := testkit.LoggedCertificate(leafTmpl, ca, &leafKey.PublicKey, caKey, newKey())
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	unsigned := push("unsigned")
+	signed := push("signed")
+	if err := signer.Sign(signed); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	attested := push("attested")
+	if err := signer.Sign(attested); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if err := signer.Attest(attested, "https://spdx.dev/Document", map[string]string{"spdxVersion": "SPDX-2.3"}); err != nil {
+		t.Fatalf("failed to attest: %v", err)
+	}
+	keylessSigned := push("keyless")
+	if err := keyless.Sign(keylessSigned); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	// Signatures entered in a transparency log, with offline bundles from it.
+	rekorKey := newKey()
+	logged := push("logged")
+	loggedKeyless := keyless
+	loggedKeyless.Rekor, loggedKeyless.LoggedAt = rekorKey, time.Now()
+	if err := loggedKeyless.Sign(logged); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if err := loggedKeyless.Attest(logged, "https://spdx.dev/Document", map[string]string{"spdxVersion": "SPDX-2.3"}); err != nil {
+		t.Fatalf("failed to attest: %v", err)
+	}
+	// One signed with a key rather than a certificate.
+	loggedKeyed := push("logged-keyed")
+	loggedSigner := signer
+	loggedSigner.Rekor, loggedSigner.LoggedAt = rekorKey, time.Now()
+	if err := loggedSigner.Sign(loggedKeyed); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	// One whose log entry names another signer doesn't count.
+	otherSigner := push("other-signer")
+	otherLoggedKeyless := loggedKeyless
+	otherLoggedKeyless.LoggedAs = otherLogged
+	if err := otherLoggedKeyless.Sign(otherSigner); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	otherAttester := push("other-attester")
+	if err := loggedKeyless.Sign(otherAttester); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if err := otherLoggedKeyless.Attest(otherAttester, "https://spdx.dev/Document", map[string]string{"spdxVersion": "SPDX-2.3"}); err != nil {
+		t.Fatalf("failed to attest: %v", err)
+	}
+	// Ones by certificates that weren't logged to the CT log.
+	unloggedCert := push("unlogged-cert")
+	unloggedKeyless := loggedKeyless
+	unloggedKeyless.Cert = unlogged
+	if err := unloggedKeyless.Sign(unloggedCert); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	otherLogCert := push("other-log-cert")
+	unloggedKeyless.Cert = otherLogged
+	if err := unloggedKeyless.Sign(otherLogCert); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	// One logged after its certificate expired doesn't count.
+	late := push("late")
+	loggedKeyless.LoggedAt = time.Now().Add(time.Hour)
+	if err := loggedKeyless.Sign(late); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	// Signatures countersigned by a timestamp authority with its own CA.
+	// Its root outlives the late timestamp below, so only the signing
+	// certificate is expired by then.
+	tsaRootKey := newKey()
+	tsaRootTmpl := *caTmpl
+	tsaRootTmpl.NotAfter = time.Now().Add(24 * time.Hour)
+	tsaRootDER, err := x509.CreateCertificate(rand.Reader, &tsaRootTmpl, &tsaRootTmpl, &tsaRootKey.PublicKey, tsaRootKey)
+	if err != nil {
+		t.Fatalf("failed to create TSA root: %v", err)
+	}
+	tsaRoot, err := x509.ParseCertificate(tsaRootDER)
+	if err != nil {
+		t.Fatalf("failed to parse TSA root: %v", err)
+	}
+	tsaRoots := x509.NewCertPool()
+	tsaRoots.AddCert(tsaRoot)
+	tsaKey := newKey()
+	tsaDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "test tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, tsaRoot, &tsaKey.PublicKey, tsaRootKey)
+	if err != nil {
+		t.Fatalf("failed to create TSA certificate: %v", err)
+	}
+	tsaCert, err := x509.ParseCertificate(tsaDER)
+	if err != nil {
+		t.Fatalf("failed to parse TSA certificate: %v", err)
+	}
+	timestamped := push("timestamped")
+	timestampedKeyless := keyless
+	timestampedKeyless.TSA, timestampedKeyless.TSACert, timestampedKeyless.TimestampedAt = tsaKey, tsaCert, time.Now()
+	if err := timestampedKeyless.Sign(timestamped); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if err := timestampedKeyless.Attest(timestamped, "https://spdx.dev/Document", map[string]string{"spdxVersion": "SPDX-2.3"}); err != nil {
+		t.Fatalf("failed to attest: %v", err)
+	}
+	// One from an authority signing with RSA-PSS, and one from an
+	// authority leaving its certificate out of the timestamp.
+	pssKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pssDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "test pss tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, tsaRoot, &pssKey.PublicKey, tsaRootKey)
+	if err != nil {
+		t.Fatalf("failed to create TSA certificate: %v", err)
+	}
+	pssCert, err := x509.ParseCertificate(pssDER)
+	if err != nil {
+		t.Fatalf("failed to parse TSA certificate: %v", err)
+	}
+	pssTimestamped := push("pss-timestamped")
+	pssKeyless := timestampedKeyless
+	pssKeyless.TSA, pssKeyless.TSACert = pssKey, pssCert
+	if err := pssKeyless.Sign(pssTimestamped); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	certlessTimestamped := push("certless-timestamped")
+	certlessKeyless := timestampedKeyless
+	certlessKeyless.TSAOmitsCert = true
+	if err := certlessKeyless.Sign(certlessTimestamped); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	lateTimestamp := push("late-timestamp")
+	timestampedKeyless.TimestampedAt = time.Now().Add(time.Hour)
+	if err := timestampedKeyless.Sign(lateTimestamp); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	// A signature copied from another artifact doesn't count.
+	copied := push("copied")
+	img, err := remote.Image(signed.Context().Tag(strings.Replace(signed.DigestStr(), ":", "-", 1) + ".sig"))
+	if err != nil {
+		t.Fatalf("failed to fetch signature: %v", err)
+	}
+	if err := remote.Write(copied.Context().Tag(strings.Replace(copied.DigestStr(), ":", "-", 1)+".sig"), img); err != nil {
+		t.Fatalf("failed to copy signature: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		ref     name.Digest
+		policy  chart.Policy
+		wantErr string
+	}{
+		{name: "unsigned", ref: unsigned, policy: chart.Policy{PublicKey: &key.PublicKey}, wantErr: "is not signed"},
+		{name: "signed", ref: signed, policy: chart.Policy{PublicKey: &key.PublicKey}},
+		{name: "wrong key", ref: signed, policy: chart.Policy{PublicKey: &newKey().PublicKey}, wantErr: "invalid signature"},
+		{name: "signature for another digest", ref: copied, policy: chart.Policy{PublicKey: &key.PublicKey}, wantErr: "signature is for"},
+		{name: "missing attestation", ref: signed, policy: chart.Policy{PublicKey: &key.PublicKey, Predicates: []string{"https://spdx.dev/Document"}}, wantErr: "has no https://spdx.dev/Document attestation"},
+		{name: "attested", ref: attested, policy: chart.Policy{PublicKey: &key.PublicKey, Predicates: []string{"https://spdx.dev/Document"}}},
+		{name: "other predicate", ref: attested, policy: chart.Policy{PublicKey: &key.PublicKey, Predicates: []string{"https://slsa.dev/provenance/v1"}}, wantErr: "has no https://slsa.dev/provenance/v1 attestation"},
+		{name: "keyless", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), Issuer: "https://token.actions.githubusercontent.com", RekorKey: &rekorKey.PublicKey}},
+		{name: "keyless without proof of time", ref: keylessSigned, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String()}, wantErr: "neither a Rekor key nor timestamp authority roots"},
+		{name: "keyless wrong identity", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: "someone@example.com", RekorKey: &rekorKey.PublicKey}, wantErr: "signing certificate is for"},
+		{name: "keyless wrong issuer", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Issuer: "https://accounts.google.com", RekorKey: &rekorKey.PublicKey}, wantErr: "signing certificate was issued by"},
+		{name: "keyless untrusted root", ref: logged, policy: chart.Policy{Roots: x509.NewCertPool(), CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "verifying signing certificate"},
+		{name: "keyless without certificate", ref: loggedKeyed, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "no signing certificate"},
+		{name: "logged", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}},
+		{name: "logged attestation", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey, Predicates: []string{"https://spdx.dev/Document"}}},
+		{name: "logged with key", ref: loggedKeyed, policy: chart.Policy{PublicKey: &key.PublicKey, RekorKey: &rekorKey.PublicKey}},
+		{name: "attestation not logged", ref: attested, policy: chart.Policy{PublicKey: &key.PublicKey, RekorKey: &rekorKey.PublicKey}, wantErr: "no transparency log bundle"},
+		{name: "logged after expiry", ref: late, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "verifying signing certificate"},
+		{name: "not logged", ref: keylessSigned, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "no transparency log bundle"},
+		{name: "timestamped", ref: timestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots, Predicates: []string{"https://spdx.dev/Document"}}},
+		{name: "timestamped after expiry", ref: lateTimestamp, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots}, wantErr: "verifying signing certificate"},
+		{name: "not timestamped", ref: keylessSigned, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots}, wantErr: "no timestamp"},
+		{name: "untrusted timestamp authority", ref: timestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: roots}, wantErr: "verifying timestamp authority certificate"},
+		{name: "timestamped with RSA-PSS", ref: pssTimestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots}},
+		{name: "timestamp without certificate", ref: certlessTimestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots}, wantErr: "neither in the timestamp nor the policy"},
+		{name: "timestamp certificate from policy", ref: certlessTimestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots, TimestampCerts: []*x509.Certificate{tsaCert}}},
+		{name: "timestamp signed by another certificate", ref: certlessTimestamped, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), TimestampRoots: tsaRoots, TimestampCerts: []*x509.Certificate{pssCert}}, wantErr: "neither in the timestamp nor the policy"},
+		{name: "keyless without CT log keys", ref: logged, policy: chart.Policy{Roots: roots, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "no certificate transparency log keys"},
+		{name: "certificate not in CT log", ref: unloggedCert, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "no signed certificate timestamp"},
+		{name: "certificate in another CT log", ref: otherLogCert, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "no signed certificate timestamp from a trusted log"},
+		{name: "logged by another signer", ref: otherSigner, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey}, wantErr: "made by another signer"},
+		{name: "attestation logged by another signer", ref: otherAttester, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &rekorKey.PublicKey, Predicates: []string{"https://spdx.dev/Document"}}, wantErr: "made by another signer"},
+		{name: "identity regexp", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, IdentityRegexp: regexp.MustCompile(`^https://github\.com/example/repo/\.github/workflows/release\.yaml@refs/(heads|tags)/.+$`), RekorKey: &rekorKey.PublicKey}},
+		{name: "identity regexp mismatch", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, IdentityRegexp: regexp.MustCompile(`^https://github\.com/other/.+$`), RekorKey: &rekorKey.PublicKey}, wantErr: "none matching"},
+		{name: "other log", ref: logged, policy: chart.Policy{Roots: roots, CTLogKeys: ctKeys, Identity: identity.String(), RekorKey: &newKey().PublicKey}, wantErr: "verifying transparency log bundle"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := chart.Verify(tc.ref, tc.policy)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Verify = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	build := func(t *testing.T, pkg string) chart.Chart {
+		artifact, err := chart.Build(t.Context(), pkg, &chart.BuildConfig{
+			RuntimeRepos: []string{"testdata/packages"},
+			Keys:         []string{"testdata/packages/melange.rsa.pub"},
+			Arch:         "x86_64",
+		})
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	tests := []struct {
+		name   string
+		pkg    string
+		values map[string]any
+		want   []string
+	}{{
+		name: "defaults",
+		pkg:  "chart-basic",
+		want: []string{"writable-root-fs", "privilege-escalation", "runs-as-root", "capabilities-not-dropped", "no-cpu-limit", "no-memory-limit"},
+	}, {
+		name:   "values",
+		pkg:    "chart-basic",
+		values: map[string]any{"image": map[string]any{"tag": "latest"}},
+		want:   []string{"writable-root-fs", "latest-tag", "privilege-escalation", "runs-as-root", "capabilities-not-dropped", "no-cpu-limit", "no-memory-limit"},
+	}, {
+		name: "library",
+		pkg:  "chart-basiclibrary",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			findings, err := chart.Scan(build(t, tc.pkg), tc.values)
+			if err != nil {
+				t.Fatalf("Scan() = %v", err)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, f.ID)
+				if f.Resource != "Deployment/release" || f.Container != "basic" || f.Template != "basic/templates/deployment.yaml" {
+					t.Errorf("finding %s is for %s, container %q in %s", f.ID, f.Resource, f.Container, f.Template)
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Scan() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderedManifest(t *testing.T) {
+	build := func(t *testing.T, pkg string, patches map[string][]byte) chart.Chart {
+		artifact, err := chart.Build(t.Context(), pkg, &chart.BuildConfig{
+			RuntimeRepos:       []string{"testdata/packages"},
+			Keys:               []string{"testdata/packages/melange.rsa.pub"},
+			Arch:               "x86_64",
+			JSONRFC6902Patches: patches,
+		})
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	got, err := chart.RenderedManifest(build(t, "chart-basic", nil))
+	if err != nil {
+		t.Fatalf("RenderedManifest() = %v", err)
+	}
+	if !strings.HasPrefix(got, "---\n# Source: basic/templates/") || !strings.Contains(got, "kind: Deployment") {
+		t.Errorf("RenderedManifest() = %q, want the chart's manifests", got)
+	}
+	if strings.Contains(got, "NOTES.txt") {
+		t.Errorf("RenderedManifest() = %q, want no install notes", got)
+	}
+	again, err := chart.RenderedManifest(build(t, "chart-basic", nil))
+	if err != nil {
+		t.Fatalf("RenderedManifest() = %v", err)
+	}
+	if again != got {
+		t.Errorf("rendering again = %q, want %q", again, got)
+	}
+
+	// Changing a default value changes the output, though not the version.
+	patched, err := chart.RenderedManifest(build(t, "chart-basic", map[string][]byte{
+		"values.yaml": []byte(`[{"op": "replace", "path": "/image/tag", "value": "patched"}]`),
+	}))
+	if err != nil {
+		t.Fatalf("RenderedManifest() = %v", err)
+	}
+	if patched == got || !strings.Contains(patched, "patched") {
+		t.Errorf("RenderedManifest() with patched values = %q", patched)
+	}
+
+	lib, err := chart.RenderedManifest(build(t, "chart-basiclibrary", nil))
+	if err != nil {
+		t.Fatalf("RenderedManifest() = %v", err)
+	}
+	if lib != "" {
+		t.Errorf("RenderedManifest() of library chart = %q, want empty", lib)
+	}
+}
+
+func TestAttest(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(s.URL, "http://") + "/attest")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatalf("failed to digest image: %v", err)
+	}
+	subject := repo.Digest(d.String())
+	if err := remote.Write(subject, img); err != nil {
+		t.Fatalf("failed to push image: %v", err)
+	}
+
+	report := chart.ScanReport{Linter: chart.ScanLinter, Checks: chart.ScanChecks(), FailOn: chart.SeverityHigh, Findings: []chart.Finding{{ID: "writable-root-fs", Severity: chart.SeverityHigh}}}
+	h, err := chart.Attest(subject, chart.ScanPredicateType, report)
+	if err != nil {
+		t.Fatalf("Attest() = %v", err)
+	}
+	// The same predicate makes the same attestation, rather than another.
+	if again, err := chart.Attest(subject, chart.ScanPredicateType, report); err != nil || again != h {
+		t.Fatalf("Attest() again = %s, %v; want %s", again, err, h)
+	}
+
+	idx, err := remote.Referrers(subject)
+	if err != nil {
+		t.Fatalf("failed to list referrers: %v", err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("failed to read referrers: %v", err)
+	}
+	if len(m.Manifests) != 1 || m.Manifests[0].Digest != h {
+		t.Fatalf("referrers = %v, want %s", m.Manifests, h)
+	}
+	if got := m.Manifests[0].Annotations["in-toto.io/predicate-type"]; got != chart.ScanPredicateType {
+		t.Errorf("predicate type annotation = %q, want %q", got, chart.ScanPredicateType)
+	}
+
+	att, err := remote.Image(repo.Digest(h.String()))
+	if err != nil {
+		t.Fatalf("failed to fetch attestation: %v", err)
+	}
+	mf, err := att.Manifest()
+	if err != nil {
+		t.Fatalf("failed to read attestation manifest: %v", err)
+	}
+	if mf.Subject == nil || mf.Subject.Digest != d {
+		t.Errorf("attestation subject = %v, want %s", mf.Subject, d)
+	}
+	ls, err := att.Layers()
+	if err != nil || len(ls) != 1 {
+		t.Fatalf("attestation layers = %v, %v; want one", ls, err)
+	}
+	rc, err := ls[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("failed to read statement: %v", err)
+	}
+	defer rc.Close()
+	var statement struct {
+		Subject []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		PredicateType string           `json:"predicateType"`
+		Predicate     chart.ScanReport `json:"predicate"`
+	}
+	if err := json.NewDecoder(rc).Decode(&statement); err != nil {
+		t.Fatalf("failed to parse statement: %v", err)
+	}
+	if len(statement.Subject) != 1 || "sha256:"+statement.Subject[0].Digest["sha256"] != d.String() {
+		t.Errorf("statement subject = %v, want %s", statement.Subject, d)
+	}
+	if statement.PredicateType != chart.ScanPredicateType || statement.Predicate.Linter != chart.ScanLinter || len(statement.Predicate.Checks) != 13 || len(statement.Predicate.Findings) != 1 || statement.Predicate.Findings[0].ID != "writable-root-fs" {
+		t.Errorf("statement = %+v, want the scan report", statement)
+	}
+}
+
+func TestBuildFiles(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		Files: map[string]chart.File{
+			"README.md":           {Content: []byte("# ${name}\n\nVersion ${version}, {{ .Chart.Name }} untouched.\n")},
+			"values.yaml":         {Content: []byte("support: ${name}@example.com\n"), Append: true},
+			"templates/NOTES.txt": {Content: []byte("Installed ${name}.\n"), Append: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+
+	got := map[string]string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read layer: %v", err)
+		}
+		raw, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = string(raw)
+	}
+
+	want := map[string]string{
+		"basic/README.md":           "# basic\n\nVersion 0.0.1, {{ .Chart.Name }} untouched.\n",
+		"basic/values.yaml":         "image:\n  repository: foobear\n  tag: \"foobar\"\nsupport: basic@example.com\n",
+		"basic/templates/NOTES.txt": "Installed basic.\n",
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+	if _, ok := got["basic/templates/deployment.yaml"]; !ok {
+		t.Errorf("chart lost its other files: %v", slices.Collect(maps.Keys(got)))
+	}
+}
+
+func TestBuildBundle(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/basic"), Depends: []string{"chart-basiclib", "basic-tools"}},
+		{Name: "chart-basiclib", Version: "0.1.0-r0", Chart: os.DirFS("../../../testdata/charts/basiclibrary")},
+		{Name: "basic-tools", Version: "0.0.1-r0", Chart: os.DirFS("../../../testdata/charts/versioned")},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:  []string{repo.Path()},
+		Keys:          []string{repo.KeyPath()},
+		Arch:          testkit.DefaultArch,
+		BundlePattern: "chart-*",
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	hc, err := loader.LoadArchive(rc)
+	if err != nil {
+		t.Fatalf("failed to load chart: %v", err)
+	}
+
+	// Only dependencies matching the pattern are bundled.
+	var got []string
+	for _, dep := range hc.Dependencies() {
+		got = append(got, dep.Name())
+	}
+	if want := []string{"basiclib"}; !slices.Equal(got, want) {
+		t.Errorf("bundled charts = %q, want %q", got, want)
+	}
+}
+
+func TestBuildExtraLayers(t *testing.T) {
+	bundle := []byte(`{"images": ["cgr.dev/chainguard/nginx"]}`)
+	c, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Layers: []chart.Layer{
+			{MediaType: "application/vnd.example.bundle.v1+json", Content: bundle, Title: "bundle.json"},
+			{MediaType: "application/vnd.example.notes.v1", Content: []byte("notes")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	m, err := c.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if len(m.Layers) != 3 {
+		t.Fatalf("manifest has %d layers, want the content and 2 extra", len(m.Layers))
+	}
+	if got, want := string(m.Layers[0].MediaType), "application/vnd.cncf.helm.chart.content.v1.tar+gzip"; got != want {
+		t.Errorf("first layer media type = %s, want the chart content, %s", got, want)
+	}
+	if got, want := string(m.Layers[1].MediaType), "application/vnd.example.bundle.v1+json"; got != want {
+		t.Errorf("extra layer media type = %s, want %s", got, want)
+	}
+	if got := m.Layers[1].Annotations["org.opencontainers.image.title"]; got != "bundle.json" {
+		t.Errorf("extra layer title = %q, want bundle.json", got)
+	}
+	if m.Layers[2].Annotations != nil {
+		t.Errorf("untitled layer has annotations %v", m.Layers[2].Annotations)
+	}
+
+	layers, err := c.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[1].Uncompressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, bundle) {
+		t.Errorf("extra layer = %q, %v, want %q", got, err, bundle)
+	}
+
+	// Layers Helm would read as the chart are refused.
+	if _, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Layers:       []chart.Layer{{MediaType: "application/vnd.cncf.helm.chart.content.v1.tar+gzip"}},
+	}); err == nil {
+		t.Error("Build() with a chart content layer succeeded, want an error")
+	}
+}
+
+func TestChartManifestIsCopied(t *testing.T) {
+	c, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	digest, err := c.Digest()
+	if err != nil {
+		t.Fatalf("failed to get digest: %v", err)
+	}
+
+	// The manifest is computed once, so changes to a returned copy must not
+	// leak into what is pushed.
+	m, err := c.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	m.Annotations["changed"] = "true"
+	m.Layers = nil
+
+	again, err := c.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if _, ok := again.Annotations["changed"]; ok || len(again.Layers) != 1 {
+		t.Errorf("Manifest() = %+v, changed by a caller", again)
+	}
+	raw, err := c.RawManifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if got, _, err := v1.SHA256(bytes.NewReader(raw)); err != nil || got != digest {
+		t.Errorf("RawManifest() digest = %v, %v, want %v", got, err, digest)
+	}
+	if cfg, err := partial.ConfigLayer(c); err != nil {
+		t.Errorf("ConfigLayer() = %v", err)
+	} else if d, _ := cfg.Digest(); d != again.Config.Digest {
+		t.Errorf("config layer digest = %v, want %v", d, again.Config.Digest)
+	}
+}
+
+func TestBuildIcon(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		Icon:         "https://cdn.example.com/icons/${name}-${version}.svg",
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	const want = "https://cdn.example.com/icons/basic-0.0.1.svg"
+	md, err := artifact.Metadata()
+	if err != nil {
+		t.Fatalf("failed to get chart metadata: %v", err)
+	}
+	if md.Icon != want {
+		t.Errorf("metadata icon = %q, want %q", md.Icon, want)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatal("Chart.yaml not found in chart layer")
+		}
+		if err != nil {
+			t.Fatalf("failed to read layer: %v", err)
+		}
+		if hdr.Name != "basic/Chart.yaml" {
+			continue
+		}
+		raw, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read Chart.yaml: %v", err)
+		}
+		var layerMD helmchart.Metadata
+		if err := yaml.Unmarshal(raw, &layerMD); err != nil {
+			t.Fatalf("failed to parse Chart.yaml: %v", err)
+		}
+		if layerMD.Icon != want {
+			t.Errorf("Chart.yaml icon = %q, want %q", layerMD.Icon, want)
+		}
+		return
+	}
+}
+
+func TestBuildMaintainers(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		append bool
+	}{
+		{"replace", false},
+		{"append", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+				RuntimeRepos: []string{"testdata/packages"},
+				Keys:         []string{"testdata/packages/melange.rsa.pub"},
+				Arch:         "x86_64",
+				JSONRFC6902Patches: map[string][]byte{
+					"Chart.yaml": []byte(`[{"op":"add","path":"/maintainers","value":[{"name":"upstream"}]}]`),
+				},
+				Maintainers: []*helmchart.Maintainer{
+					{Name: "Support", Email: "support@example.com", URL: "https://example.com/support"},
+				},
+				AppendMaintainers: tc.append,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			md, err := artifact.Metadata()
+			if err != nil {
+				t.Fatalf("failed to get chart metadata: %v", err)
+			}
+
+			want := []*helmchart.Maintainer{{Name: "Support", Email: "support@example.com", URL: "https://example.com/support"}}
+			if tc.append {
+				want = append([]*helmchart.Maintainer{{Name: "upstream"}}, want...)
+			}
+			if diff := cmp.Diff(want, md.Maintainers); diff != "" {
+				t.Errorf("metadata maintainers (-want +got):\n%s", diff)
+			}
+
+			layers, err := artifact.Layers()
+			if err != nil {
+				t.Fatalf("failed to get layers: %v", err)
+			}
+			rc, err := layers[0].Compressed()
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			defer rc.Close()
+			hc, err := loader.LoadArchive(rc)
+			if err != nil {
+				t.Fatalf("failed to load chart: %v", err)
+			}
+			if diff := cmp.Diff(want, hc.Metadata.Maintainers); diff != "" {
+				t.Errorf("Chart.yaml maintainers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildCatalogMetadata(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		JSONRFC6902Patches: map[string][]byte{
+			"Chart.yaml": []byte(`[{"op":"add","path":"/keywords","value":["upstream"]},{"op":"add","path":"/home","value":"https://upstream.example.com"}]`),
+		},
+		Keywords: []string{"web", "hardened"},
+		Home:     "https://example.com/charts/${name}",
+		Sources:  []string{"https://github.com/example/${name}/tree/v${version}"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	hc, err := loader.LoadArchive(rc)
+	if err != nil {
+		t.Fatalf("failed to load chart: %v", err)
+	}
+	md := hc.Metadata
+	if want := []string{"web", "hardened"}; !slices.Equal(md.Keywords, want) {
+		t.Errorf("keywords = %v, want %v", md.Keywords, want)
+	}
+	if want := "https://example.com/charts/basic"; md.Home != want {
+		t.Errorf("home = %q, want %q", md.Home, want)
+	}
+	const source = "https://github.com/example/basic/tree/v0.0.1"
+	if want := []string{source}; !slices.Equal(md.Sources, want) {
+		t.Errorf("sources = %v, want %v", md.Sources, want)
+	}
+
+	m, err := artifact.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if got := m.Annotations["org.opencontainers.image.source"]; got != source {
+		t.Errorf("source annotation = %q, want %q", got, source)
+	}
+}
+
+func TestBuildSourceAnnotation(t *testing.T) {
+	sources := []string{"", "https://github.com/example/basic", "https://example.com/provenance"}
+	for _, tc := range []struct {
+		name    string
+		format  string
+		sources []string
+		want    string
+	}{
+		{name: "default", sources: sources, want: "https://github.com/example/basic,https://example.com/provenance"},
+		{name: "join", format: chart.SourcesJoin, sources: sources, want: "https://github.com/example/basic,https://example.com/provenance"},
+		{name: "first", format: chart.SourcesFirst, sources: sources, want: "https://github.com/example/basic"},
+		{name: "custom", format: "https://github.com/example/${name}", sources: sources, want: "https://github.com/example/basic"},
+		{name: "empty", format: chart.SourcesFirst, sources: []string{}, want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+				RuntimeRepos:     []string{"testdata/packages"},
+				Keys:             []string{"testdata/packages/melange.rsa.pub"},
+				Arch:             "x86_64",
+				Sources:          tc.sources,
+				SourceAnnotation: tc.format,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			m, err := artifact.Manifest()
+			if err != nil {
+				t.Fatalf("failed to get manifest: %v", err)
+			}
+			got, ok := m.Annotations[chart.SourceAnnotation]
+			if got != tc.want || ok != (tc.want != "") {
+				t.Errorf("source annotation = %q (set: %t), want %q", got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildCreated(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	for _, tc := range []struct {
+		name    string
+		created string
+		want    string
+	}{
+		{name: "unset"},
+		{name: "source date epoch", created: chart.CreatedSourceDateEpoch, want: "2023-11-14T22:13:20Z"},
+		{name: "fixed", created: "2024-01-02T03:04:05+01:00", want: "2024-01-02T02:04:05Z"},
+		{name: "build time", created: chart.CreatedBuildTime},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+				RuntimeRepos: []string{"testdata/packages"},
+				Keys:         []string{"testdata/packages/melange.rsa.pub"},
+				Arch:         "x86_64",
+				Created:      tc.created,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			m, err := artifact.Manifest()
+			if err != nil {
+				t.Fatalf("failed to get manifest: %v", err)
+			}
+			got, ok := m.Annotations[chart.CreatedAnnotation]
+			switch {
+			case tc.created == "":
+				if ok {
+					t.Errorf("created annotation = %q, want none", got)
+				}
+			case tc.created == chart.CreatedBuildTime:
+				if ts, err := time.Parse(time.RFC3339, got); err != nil || time.Since(ts) > time.Hour {
+					t.Errorf("created annotation = %q, want the build time", got)
+				}
+			case got != tc.want:
+				t.Errorf("created annotation = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("invalid epoch", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+		if _, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+			RuntimeRepos: []string{"testdata/packages"},
+			Keys:         []string{"testdata/packages/melange.rsa.pub"},
+			Arch:         "x86_64",
+			Created:      chart.CreatedSourceDateEpoch,
+		}); err == nil {
+			t.Error("Build() succeeded with an invalid SOURCE_DATE_EPOCH")
+		}
+	})
+}
+
+func TestValuesSchema(t *testing.T) {
+	build := func(files map[string]chart.File) chart.Chart {
+		t.Helper()
+		artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+			RuntimeRepos: []string{"testdata/packages"},
+			Keys:         []string{"testdata/packages/melange.rsa.pub"},
+			Arch:         "x86_64",
+			Files:        files,
+		})
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	const bundled = `{"type":"object","required":["image"]}`
+	schema, inferred, err := chart.ValuesSchema(build(map[string]chart.File{
+		"values.schema.json": {Content: []byte(bundled)},
+	}))
+	if err != nil {
+		t.Fatalf("ValuesSchema() = %v", err)
+	}
+	if inferred || string(schema) != bundled {
+		t.Errorf("ValuesSchema() = %s, %t, want the bundled schema", schema, inferred)
+	}
+
+	schema, inferred, err = chart.ValuesSchema(build(nil))
+	if err != nil {
+		t.Fatalf("ValuesSchema() = %v", err)
+	}
+	if !inferred {
+		t.Error("ValuesSchema() didn't infer the schema of a chart without one")
+	}
+	var got struct {
+		Properties map[string]any `json:"properties"`
+	}
+	if err := json.Unmarshal(schema, &got); err != nil {
+		t.Fatalf("parsing schema: %v", err)
+	}
+	if _, ok := got.Properties["image"]; !ok {
+		t.Errorf("inferred schema has no image property: %s", schema)
+	}
+}
+
+func TestBuildCopyAnnotations(t *testing.T) {
+	patch := []byte(`[{"op":"add","path":"/annotations/artifacthub.io~1license","value":"Apache-2.0"}]`)
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		want     []string
+		dropped  []string
+	}{
+		{name: "all", want: []string{"thisshould", "artifacthub.io/license"}},
+		{name: "none", patterns: []string{}, dropped: []string{"thisshould", "artifacthub.io/license"}},
+		{name: "allowlist", patterns: []string{"artifacthub.io/*"}, want: []string{"artifacthub.io/license"}, dropped: []string{"thisshould"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+				RuntimeRepos:       []string{"testdata/packages"},
+				Keys:               []string{"testdata/packages/melange.rsa.pub"},
+				Arch:               "x86_64",
+				JSONRFC6902Patches: map[string][]byte{"Chart.yaml": patch},
+				CopyAnnotations:    tc.patterns,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+			m, err := artifact.Manifest()
+			if err != nil {
+				t.Fatalf("failed to get manifest: %v", err)
+			}
+			for _, k := range tc.want {
+				if _, ok := m.Annotations[k]; !ok {
+					t.Errorf("annotation %s not copied", k)
+				}
+			}
+			for _, k := range tc.dropped {
+				if v, ok := m.Annotations[k]; ok {
+					t.Errorf("annotation %s = %q, want it left out", k, v)
+				}
+			}
+			// The chart's own annotations are set whatever is copied.
+			if got := m.Annotations["org.opencontainers.image.title"]; got != "basic" {
+				t.Errorf("title annotation = %q, want %q", got, "basic")
+			}
+		})
+	}
+}
+
+func TestOversizedAnnotations(t *testing.T) {
+	long := strings.Repeat("a", 5000)
+	build := func(max int) chart.Chart {
+		t.Helper()
+		artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+			RuntimeRepos: []string{"testdata/packages"},
+			Keys:         []string{"testdata/packages/melange.rsa.pub"},
+			Arch:         "x86_64",
+			JSONRFC6902Patches: map[string][]byte{
+				"Chart.yaml": []byte(`[{"op":"add","path":"/annotations/example.com~1long","value":"` + long + `"}]`),
+			},
+			MaxAnnotationSize: max,
+		})
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	for _, tc := range []struct {
+		name string
+		max  int
+		want int
+	}{
+		{name: "untruncated", want: len(long)},
+		{name: "truncated", max: 4096, want: 4096},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact := build(tc.max)
+			keys, err := chart.OversizedAnnotations(artifact, 4096)
+			if err != nil {
+				t.Fatalf("OversizedAnnotations() = %v", err)
+			}
+			if want := []string{"example.com/long"}; !slices.Equal(keys, want) {
+				t.Errorf("OversizedAnnotations() = %v, want %v", keys, want)
+			}
+			m, err := artifact.Manifest()
+			if err != nil {
+				t.Fatalf("failed to get manifest: %v", err)
+			}
+			if got := len(m.Annotations["example.com/long"]); got != tc.want {
+				t.Errorf("annotation length = %d, want %d", got, tc.want)
+			}
+			if got := m.Annotations["thisshould"]; got != "bepreserved" {
+				t.Errorf("short annotation = %q, want it untouched", got)
+			}
+		})
+	}
+}
+
+func TestBuildDeprecated(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		Deprecated:   true,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	hc, err := loader.LoadArchive(rc)
+	if err != nil {
+		t.Fatalf("failed to load chart: %v", err)
+	}
+	if !hc.Metadata.Deprecated {
+		t.Error("Chart.yaml is not deprecated")
+	}
+
+	m, err := artifact.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if got := m.Annotations[chart.DeprecatedAnnotation]; got != "true" {
+		t.Errorf("%s annotation = %q, want %q", chart.DeprecatedAnnotation, got, "true")
+	}
+}
+
+func TestBuildDebugDir(t *testing.T) {
+	dir := t.TempDir()
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		JSONRFC6902Patches: map[string][]byte{
+			"Chart.yaml": []byte(`[{"op": "add", "path": "/annotations/patched", "value": "patched-value"}]`),
+		},
+		DebugDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	pkg := artifact.Package()
+	out := filepath.Join(dir, pkg.Name+"-"+pkg.Version+"-"+pkg.Arch)
+
+	apk, err := os.ReadFile(filepath.Join(out, "package.apk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The package was fetched from a local repository.
+	if fetched, err := os.ReadFile(pkg.URL); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(apk, fetched) {
+		t.Errorf("package.apk is %d bytes, want %s's %d", len(apk), pkg.URL, len(fetched))
+	}
+
+	for _, tc := range []struct {
+		dir     string
+		patched bool
+	}{{dir: "original"}, {dir: "chart", patched: true}} {
+		raw, err := os.ReadFile(filepath.Join(out, tc.dir, "Chart.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(raw), "patched-value"); got != tc.patched {
+			t.Errorf("%s/Chart.yaml patched = %t, want %t:\n%s", tc.dir, got, tc.patched, raw)
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(out, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := artifact.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("manifest.json = %s, want %s", got, want)
+	}
+}
+
+func TestBuildManifestFormat(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:   []string{"testdata/packages"},
+		Keys:           []string{"testdata/packages/melange.rsa.pub"},
+		Arch:           "x86_64",
+		ManifestFormat: chart.ManifestDocker,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	digest, err := artifact.Digest()
+	if err != nil {
+		t.Fatalf("failed to get chart digest: %v", err)
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s/basic@%s", strings.TrimPrefix(s.URL, "http://"), digest))
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+	if err := remote.Write(ref, artifact); err != nil {
+		t.Fatalf("failed to push chart to registry: %v", err)
+	}
+
+	desc, err := remote.Get(ref)
+	if err != nil {
+		t.Fatalf("failed to fetch manifest: %v", err)
+	}
+	if desc.MediaType != types.DockerManifestSchema2 {
+		t.Errorf("media type = %s, want %s", desc.MediaType, types.DockerManifestSchema2)
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if m.MediaType != types.DockerManifestSchema2 {
+		t.Errorf("manifest mediaType = %s, want %s", m.MediaType, types.DockerManifestSchema2)
+	}
+	if m.Config.MediaType != helmregistry.ConfigMediaType {
+		t.Errorf("config media type = %s, want %s", m.Config.MediaType, helmregistry.ConfigMediaType)
+	}
+}
+
+func TestBuildMediaTypes(t *testing.T) {
+	const (
+		configType = "application/vnd.example.helm.config.v1+json"
+		chartType  = "application/vnd.example.helm.chart.v1.tar+gzip"
+	)
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:    []string{"testdata/packages"},
+		Keys:            []string{"testdata/packages/melange.rsa.pub"},
+		Arch:            "x86_64",
+		ConfigMediaType: configType,
+		ChartMediaType:  chartType,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+	m, err := artifact.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if m.Config.MediaType != configType {
+		t.Errorf("config media type = %s, want %s", m.Config.MediaType, configType)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != chartType {
+		t.Errorf("layers = %+v, want one of media type %s", m.Layers, chartType)
+	}
+
+	// Extra layers can't take the media types the chart has.
+	_, err = chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos:   []string{"testdata/packages"},
+		Keys:           []string{"testdata/packages/melange.rsa.pub"},
+		Arch:           "x86_64",
+		ChartMediaType: chartType,
+		Layers:         []chart.Layer{{MediaType: chartType, Content: []byte("{}")}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "which the chart is published with") {
+		t.Errorf("Build() = %v, want a media type error", err)
+	}
+}
+
+func TestBuildValuesDocs(t *testing.T) {
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		JSONRFC6902Patches: map[string][]byte{
+			"values.yaml": []byte(`[{"op":"replace","path":"/image/tag","value":"patched"}]`),
+		},
+		Files: map[string]chart.File{
+			"README.md": {Content: []byte("# ${name}\n")},
+		},
+		ValuesDocs: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("failed to read layer: %v", err)
+	}
+	defer rc.Close()
+	hc, err := loader.LoadArchive(rc)
+	if err != nil {
+		t.Fatalf("failed to load chart: %v", err)
+	}
+
+	const want = "# basic\n\n## Values\n\n" +
+		"| Key | Type | Default | Description |\n" +
+		"|-----|------|---------|-------------|\n" +
+		"| image.repository | string | `\"foobear\"` |  |\n" +
+		"| image.tag | string | `\"patched\"` |  |\n"
+	for _, f := range hc.Files {
+		if f.Name == "README.md" {
+			if got := string(f.Data); got != want {
+				t.Errorf("README.md =\n%s\nwant:\n%s", got, want)
+			}
+			return
+		}
+	}
+	t.Error("chart has no README.md")
+}
+
+func TestUnitTest(t *testing.T) {
+	bundled := `
+suite: bundled
+templates: [deployment.yaml]
+tests:
+- it: names the deployment after the release
+  release:
+    name: web
+  asserts:
+  - isKind:
+      of: Deployment
+  - equal:
+      path: metadata.name
+      value: web
+  - hasDocuments:
+      count: 1
+`
+	artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+		RuntimeRepos: []string{"testdata/packages"},
+		Keys:         []string{"testdata/packages/melange.rsa.pub"},
+		Arch:         "x86_64",
+		Files: map[string]chart.File{
+			"tests/deployment_test.yaml": {Content: []byte(bundled)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build chart: %v", err)
+	}
+
+	extra := `
+suite: image
+tests:
+- it: uses the image tag
+  set:
+    image.tag: v2
+  asserts:
+  - equal:
+      path: spec.template.spec.containers[0].image
+      value: foobear:v2
+  - matchRegex:
+      path: spec.template.spec.containers[0].name
+      pattern: ^basic$
+  - notExists:
+      path: spec.replicas
+  - isNotNull:
+      path: spec.template.spec.containers
+  - lengthEqual:
+      path: spec.template.spec.containers
+      count: 1
+- it: is wrong
+  asserts:
+  - contains:
+      path: spec.template.spec.containers
+      content:
+        name: other
+  - equal:
+      path: kind
+      value: Pod
+- it: is negated
+  asserts:
+  - isKind:
+      of: Deployment
+    not: true
+`
+	res, err := chart.UnitTest(artifact, map[string][]byte{"image_test.yaml": []byte(extra)})
+	if err != nil {
+		t.Fatalf("UnitTest() = %v", err)
+	}
+	if res.Suites != 2 || res.Tests != 4 {
+		t.Errorf("ran %d suites and %d tests, want 2 and 4", res.Suites, res.Tests)
+	}
+	var got []string
+	for _, f := range res.Failures {
+		got = append(got, f.String())
+	}
+	want := []string{
+		`image: is wrong: assertion 1 (contains): deployment.yaml: expected spec.template.spec.containers to contain {"name":"other"}, got [{"image":"foobear:foobar","name":"basic"}]`,
+		`image: is negated: assertion 1 (isKind): deployment.yaml: expected kind not to be Deployment`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("failures (-want +got):\n%s", diff)
+	}
+
+	if _, err := chart.UnitTest(artifact, map[string][]byte{"tests/deployment_test.yaml": []byte(bundled)}); err == nil {
+		t.Error("UnitTest() with a suite clashing with a bundled one succeeded")
+	}
+	if _, err := chart.UnitTest(artifact, map[string][]byte{"bad_test.yaml": []byte("tests:\n- it: x\n  asserts:\n  - bogus: {}\n")}); err == nil || !strings.Contains(err.Error(), "unsupported assertion bogus") {
+		t.Errorf("UnitTest() with an unknown assertion = %v", err)
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	build := func(app, storage string) chart.Chart {
+		t.Helper()
+		manifests := fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  selector:
+    matchLabels:
+      app: %[1]s
+  template:
+    metadata:
+      labels:
+        app: %[1]s
+    spec:
+      containers:
+      - name: app
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  selector:
+    matchLabels:
+      app: db
+  serviceName: db
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      resources:
+        requests:
+          storage: %[2]s
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+immutable: true
+data:
+  app: %[1]s
+`, app, storage)
+		artifact, err := chart.Build(t.Context(), "chart-basic", &chart.BuildConfig{
+			RuntimeRepos: []string{"testdata/packages"},
+			Keys:         []string{"testdata/packages/melange.rsa.pub"},
+			Arch:         "x86_64",
+			Files: map[string]chart.File{
+				"templates/deployment.yaml": {Content: []byte(manifests)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	prev := build("web", "1Gi")
+	problems, err := chart.CheckUpgrade(prev, build("web", "1Gi"), nil)
+	if err != nil {
+		t.Fatalf("CheckUpgrade() = %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("CheckUpgrade() of the same chart = %v", problems)
+	}
+
+	problems, err = chart.CheckUpgrade(prev, build("frontend", "2Gi"), map[string]any{"image": map[string]any{"tag": "v2"}})
+	if err != nil {
+		t.Fatalf("CheckUpgrade() = %v", err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		"ConfigMap/settings: data changed (basic/templates/deployment.yaml)",
+		"Deployment/release: spec.selector changed (basic/templates/deployment.yaml)",
+		"StatefulSet/db: spec.volumeClaimTemplates changed (basic/templates/deployment.yaml)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckUpgrade() (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	build := func(config *chart.BuildConfig) chart.Chart {
+		t.Helper()
+		config.RuntimeRepos = []string{"testdata/packages"}
+		config.Keys = []string{"testdata/packages/melange.rsa.pub"}
+		config.Arch = "x86_64"
+		artifact, err := chart.Build(t.Context(), "chart-basic", config)
+		if err != nil {
+			t.Fatalf("failed to build chart: %v", err)
+		}
+		return artifact
+	}
+
+	prev := build(&chart.BuildConfig{})
+	got, err := chart.Diff(prev, build(&chart.BuildConfig{}))
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+	if diff := cmp.Diff(&chart.FileDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}, got); diff != "" {
+		t.Errorf("Diff() of the same chart (-want +got):\n%s", diff)
+	}
+
+	got, err = chart.Diff(prev, build(&chart.BuildConfig{
+		JSONRFC6902Patches: map[string][]byte{
+			"values.yaml": []byte(`[{"op":"replace","path":"/image/tag","value":"v2"}]`),
+		},
+		Files: map[string]chart.File{"README.md": {Content: []byte("# basic\n")}},
+	}))
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+	want := &chart.FileDiff{Added: []string{"README.md"}, Removed: []string{}, Changed: []string{"values.yaml"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Diff() (-want +got):\n%s", diff)
+	}
+}
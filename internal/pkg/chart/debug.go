@@ -0,0 +1,117 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeDebugInputs writes what building cd starts from to a directory under
+// DebugDir named for its package, emptied of any earlier build's, and
+// returns the directory: the package as fetched, as package.apk, and the
+// chart as it is in the package, in original/.
+func (c *BuildConfig) writeDebugInputs(ctx context.Context, cd *chartData) (string, error) {
+	// An absolute path lets Go write past Windows' path length limit.
+	root, err := filepath.Abs(c.DebugDir)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, fmt.Sprintf("%s-%s-%s", cd.pkg.Name, cd.pkg.Version, cd.pkg.Arch))
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "package.apk"), cd.apk, 0o644); err != nil {
+		return "", err
+	}
+
+	// cd.data is read from a copy, as chartify drains it.
+	gr, err := gzip.NewReader(bytes.NewReader(cd.data.Bytes()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+	return dir, extractTar(ctx, gr, filepath.Join(dir, "original"), cd.dir, cd.links)
+}
+
+// writeDebugOutputs writes what c was built into to dir: its chart, the
+// chart named name in its content layer, in chart/, and its manifest, as
+// pushed, to manifest.json.
+func writeDebugOutputs(ctx context.Context, dir string, c *chart, name string) error {
+	rc, err := c.content.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := extractTar(ctx, rc, filepath.Join(dir, "chart"), name, nil); err != nil {
+		return err
+	}
+	raw, err := c.RawManifest()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), raw, 0o644)
+}
+
+// extractTar writes the directories and regular files under prefix in the
+// tar stream r to dst, with links written as the files in links they
+// resolve to. Anything else is skipped.
+func extractTar(ctx context.Context, r io.Reader, dst, prefix string, links map[string]linkedFile) error {
+	tr := tar.NewReader(ctxReader{ctx: ctx, r: r})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar: %w", err)
+		}
+		rel, ok := strings.CutPrefix(hdr.Name, prefix+"/")
+		if !ok || rel == "" {
+			continue
+		}
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("%s isn't within %s", hdr.Name, prefix)
+		}
+		var content io.Reader = tr
+		if l, ok := links[hdr.Name]; ok {
+			hdr, content = l.header(hdr.Name), bytes.NewReader(l.content)
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, content); err != nil {
+				return fmt.Errorf("writing %s: %w", rel, err)
+			}
+		}
+	}
+}
+
+// writeFile writes the content of r to a new file at path.
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
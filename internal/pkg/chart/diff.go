@@ -0,0 +1,109 @@
+package chart
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// FileDiff summarizes how the files of one chart differ from another's, by
+// path relative to the chart root.
+type FileDiff struct {
+	Added, Removed, Changed []string
+}
+
+// Diff compares the files in next's content layer to those in prev's.
+func Diff(prev, next Chart) (*FileDiff, error) {
+	before, err := fileDigests(prev)
+	if err != nil {
+		return nil, fmt.Errorf("reading previous chart: %w", err)
+	}
+	after, err := fileDigests(next)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &FileDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for _, p := range slices.Sorted(maps.Keys(after)) {
+		old, ok := before[p]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, p)
+		case old != after[p]:
+			d.Changed = append(d.Changed, p)
+		}
+	}
+	for _, p := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[p]; !ok {
+			d.Removed = append(d.Removed, p)
+		}
+	}
+	return d, nil
+}
+
+// fileDigests returns the SHA-256 of each regular file in c's content layer,
+// by path relative to the chart root.
+func fileDigests(c Chart) (map[string][sha256.Size]byte, error) {
+	digests := map[string][sha256.Size]byte{}
+	err := walkFiles(c, func(rel string, _ *tar.Header, r io.Reader) error {
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		digests[rel] = [sha256.Size]byte(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// walkFiles calls fn with each regular file in c's content layer, by path
+// relative to the chart root, in the order they are in the layer.
+func walkFiles(c Chart, fn func(rel string, hdr *tar.Header, r io.Reader) error) error {
+	ls, err := c.Layers()
+	if err != nil {
+		return err
+	}
+	if len(ls) == 0 {
+		return fmt.Errorf("chart has no content layer")
+	}
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	gr, err := gzip.NewReader(rc)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Charts are archived under a directory named after them.
+		_, rel, ok := strings.Cut(hdr.Name, "/")
+		if !ok {
+			continue
+		}
+		if err := fn(rel, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
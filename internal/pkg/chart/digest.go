@@ -0,0 +1,144 @@
+package chart
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// The algorithms manifests can be addressed by. go-containerregistry only
+// computes and checks sha256 digests, so sha512 ones are handled here. Blobs
+// are always addressed by sha256.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+// DigestAlgorithms returns the algorithms manifests can be addressed by.
+func DigestAlgorithms() []string {
+	return []string{SHA256, SHA512}
+}
+
+// digestRef is a reference by a digest other than sha256. Unlike for a
+// name.Digest, the registry client doesn't check the manifests it fetches by
+// one against the digest, which it couldn't, so Pull does.
+type digestRef struct {
+	name.Repository
+	digest string
+}
+
+func (r digestRef) Context() name.Repository { return r.Repository }
+func (r digestRef) Identifier() string       { return r.digest }
+func (r digestRef) Name() string             { return r.Repository.Name() + "@" + r.digest }
+func (r digestRef) String() string           { return r.Name() }
+
+// DigestRef returns the reference to the manifest in repo with digest, by
+// either algorithm.
+func DigestRef(repo name.Repository, digest string) name.Reference {
+	if strings.HasPrefix(digest, SHA256+":") {
+		return repo.Digest(digest)
+	}
+	return digestRef{Repository: repo, digest: digest}
+}
+
+// ParseDigest parses ref, <repo>@<algorithm>:<hex>, as a reference by digest
+// by either algorithm. name.NewDigest only accepts sha256.
+func ParseDigest(ref string, opts ...name.Option) (name.Reference, error) {
+	base, digest, ok := strings.Cut(ref, "@")
+	if !ok || !strings.HasPrefix(digest, SHA512+":") {
+		return name.NewDigest(ref, opts...)
+	}
+	if err := checkDigest(digest); err != nil {
+		return nil, err
+	}
+	if t, err := name.NewTag(base, opts...); err == nil {
+		base = t.Repository.Name()
+	}
+	repo, err := name.NewRepository(base, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return DigestRef(repo, digest), nil
+}
+
+// ParseReference parses ref as a reference by tag, or by digest by either
+// algorithm. name.ParseReference only accepts sha256 digests.
+func ParseReference(ref string, opts ...name.Option) (name.Reference, error) {
+	if t, err := name.NewTag(ref, opts...); err == nil {
+		return t, nil
+	}
+	return ParseDigest(ref, opts...)
+}
+
+// checkDigest checks that digest is <algorithm>:<hex>, with as many
+// lowercase hex digits as algorithm's sums have.
+func checkDigest(digest string) error {
+	algorithm, sum, _ := strings.Cut(digest, ":")
+	var size int
+	switch algorithm {
+	case SHA256:
+		size = sha256.Size
+	case SHA512:
+		size = sha512.Size
+	default:
+		return fmt.Errorf("unsupported digest algorithm %q, only %s", algorithm, strings.Join(DigestAlgorithms(), " and "))
+	}
+	if len(sum) != hex.EncodedLen(size) || strings.Trim(sum, "0123456789abcdef") != "" {
+		return fmt.Errorf("%q is not a %s digest, which is %d lowercase hex digits", digest, algorithm, hex.EncodedLen(size))
+	}
+	return nil
+}
+
+// ManifestDigest returns the digest of raw, a manifest, by algorithm.
+func ManifestDigest(raw []byte, algorithm string) (string, error) {
+	switch algorithm {
+	case SHA256:
+		sum := sha256.Sum256(raw)
+		return SHA256 + ":" + hex.EncodeToString(sum[:]), nil
+	case SHA512:
+		sum := sha512.Sum512(raw)
+		return SHA512 + ":" + hex.EncodeToString(sum[:]), nil
+	}
+	return "", fmt.Errorf("unsupported digest algorithm %q, only %s", algorithm, strings.Join(DigestAlgorithms(), " and "))
+}
+
+// CheckManifest checks that raw, the manifest fetched by ref, has the digest
+// ref names, when the registry client couldn't: for references by sha512
+// digest, as from DigestRef.
+func CheckManifest(ref name.Reference, raw []byte) error {
+	r, ok := ref.(digestRef)
+	if !ok {
+		return nil
+	}
+	algorithm, _, _ := strings.Cut(r.digest, ":")
+	got, err := ManifestDigest(raw, algorithm)
+	if err != nil {
+		return err
+	}
+	if got != r.digest {
+		return fmt.Errorf("manifest digest %s does not match requested digest %s for %s", got, r.digest, ref)
+	}
+	return nil
+}
+
+// SHA256Digest returns the reference by sha256 digest to the manifest ref
+// names, as signatures, attestations and referrers are found by. A reference
+// by sha512 digest is resolved by fetching and checking the manifest.
+func SHA256Digest(ref name.Reference, opts ...remote.Option) (name.Digest, error) {
+	if d, ok := ref.(name.Digest); ok {
+		return d, nil
+	}
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	if err := CheckManifest(ref, desc.Manifest); err != nil {
+		return name.Digest{}, err
+	}
+	return ref.Context().Digest(desc.Digest.String()), nil
+}
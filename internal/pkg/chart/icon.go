@@ -0,0 +1,26 @@
+package chart
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IconDataURI returns the data URI of the image file at p, for
+// BuildConfig.Icon, typed by its extension or, failing that, its content.
+func IconDataURI(p string) (string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	// Sniffing can't tell SVG from other XML, so trust the extension first.
+	typ := mime.TypeByExtension(filepath.Ext(p))
+	if typ == "" {
+		typ = http.DetectContentType(b)
+	}
+	typ, _, _ = strings.Cut(typ, ";")
+	return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(b), nil
+}
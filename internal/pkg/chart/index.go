@@ -0,0 +1,117 @@
+package chart
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/scratch"
+)
+
+// IndexEntry is a package listed in an APKINDEX.
+type IndexEntry struct {
+	Name         string
+	Version      string
+	Arch         string
+	Description  string
+	Dependencies []string
+	// Checksum is the APKINDEX checksum of the package, as in Package.
+	Checksum string
+	// Repository is the repository whose index lists the package.
+	Repository string
+}
+
+// ListIndex returns every package in the indexes of the repositories
+// configured in config for its arch, sorted by name and then version.
+func ListIndex(ctx context.Context, config *BuildConfig) ([]IndexEntry, error) {
+	config.defaultArch()
+
+	// The world is irrelevant to reading indexes, but apko requires one.
+	tmp := scratch.New(ctx, "")
+	defer tmp.Close()
+	bc, err := config.bc(ctx, "", tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := bc.APK().GetRepositoryIndexes(ctx, config.AllowUnsigned)
+	if err != nil {
+		return nil, fmt.Errorf("getting repository indexes: %w", err)
+	}
+
+	var entries []IndexEntry
+	for _, idx := range indexes {
+		for _, pkg := range idx.Packages() {
+			entries = append(entries, IndexEntry{
+				Name:         pkg.Name,
+				Version:      pkg.Version,
+				Arch:         pkg.Arch,
+				Description:  pkg.Description,
+				Dependencies: pkg.Dependencies,
+				Checksum:     pkg.ChecksumString(),
+				Repository:   idx.Source(),
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		vi, erri := apk.ParseVersion(entries[i].Version)
+		vj, errj := apk.ParseVersion(entries[j].Version)
+		if erri != nil || errj != nil {
+			return entries[i].Version < entries[j].Version
+		}
+		return apk.CompareVersions(vi, vj) < 0
+	})
+
+	return entries, nil
+}
+
+// ResolveWorld resolves world, a list of APK world entries like
+// "name=version", together as apko would install them, and returns the
+// package resolved for each entry, in order. Resolving them at once keeps
+// related packages consistent, e.g. at versions depending on one another.
+func ResolveWorld(ctx context.Context, config *BuildConfig, world []string) ([]IndexEntry, error) {
+	config.defaultArch()
+
+	tmp := scratch.New(ctx, "")
+	defer tmp.Close()
+	bc, err := config.bc(ctx, "", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.APK().SetWorld(ctx, world); err != nil {
+		return nil, fmt.Errorf("setting world: %w", err)
+	}
+	pkgs, conflicts, err := bc.APK().ResolveWorld(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve packages: %w for arch %q", err, config.Arch)
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("package conflicts detected: %v", conflicts)
+	}
+
+	entries := make([]IndexEntry, 0, len(world))
+	for _, w := range world {
+		name := apk.ResolvePackageNameVersionPin(w).Name
+		i := slices.IndexFunc(pkgs, func(p *apk.RepositoryPackage) bool { return p.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("package %q not found in resolved packages", name)
+		}
+		pkg := pkgs[i]
+		entries = append(entries, IndexEntry{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Arch:         pkg.Arch,
+			Description:  pkg.Description,
+			Dependencies: pkg.Dependencies,
+			Checksum:     pkg.ChecksumString(),
+			Repository:   pkg.Repository().IndexURI(),
+		})
+	}
+	return entries, nil
+}
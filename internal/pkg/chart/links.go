@@ -0,0 +1,121 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxLinkHops bounds how many links are followed to resolve one, so loops
+// fail rather than spin.
+const maxLinkHops = 40
+
+// linkedFile is the regular file a link in a package resolves to.
+type linkedFile struct {
+	hdr     *tar.Header
+	content []byte
+}
+
+// header returns the header of the file as a regular file named name.
+func (l linkedFile) header(name string) *tar.Header {
+	hdr := *l.hdr
+	hdr.Name = name
+	return &hdr
+}
+
+// packagePath returns name as a path from the package root, as symlink
+// targets are absolute from where the package is installed.
+func packagePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// resolveLinks returns the files the symlinks and hardlinks under dir
+// resolve to, by the link's name, reading their content from data, the
+// package's gzipped data section. entries are the section's headers by
+// packagePath. Charts are built with links replaced by the files they
+// resolve to, since Helm reads links as empty files.
+func resolveLinks(ctx context.Context, data []byte, entries map[string]*tar.Header, dir string) (map[string]linkedFile, error) {
+	targets := map[string]string{}
+	wanted := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		hdr := entries[name]
+		if !strings.HasPrefix(hdr.Name, dir+"/") || (hdr.Typeflag != tar.TypeSymlink && hdr.Typeflag != tar.TypeLink) {
+			continue
+		}
+		target, err := resolveLink(entries, name)
+		if err != nil {
+			return nil, fmt.Errorf("resolving link %s: %w", hdr.Name, err)
+		}
+		targets[hdr.Name] = target
+		wanted[target] = true
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	contents := map[string][]byte{}
+	tr := tar.NewReader(ctxReader{ctx: ctx, r: gr})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar: %w", err)
+		}
+		name := packagePath(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !wanted[name] {
+			continue
+		}
+		if contents[name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+	}
+
+	links := make(map[string]linkedFile, len(targets))
+	for link, target := range targets {
+		links[link] = linkedFile{hdr: entries[target], content: contents[target]}
+	}
+	return links, nil
+}
+
+// resolveLink follows the link at name, a packagePath, through any links
+// it leads to, and returns the packagePath of the regular file it ends at.
+func resolveLink(entries map[string]*tar.Header, name string) (string, error) {
+	for range maxLinkHops {
+		hdr, ok := entries[name]
+		if !ok {
+			return "", fmt.Errorf("%s isn't in the package", name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			return name, nil
+		case tar.TypeSymlink:
+			target := hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			name = packagePath(target)
+		case tar.TypeLink:
+			// Hardlink targets are paths in the archive.
+			name = packagePath(hdr.Linkname)
+		default:
+			return "", fmt.Errorf("%s isn't a regular file, and only links to files are supported", name)
+		}
+	}
+	return "", errors.New("too many levels of links")
+}
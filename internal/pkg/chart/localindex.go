@@ -0,0 +1,171 @@
+package chart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/scratch"
+)
+
+// localRepos returns repos with each local repository lacking an APKINDEX
+// for arch replaced by one with a generated index, written under tmp. A
+// local repository is a directory, possibly as a file:// URL, of .apk files
+// either directly or under arch, or a glob of .apk files. Generated indexes
+// are unsigned, so they are only made when signatures aren't verified, with
+// allowUnsigned. Generated repositories link to the packages rather than
+// copy them, and are made for every operation, so packages added since are
+// found.
+func localRepos(ctx context.Context, repos []string, arch string, allowUnsigned bool, tmp *scratch.Dir) ([]string, error) {
+	var out []string
+	for _, repo := range repos {
+		files, err := localPackages(repo, arch)
+		if err != nil {
+			return nil, err
+		}
+		if files == nil {
+			out = append(out, repo)
+			continue
+		}
+		if !allowUnsigned {
+			return nil, fmt.Errorf("%s has no APKINDEX.tar.gz for %s: index and sign it, as with melange index --signing-key, or allow unsigned packages to have it indexed for each build", repo, arch)
+		}
+		dir, err := writeLocalIndex(ctx, tmp, repo, arch, files)
+		if err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", repo, err)
+		}
+		out = append(out, dir)
+	}
+	return out, nil
+}
+
+// localPackages returns the .apk files in repo for arch, or nil if repo
+// isn't local or already has an index.
+func localPackages(repo, arch string) ([]string, error) {
+	// Pinned repositories, like "@local /path", are left to apko.
+	if strings.HasPrefix(repo, "@") || strings.HasPrefix(repo, "http://") || strings.HasPrefix(repo, "https://") {
+		return nil, nil
+	}
+	repo = localPath(repo)
+
+	var patterns []string
+	if strings.ContainsAny(repo, "*?[") {
+		patterns = []string{repo}
+	} else {
+		if _, err := os.Stat(filepath.Join(repo, arch, "APKINDEX.tar.gz")); !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		patterns = []string{filepath.Join(repo, arch, "*.apk"), filepath.Join(repo, "*.apk")}
+	}
+
+	var files []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("matching %s: %w", p, err)
+		}
+		for _, m := range matches {
+			if strings.HasSuffix(m, ".apk") {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// localPath returns the path repo, a path or file:// URL, names on this OS.
+// URLs of Windows paths have a slash before the drive, as in
+// file:///C:/packages.
+func localPath(repo string) string {
+	p, ok := strings.CutPrefix(repo, "file://")
+	if ok && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// writeLocalIndex writes a repository of files for arch, with an unsigned
+// index and links to the packages, to a new directory under tmp, and returns
+// the directory.
+func writeLocalIndex(ctx context.Context, tmp *scratch.Dir, repo, arch string, files []string) (string, error) {
+	var pkgs []*apk.Package
+	links := map[string]string{}
+	for _, f := range files {
+		pkg, err := parseLocalPackage(ctx, f)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", f, err)
+		}
+		if pkg.Arch != arch && pkg.Arch != "noarch" {
+			continue
+		}
+		if links[pkg.Filename()], err = filepath.Abs(f); err != nil {
+			return "", err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	archive, err := apk.ArchiveFromIndex(&apk.APKIndex{Description: repo, Packages: pkgs})
+	if err != nil {
+		return "", err
+	}
+	index, err := io.ReadAll(archive)
+	if err != nil {
+		return "", err
+	}
+
+	parent, err := tmp.Path()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(parent, "index-")
+	if err != nil {
+		return "", err
+	}
+	archDir := filepath.Join(dir, arch)
+	if err := os.Mkdir(archDir, 0o700); err != nil {
+		return "", err
+	}
+	for name, target := range links {
+		if err := linkPackage(target, filepath.Join(archDir, name)); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(archDir, "APKINDEX.tar.gz"), index, 0o600); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// linkPackage links link to the package at target: by symlink, or, where
+// those need privileges as on Windows, by hardlink, or, across volumes, by
+// copying it.
+func linkPackage(target, link string) error {
+	if os.Symlink(target, link) == nil || os.Link(target, link) == nil {
+		return nil
+	}
+	src, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeFile(link, src)
+}
+
+// parseLocalPackage returns the index entry of the .apk file f.
+func parseLocalPackage(ctx context.Context, f string) (*apk.Package, error) {
+	file, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return apk.ParsePackage(ctx, file, uint64(fi.Size()))
+}
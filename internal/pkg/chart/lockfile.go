@@ -0,0 +1,174 @@
+package chart
+
+import (
+	"crypto/sha1" //nolint:gosec // APK control checksums are SHA-1 by definition.
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkotypes "chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// lockedPackage is a package pinned by a lockfile. It is fetched directly
+// from its URL rather than located through an APKINDEX.
+type lockedPackage struct {
+	name string
+	url  string
+}
+
+func (p lockedPackage) URL() string         { return p.url }
+func (p lockedPackage) PackageName() string { return p.name }
+
+// fromLock looks name up in the configured lockfile for the configured arch,
+// and checks that the locked version satisfies any version constraint.
+func (c *BuildConfig) fromLock(name string) (lockedPackage, *Package, error) {
+	l, err := lock.FromFile(c.Lockfile)
+	if err != nil {
+		return lockedPackage{}, nil, fmt.Errorf("reading lockfile %s: %w", c.Lockfile, err)
+	}
+
+	arch := apkotypes.ParseArchitecture(c.Arch).ToAPK()
+	for _, p := range l.Contents.Packages {
+		if p.Name != name || p.Architecture != arch {
+			continue
+		}
+
+		if p.Checksum == "" {
+			return lockedPackage{}, nil, fmt.Errorf("lockfile %s has no checksum for %s", c.Lockfile, name)
+		}
+
+		v, err := apk.ParseVersion(p.Version)
+		if err != nil {
+			return lockedPackage{}, nil, fmt.Errorf("parsing locked version %q of %s: %w", p.Version, name, err)
+		}
+		ok, err := apk.ResolvePackageNameVersionPin(c.world(name)).SatisfiedBy(v)
+		if err != nil {
+			return lockedPackage{}, nil, fmt.Errorf("checking locked version of %s: %w", name, err)
+		}
+		if !ok {
+			return lockedPackage{}, nil, fmt.Errorf("lockfile %s pins %s-%s, which does not satisfy version %q", c.Lockfile, name, p.Version, c.Version)
+		}
+
+		return lockedPackage{name: p.Name, url: p.URL}, &Package{
+			Name:       p.Name,
+			Version:    p.Version,
+			Arch:       p.Architecture,
+			Checksum:   p.Checksum,
+			URL:        p.URL,
+			Repository: p.URL[:max(strings.LastIndex(p.URL, "/"), 0)],
+		}, nil
+	}
+
+	return lockedPackage{}, nil, fmt.Errorf("package %q for arch %q not found in lockfile %s", name, arch, c.Lockfile)
+}
+
+// Lock is an apko lock file extended with the chart build inputs that don't
+// affect package resolution. It remains readable as a plain apko lock, so it
+// can be fed back through BuildConfig.Lockfile.
+type Lock struct {
+	lock.Lock
+	// Patches maps each patched file to the hex SHA-256 of its JSON patch.
+	Patches map[string]string `json:"patches,omitempty"`
+}
+
+// NewLock records the package a chart was built from, along with the
+// keyrings and patches in config. A package from one of config.BuildRepos
+// has its repository listed under the lock's build repositories, as apko
+// does, rather than its repositories.
+func NewLock(pkg *Package, config *BuildConfig) Lock {
+	// APK repositories lay packages out as <repo>/<arch>/<file>.
+	archDir := parentURL(pkg.URL)
+	repo := lock.LockRepo{
+		Name:         parentURL(archDir),
+		URL:          archDir + "/APKINDEX.tar.gz",
+		Architecture: pkg.Arch,
+	}
+
+	l := Lock{
+		Lock: lock.Lock{
+			Version: "v1",
+			Contents: lock.LockContents{
+				Keyrings:                []lock.LockKeyring{},
+				Repositories:            []lock.LockRepo{repo},
+				BuildRepositories:       []lock.LockRepo{},
+				RuntimeOnlyRepositories: []lock.LockRepo{},
+				Packages: []lock.LockPkg{{
+					Name:         pkg.Name,
+					URL:          pkg.URL,
+					Version:      pkg.Version,
+					Architecture: pkg.Arch,
+					Checksum:     pkg.Checksum,
+				}},
+			},
+		},
+	}
+
+	if slices.ContainsFunc(config.BuildRepos, func(r string) bool { return repoURL(r) == repoURL(repo.Name) }) {
+		l.Contents.Repositories, l.Contents.BuildRepositories = l.Contents.BuildRepositories, l.Contents.Repositories
+	}
+
+	for _, k := range config.Keys {
+		l.Contents.Keyrings = append(l.Contents.Keyrings, lock.LockKeyring{Name: path.Base(k), URL: k})
+	}
+
+	if len(config.JSONRFC6902Patches) > 0 {
+		l.Patches = make(map[string]string, len(config.JSONRFC6902Patches))
+		for file, patch := range config.JSONRFC6902Patches {
+			sum := sha256.Sum256(patch)
+			l.Patches[file] = hex.EncodeToString(sum[:])
+		}
+	}
+
+	return l
+}
+
+// SaveToFile writes the lock as indented JSON. It shadows lock.Lock's method,
+// which would drop the chart-specific fields.
+func (l Lock) SaveToFile(lockFile string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling lockfile: %w", err)
+	}
+	return os.WriteFile(lockFile, append(b, '\n'), 0o644)
+}
+
+// repoURL returns the URL of repo, a configured repository, without the
+// "@tag" pinned repositories are listed with or a trailing slash.
+func repoURL(repo string) string {
+	fields := strings.Fields(repo)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(fields[len(fields)-1], "/")
+}
+
+// parentURL trims the last path element from u. Unlike path.Dir it leaves the
+// scheme's "//" alone.
+func parentURL(u string) string {
+	if i := strings.LastIndex(u, "/"); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+// verifyChecksum checks that the APK control section read from control hashes
+// to want, an APK-style "Q1"-prefixed base64 SHA-1.
+func verifyChecksum(control io.Reader, want string) error {
+	h := sha1.New() //nolint:gosec
+	if _, err := io.Copy(h, control); err != nil {
+		return fmt.Errorf("hashing control section: %w", err)
+	}
+	if got := "Q1" + base64.StdEncoding.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+	return nil
+}
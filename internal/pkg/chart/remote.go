@@ -0,0 +1,387 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+)
+
+// remoteChart is a Chart backed by an artifact already in a registry.
+type remoteChart struct {
+	v1.Image
+}
+
+// Pull fetches the chart at ref from a registry. Only the manifest is fetched
+// eagerly; the config blob is fetched when Metadata is called. References by
+// sha512 digest, as from DigestRef, are checked against the manifest too.
+func Pull(ref name.Reference, opts ...remote.Option) (Chart, error) {
+	img, err := remote.Image(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckManifest(ref, raw); err != nil {
+		return nil, err
+	}
+	return &remoteChart{Image: img}, nil
+}
+
+func (c *remoteChart) Metadata() (*helmchart.Metadata, error) {
+	raw, err := c.RawConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("fetching chart config: %w", err)
+	}
+
+	var md helmchart.Metadata
+	if err := json.Unmarshal(raw, &md); err != nil {
+		return nil, fmt.Errorf("parsing chart config: %w", err)
+	}
+	return &md, nil
+}
+
+// mountableChart is a Chart whose blobs are mounted from another repository
+// when pushed, rather than uploaded.
+type mountableChart struct {
+	Chart
+	from name.Repository
+}
+
+// MountFrom returns c with its blobs marked as available in repo from. When c
+// is written to another repository in the same registry, the registry is asked
+// to mount each blob from there, and only blobs missing from both are
+// uploaded. Pushes to other registries upload as usual.
+func MountFrom(c Chart, from name.Repository) Chart {
+	return &mountableChart{Chart: c, from: from}
+}
+
+func (c *mountableChart) Layers() ([]v1.Layer, error) {
+	ls, err := c.Chart.Layers()
+	if err != nil {
+		return nil, err
+	}
+	mls := make([]v1.Layer, 0, len(ls))
+	for _, l := range ls {
+		ml, err := c.mountable(l)
+		if err != nil {
+			return nil, err
+		}
+		mls = append(mls, ml)
+	}
+	return mls, nil
+}
+
+func (c *mountableChart) ConfigLayer() (v1.Layer, error) {
+	l, err := partial.ConfigLayer(c.Chart)
+	if err != nil {
+		return nil, err
+	}
+	return c.mountable(l)
+}
+
+func (c *mountableChart) mountable(l v1.Layer) (v1.Layer, error) {
+	h, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return &remote.MountableLayer{Layer: l, Reference: c.from.Digest(h.String())}, nil
+}
+
+// cosignSuffixes are the tag suffixes cosign attaches signatures,
+// attestations and SBOMs under, on registries without the referrers API.
+var cosignSuffixes = []string{"sig", "att", "sbom"}
+
+// Copy copies the artifact at src to the same digest in dst, along with
+// everything attached to it: referrers, found through the OCI referrers API
+// or its fallback tag, and cosign's sha256-<hex>.sig, .att and .sbom tags.
+// Attachments are copied recursively, so a signature on an attached SBOM
+// comes along too. It returns the digests of the attachments copied.
+func Copy(src name.Digest, dst name.Repository, opts ...remote.Option) ([]v1.Hash, error) {
+	c := &copier{dst: dst, opts: opts, seen: map[string]bool{}}
+	if err := c.copy(src); err != nil {
+		return nil, err
+	}
+	return c.copied[1:], nil
+}
+
+type copier struct {
+	dst    name.Repository
+	opts   []remote.Option
+	seen   map[string]bool
+	copied []v1.Hash
+}
+
+// copy copies src, by digest, then whatever is attached to it.
+func (c *copier) copy(src name.Digest) error {
+	if c.seen[src.DigestStr()] {
+		return nil
+	}
+	c.seen[src.DigestStr()] = true
+
+	desc, err := remote.Get(src, c.opts...)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", src, err)
+	}
+	if err := c.write(c.dst.Digest(src.DigestStr()), desc); err != nil {
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+	c.copied = append(c.copied, desc.Digest)
+
+	if err := c.copyReferrers(src); err != nil {
+		return err
+	}
+	return c.copyCosignTags(src)
+}
+
+// write pushes desc to ref. Blobs from the same registry are mounted rather
+// than uploaded, since layers of remote images know where they came from.
+func (c *copier) write(ref name.Reference, desc *remote.Descriptor) error {
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		return remote.WriteIndex(ref, idx, c.opts...)
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return err
+	}
+	return remote.Write(ref, img, c.opts...)
+}
+
+// copyReferrers copies the referrers of src and makes sure dst lists them.
+func (c *copier) copyReferrers(src name.Digest) error {
+	idx, err := remote.Referrers(src, c.opts...)
+	if err != nil {
+		return fmt.Errorf("listing referrers of %s: %w", src, err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	if len(m.Manifests) == 0 {
+		return nil
+	}
+	for _, r := range m.Manifests {
+		if err := c.copy(src.Context().Digest(r.Digest.String())); err != nil {
+			return err
+		}
+	}
+
+	// Registries with the referrers API index the copies as they are pushed.
+	// For the rest, pushing doesn't update the fallback tag, so do it here.
+	return addReferrers(c.dst.Digest(src.DigestStr()), m.Manifests, c.opts...)
+}
+
+// addReferrers makes sure subject's referrers list refs as given. Registries
+// with the referrers API list a referrer as soon as it is pushed, but for the
+// rest the referrers index under the fallback tag has to be updated by hand.
+func addReferrers(subject name.Digest, refs []v1.Descriptor, opts ...remote.Option) error {
+	have, err := remote.Referrers(subject, opts...)
+	if err != nil {
+		return fmt.Errorf("listing referrers of %s: %w", subject, err)
+	}
+	hm, err := have.IndexManifest()
+	if err != nil {
+		return err
+	}
+	out := v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     ggcrtypes.OCIImageIndex,
+		Manifests:     slices.Clone(hm.Manifests),
+	}
+	changed := false
+	for _, r := range refs {
+		i := slices.IndexFunc(out.Manifests, func(d v1.Descriptor) bool { return d.Digest == r.Digest })
+		switch {
+		case i < 0:
+			out.Manifests = append(out.Manifests, r)
+			changed = true
+		// Pushing a manifest with a subject adds it to the fallback tag,
+		// but typed by its config and without its annotations.
+		case out.Manifests[i].ArtifactType != r.ArtifactType || !maps.Equal(out.Manifests[i].Annotations, r.Annotations):
+			out.Manifests[i] = r
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if err := remote.Put(subject.Context().Tag(fallbackTag(subject)), rawIndex(raw), opts...); err != nil {
+		return fmt.Errorf("updating referrers of %s: %w", subject, err)
+	}
+	return nil
+}
+
+// copyCosignTags copies the cosign attachments of src, keeping their tags.
+func (c *copier) copyCosignTags(src name.Digest) error {
+	for _, suffix := range cosignSuffixes {
+		tag := src.Context().Tag(fallbackTag(src) + "." + suffix)
+		desc, err := remote.Head(tag, c.opts...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return fmt.Errorf("checking %s: %w", tag, err)
+		}
+		if err := c.copy(src.Context().Digest(desc.Digest.String())); err != nil {
+			return err
+		}
+		copied, err := remote.Get(c.dst.Digest(desc.Digest.String()), c.opts...)
+		if err != nil {
+			return err
+		}
+		if err := remote.Tag(c.dst.Tag(tag.TagStr()), copied, c.opts...); err != nil {
+			return fmt.Errorf("tagging %s: %w", tag.TagStr(), err)
+		}
+	}
+	return nil
+}
+
+// Referrers lists what is attached to subject: the manifests the OCI
+// referrers API or its fallback tag lists, then those under cosign's
+// sha256-<hex>.sig, .att and .sbom tags, each listed once. Unlike Copy, it
+// doesn't descend into attachments of attachments.
+func Referrers(subject name.Digest, opts ...remote.Option) ([]v1.Descriptor, error) {
+	idx, err := remote.Referrers(subject, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers of %s: %w", subject, err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	out := slices.Clone(m.Manifests)
+
+	tags, err := cosignTags(subject, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, suffix := range cosignSuffixes {
+		desc, ok := tags[suffix]
+		if !ok || slices.ContainsFunc(out, func(d v1.Descriptor) bool { return d.Digest == desc.Digest }) {
+			continue
+		}
+		out = append(out, *desc)
+	}
+	return out, nil
+}
+
+// cosignTags returns the manifests under subject's cosign tags, by the
+// suffix of the tag.
+func cosignTags(subject name.Digest, opts ...remote.Option) (map[string]*v1.Descriptor, error) {
+	out := map[string]*v1.Descriptor{}
+	for _, suffix := range cosignSuffixes {
+		tag := subject.Context().Tag(fallbackTag(subject) + "." + suffix)
+		desc, err := remote.Head(tag, opts...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, fmt.Errorf("checking %s: %w", tag, err)
+		}
+		out[suffix] = desc
+	}
+	return out, nil
+}
+
+var (
+	// signatureTypes are the artifact types of signatures: Notary Project
+	// signatures, and cosign's signatures and Sigstore bundles attached as
+	// referrers.
+	signatureTypes = []string{
+		"application/vnd.cncf.notary.signature",
+		"application/vnd.dev.cosign.artifact.sig.v1+json",
+		"application/vnd.dev.sigstore.bundle.v0.3+json",
+	}
+	// sbomTypes are the artifact types of SBOMs.
+	sbomTypes = []string{
+		"application/spdx+json",
+		"text/spdx",
+		"application/vnd.cyclonedx+json",
+		"application/vnd.cyclonedx+xml",
+		"application/vnd.syft+json",
+	}
+)
+
+// Attached is what kinds of artifact are attached to a chart.
+type Attached struct {
+	// Signed reports whether a Notary Project or cosign signature is.
+	Signed bool
+	// SBOM reports whether an SPDX, CycloneDX or Syft SBOM is.
+	SBOM bool
+	// Attested reports whether an in-toto attestation is, such as a scan
+	// report or provenance.
+	Attested bool
+}
+
+// Attachments reports what is attached to subject, as Referrers finds it,
+// by the attachments' artifact types and the cosign tags they are under.
+// Only manifests are looked at, not the attachments' content, so it is
+// cheap enough to check on every refresh, but nothing is verified: see
+// Verify for that.
+func Attachments(subject name.Digest, opts ...remote.Option) (*Attached, error) {
+	idx, err := remote.Referrers(subject, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers of %s: %w", subject, err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := cosignTags(subject, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Attached{
+		Signed:   tags["sig"] != nil,
+		Attested: tags["att"] != nil,
+		SBOM:     tags["sbom"] != nil,
+	}
+	for _, d := range m.Manifests {
+		switch {
+		case slices.Contains(signatureTypes, d.ArtifactType):
+			a.Signed = true
+		case slices.Contains(sbomTypes, d.ArtifactType):
+			a.SBOM = true
+		case d.ArtifactType == inTotoMediaType:
+			a.Attested = true
+		}
+	}
+	return a, nil
+}
+
+// fallbackTag is the tag both the referrers API fallback and cosign derive
+// from a digest: sha256:<hex> becomes sha256-<hex>.
+func fallbackTag(d name.Digest) string {
+	return strings.Replace(d.DigestStr(), ":", "-", 1)
+}
+
+// rawIndex is an OCI image index manifest to put as is.
+type rawIndex []byte
+
+func (r rawIndex) RawManifest() ([]byte, error) { return r, nil }
+
+func (r rawIndex) MediaType() (ggcrtypes.MediaType, error) { return ggcrtypes.OCIImageIndex, nil }
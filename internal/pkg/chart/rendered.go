@@ -0,0 +1,44 @@
+package chart
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// RenderedManifest returns what c renders as with its default values, in the
+// form helm template prints it: every manifest, in the order Helm installs
+// them, then every hook, each under a comment naming its template. Library
+// charts render nothing.
+func RenderedManifest(c Chart) (string, error) {
+	hc, err := loadChart(c)
+	if err != nil {
+		return "", err
+	}
+	if hc.Metadata.Type == "library" {
+		return "", nil
+	}
+	rendered, err := render(hc, nil)
+	if err != nil {
+		return "", err
+	}
+	// Install notes are printed apart from the manifests.
+	maps.DeleteFunc(rendered, func(tmpl, _ string) bool {
+		return strings.HasSuffix(tmpl, "NOTES.txt")
+	})
+
+	hooks, manifests, err := releaseutil.SortManifests(rendered, nil, releaseutil.InstallOrder)
+	if err != nil {
+		return "", fmt.Errorf("parsing manifests: %w", err)
+	}
+	var b strings.Builder
+	for _, m := range manifests {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", m.Name, m.Content)
+	}
+	for _, h := range hooks {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
+	return b.String(), nil
+}
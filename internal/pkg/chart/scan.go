@@ -0,0 +1,347 @@
+package chart
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// Severity ranks how serious a scan finding is.
+type Severity string
+
+const (
+	SeverityLow      Severity = "LOW"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityHigh     Severity = "HIGH"
+	SeverityCritical Severity = "CRITICAL"
+)
+
+// Severities returns the known severities, least severe first.
+func Severities() []string {
+	return []string{string(SeverityLow), string(SeverityMedium), string(SeverityHigh), string(SeverityCritical)}
+}
+
+// AtLeast reports whether s is as severe as min or more.
+func (s Severity) AtLeast(min Severity) bool {
+	return slices.Index(Severities(), string(s)) >= slices.Index(Severities(), string(min))
+}
+
+// Finding is a misconfiguration found in a rendered manifest.
+type Finding struct {
+	// ID names the check, e.g. runs-as-root.
+	ID       string   `json:"id"`
+	Severity Severity `json:"severity"`
+	Title    string   `json:"title"`
+	// Resource is the offending object as <kind>/<name>.
+	Resource string `json:"resource"`
+	// Container is the offending container, for container-level checks.
+	Container string `json:"container,omitempty"`
+	// Template is the chart template that rendered the resource.
+	Template string `json:"template"`
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s %s: %s (%s", f.Severity, f.ID, f.Title, f.Resource)
+	if f.Container != "" {
+		s += ", container " + f.Container
+	}
+	return s + ")"
+}
+
+// Scan renders c with its default values, overridden by values, and lints
+// the workloads it renders for a few common security misconfigurations. It
+// is a minimal built-in linter, not a substitute for a full policy scanner
+// like Trivy, whose checks cover far more. Findings
+// are ordered most severe first. Library charts render nothing, so have no
+// findings.
+func Scan(c Chart, values map[string]any) ([]Finding, error) {
+	hc, err := loadChart(c)
+	if err != nil {
+		return nil, err
+	}
+	if hc.Metadata.Type == "library" {
+		return nil, nil
+	}
+
+	rendered, err := render(hc, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for tmpl, out := range rendered {
+		// NOTES.txt and partials aren't manifests.
+		if !slices.Contains([]string{".yaml", ".yml"}, path.Ext(tmpl)) {
+			continue
+		}
+		for _, doc := range releaseutil.SplitManifests(out) {
+			fs, err := scanManifest(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tmpl, err)
+			}
+			for i := range fs {
+				fs[i].Template = tmpl
+			}
+			findings = append(findings, fs...)
+		}
+	}
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			slices.Index(Severities(), string(b.Severity))-slices.Index(Severities(), string(a.Severity)),
+			strings.Compare(a.Resource, b.Resource),
+			strings.Compare(a.Container, b.Container),
+			strings.Compare(a.ID, b.ID),
+		)
+	})
+	return findings, nil
+}
+
+// loadChart loads c's content layer as a Helm chart.
+func loadChart(c Chart) (*helmchart.Chart, error) {
+	ls, err := c.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) == 0 {
+		return nil, fmt.Errorf("chart has no content layer")
+	}
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	archive, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("loading chart: %w", err)
+	}
+	return hc, nil
+}
+
+// render renders hc as a fresh install of a release named "release" in the
+// "default" namespace, with values over its defaults.
+func render(hc *helmchart.Chart, values map[string]any) (map[string]string, error) {
+	vals, err := chartutil.ToRenderValues(hc, values, chartutil.ReleaseOptions{
+		Name:      "release",
+		Namespace: "default",
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("composing values: %w", err)
+	}
+	rendered, err := engine.Render(hc, vals)
+	if err != nil {
+		return nil, fmt.Errorf("rendering chart: %w", err)
+	}
+	return rendered, nil
+}
+
+// The parts of a pod spec the checks look at.
+type (
+	podSpec struct {
+		HostNetwork     bool                `json:"hostNetwork"`
+		HostPID         bool                `json:"hostPID"`
+		HostIPC         bool                `json:"hostIPC"`
+		SecurityContext *podSecurityContext `json:"securityContext"`
+		Containers      []container         `json:"containers"`
+		InitContainers  []container         `json:"initContainers"`
+		Volumes         []volume            `json:"volumes"`
+	}
+	volume struct {
+		HostPath *struct{} `json:"hostPath"`
+	}
+	podSecurityContext struct {
+		RunAsNonRoot *bool  `json:"runAsNonRoot"`
+		RunAsUser    *int64 `json:"runAsUser"`
+	}
+	container struct {
+		Name            string           `json:"name"`
+		Image           string           `json:"image"`
+		SecurityContext *securityContext `json:"securityContext"`
+		Resources       struct {
+			Limits map[string]any `json:"limits"`
+		} `json:"resources"`
+	}
+	securityContext struct {
+		Privileged               *bool  `json:"privileged"`
+		AllowPrivilegeEscalation *bool  `json:"allowPrivilegeEscalation"`
+		RunAsNonRoot             *bool  `json:"runAsNonRoot"`
+		RunAsUser                *int64 `json:"runAsUser"`
+		ReadOnlyRootFilesystem   *bool  `json:"readOnlyRootFilesystem"`
+		Capabilities             *struct {
+			Add  []string `json:"add"`
+			Drop []string `json:"drop"`
+		} `json:"capabilities"`
+	}
+)
+
+// podChecks apply to a pod as a whole.
+var podChecks = []struct {
+	id       string
+	severity Severity
+	title    string
+	fails    func(p podSpec) bool
+}{
+	{"host-ipc", SeverityHigh, "Access to host IPC namespace", func(p podSpec) bool { return p.HostIPC }},
+	{"host-network", SeverityHigh, "Access to host network", func(p podSpec) bool { return p.HostNetwork }},
+	{"host-pid", SeverityHigh, "Access to host PID", func(p podSpec) bool { return p.HostPID }},
+	{"host-path", SeverityMedium, "hostPath volumes mounted", func(p podSpec) bool {
+		return slices.ContainsFunc(p.Volumes, func(v volume) bool { return v.HostPath != nil })
+	}},
+}
+
+// containerChecks apply to each container and init container in a pod.
+var containerChecks = []struct {
+	id       string
+	severity Severity
+	title    string
+	fails    func(p podSpec, c container) bool
+}{
+	{"privilege-escalation", SeverityMedium, "Can elevate its own privileges", func(_ podSpec, c container) bool {
+		sc := c.SecurityContext
+		return sc == nil || sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation
+	}},
+	{"capabilities-not-dropped", SeverityLow, "Default capabilities not dropped", func(_ podSpec, c container) bool {
+		sc := c.SecurityContext
+		return sc == nil || sc.Capabilities == nil || !slices.ContainsFunc(sc.Capabilities.Drop, func(s string) bool { return strings.EqualFold(s, "ALL") })
+	}},
+	{"sys-admin-capability", SeverityHigh, "SYS_ADMIN capability added", func(_ podSpec, c container) bool {
+		sc := c.SecurityContext
+		return sc != nil && sc.Capabilities != nil && slices.ContainsFunc(sc.Capabilities.Add, func(s string) bool { return strings.EqualFold(s, "SYS_ADMIN") })
+	}},
+	{"no-cpu-limit", SeverityLow, "CPU not limited", func(_ podSpec, c container) bool {
+		return c.Resources.Limits["cpu"] == nil
+	}},
+	{"runs-as-root", SeverityMedium, "Runs as root user", runsAsRoot},
+	{"latest-tag", SeverityMedium, "Image tag \":latest\" used", func(_ podSpec, c container) bool {
+		ref, err := name.ParseReference(c.Image)
+		if err != nil {
+			return false
+		}
+		tag, ok := ref.(name.Tag)
+		return ok && tag.TagStr() == "latest"
+	}},
+	{"writable-root-fs", SeverityHigh, "Root file system is not read-only", func(_ podSpec, c container) bool {
+		sc := c.SecurityContext
+		return sc == nil || sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem
+	}},
+	{"privileged", SeverityHigh, "Privileged container", func(_ podSpec, c container) bool {
+		sc := c.SecurityContext
+		return sc != nil && sc.Privileged != nil && *sc.Privileged
+	}},
+	{"no-memory-limit", SeverityLow, "Memory not limited", func(_ podSpec, c container) bool {
+		return c.Resources.Limits["memory"] == nil
+	}},
+}
+
+// ScanChecks returns the IDs of the checks Scan runs, pod checks first.
+func ScanChecks() []string {
+	var ids []string
+	for _, c := range podChecks {
+		ids = append(ids, c.id)
+	}
+	for _, c := range containerChecks {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+// runsAsRoot reports whether c may run as root, going by its security
+// context and then its pod's.
+func runsAsRoot(p podSpec, c container) bool {
+	var (
+		nonRoot *bool
+		uid     *int64
+	)
+	if sc := p.SecurityContext; sc != nil {
+		nonRoot, uid = sc.RunAsNonRoot, sc.RunAsUser
+	}
+	if sc := c.SecurityContext; sc != nil {
+		if sc.RunAsNonRoot != nil {
+			nonRoot = sc.RunAsNonRoot
+		}
+		if sc.RunAsUser != nil {
+			uid = sc.RunAsUser
+		}
+	}
+	if uid != nil {
+		return *uid == 0
+	}
+	return nonRoot == nil || !*nonRoot
+}
+
+// podSpecPaths locates the pod spec in each kind of workload.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// scanManifest checks a single rendered manifest.
+func scanManifest(doc string) ([]Finding, error) {
+	var obj map[string]any
+	if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	kind, _ := obj["kind"].(string)
+	keys, ok := podSpecPaths[kind]
+	if !ok {
+		return nil, nil
+	}
+	var raw any = obj
+	for _, k := range keys {
+		m, _ := raw.(map[string]any)
+		raw = m[k]
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var pod podSpec
+	if err := json.Unmarshal(b, &pod); err != nil {
+		return nil, fmt.Errorf("parsing %s pod spec: %w", kind, err)
+	}
+
+	md, _ := obj["metadata"].(map[string]any)
+	objName, _ := md["name"].(string)
+	resource := kind + "/" + objName
+
+	var findings []Finding
+	for _, c := range podChecks {
+		if c.fails(pod) {
+			findings = append(findings, Finding{ID: c.id, Severity: c.severity, Title: c.title, Resource: resource})
+		}
+	}
+	for _, ctr := range slices.Concat(pod.InitContainers, pod.Containers) {
+		for _, c := range containerChecks {
+			if c.fails(pod, ctr) {
+				findings = append(findings, Finding{ID: c.id, Severity: c.severity, Title: c.title, Resource: resource, Container: ctr.Name})
+			}
+		}
+	}
+	return findings, nil
+}
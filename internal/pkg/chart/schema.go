@@ -0,0 +1,102 @@
+package chart
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValuesSchema returns the JSON schema of c's values: its values.schema.json,
+// or, if it has none, one inferred from its values.yaml by inferValuesSchema.
+// inferred reports which it is.
+func ValuesSchema(c Chart) (schema []byte, inferred bool, err error) {
+	hc, err := loadChart(c)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(hc.Schema) > 0 {
+		return hc.Schema, false, nil
+	}
+	var values []byte
+	for _, f := range hc.Raw {
+		if f.Name == "values.yaml" {
+			values = f.Data
+		}
+	}
+	schema, err = inferValuesSchema(values)
+	return schema, true, err
+}
+
+// inferValuesSchema returns a draft-07 JSON schema describing values, a
+// values.yaml. Each key's type comes from its default, its description from
+// its helm-docs "# --" comment, and scalar defaults are kept as the schema's
+// defaults. Nothing is required, and null defaults allow any type.
+func inferValuesSchema(values []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(values, &doc); err != nil {
+		return nil, fmt.Errorf("parsing values.yaml: %w", err)
+	}
+	schema := map[string]any{"type": "object"}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		var err error
+		if schema, err = nodeSchema(doc.Content[0]); err != nil {
+			return nil, err
+		}
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// nodeSchema returns the JSON schema of the value v.
+func nodeSchema(v *yaml.Node) (map[string]any, error) {
+	switch v.Kind {
+	case yaml.AliasNode:
+		return nodeSchema(v.Alias)
+	case yaml.MappingNode:
+		props := map[string]any{}
+		for i := 0; i+1 < len(v.Content); i += 2 {
+			k, val := v.Content[i], v.Content[i+1]
+			s, err := nodeSchema(val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k.Value, err)
+			}
+			if desc, _, _ := parseValueComment(k.HeadComment); desc != "" {
+				s["description"] = desc
+			}
+			props[k.Value] = s
+		}
+		return map[string]any{"type": "object", "properties": props}, nil
+	case yaml.SequenceNode:
+		s := map[string]any{"type": "array"}
+		if len(v.Content) > 0 {
+			items, err := nodeSchema(v.Content[0])
+			if err != nil {
+				return nil, err
+			}
+			delete(items, "default")
+			s["items"] = items
+		}
+		return s, nil
+	}
+
+	var def any
+	if err := v.Decode(&def); err != nil {
+		return nil, err
+	}
+	s := map[string]any{}
+	switch v.Tag {
+	case "!!null":
+		return s, nil
+	case "!!int":
+		s["type"] = "integer"
+	case "!!float":
+		s["type"] = "number"
+	case "!!bool":
+		s["type"] = "boolean"
+	default:
+		s["type"] = "string"
+	}
+	s["default"] = def
+	return s, nil
+}
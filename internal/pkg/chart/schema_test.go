@@ -0,0 +1,62 @@
+package chart
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInferValuesSchema(t *testing.T) {
+	values := `
+# -- Image to run.
+image:
+  repository: nginx
+  tag: "1.27"
+# -- (int) How many pods to run.
+replicaCount: 1
+ratio: 0.5
+enabled: true
+nameOverride: ~
+args:
+- --verbose
+resources: {}
+tolerations: []
+`
+	raw, err := inferValuesSchema([]byte(values))
+	if err != nil {
+		t.Fatalf("inferValuesSchema() = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("parsing schema: %v", err)
+	}
+	want := map[string]any{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]any{
+			"image": map[string]any{
+				"type":        "object",
+				"description": "Image to run.",
+				"properties": map[string]any{
+					"repository": map[string]any{"type": "string", "default": "nginx"},
+					"tag":        map[string]any{"type": "string", "default": "1.27"},
+				},
+			},
+			"replicaCount": map[string]any{"type": "integer", "default": 1.0, "description": "How many pods to run."},
+			"ratio":        map[string]any{"type": "number", "default": 0.5},
+			"enabled":      map[string]any{"type": "boolean", "default": true},
+			"nameOverride": map[string]any{},
+			"args":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"resources":    map[string]any{"type": "object", "properties": map[string]any{}},
+			"tolerations":  map[string]any{"type": "array"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("schema (-want +got):\n%s", diff)
+	}
+
+	if _, err := inferValuesSchema([]byte("a: [")); err == nil {
+		t.Error("inferValuesSchema() succeeded on invalid YAML")
+	}
+}
@@ -0,0 +1,182 @@
+package chart
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// oidSCTList is the certificate extension RFC 6962 embeds signed
+// certificate timestamps in, as Fulcio does.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// sct is an RFC 6962 v1 signed certificate timestamp.
+type sct struct {
+	logID      [32]byte
+	timestamp  uint64
+	extensions []byte
+	signature  []byte
+}
+
+// verifySCT checks that cert, issued by issuer, carries a signed certificate
+// timestamp from one of the certificate transparency logs with keys logs, as
+// proof it was publicly logged when issued.
+func verifySCT(cert, issuer *x509.Certificate, logs []crypto.PublicKey) error {
+	var list []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+				return fmt.Errorf("parsing signed certificate timestamps: %w", err)
+			}
+		}
+	}
+	if list == nil {
+		return errors.New("signing certificate has no signed certificate timestamp")
+	}
+	scts, err := parseSCTList(list)
+	if err != nil {
+		return fmt.Errorf("parsing signed certificate timestamps: %w", err)
+	}
+
+	tbs, err := precertTBS(cert)
+	if err != nil {
+		return fmt.Errorf("reading signing certificate: %w", err)
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	var errs []error
+	for _, s := range scts {
+		for _, log := range logs {
+			der, err := x509.MarshalPKIXPublicKey(log)
+			if err != nil {
+				return err
+			}
+			if sha256.Sum256(der) != s.logID {
+				continue
+			}
+			if err := verifyWithKey(log, s.signedData(issuerKeyHash, tbs), s.signature); err != nil {
+				errs = append(errs, fmt.Errorf("verifying signed certificate timestamp: %w", err))
+				continue
+			}
+			return nil
+		}
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return errors.New("signing certificate has no signed certificate timestamp from a trusted log")
+}
+
+// signedData returns what a log signs for s about a precertificate, by the
+// hash of its issuer's key and its TBSCertificate.
+func (s sct) signedData(issuerKeyHash [32]byte, tbs []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(0) // v1
+	b.WriteByte(0) // certificate_timestamp
+	binary.Write(&b, binary.BigEndian, s.timestamp)
+	binary.Write(&b, binary.BigEndian, uint16(1)) // precert_entry
+	b.Write(issuerKeyHash[:])
+	b.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	b.Write(tbs)
+	binary.Write(&b, binary.BigEndian, uint16(len(s.extensions)))
+	b.Write(s.extensions)
+	return b.Bytes()
+}
+
+// parseSCTList parses a TLS-encoded SignedCertificateTimestampList, skipping
+// timestamps of versions other than v1.
+func parseSCTList(b []byte) ([]sct, error) {
+	list, rest, err := readOpaque16(b)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("malformed list")
+	}
+	var out []sct
+	for len(list) > 0 {
+		var raw []byte
+		if raw, list, err = readOpaque16(list); err != nil {
+			return nil, err
+		}
+		if len(raw) < 1+32+8 || raw[0] != 0 {
+			continue
+		}
+		var s sct
+		copy(s.logID[:], raw[1:33])
+		s.timestamp = binary.BigEndian.Uint64(raw[33:41])
+		if s.extensions, raw, err = readOpaque16(raw[41:]); err != nil {
+			return nil, err
+		}
+		// The hash and signature algorithms are implied by the log's key.
+		if len(raw) < 2 {
+			return nil, errors.New("malformed timestamp")
+		}
+		if s.signature, raw, err = readOpaque16(raw[2:]); err != nil || len(raw) != 0 {
+			return nil, errors.New("malformed timestamp")
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// readOpaque16 reads a TLS opaque value with a 16-bit length from b,
+// returning it and what follows.
+func readOpaque16(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("truncated")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
+
+// precertTBS returns the TBSCertificate of cert without its signed
+// certificate timestamps, which is what the logs timestamped.
+func precertTBS(cert *x509.Certificate) ([]byte, error) {
+	var tbs asn1.RawValue
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, err
+	}
+	var fields []byte
+	for rest := tbs.Bytes; len(rest) > 0; {
+		var f asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &f); err != nil {
+			return nil, err
+		}
+		if f.Class != asn1.ClassContextSpecific || f.Tag != 3 {
+			fields = append(fields, f.FullBytes...)
+			continue
+		}
+		var seq asn1.RawValue
+		if _, err := asn1.Unmarshal(f.Bytes, &seq); err != nil {
+			return nil, err
+		}
+		var kept []byte
+		for exts := seq.Bytes; len(exts) > 0; {
+			var ext pkix.Extension
+			before := exts
+			if exts, err = asn1.Unmarshal(exts, &ext); err != nil {
+				return nil, err
+			}
+			if !ext.Id.Equal(oidSCTList) {
+				kept = append(kept, before[:len(before)-len(exts)]...)
+			}
+		}
+		seqDER, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: kept})
+		if err != nil {
+			return nil, err
+		}
+		extsDER, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: seqDER})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, extsDER...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+}
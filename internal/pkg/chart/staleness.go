@@ -0,0 +1,81 @@
+package chart
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/scratch"
+)
+
+// Staleness describes how far the package Build would use is behind the
+// newest version available in the configured repositories.
+type Staleness struct {
+	// Resolved is the package Build would use.
+	Resolved *Package
+	// Latest is the newest available version of the package.
+	Latest *Package
+	// VersionsBehind is how many distinct newer versions are available.
+	VersionsBehind int
+	// Behind is how much older Resolved's build is than Latest's. It is zero
+	// when either build time is unknown.
+	Behind time.Duration
+}
+
+// CheckStaleness compares the package Build would use for name against every
+// version of it in the configured repositories' indexes.
+func CheckStaleness(ctx context.Context, name string, config *BuildConfig) (*Staleness, error) {
+	tmp := scratch.New(ctx, "")
+	defer tmp.Close()
+	_, _, resolved, _, err := config.resolve(ctx, name, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := config.bc(ctx, name, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := bc.APK().GetRepositoryIndexes(ctx, config.AllowUnsigned)
+	if err != nil {
+		return nil, fmt.Errorf("getting repository indexes: %w", err)
+	}
+
+	current, err := apk.ParseVersion(resolved.Version)
+	if err != nil {
+		return nil, fmt.Errorf("parsing resolved version %q: %w", resolved.Version, err)
+	}
+
+	s := &Staleness{Resolved: resolved, Latest: resolved}
+	latest := current
+	newer := make(map[string]bool)
+	for _, idx := range indexes {
+		for _, pkg := range idx.Packages() {
+			if pkg.Name != name || pkg.Arch != resolved.Arch {
+				continue
+			}
+			v, err := apk.ParseVersion(pkg.Version)
+			if err != nil {
+				return nil, fmt.Errorf("parsing version %q of %s: %w", pkg.Version, name, err)
+			}
+			if apk.CompareVersions(v, current) <= 0 {
+				continue
+			}
+			newer[pkg.Version] = true
+			if apk.CompareVersions(v, latest) > 0 {
+				latest = v
+				s.Latest = toPackage(pkg)
+			}
+		}
+	}
+
+	s.VersionsBehind = len(newer)
+	// Reproducible builds often stamp packages with the epoch, which says
+	// nothing about their age.
+	if resolved.BuildTime.Unix() > 0 && s.Latest.BuildTime.Unix() > 0 && s.Latest.BuildTime.After(resolved.BuildTime) {
+		s.Behind = s.Latest.BuildTime.Sub(resolved.BuildTime)
+	}
+	return s, nil
+}
@@ -0,0 +1,66 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+)
+
+// binarySniffLen is how much of a file is looked at to decide whether it is
+// binary, as git does.
+const binarySniffLen = 8000
+
+// SuspectFile is a file in a chart that is larger than expected or binary,
+// such as an image or archive packaged by accident.
+type SuspectFile struct {
+	// Path is the file's path relative to the chart root.
+	Path string
+	Size int64
+	// Large reports whether the file is larger than the limit it was
+	// checked against.
+	Large bool
+	// Binary reports whether the file has a NUL byte near its start, as
+	// text files don't.
+	Binary bool
+}
+
+// SuspectFiles returns the files in c's content layer that are larger than
+// maxSize bytes, unless it is zero, or binary, in the order they are in the
+// chart. Packaged subcharts in charts/, and files matching any of
+// allowBinary, as understood by path.Match, may be binary.
+func SuspectFiles(c Chart, maxSize int64, allowBinary []string) ([]SuspectFile, error) {
+	var suspect []SuspectFile
+	err := walkFiles(c, func(rel string, hdr *tar.Header, r io.Reader) error {
+		f := SuspectFile{Path: rel, Size: hdr.Size, Large: maxSize > 0 && hdr.Size > maxSize}
+		if !binaryAllowed(rel, allowBinary) {
+			head := make([]byte, min(hdr.Size, binarySniffLen))
+			if _, err := io.ReadFull(r, head); err != nil {
+				return err
+			}
+			f.Binary = bytes.IndexByte(head, 0) >= 0
+		}
+		if f.Large || f.Binary {
+			suspect = append(suspect, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suspect, nil
+}
+
+// binaryAllowed reports whether the file at rel may be binary.
+func binaryAllowed(rel string, allow []string) bool {
+	if dir, file := path.Split(rel); dir == "charts/" && strings.HasSuffix(file, ".tgz") {
+		return true
+	}
+	for _, pattern := range allow {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,378 @@
+package chart
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	_ "crypto/sha512" // for timestamps made with SHA-384 and SHA-512
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// cosignTimestampAnnotation is the annotation cosign records a timestamp
+// authority's RFC 3161 countersignature of a signature under.
+const cosignTimestampAnnotation = "dev.sigstore.cosign/rfc3161timestamp"
+
+// The object identifiers of RFC 3161 timestamp tokens and the CMS
+// structures carrying them.
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	// The ESS attributes binding a CMS signature to its signer's
+	// certificate, by its SHA-1 hash or, in v2, any hash.
+	oidSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	// The signature algorithms timestamp authorities sign with.
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSASSAPSS       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidMGF1            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// timeStampResp is an RFC 3161 TimeStampResp, as cosign stores it.
+type timeStampResp struct {
+	Status struct {
+		Status int
+	}
+	Token asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,optional,tag:0"`
+	}
+	Certificates asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos  []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// pssParams are RSASSA-PSS parameters. Omitted ones default to SHA-1,
+// which isn't accepted.
+type pssParams struct {
+	Hash       pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+	MGF        pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:1"`
+	SaltLength int                      `asn1:"explicit,optional,default:20,tag:2"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      time.Time `asn1:"generalized"`
+}
+
+// verifyTimestamp checks the RFC 3161 timestamp attached to l was issued
+// over sig by an authority chaining to the policy's timestamp roots,
+// returning the time it vouches for.
+func (p Policy) verifyTimestamp(l cosignLayer, sig []byte) (time.Time, error) {
+	raw, ok := l.annotations[cosignTimestampAnnotation]
+	if !ok {
+		return time.Time{}, errors.New("signature has no timestamp")
+	}
+	var ts struct {
+		SignedRFC3161Timestamp []byte
+	}
+	if err := json.Unmarshal([]byte(raw), &ts); err != nil {
+		return time.Time{}, fmt.Errorf("parsing timestamp: %w", err)
+	}
+	info, err := p.verifyTimestampResponse(ts.SignedRFC3161Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("verifying timestamp: %w", err)
+	}
+
+	h, err := hashFor(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("verifying timestamp: %w", err)
+	}
+	d := h.New()
+	d.Write(sig)
+	if !bytes.Equal(d.Sum(nil), info.MessageImprint.HashedMessage) {
+		return time.Time{}, errors.New("timestamp is for another signature")
+	}
+	return info.GenTime, nil
+}
+
+// verifyTimestampResponse checks the signature on the token in resp, a DER
+// TimeStampResp, and returns what it attests to.
+func (p Policy) verifyTimestampResponse(resp []byte) (*tstInfo, error) {
+	var tsr timeStampResp
+	if _, err := asn1.Unmarshal(resp, &tsr); err != nil {
+		return nil, fmt.Errorf("parsing timestamp response: %w", err)
+	}
+	// 0 and 1 are granted, and granted with modifications.
+	if tsr.Status.Status > 1 || len(tsr.Token.FullBytes) == 0 {
+		return nil, fmt.Errorf("timestamp request was rejected with status %d", tsr.Status.Status)
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(tsr.Token.FullBytes, &ci); err != nil {
+		return nil, fmt.Errorf("parsing timestamp token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("timestamp token is a %s, not signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("parsing timestamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("timestamp token holds a %s, not a timestamp", sd.EncapContentInfo.EContentType)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("parsing timestamp: %w", err)
+	}
+	// Authorities may leave their certificates out of timestamps, so the
+	// policy's are candidates too.
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing timestamp certificates: %w", err)
+	}
+	certs = append(certs, p.TimestampCerts...)
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("timestamp token has %d signers, not one", len(sd.SignerInfos))
+	}
+
+	si := sd.SignerInfos[0]
+	h, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, errors.New("timestamp token has no signed attributes")
+	}
+	// The signature is over the signed attributes with their SET tag,
+	// rather than the implicit [0] they are sent with.
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return nil, fmt.Errorf("parsing timestamp signed attributes: %w", err)
+	}
+	if err := checkMessageDigest(attrs, h, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+	signer, err := signingCertificate(attrs, certs)
+	if err != nil {
+		return nil, err
+	}
+	d := h.New()
+	d.Write(signed)
+	if err := verifyDigest(signer.PublicKey, si.SignatureAlgorithm, h, d.Sum(nil), si.Signature); err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         p.TimestampRoots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("verifying timestamp authority certificate: %w", err)
+	}
+	return &info, nil
+}
+
+// signingCertificate returns the one of certs the ESS signing certificate
+// attribute in attrs names as the timestamp's signer, as RFC 3161 requires
+// authorities to include.
+func signingCertificate(attrs []attribute, certs []*x509.Certificate) (*x509.Certificate, error) {
+	for _, a := range attrs {
+		v2 := a.Type.Equal(oidSigningCertificateV2)
+		if !v2 && !a.Type.Equal(oidSigningCertificate) {
+			continue
+		}
+		// SigningCertificate(V2) ::= SEQUENCE { certs SEQUENCE OF
+		// ESSCertID(v2), ... }, of which the first is the signer's.
+		var sc struct {
+			Certs []asn1.RawValue
+			Rest  asn1.RawValue `asn1:"optional"`
+		}
+		if _, err := asn1.Unmarshal(a.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+			return nil, errors.New("parsing timestamp signing certificate attribute")
+		}
+		// ESSCertID(v2)'s fields are read one by one, since v2's hash
+		// algorithm is optional and comes first.
+		var fields []asn1.RawValue
+		for rest := sc.Certs[0].Bytes; len(rest) > 0; {
+			var f asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &f); err != nil {
+				return nil, errors.New("parsing timestamp signing certificate attribute")
+			}
+			fields = append(fields, f)
+		}
+		hash := crypto.SHA1
+		if v2 {
+			hash = crypto.SHA256
+			if len(fields) > 0 && fields[0].Tag == asn1.TagSequence {
+				var alg pkix.AlgorithmIdentifier
+				if _, err := asn1.Unmarshal(fields[0].FullBytes, &alg); err != nil {
+					return nil, errors.New("parsing timestamp signing certificate attribute")
+				}
+				var err error
+				if hash, err = hashFor(alg.Algorithm); err != nil {
+					return nil, err
+				}
+				fields = fields[1:]
+			}
+		}
+		if len(fields) == 0 || fields[0].Tag != asn1.TagOctetString {
+			return nil, errors.New("parsing timestamp signing certificate attribute")
+		}
+		for _, c := range certs {
+			if bytes.Equal(certHash(hash, c), fields[0].Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("timestamp authority certificate is neither in the timestamp nor the policy")
+	}
+	return nil, errors.New("timestamp token doesn't name its signing certificate")
+}
+
+// certHash returns the hash of c's DER encoding with h.
+func certHash(h crypto.Hash, c *x509.Certificate) []byte {
+	switch h {
+	case crypto.SHA1:
+		sum := sha1.Sum(c.Raw)
+		return sum[:]
+	case crypto.SHA256:
+		sum := sha256.Sum256(c.Raw)
+		return sum[:]
+	}
+	d := h.New()
+	d.Write(c.Raw)
+	return d.Sum(nil)
+}
+
+// checkMessageDigest checks the message digest in attrs is that of content.
+func checkMessageDigest(attrs []attribute, h crypto.Hash, content []byte) error {
+	d := h.New()
+	d.Write(content)
+	for _, a := range attrs {
+		if !a.Type.Equal(oidMessageDigest) {
+			continue
+		}
+		var got []byte
+		if _, err := asn1.Unmarshal(a.Values.Bytes, &got); err != nil {
+			return fmt.Errorf("parsing timestamp message digest: %w", err)
+		}
+		if !bytes.Equal(got, d.Sum(nil)) {
+			return errors.New("timestamp token's signature is for other content")
+		}
+		return nil
+	}
+	return errors.New("timestamp token has no message digest")
+}
+
+// hashFor returns the hash an RFC 3161 or CMS algorithm identifier names.
+func hashFor(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %s", oid)
+}
+
+// verifyDigest checks sig over a digest made with h, by the signature
+// algorithm alg, which must agree with h and pub's type.
+func verifyDigest(pub crypto.PublicKey, alg pkix.AlgorithmIdentifier, h crypto.Hash, digest, sig []byte) error {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !matchesHash(alg.Algorithm, h, oidECPublicKey, map[crypto.Hash]asn1.ObjectIdentifier{crypto.SHA256: oidECDSAWithSHA256, crypto.SHA384: oidECDSAWithSHA384, crypto.SHA512: oidECDSAWithSHA512}) {
+			return fmt.Errorf("timestamp signature algorithm %s doesn't match its %s digest and ECDSA key", alg.Algorithm, h)
+		}
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return errors.New("invalid timestamp signature")
+		}
+	case *rsa.PublicKey:
+		if alg.Algorithm.Equal(oidRSASSAPSS) {
+			var params pssParams
+			if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+				return fmt.Errorf("parsing timestamp RSA-PSS parameters: %w", err)
+			}
+			var mgfHash pkix.AlgorithmIdentifier
+			if _, err := asn1.Unmarshal(params.MGF.Parameters.FullBytes, &mgfHash); err != nil || !params.MGF.Algorithm.Equal(oidMGF1) {
+				return errors.New("timestamp RSA-PSS signature doesn't use MGF1")
+			}
+			if ph, err := hashFor(params.Hash.Algorithm); err != nil || ph != h || !mgfHash.Algorithm.Equal(params.Hash.Algorithm) {
+				return fmt.Errorf("timestamp RSA-PSS parameters don't match its %s digest", h)
+			}
+			if err := rsa.VerifyPSS(k, h, digest, sig, &rsa.PSSOptions{SaltLength: params.SaltLength, Hash: h}); err != nil {
+				return fmt.Errorf("invalid timestamp signature: %w", err)
+			}
+			return nil
+		}
+		if !matchesHash(alg.Algorithm, h, oidRSAEncryption, map[crypto.Hash]asn1.ObjectIdentifier{crypto.SHA256: oidSHA256WithRSA, crypto.SHA384: oidSHA384WithRSA, crypto.SHA512: oidSHA512WithRSA}) {
+			return fmt.Errorf("timestamp signature algorithm %s doesn't match its %s digest and RSA key", alg.Algorithm, h)
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, digest, sig); err != nil {
+			return fmt.Errorf("invalid timestamp signature: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported timestamp authority key type %T", pub)
+	}
+	return nil
+}
+
+// matchesHash reports whether the signature algorithm alg is the bare key
+// algorithm, which CMS allows with the hash given separately, or the one
+// byHash names for h.
+func matchesHash(alg asn1.ObjectIdentifier, h crypto.Hash, bare asn1.ObjectIdentifier, byHash map[crypto.Hash]asn1.ObjectIdentifier) bool {
+	return alg.Equal(bare) || alg.Equal(byHash[h])
+}
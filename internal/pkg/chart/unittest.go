@@ -0,0 +1,585 @@
+package chart
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"sigs.k8s.io/yaml"
+)
+
+// UnitTestFailure is a failed test of a unit test suite.
+type UnitTestFailure struct {
+	Suite string
+	Test  string
+	// Message says which assertion failed and how.
+	Message string
+}
+
+func (f UnitTestFailure) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Suite, f.Test, f.Message)
+}
+
+// UnitTestResult is the outcome of UnitTest.
+type UnitTestResult struct {
+	Suites, Tests int
+	Failures      []UnitTestFailure
+}
+
+// UnitTest runs helm-unittest style test suites against c: those bundled in
+// the chart as tests/*_test.yaml, then extra, by name. It supports
+// helm-unittest's templates, set and release settings and its common
+// assertions, and fails if there are no suites to run.
+func UnitTest(c Chart, extra map[string][]byte) (*UnitTestResult, error) {
+	hc, err := loadChart(c)
+	if err != nil {
+		return nil, err
+	}
+
+	suites := map[string][]byte{}
+	for _, f := range hc.Files {
+		if ok, _ := path.Match("tests/*_test.yaml", f.Name); ok {
+			suites[f.Name] = f.Data
+		}
+	}
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(suites)) {
+		names = append(names, name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(extra)) {
+		if _, ok := suites[name]; ok {
+			return nil, fmt.Errorf("test suite %s is also bundled in the chart", name)
+		}
+		suites[name] = extra[name]
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("found no unit test suites")
+	}
+
+	res := &UnitTestResult{}
+	for _, name := range names {
+		var s testSuite
+		if err := yaml.UnmarshalStrict(suites[name], &s); err != nil {
+			return nil, fmt.Errorf("parsing test suite %s: %w", name, err)
+		}
+		res.Suites++
+		for _, t := range s.Tests {
+			res.Tests++
+			if msg := runUnitTest(hc, &s, &t); msg != "" {
+				res.Failures = append(res.Failures, UnitTestFailure{Suite: cmp.Or(s.Suite, name), Test: t.It, Message: msg})
+			}
+		}
+	}
+	return res, nil
+}
+
+type (
+	testSuite struct {
+		Suite     string         `json:"suite"`
+		Templates []string       `json:"templates"`
+		Set       map[string]any `json:"set"`
+		Release   *testRelease   `json:"release"`
+		Tests     []unitTest     `json:"tests"`
+	}
+	testRelease struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Revision  int    `json:"revision"`
+		Upgrade   bool   `json:"upgrade"`
+	}
+	unitTest struct {
+		It            string         `json:"it"`
+		Template      string         `json:"template"`
+		Templates     []string       `json:"templates"`
+		DocumentIndex *int           `json:"documentIndex"`
+		Set           map[string]any `json:"set"`
+		Release       *testRelease   `json:"release"`
+		Asserts       []assertion    `json:"asserts"`
+	}
+	// assertion is one of a test's asserts, like
+	// {"equal": {"path": "kind", "value": "Pod"}, "not": true}.
+	assertion struct {
+		Type          string
+		Params        assertParams
+		Not           bool
+		Template      string
+		DocumentIndex *int
+	}
+	assertParams struct {
+		Path         string `json:"path"`
+		Value        any    `json:"value"`
+		Content      any    `json:"content"`
+		Pattern      string `json:"pattern"`
+		Of           string `json:"of"`
+		Count        *int   `json:"count"`
+		ErrorMessage string `json:"errorMessage"`
+		ErrorPattern string `json:"errorPattern"`
+	}
+)
+
+func (a *assertion) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	for k, v := range raw {
+		var err error
+		switch k {
+		case "not":
+			err = json.Unmarshal(v, &a.Not)
+		case "template":
+			err = json.Unmarshal(v, &a.Template)
+		case "documentIndex":
+			err = json.Unmarshal(v, &a.DocumentIndex)
+		default:
+			if a.Type != "" {
+				return fmt.Errorf("assertion has both %s and %s", a.Type, k)
+			}
+			if !knownAssertion(k) {
+				return fmt.Errorf("unsupported assertion %s", k)
+			}
+			a.Type = k
+			if string(v) != "null" {
+				err = json.Unmarshal(v, &a.Params)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	if a.Type == "" {
+		return fmt.Errorf("assertion has no type")
+	}
+	return nil
+}
+
+// knownAssertion reports whether name is an assertion UnitTest supports.
+func knownAssertion(name string) bool {
+	_, doc := docAssertions[name]
+	_, alias := assertionAliases[name]
+	return doc || alias || name == "hasDocuments" || name == "failedTemplate"
+}
+
+// docAssertion checks a rendered document, returning why it doesn't hold,
+// or "" if it does. negated is what to say when it holds but shouldn't.
+type docAssertion struct {
+	check   func(doc map[string]any, p assertParams) string
+	negated func(p assertParams) string
+}
+
+// docAssertions are the assertions on single documents, by their
+// helm-unittest names. Any of them can be negated with "not: true".
+var docAssertions = map[string]docAssertion{
+	"equal": {
+		check: func(doc map[string]any, p assertParams) string {
+			got, ok := lookup(doc, p.Path)
+			if !ok || !reflect.DeepEqual(got, normalize(p.Value)) {
+				return fmt.Sprintf("expected %s to equal %s, got %s", p.Path, show(p.Value), showLookup(got, ok))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected %s not to equal %s", p.Path, show(p.Value)) },
+	},
+	"isNull": {
+		check: func(doc map[string]any, p assertParams) string {
+			if got, ok := lookup(doc, p.Path); ok && got != nil {
+				return fmt.Sprintf("expected %s to be null, got %s", p.Path, show(got))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected %s not to be null", p.Path) },
+	},
+	"isEmpty": {
+		check: func(doc map[string]any, p assertParams) string {
+			if got, ok := lookup(doc, p.Path); ok && got != nil && !reflect.ValueOf(got).IsZero() && !(isCollection(got) && reflect.ValueOf(got).Len() == 0) {
+				return fmt.Sprintf("expected %s to be empty, got %s", p.Path, show(got))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected %s not to be empty", p.Path) },
+	},
+	"exists": {
+		check: func(doc map[string]any, p assertParams) string {
+			if _, ok := lookup(doc, p.Path); !ok {
+				return fmt.Sprintf("expected %s to exist", p.Path)
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected %s not to exist", p.Path) },
+	},
+	"contains": {
+		check: func(doc map[string]any, p assertParams) string {
+			got, ok := lookup(doc, p.Path)
+			list, _ := got.([]any)
+			if !ok || !slices.ContainsFunc(list, func(e any) bool { return reflect.DeepEqual(e, normalize(p.Content)) }) {
+				return fmt.Sprintf("expected %s to contain %s, got %s", p.Path, show(p.Content), showLookup(got, ok))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string {
+			return fmt.Sprintf("expected %s not to contain %s", p.Path, show(p.Content))
+		},
+	},
+	"isSubset": {
+		check: func(doc map[string]any, p assertParams) string {
+			got, found := lookup(doc, p.Path)
+			m, _ := got.(map[string]any)
+			want, _ := normalize(p.Content).(map[string]any)
+			for k, v := range want {
+				if mv, ok := m[k]; !ok || !reflect.DeepEqual(mv, v) {
+					return fmt.Sprintf("expected %s to contain %s, got %s", p.Path, show(p.Content), showLookup(got, found))
+				}
+			}
+			return ""
+		},
+		negated: func(p assertParams) string {
+			return fmt.Sprintf("expected %s not to contain %s", p.Path, show(p.Content))
+		},
+	},
+	"matchRegex": {
+		check: func(doc map[string]any, p assertParams) string {
+			re, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return fmt.Sprintf("invalid pattern: %v", err)
+			}
+			got, ok := lookup(doc, p.Path)
+			s, isString := got.(string)
+			if !isString || !re.MatchString(s) {
+				return fmt.Sprintf("expected %s to match %q, got %s", p.Path, p.Pattern, showLookup(got, ok))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected %s not to match %q", p.Path, p.Pattern) },
+	},
+	"lengthEqual": {
+		check: func(doc map[string]any, p assertParams) string {
+			got, ok := lookup(doc, p.Path)
+			if p.Count == nil {
+				return "lengthEqual needs a count"
+			}
+			if !ok || !isCollection(got) || reflect.ValueOf(got).Len() != *p.Count {
+				return fmt.Sprintf("expected %s to have %d elements, got %s", p.Path, *p.Count, showLookup(got, ok))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string {
+			return fmt.Sprintf("expected %s not to have %d elements", p.Path, *p.Count)
+		},
+	},
+	"isKind": {
+		check: func(doc map[string]any, p assertParams) string {
+			if doc["kind"] != p.Of {
+				return fmt.Sprintf("expected kind %s, got %s", p.Of, show(doc["kind"]))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected kind not to be %s", p.Of) },
+	},
+	"isAPIVersion": {
+		check: func(doc map[string]any, p assertParams) string {
+			if doc["apiVersion"] != p.Of {
+				return fmt.Sprintf("expected apiVersion %s, got %s", p.Of, show(doc["apiVersion"]))
+			}
+			return ""
+		},
+		negated: func(p assertParams) string { return fmt.Sprintf("expected apiVersion not to be %s", p.Of) },
+	},
+}
+
+// assertionAliases maps helm-unittest's names for negated assertions, like
+// notEqual, to their entries in docAssertions.
+var assertionAliases = map[string]string{
+	"isNotNull":     "isNull",
+	"isNotEmpty":    "isEmpty",
+	"notExists":     "exists",
+	"notEqual":      "equal",
+	"notContains":   "contains",
+	"notMatchRegex": "matchRegex",
+	"isNotSubset":   "isSubset",
+}
+
+// runUnitTest runs t from suite s against hc, returning why it failed, or
+// "" if it passed.
+func runUnitTest(hc *helmchart.Chart, s *testSuite, t *unitTest) string {
+	values := map[string]any{}
+	for _, set := range []map[string]any{s.Set, t.Set} {
+		for _, k := range slices.Sorted(maps.Keys(set)) {
+			setValue(values, k, normalize(set[k]))
+		}
+	}
+	rel := testRelease{Name: "RELEASE-NAME", Namespace: "NAMESPACE", Revision: 1}
+	for _, r := range []*testRelease{s.Release, t.Release} {
+		if r == nil {
+			continue
+		}
+		rel.Name, rel.Namespace = cmp.Or(r.Name, rel.Name), cmp.Or(r.Namespace, rel.Namespace)
+		if r.Revision != 0 {
+			rel.Revision = r.Revision
+		}
+		rel.Upgrade = rel.Upgrade || r.Upgrade
+	}
+
+	var (
+		rendered  map[string]string
+		renderErr error
+	)
+	vals, err := chartutil.ToRenderValues(hc, values, chartutil.ReleaseOptions{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Revision,
+		IsInstall: !rel.Upgrade,
+		IsUpgrade: rel.Upgrade,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		renderErr = err
+	} else {
+		rendered, renderErr = engine.Render(hc, vals)
+	}
+
+	// Documents of each template, by its path under templates/.
+	docs := map[string][]map[string]any{}
+	prefix := hc.Name() + "/templates/"
+	for name, out := range rendered {
+		rel, ok := strings.CutPrefix(name, prefix)
+		if !ok || !slices.Contains([]string{".yaml", ".yml"}, path.Ext(rel)) {
+			continue
+		}
+		for _, d := range documentSeparator.Split(out, -1) {
+			var doc map[string]any
+			if err := yaml.Unmarshal([]byte(d), &doc); err != nil {
+				return fmt.Sprintf("parsing %s: %v", rel, err)
+			}
+			if doc != nil {
+				docs[rel] = append(docs[rel], doc)
+			}
+		}
+	}
+
+	patterns := s.Templates
+	if t.Template != "" {
+		patterns = []string{t.Template}
+	} else if len(t.Templates) > 0 {
+		patterns = t.Templates
+	}
+
+	for i, a := range t.Asserts {
+		if msg := checkAssertion(a, t, patterns, docs, renderErr); msg != "" {
+			return fmt.Sprintf("assertion %d (%s): %s", i+1, a.Type, msg)
+		}
+	}
+	return ""
+}
+
+// documentSeparator splits rendered templates into YAML documents.
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// checkAssertion checks a against the documents of the templates matching
+// patterns, returning why it failed, or "" if it held.
+func checkAssertion(a assertion, t *unitTest, patterns []string, docs map[string][]map[string]any, renderErr error) string {
+	if a.Type == "failedTemplate" {
+		var msg string
+		switch {
+		case renderErr == nil:
+			msg = "expected rendering to fail"
+		case a.Params.ErrorMessage != "" && !strings.Contains(renderErr.Error(), a.Params.ErrorMessage):
+			msg = fmt.Sprintf("expected error containing %q, got %q", a.Params.ErrorMessage, renderErr)
+		case a.Params.ErrorPattern != "":
+			re, err := regexp.Compile(a.Params.ErrorPattern)
+			if err != nil {
+				return fmt.Sprintf("invalid errorPattern: %v", err)
+			}
+			if !re.MatchString(renderErr.Error()) {
+				msg = fmt.Sprintf("expected error matching %q, got %q", a.Params.ErrorPattern, renderErr)
+			}
+		}
+		if a.Not {
+			if renderErr != nil {
+				return fmt.Sprintf("expected rendering to succeed, got %v", renderErr)
+			}
+			return ""
+		}
+		return msg
+	}
+	if renderErr != nil {
+		return fmt.Sprintf("rendering chart: %v", renderErr)
+	}
+
+	if a.Template != "" {
+		patterns = []string{a.Template}
+	}
+	var templates []string
+	for _, name := range slices.Sorted(maps.Keys(docs)) {
+		if len(patterns) == 0 || slices.ContainsFunc(patterns, func(p string) bool {
+			ok, _ := path.Match(p, name)
+			return ok
+		}) {
+			templates = append(templates, name)
+		}
+	}
+
+	if a.Type == "hasDocuments" {
+		if a.Params.Count == nil {
+			return "hasDocuments needs a count"
+		}
+		n := 0
+		for _, name := range templates {
+			n += len(docs[name])
+		}
+		if (n == *a.Params.Count) == a.Not {
+			return fmt.Sprintf("expected %d documents, got %d", *a.Params.Count, n)
+		}
+		return ""
+	}
+
+	name, not := a.Type, a.Not
+	if alias, ok := assertionAliases[name]; ok {
+		name, not = alias, !not
+	}
+	da, ok := docAssertions[name]
+	if !ok {
+		return "unsupported assertion"
+	}
+	idx := t.DocumentIndex
+	if a.DocumentIndex != nil {
+		idx = a.DocumentIndex
+	}
+	checked := 0
+	for _, tmpl := range templates {
+		ds := docs[tmpl]
+		if idx != nil {
+			if *idx < 0 || *idx >= len(ds) {
+				return fmt.Sprintf("%s has no document %d", tmpl, *idx)
+			}
+			ds = ds[*idx : *idx+1]
+		}
+		for _, doc := range ds {
+			checked++
+			msg := da.check(doc, a.Params)
+			switch {
+			case not && msg == "":
+				return tmpl + ": " + da.negated(a.Params)
+			case !not && msg != "":
+				return tmpl + ": " + msg
+			}
+		}
+	}
+	if checked == 0 {
+		return "no documents rendered"
+	}
+	return ""
+}
+
+// lookup returns the value at p in doc, in helm-unittest's path syntax, like
+// spec.containers[0].image or metadata.labels["app.kubernetes.io/name"].
+func lookup(doc any, p string) (any, bool) {
+	cur := doc
+	for p != "" {
+		var key any
+		switch {
+		case strings.HasPrefix(p, `["`):
+			end := strings.Index(p, `"]`)
+			if end < 0 {
+				return nil, false
+			}
+			key, p = p[2:end], p[end+2:]
+		case strings.HasPrefix(p, "["):
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, false
+			}
+			i, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, false
+			}
+			key, p = i, p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key, p = p[:end], p[end:]
+		}
+		p = strings.TrimPrefix(p, ".")
+
+		switch k := key.(type) {
+		case string:
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[k]; !ok {
+				return nil, false
+			}
+		case int:
+			l, ok := cur.([]any)
+			if !ok || k < 0 || k >= len(l) {
+				return nil, false
+			}
+			cur = l[k]
+		}
+	}
+	return cur, true
+}
+
+// setValue sets the value at the dotted path p in values, as helm's --set
+// does.
+func setValue(values map[string]any, p string, v any) {
+	keys := strings.Split(p, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := values[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			values[k] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = v
+}
+
+// normalize returns v as it would be parsed from JSON, so it compares equal
+// to values parsed from rendered documents.
+func normalize(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// isCollection reports whether v is a list or map.
+func isCollection(v any) bool {
+	k := reflect.ValueOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Map
+}
+
+// show renders v for a failure message.
+func show(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// showLookup renders the result of lookup for a failure message.
+func showLookup(v any, ok bool) string {
+	if !ok {
+		return "nothing"
+	}
+	return show(v)
+}
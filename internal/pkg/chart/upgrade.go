@@ -0,0 +1,129 @@
+package chart
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// UpgradeProblem is a change between two versions of a chart to a field
+// Kubernetes won't change in place, so upgrading a release between them is
+// likely to fail.
+type UpgradeProblem struct {
+	// Resource is the changed object as <kind>/<name>.
+	Resource string
+	// Field is the changed field's path.
+	Field string
+	// Template is the chart template that renders the resource.
+	Template string
+}
+
+func (p UpgradeProblem) String() string {
+	return fmt.Sprintf("%s: %s changed (%s)", p.Resource, p.Field, p.Template)
+}
+
+// immutableFields are the fields of each kind that can't be updated, in
+// lookup's path syntax.
+var immutableFields = map[string][]string{
+	"Deployment":            {"spec.selector"},
+	"ReplicaSet":            {"spec.selector"},
+	"DaemonSet":             {"spec.selector"},
+	"StatefulSet":           {"spec.selector", "spec.serviceName", "spec.volumeClaimTemplates", "spec.podManagementPolicy"},
+	"Job":                   {"spec.selector", "spec.template", "spec.completionMode"},
+	"Service":               {"spec.clusterIP"},
+	"PersistentVolumeClaim": {"spec.accessModes", "spec.storageClassName", "spec.volumeMode", "spec.volumeName", "spec.selector"},
+}
+
+// immutableData are the fields of ConfigMaps and Secrets marked immutable.
+var immutableData = []string{"data", "binaryData", "stringData"}
+
+// CheckUpgrade renders prev and next, both with their default values
+// overridden by values, and reports changes to the fields of objects in both
+// that Kubernetes won't update in place, like Deployment selectors and
+// StatefulSet volume claim templates. Objects are matched by kind and name.
+func CheckUpgrade(prev, next Chart, values map[string]any) ([]UpgradeProblem, error) {
+	before, err := renderObjects(prev, values)
+	if err != nil {
+		return nil, fmt.Errorf("rendering previous chart: %w", err)
+	}
+	after, err := renderObjects(next, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []UpgradeProblem
+	for _, key := range slices.Sorted(maps.Keys(after)) {
+		old, ok := before[key]
+		if !ok {
+			continue
+		}
+		obj := after[key]
+		kind, _, _ := strings.Cut(key, "/")
+		fields := immutableFields[kind]
+		if (kind == "ConfigMap" || kind == "Secret") && old.object["immutable"] == true {
+			fields = immutableData
+		}
+		for _, f := range fields {
+			was, wasSet := lookup(old.object, f)
+			is, isSet := lookup(obj.object, f)
+			if wasSet != isSet || !reflect.DeepEqual(was, is) {
+				problems = append(problems, UpgradeProblem{Resource: key, Field: f, Template: obj.template})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// renderedObject is an object a chart renders.
+type renderedObject struct {
+	object   map[string]any
+	template string
+}
+
+// renderObjects renders c, returning its objects by <kind>/<name>. Library
+// charts render nothing.
+func renderObjects(c Chart, values map[string]any) (map[string]renderedObject, error) {
+	hc, err := loadChart(c)
+	if err != nil {
+		return nil, err
+	}
+	objs := map[string]renderedObject{}
+	if hc.Metadata.Type == "library" {
+		return objs, nil
+	}
+	rendered, err := render(hc, values)
+	if err != nil {
+		return nil, err
+	}
+	for tmpl, out := range rendered {
+		if !slices.Contains([]string{".yaml", ".yml"}, path.Ext(tmpl)) {
+			continue
+		}
+		for _, doc := range releaseutil.SplitManifests(out) {
+			var obj map[string]any
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				return nil, fmt.Errorf("%s: parsing manifest: %w", tmpl, err)
+			}
+			kind, _ := obj["kind"].(string)
+			md, _ := obj["metadata"].(map[string]any)
+			objName, _ := md["name"].(string)
+			if kind == "" || objName == "" {
+				continue
+			}
+			key := kind + "/" + objName
+			// Keep the first template to render an object, whatever order
+			// the templates were rendered in.
+			if o, ok := objs[key]; !ok || cmp.Less(tmpl, o.template) {
+				objs[key] = renderedObject{object: obj, template: tmpl}
+			}
+		}
+	}
+	return objs, nil
+}
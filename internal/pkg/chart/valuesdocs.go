@@ -0,0 +1,196 @@
+package chart
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// valueDoc documents a single key of values.yaml, as a row of the table
+// helm-docs generates.
+type valueDoc struct {
+	Key, Type, Default, Description string
+}
+
+// valuesTable returns a helm-docs style markdown table of the values in
+// values, described by their "# --" comments. Like helm-docs, a comment may
+// give the type as "# -- (type) description", continue on following "#"
+// lines, and override the default with "# @default -- value". Maps are
+// documented key by key unless they have a description or are empty, and
+// lists are documented whole. It is empty if there are no values.
+func valuesTable(values []byte) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(values, &doc); err != nil {
+		return "", fmt.Errorf("parsing values.yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", nil
+	}
+
+	var docs []valueDoc
+	if err := documentValues(doc.Content[0], "", &docs); err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "", nil
+	}
+	slices.SortFunc(docs, func(a, b valueDoc) int { return strings.Compare(a.Key, b.Key) })
+
+	var b strings.Builder
+	b.WriteString("| Key | Type | Default | Description |\n")
+	b.WriteString("|-----|------|---------|-------------|\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", cell(d.Key), cell(d.Type), cell(d.Default), cell(d.Description))
+	}
+	return b.String(), nil
+}
+
+// documentValues appends the docs of the keys in m, prefixed with prefix.
+func documentValues(m *yaml.Node, prefix string, docs *[]valueDoc) error {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		key := k.Value
+		if strings.Contains(key, ".") {
+			key = `"` + key + `"`
+		}
+		key = prefix + key
+
+		desc, typ, def := parseValueComment(k.HeadComment)
+		if v.Kind == yaml.MappingNode && len(v.Content) > 0 && desc == "" {
+			if err := documentValues(v, key+".", docs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if typ == "" {
+			typ = valueType(v)
+		}
+		if def == "" {
+			var val any
+			if err := v.Decode(&val); err != nil {
+				return fmt.Errorf("decoding %s: %w", key, err)
+			}
+			if val == nil {
+				def = "nil"
+			} else {
+				b, err := json.Marshal(val)
+				if err != nil {
+					return fmt.Errorf("encoding %s: %w", key, err)
+				}
+				def = string(b)
+			}
+		}
+		*docs = append(*docs, valueDoc{Key: key, Type: typ, Default: "`" + def + "`", Description: desc})
+	}
+	return nil
+}
+
+// typePrefix matches the type a description may start with.
+var typePrefix = regexp.MustCompile(`^\(([^)]+)\)\s*`)
+
+// parseValueComment returns the description, type and default that a key's
+// head comment gives, if any.
+func parseValueComment(comment string) (desc, typ, def string) {
+	var lines []string
+	in := false
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+		switch {
+		case strings.HasPrefix(line, "-- ") || line == "--":
+			// The last "# --" comment is the one for this key.
+			lines, in = []string{strings.TrimSpace(strings.TrimPrefix(line, "--"))}, true
+		case strings.HasPrefix(line, "@default -- "):
+			def, in = strings.TrimPrefix(line, "@default -- "), false
+		case strings.HasPrefix(line, "@"):
+			in = false
+		case in && line != "":
+			lines = append(lines, line)
+		}
+	}
+	desc = strings.Join(lines, " ")
+	if m := typePrefix.FindStringSubmatch(desc); m != nil {
+		typ, desc = m[1], desc[len(m[0]):]
+	}
+	return desc, typ, def
+}
+
+// valueType returns the helm-docs type of v.
+func valueType(v *yaml.Node) string {
+	switch v.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "list"
+	}
+	switch v.Tag {
+	case "!!int":
+		return "int"
+	case "!!float":
+		return "float"
+	case "!!bool":
+		return "bool"
+	}
+	return "string"
+}
+
+// cell escapes s for a markdown table cell.
+func cell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// valuesTemplates are the helm-docs README.md.gotmpl templates the values
+// docs replace.
+var valuesTemplates = regexp.MustCompile(`\{\{-?\s*template\s+"chart\.values(Section|Table)"\s+\.\s*-?\}\}`)
+
+// valuesHeading matches the heading of a README's values section, and
+// nextHeading the heading that ends it.
+var (
+	valuesHeading = regexp.MustCompile(`(?m)^## Values[ \t]*$`)
+	nextHeading   = regexp.MustCompile(`(?m)^#{1,2} `)
+)
+
+// withValuesDocs puts table into readme. It fills in helm-docs'
+// chart.valuesSection and chart.valuesTable templates if readme uses them,
+// and otherwise replaces the README's "## Values" section, such as one
+// helm-docs generated for the upstream chart, or appends one.
+func withValuesDocs(readme []byte, table string) []byte {
+	section := ""
+	if table != "" {
+		section = "## Values\n\n" + table
+	}
+	if valuesTemplates.Match(readme) {
+		return valuesTemplates.ReplaceAllFunc(readme, func(m []byte) []byte {
+			if valuesTemplates.FindSubmatch(m)[1][0] == 'T' {
+				return []byte(table)
+			}
+			return []byte(section)
+		})
+	}
+	if loc := valuesHeading.FindIndex(readme); loc != nil {
+		end := len(readme)
+		if next := nextHeading.FindIndex(readme[loc[1]:]); next != nil {
+			end = loc[1] + next[0]
+		}
+		rest := readme[end:]
+		if len(rest) > 0 && section != "" {
+			section += "\n"
+		}
+		return slices.Concat(readme[:loc[0]], []byte(section), rest)
+	}
+	if section == "" {
+		return readme
+	}
+	sep := ""
+	if len(readme) > 0 {
+		sep = "\n"
+		if !strings.HasSuffix(string(readme), "\n") {
+			sep = "\n\n"
+		}
+	}
+	return slices.Concat(readme, []byte(sep+section))
+}
@@ -0,0 +1,86 @@
+package chart
+
+import "testing"
+
+func TestValuesTable(t *testing.T) {
+	values := `
+# -- Image to run.
+image:
+  repository: nginx
+  tag: "1.27"
+# -- (int) How many pods to run,
+# and more about it.
+replicaCount: 1
+resources: {}
+# @default -- computed from the release name
+fullnameOverride: ""
+podLabels:
+  # -- Labels | with a pipe.
+  app.kubernetes.io/part-of: example
+  enabled: true
+args: [--verbose]
+ratio: 0.5
+nothing:
+`
+	want := "| Key | Type | Default | Description |\n" +
+		"|-----|------|---------|-------------|\n" +
+		"| args | list | `[\"--verbose\"]` |  |\n" +
+		"| fullnameOverride | string | `computed from the release name` |  |\n" +
+		"| image | object | `{\"repository\":\"nginx\",\"tag\":\"1.27\"}` | Image to run. |\n" +
+		"| nothing | string | `nil` |  |\n" +
+		"| podLabels.\"app.kubernetes.io/part-of\" | string | `\"example\"` | Labels \\| with a pipe. |\n" +
+		"| podLabels.enabled | bool | `true` |  |\n" +
+		"| ratio | float | `0.5` |  |\n" +
+		"| replicaCount | int | `1` | How many pods to run, and more about it. |\n" +
+		"| resources | object | `{}` |  |\n"
+
+	got, err := valuesTable([]byte(values))
+	if err != nil {
+		t.Fatalf("valuesTable() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("valuesTable() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithValuesDocs(t *testing.T) {
+	const table = "| Key | Type | Default | Description |\n|-----|------|---------|-------------|\n| a | int | `1` |  |\n"
+	const section = "## Values\n\n" + table
+
+	tests := []struct {
+		name   string
+		readme string
+		want   string
+	}{{
+		name:   "empty",
+		readme: "",
+		want:   section,
+	}, {
+		name:   "append",
+		readme: "# chart\n\nIntro.",
+		want:   "# chart\n\nIntro.\n\n" + section,
+	}, {
+		name:   "section template",
+		readme: "# chart\n\n{{ template \"chart.valuesSection\" . }}\n\nFooter\n",
+		want:   "# chart\n\n" + section + "\n\nFooter\n",
+	}, {
+		name:   "table template",
+		readme: "## Settings\n\n{{- template \"chart.valuesTable\" . -}}\n",
+		want:   "## Settings\n\n" + table + "\n",
+	}, {
+		name:   "replace section",
+		readme: "# chart\n\n## Values\n\n| old |\n\n## Upgrading\n\nCarefully.\n",
+		want:   "# chart\n\n" + section + "\n## Upgrading\n\nCarefully.\n",
+	}, {
+		name:   "replace last section",
+		readme: "# chart\n\n## Values\n\n| old |\n",
+		want:   "# chart\n\n" + section,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(withValuesDocs([]byte(tt.readme), table)); got != tt.want {
+				t.Errorf("withValuesDocs() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
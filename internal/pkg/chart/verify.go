@@ -0,0 +1,615 @@
+package chart
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// The annotations cosign records signatures and keyless certificates under.
+const (
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignPredicateAnnotation   = "predicateType"
+	cosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+)
+
+// The Fulcio certificate extensions carrying the OIDC issuer: the original,
+// with the raw issuer as its value, and its DER-encoded replacement.
+var (
+	fulcioIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Policy is what Verify requires of an artifact's cosign signatures and
+// attestations.
+type Policy struct {
+	// PublicKey, if set, is the key signatures must verify with.
+	PublicKey crypto.PublicKey
+	// Roots, if set, are the CAs keyless signing certificates must chain to.
+	// They need RekorKey or TimestampRoots too, to prove signatures were
+	// made while their short-lived certificates were valid.
+	Roots *x509.CertPool
+	// Identity and Issuer, if set, are the subject alternative name and OIDC
+	// issuer keyless signing certificates must have been issued for.
+	// IdentityRegexp, if set, must match one of their subject alternative
+	// names instead, for signers like CI workflows whose identity varies by
+	// ref.
+	Identity       string
+	IdentityRegexp *regexp.Regexp
+	Issuer         string
+	// CTLogKeys are the keys of the certificate transparency logs keyless
+	// signing certificates must carry a signed certificate timestamp from,
+	// proving they were publicly logged. They are required with Roots.
+	CTLogKeys []crypto.PublicKey
+	// RekorKey, if set, is the key of the transparency log signatures must
+	// have been entered in, as proven by the offline bundle cosign attaches
+	// to them. Keyless certificates are then checked as of the entry's time.
+	RekorKey crypto.PublicKey
+	// TimestampRoots, if set, are the CAs of the timestamp authorities that
+	// must have countersigned signatures with an RFC 3161 timestamp. Keyless
+	// certificates are then checked as of the timestamp too.
+	TimestampRoots *x509.CertPool
+	// TimestampCerts are the signing certificates, and intermediates, of
+	// timestamp authorities that leave them out of their timestamps.
+	TimestampCerts []*x509.Certificate
+	// Predicates are the in-toto predicate types that must each be attested
+	// to by a verified attestation.
+	Predicates []string
+}
+
+// ParsePublicKey parses a PEM-encoded PKIX public key, as written by
+// cosign generate-key-pair.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// ParsePublicKeys parses one or more concatenated PEM-encoded PKIX public
+// keys, such as those of several certificate transparency logs.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var out []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pub)
+	}
+	if out == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return out, nil
+}
+
+// Verify checks that the artifact at ref has a cosign signature, and an
+// attestation for each of p.Predicates, that satisfy p. Signatures and
+// attestations are found under cosign's sha256-<hex>.sig and .att tags.
+func Verify(ref name.Digest, p Policy, opts ...remote.Option) error {
+	if p.PublicKey == nil && p.Roots == nil {
+		return errors.New("policy has neither a public key nor certificate roots")
+	}
+	if p.Roots != nil && p.RekorKey == nil && p.TimestampRoots == nil {
+		return errors.New("policy has certificate roots but neither a Rekor key nor timestamp authority roots, so nothing proves signatures were made while their certificates were valid")
+	}
+	if p.Roots != nil && len(p.CTLogKeys) == 0 {
+		return errors.New("policy has certificate roots but no certificate transparency log keys, so nothing proves certificates were publicly logged")
+	}
+	payloads, err := cosignLayers(ref, "sig", opts...)
+	if err != nil {
+		return err
+	}
+	if len(payloads) == 0 {
+		return fmt.Errorf("%s is not signed", ref)
+	}
+	var errs []error
+	for _, l := range payloads {
+		if err := p.verifySignature(ref, l); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = nil
+		break
+	}
+	if errs != nil {
+		return fmt.Errorf("no signature on %s satisfies the policy: %w", ref, errors.Join(errs...))
+	}
+
+	if len(p.Predicates) == 0 {
+		return nil
+	}
+	attestations, err := cosignLayers(ref, "att", opts...)
+	if err != nil {
+		return err
+	}
+	for _, want := range p.Predicates {
+		var (
+			errs     []error
+			verified bool
+		)
+		for _, l := range attestations {
+			if l.annotations[cosignPredicateAnnotation] != want {
+				continue
+			}
+			if err := p.verifyAttestation(ref, want, l); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			verified = true
+			break
+		}
+		switch {
+		case verified:
+		case len(errs) == 0:
+			return fmt.Errorf("%s has no %s attestation", ref, want)
+		default:
+			return fmt.Errorf("no %s attestation on %s satisfies the policy: %w", want, ref, errors.Join(errs...))
+		}
+	}
+	return nil
+}
+
+// cosignLayer is a layer of a cosign signature or attestation image.
+type cosignLayer struct {
+	payload     []byte
+	annotations map[string]string
+}
+
+// cosignLayers returns the layers of the image under ref's cosign tag with
+// the given suffix, or nothing if there is no such tag.
+func cosignLayers(ref name.Digest, suffix string, opts ...remote.Option) ([]cosignLayer, error) {
+	tag := ref.Context().Tag(fallbackTag(ref) + "." + suffix)
+	img, err := remote.Image(tag, opts...)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching %s: %w", tag, err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]cosignLayer, 0, len(m.Layers))
+	for _, desc := range m.Layers {
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		// Cosign payloads are stored as is, so read the blob rather than
+		// let the layer guess at decompressing it.
+		rc, err := l.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s layer %s: %w", tag, desc.Digest, err)
+		}
+		payload, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s layer %s: %w", tag, desc.Digest, err)
+		}
+		out = append(out, cosignLayer{payload: payload, annotations: desc.Annotations})
+	}
+	return out, nil
+}
+
+// verifySignature checks a simple signing payload signed for ref.
+func (p Policy) verifySignature(ref name.Digest, l cosignLayer) error {
+	sig, err := base64.StdEncoding.DecodeString(l.annotations[cosignSignatureAnnotation])
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	if err := p.verifyBlob(l, l.payload, l.payload, sig); err != nil {
+		return err
+	}
+
+	var payload struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(l.payload, &payload); err != nil {
+		return fmt.Errorf("parsing signature payload: %w", err)
+	}
+	if payload.Critical.Image.Digest != ref.DigestStr() {
+		return fmt.Errorf("signature is for %s", payload.Critical.Image.Digest)
+	}
+	return nil
+}
+
+// verifyAttestation checks a DSSE envelope holding an in-toto statement
+// about ref with the given predicate type.
+func (p Policy) verifyAttestation(ref name.Digest, predicateType string, l cosignLayer) error {
+	var env struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []struct {
+			Sig string `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(l.payload, &env); err != nil {
+		return fmt.Errorf("parsing attestation envelope: %w", err)
+	}
+	body, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fmt.Errorf("decoding attestation payload: %w", err)
+	}
+
+	if len(env.Signatures) == 0 {
+		return errors.New("attestation is not signed")
+	}
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(env.PayloadType), env.PayloadType, len(body), body)
+	var errs []error
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("decoding attestation signature: %w", err))
+			continue
+		}
+		if err := p.verifyBlob(l, []byte(pae), body, sig); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = nil
+		break
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+		Subject       []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+	}
+	if err := json.Unmarshal(body, &statement); err != nil {
+		return fmt.Errorf("parsing attestation statement: %w", err)
+	}
+	if statement.PredicateType != predicateType {
+		return fmt.Errorf("attestation statement is a %s", statement.PredicateType)
+	}
+	algo, hex, _ := strings.Cut(ref.DigestStr(), ":")
+	for _, s := range statement.Subject {
+		if s.Digest[algo] == hex {
+			return nil
+		}
+	}
+	return fmt.Errorf("attestation is not about %s", ref.DigestStr())
+}
+
+// verifyBlob checks sig over data with the policy's key, or with the keyless
+// certificate attached to l if it satisfies the policy. With a Rekor key,
+// logged, what the transparency log entry hashes, must have been entered in
+// the log too, by the same signer, and with timestamp roots sig must have
+// been timestamped.
+func (p Policy) verifyBlob(l cosignLayer, data, logged, sig []byte) error {
+	var cert *x509.Certificate
+	if p.PublicKey == nil {
+		certs, err := parseCertificates(l.annotations[cosignCertificateAnnotation])
+		if err != nil || len(certs) != 1 {
+			return errors.New("signature has no signing certificate")
+		}
+		cert = certs[0]
+	}
+
+	var signedAt []time.Time
+	if p.RekorKey != nil {
+		t, err := p.verifyBundle(l, logged, sig, cert)
+		if err != nil {
+			return err
+		}
+		signedAt = append(signedAt, t)
+	}
+	if p.TimestampRoots != nil {
+		t, err := p.verifyTimestamp(l, sig)
+		if err != nil {
+			return err
+		}
+		signedAt = append(signedAt, t)
+	}
+	if p.PublicKey != nil {
+		return verifyWithKey(p.PublicKey, data, sig)
+	}
+
+	if err := p.verifyCertificate(l, cert, signedAt); err != nil {
+		return err
+	}
+	return verifyWithKey(cert.PublicKey, data, sig)
+}
+
+// rekorBundle is the offline proof of a transparency log entry that cosign
+// attaches to signatures: the entry, signed by the log.
+type rekorBundle struct {
+	SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		// The fields are in the order of their canonical JSON, which the
+		// log signs.
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	} `json:"Payload"`
+}
+
+// verifyBundle checks the bundle attached to l was signed by the policy's
+// Rekor key and logs sig over logged, made by cert or, without one, the
+// policy's key, returning when it was logged. hashedrekord entries, for
+// signatures, and intoto entries, for attestations, are understood.
+func (p Policy) verifyBundle(l cosignLayer, logged, sig []byte, cert *x509.Certificate) (time.Time, error) {
+	raw, ok := l.annotations[cosignBundleAnnotation]
+	if !ok {
+		return time.Time{}, errors.New("signature has no transparency log bundle")
+	}
+	var b rekorBundle
+	if err := json.Unmarshal([]byte(raw), &b); err != nil {
+		return time.Time{}, fmt.Errorf("parsing transparency log bundle: %w", err)
+	}
+	signed, err := json.Marshal(b.Payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifyWithKey(p.RekorKey, signed, b.SignedEntryTimestamp); err != nil {
+		return time.Time{}, fmt.Errorf("verifying transparency log bundle: %w", err)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decoding transparency log entry: %w", err)
+	}
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Value string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   string `json:"content"`
+				PublicKey struct {
+					Content string `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+			Content struct {
+				// Envelope is the DSSE envelope's signatures in
+				// intoto v0.0.2 entries, and the whole envelope, as a
+				// string, in v0.0.1 ones.
+				Envelope    json.RawMessage `json:"envelope"`
+				PayloadHash struct {
+					Value string `json:"value"`
+				} `json:"payloadHash"`
+			} `json:"content"`
+			// PublicKey is the signer of intoto v0.0.1 entries.
+			PublicKey string `json:"publicKey"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, fmt.Errorf("parsing transparency log entry: %w", err)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256(logged))
+	switch entry.Kind {
+	case "hashedrekord":
+		if entry.Spec.Data.Hash.Value != want || entry.Spec.Signature.Content != base64.StdEncoding.EncodeToString(sig) {
+			return time.Time{}, errors.New("transparency log entry is for another signature")
+		}
+		if err := p.loggedSigner(entry.Spec.Signature.PublicKey.Content, cert); err != nil {
+			return time.Time{}, err
+		}
+	case "intoto":
+		if entry.Spec.Content.PayloadHash.Value != want {
+			return time.Time{}, errors.New("transparency log entry is for another attestation")
+		}
+		if err := p.loggedEnvelopeSigner(entry.Spec.Content.Envelope, entry.Spec.PublicKey, sig, cert); err != nil {
+			return time.Time{}, err
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unsupported transparency log entry kind %q", entry.Kind)
+	}
+	return time.Unix(b.Payload.IntegratedTime, 0), nil
+}
+
+// loggedEnvelopeSigner checks that an intoto entry was logged for sig by
+// cert or the policy's key. v0.0.2 entries list the envelope's signatures,
+// each with its signer, and v0.0.1 entries name a single signer.
+func (p Policy) loggedEnvelopeSigner(envelope json.RawMessage, publicKey string, sig []byte, cert *x509.Certificate) error {
+	var env struct {
+		Signatures []struct {
+			Sig       string `json:"sig"`
+			PublicKey string `json:"publicKey"`
+		} `json:"signatures"`
+	}
+	if len(envelope) == 0 || envelope[0] != '{' || json.Unmarshal(envelope, &env) != nil {
+		return p.loggedSigner(publicKey, cert)
+	}
+	// Rekor base64-encodes the envelope's signatures, which are base64
+	// already, again.
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	for _, s := range env.Signatures {
+		logged, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil || string(logged) != encoded {
+			continue
+		}
+		return p.loggedSigner(s.PublicKey, cert)
+	}
+	return errors.New("transparency log entry is for another attestation signature")
+}
+
+// loggedSigner checks that logged, the base64-encoded PEM certificate or
+// public key a transparency log entry names as its signer, is cert or,
+// without one, the policy's key.
+func (p Policy) loggedSigner(logged string, cert *x509.Certificate) error {
+	errOther := errors.New("transparency log entry was made by another signer")
+	data, err := base64.StdEncoding.DecodeString(logged)
+	if err != nil {
+		return errOther
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errOther
+	}
+	if cert != nil {
+		if block.Type != "CERTIFICATE" || !bytes.Equal(block.Bytes, cert.Raw) {
+			return errOther
+		}
+		return nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errOther
+	}
+	if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(p.PublicKey) {
+		return errOther
+	}
+	return nil
+}
+
+// verifyCertificate checks that cert, the keyless signing certificate
+// attached to l, chains to the policy's roots, was logged to one of its
+// certificate transparency logs, and names its identity. It is checked as
+// of each of signedAt, the times the signature was vouched for being made,
+// of which there must be at least one.
+func (p Policy) verifyCertificate(l cosignLayer, cert *x509.Certificate, signedAt []time.Time) error {
+	if len(signedAt) == 0 {
+		return errors.New("nothing proves when the signature was made")
+	}
+
+	intermediates := x509.NewCertPool()
+	chain, err := parseCertificates(l.annotations[cosignChainAnnotation])
+	if err != nil {
+		return fmt.Errorf("parsing certificate chain: %w", err)
+	}
+	for _, c := range chain {
+		intermediates.AddCert(c)
+	}
+	var issuer *x509.Certificate
+	for _, t := range signedAt {
+		chains, err := cert.Verify(x509.VerifyOptions{
+			Roots:         p.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   t,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err != nil {
+			return fmt.Errorf("verifying signing certificate: %w", err)
+		}
+		if len(chains[0]) < 2 {
+			return errors.New("signing certificate is a root")
+		}
+		issuer = chains[0][1]
+	}
+	if err := verifySCT(cert, issuer, p.CTLogKeys); err != nil {
+		return err
+	}
+
+	ids := certificateIdentities(cert)
+	if p.Identity != "" && !slices.Contains(ids, p.Identity) {
+		return fmt.Errorf("signing certificate is for %v, not %s", ids, p.Identity)
+	}
+	if p.IdentityRegexp != nil && !slices.ContainsFunc(ids, p.IdentityRegexp.MatchString) {
+		return fmt.Errorf("signing certificate is for %v, none matching %s", ids, p.IdentityRegexp)
+	}
+	if p.Issuer != "" {
+		if got := certificateIssuer(cert); got != p.Issuer {
+			return fmt.Errorf("signing certificate was issued by %q, not %s", got, p.Issuer)
+		}
+	}
+	return nil
+}
+
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var out []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return out, nil
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+}
+
+// certificateIdentities returns the subject alternative names of c.
+func certificateIdentities(c *x509.Certificate) []string {
+	ids := slices.Clone(c.EmailAddresses)
+	for _, u := range c.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
+// certificateIssuer returns the OIDC issuer Fulcio recorded in c.
+func certificateIssuer(c *x509.Certificate) string {
+	for _, ext := range c.Extensions {
+		switch {
+		case ext.Id.Equal(fulcioIssuerV2):
+			var s string
+			if _, err := asn1.Unmarshal(ext.Value, &s); err == nil {
+				return s
+			}
+		case ext.Id.Equal(fulcioIssuerV1):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// verifyWithKey checks sig over data the way sigstore signers produce it:
+// SHA-256 for ECDSA and RSA, and the message itself for Ed25519.
+func verifyWithKey(pub crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
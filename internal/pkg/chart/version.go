@@ -0,0 +1,115 @@
+package chart
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// RevisionFormat controls how the APK package revision is carried into the
+// published chart version.
+type RevisionFormat string
+
+const (
+	// RevisionNone publishes the chart version from Chart.yaml unchanged.
+	RevisionNone RevisionFormat = "none"
+	// RevisionMetadata appends the revision as semver build metadata, e.g. 1.2.3+r4.
+	RevisionMetadata RevisionFormat = "metadata"
+	// RevisionSuffix appends the revision as a semver pre-release, e.g. 1.2.3-r4.
+	// Note that semver orders pre-releases before the release itself.
+	RevisionSuffix RevisionFormat = "suffix"
+)
+
+// RevisionFormats lists the supported revision formats.
+var RevisionFormats = []RevisionFormat{RevisionNone, RevisionMetadata, RevisionSuffix}
+
+var apkRevisionRegex = regexp.MustCompile(`-r([0-9]+)$`)
+
+// apkVersionRegex matches the APK versions we know how to express as semver:
+// up to three numeric components, an optional pre-release suffix, and an
+// optional package revision.
+var apkVersionRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+){0,2})(?:_(alpha|beta|pre|rc)([0-9]*))?(?:-r([0-9]+))?$`)
+
+// ChartVersionFromAPK translates an APK version into a chart semver.
+//
+// Missing minor and patch components are filled with zeros, APK pre-release
+// suffixes become semver pre-releases, and the package revision is carried as
+// build metadata, so "1.2.3_rc1-r4" becomes "1.2.3-rc1+r4".
+func ChartVersionFromAPK(v string) (string, error) {
+	m := apkVersionRegex.FindStringSubmatch(v)
+	if m == nil {
+		return "", fmt.Errorf("APK version %q cannot be expressed as a chart version", v)
+	}
+
+	parts := strings.Split(m[1], ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	out := strings.Join(parts, ".")
+
+	if m[2] != "" {
+		out += "-" + m[2] + m[3]
+	}
+	if m[4] != "" {
+		out += "+r" + m[4]
+	}
+	return out, nil
+}
+
+// UpstreamVersion returns the APK version with its package revision removed,
+// e.g. 1.2.3 for 1.2.3-r4.
+func UpstreamVersion(apkVersion string) string {
+	return apkRevisionRegex.ReplaceAllString(apkVersion, "")
+}
+
+// withRevision returns chartVersion with the revision of apkVersion applied
+// according to format. Existing pre-release or build metadata identifiers are
+// extended rather than replaced.
+func withRevision(chartVersion, apkVersion string, format RevisionFormat) (string, error) {
+	if format == "" || format == RevisionNone {
+		return chartVersion, nil
+	}
+
+	m := apkRevisionRegex.FindStringSubmatch(apkVersion)
+	if m == nil {
+		return "", fmt.Errorf("APK version %q has no revision", apkVersion)
+	}
+	rev := "r" + m[1]
+
+	v, err := semver.StrictNewVersion(chartVersion)
+	if err != nil {
+		return "", fmt.Errorf("parsing chart version %q: %w", chartVersion, err)
+	}
+
+	switch format {
+	case RevisionMetadata:
+		if md := v.Metadata(); md != "" {
+			rev = md + "." + rev
+		}
+		*v, err = v.SetMetadata(rev)
+	case RevisionSuffix:
+		if pre := v.Prerelease(); pre != "" {
+			rev = pre + "." + rev
+		}
+		*v, err = v.SetPrerelease(rev)
+	default:
+		return "", fmt.Errorf("unknown revision format %q", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// ExpectedChartVersion returns the chart version a build of pkg publishes,
+// assuming Chart.yaml carries the package's upstream version, as charts
+// packaged from upstream releases do.
+func ExpectedChartVersion(pkg *Package, format RevisionFormat) (string, error) {
+	v, err := ChartVersionFromAPK(UpstreamVersion(pkg.Version))
+	if err != nil {
+		return "", err
+	}
+	return withRevision(v, pkg.Version, format)
+}
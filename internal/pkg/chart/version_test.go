@@ -0,0 +1,123 @@
+package chart
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChartVersionFromAPK(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1.2.3-r4", want: "1.2.3+r4"},
+		{in: "1.2.3-r0", want: "1.2.3+r0"},
+		{in: "1.2.3", want: "1.2.3"},
+		{in: "1.20-r1", want: "1.20.0+r1"},
+		{in: "2", want: "2.0.0"},
+		{in: "1.2.3_rc1-r0", want: "1.2.3-rc1+r0"},
+		{in: "1.2.3_beta", want: "1.2.3-beta"},
+		{in: "1.2.3.4-r0", wantErr: true},
+		{in: "1.2.3a-r0", wantErr: true},
+		{in: "1.2.3_p1-r0", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := ChartVersionFromAPK(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ChartVersionFromAPK(%q) = %q, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChartVersionFromAPK(%q) error = %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("ChartVersionFromAPK(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithRevision(t *testing.T) {
+	tests := []struct {
+		chartVersion string
+		apkVersion   string
+		format       RevisionFormat
+		want         string
+		wantErr      bool
+	}{
+		{chartVersion: "1.2.3", apkVersion: "1.2.3-r4", format: RevisionNone, want: "1.2.3"},
+		{chartVersion: "1.2.3", apkVersion: "1.2.3-r4", format: "", want: "1.2.3"},
+		{chartVersion: "1.2.3", apkVersion: "1.2.3-r4", format: RevisionMetadata, want: "1.2.3+r4"},
+		{chartVersion: "1.2.3+build", apkVersion: "1.2.3-r4", format: RevisionMetadata, want: "1.2.3+build.r4"},
+		{chartVersion: "1.2.3", apkVersion: "1.2.3-r4", format: RevisionSuffix, want: "1.2.3-r4"},
+		{chartVersion: "1.2.3-rc1", apkVersion: "1.2.3_rc1-r0", format: RevisionSuffix, want: "1.2.3-rc1.r0"},
+		{chartVersion: "1.2.3", apkVersion: "1.2.3", format: RevisionMetadata, wantErr: true},
+		{chartVersion: "1.2", apkVersion: "1.2-r0", format: RevisionMetadata, wantErr: true},
+		{chartVersion: "1.2.3", apkVersion: "1.2.3-r0", format: "bogus", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s/%s/%s", tc.chartVersion, tc.apkVersion, tc.format), func(t *testing.T) {
+			got, err := withRevision(tc.chartVersion, tc.apkVersion, tc.format)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("withRevision() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("withRevision() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("withRevision() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamVersion(t *testing.T) {
+	for in, want := range map[string]string{
+		"1.2.3-r4":     "1.2.3",
+		"1.2.3-r10":    "1.2.3",
+		"1.2.3":        "1.2.3",
+		"1.2.3_rc1-r0": "1.2.3_rc1",
+		"":             "",
+	} {
+		if got := UpstreamVersion(in); got != want {
+			t.Errorf("UpstreamVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExpectedChartVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version string
+		format  RevisionFormat
+		want    string
+	}{
+		{"1.2.3-r4", RevisionNone, "1.2.3"},
+		{"1.2.3-r4", RevisionMetadata, "1.2.3+r4"},
+		{"1.2.3-r4", RevisionSuffix, "1.2.3-r4"},
+		{"1.2-r0", "", "1.2.0"},
+		{"1.2.3_rc1-r2", RevisionMetadata, "1.2.3-rc1+r2"},
+	} {
+		got, err := ExpectedChartVersion(&Package{Version: tc.version}, tc.format)
+		if err != nil {
+			t.Errorf("ExpectedChartVersion(%q, %q): %v", tc.version, tc.format, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ExpectedChartVersion(%q, %q) = %q, want %q", tc.version, tc.format, got, tc.want)
+		}
+	}
+
+	if _, err := ExpectedChartVersion(&Package{Version: "1.2.3.4-r0"}, RevisionNone); err == nil {
+		t.Error("ExpectedChartVersion(1.2.3.4-r0) succeeded, want error")
+	}
+}
@@ -0,0 +1,68 @@
+// Package scratch provides private temporary directories scoped to one
+// operation, such as a chart build, so operations run at once, in one
+// process or many, never share paths.
+package scratch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Dir is a temporary directory for one operation. It is made when first
+// needed, so operations that don't need one don't make one, and removed by
+// Close or once the operation's context is done, whichever comes first.
+type Dir struct {
+	parent string
+	stop   func() bool
+
+	mu      sync.Mutex
+	dir     string
+	removed bool
+}
+
+// New returns a Dir to be made in parent, or in the default directory for
+// temporary files if parent is "", and removed once ctx is done.
+func New(ctx context.Context, parent string) *Dir {
+	d := &Dir{parent: parent}
+	d.stop = context.AfterFunc(ctx, func() { d.Close() })
+	return d
+}
+
+// Path returns the directory, making it if this is the first call.
+func (d *Dir) Path() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.removed {
+		return "", errors.New("temporary directory already removed")
+	}
+	if d.dir == "" {
+		dir, err := os.MkdirTemp(d.parent, "terraform-provider-helm-")
+		if err != nil {
+			return "", err
+		}
+		d.dir = dir
+	}
+	return d.dir, nil
+}
+
+// Close removes the directory and everything in it, if it was made. Once
+// removed, it isn't made again.
+func (d *Dir) Close() error {
+	d.stop()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.removed {
+		return nil
+	}
+	d.removed = true
+	if d.dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(d.dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
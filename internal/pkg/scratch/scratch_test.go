@@ -0,0 +1,51 @@
+package scratch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	parent := t.TempDir()
+
+	d := New(t.Context(), parent)
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Fatalf("New() made %s before it was needed", entries[0].Name())
+	}
+	dir, err := d.Path()
+	if err != nil {
+		t.Fatalf("Path() = %v", err)
+	}
+	if again, _ := d.Path(); again != dir {
+		t.Errorf("Path() = %s, then %s", dir, again)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after Close()", dir)
+	}
+	if _, err := d.Path(); err == nil {
+		t.Error("Path() after Close() succeeded")
+	}
+
+	// A dir is removed once its context is done.
+	ctx, cancel := context.WithCancel(t.Context())
+	d = New(ctx, parent)
+	if dir, err = d.Path(); err != nil {
+		t.Fatalf("Path() = %v", err)
+	}
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return
+		}
+	}
+	t.Errorf("%s still exists after its context was canceled", dir)
+}
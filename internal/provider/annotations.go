@@ -0,0 +1,65 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+// ecrAnnotationLimit is the longest annotation value, in bytes, ECR accepts.
+const ecrAnnotationLimit = 4096
+
+// registryAnnotationLimit returns the longest annotation value, in bytes,
+// the registry at host is known to accept, or 0 if it isn't known to limit
+// them.
+func registryAnnotationLimit(host string) int {
+	if ecrHost.MatchString(host) || host == ecrPublicHost {
+		return ecrAnnotationLimit
+	}
+	return 0
+}
+
+// annotationLimit returns max_annotation_size, or else the limit of the
+// registry data.Repo is in, or 0 for no limit.
+func annotationLimit(data *helmChartResourceModel) int {
+	if !data.MaxAnnotationSize.IsNull() && !data.MaxAnnotationSize.IsUnknown() {
+		return int(data.MaxAnnotationSize.ValueInt64())
+	}
+	repo, err := name.NewRepository(data.Repo.ValueString())
+	if err != nil {
+		return 0
+	}
+	return registryAnnotationLimit(repo.RegistryStr())
+}
+
+// checkAnnotationSizes fails when annotations on c's manifest are longer
+// than annotationLimit allows, naming them, or with truncate_annotations set
+// warns that they were truncated.
+func checkAnnotationSizes(data *helmChartResourceModel, c chart.Chart) diag.Diagnostics {
+	limit := annotationLimit(data)
+	if limit == 0 {
+		return nil
+	}
+	keys, err := chart.OversizedAnnotations(c, limit)
+	if err != nil {
+		return diag.Diagnostics{diag.NewErrorDiagnostic("getting chart manifest", err.Error())}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if data.TruncateAnnotations.ValueBool() {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("truncate_annotations"), "truncated annotations",
+			fmt.Sprintf("These annotations were cut to %d bytes: %s.", limit, strings.Join(keys, ", ")))}
+	}
+	return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("max_annotation_size"), "annotations too large",
+		fmt.Sprintf("These annotations are longer than the %d bytes the registry accepts: %s. Set truncate_annotations to cut them to fit, or leave them out with the provider's copy_chart_annotations.", limit, strings.Join(keys, ", ")))}
+}
@@ -0,0 +1,24 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import "testing"
+
+func TestRegistryAnnotationLimit(t *testing.T) {
+	for host, want := range map[string]int{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com":     ecrAnnotationLimit,
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn": ecrAnnotationLimit,
+		"public.ecr.aws":    ecrAnnotationLimit,
+		"ghcr.io":           0,
+		"ecr.example.com":   0,
+		"us-docker.pkg.dev": 0,
+		"localhost:5000":    0,
+	} {
+		if got := registryAnnotationLimit(host); got != want {
+			t.Errorf("registryAnnotationLimit(%q) = %d, want %d", host, got, want)
+		}
+	}
+}
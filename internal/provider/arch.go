@@ -0,0 +1,106 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	apkotypes "chainguard.dev/apko/pkg/build/types"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+var (
+	_ basetypes.StringTypable                    = archType{}
+	_ basetypes.StringValuableWithSemanticEquals = archValue{}
+)
+
+// archType is a string type for package architectures that treats APK and Go
+// spellings of the same architecture (x86_64 and amd64, aarch64 and arm64) as
+// equal, so switching between them doesn't produce a diff.
+type archType struct {
+	basetypes.StringType
+}
+
+func (t archType) Equal(o attr.Type) bool {
+	other, ok := o.(archType)
+	if !ok {
+		return false
+	}
+	return t.StringType.Equal(other.StringType)
+}
+
+func (t archType) String() string {
+	return "archType"
+}
+
+func (t archType) ValueFromString(_ context.Context, in basetypes.StringValue) (basetypes.StringValuable, diag.Diagnostics) {
+	return archValue{StringValue: in}, nil
+}
+
+func (t archType) ValueFromTerraform(ctx context.Context, in tftypes.Value) (attr.Value, error) {
+	v, err := t.StringType.ValueFromTerraform(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	sv, ok := v.(basetypes.StringValue)
+	if !ok {
+		return nil, fmt.Errorf("unexpected value type of %T", v)
+	}
+
+	return archValue{StringValue: sv}, nil
+}
+
+func (t archType) ValueType(context.Context) attr.Value {
+	return archValue{}
+}
+
+// archValue is the value of an archType attribute.
+type archValue struct {
+	basetypes.StringValue
+}
+
+func (v archValue) Equal(o attr.Value) bool {
+	other, ok := o.(archValue)
+	if !ok {
+		return false
+	}
+	return v.StringValue.Equal(other.StringValue)
+}
+
+func (v archValue) Type(context.Context) attr.Type {
+	return archType{}
+}
+
+func (v archValue) StringSemanticEquals(_ context.Context, newValuable basetypes.StringValuable) (bool, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	nv, ok := newValuable.(archValue)
+	if !ok {
+		diags.AddError("Semantic Equality Check Error", fmt.Sprintf("Expected value type %T, got %T. Please report this issue to the provider developers.", v, newValuable))
+		return false, diags
+	}
+
+	return v.Canonical() == nv.Canonical(), diags
+}
+
+// Canonical returns the APK name of the architecture, e.g. x86_64 for amd64.
+// Null, unknown, and empty values canonicalize to the empty string.
+func (v archValue) Canonical() string {
+	return canonicalArch(v.ValueString())
+}
+
+// canonicalArch returns the APK name of arch, or the empty string if arch is empty.
+func canonicalArch(arch string) string {
+	if arch == "" {
+		return ""
+	}
+	return apkotypes.ParseArchitecture(arch).ToAPK()
+}
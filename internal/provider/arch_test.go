@@ -0,0 +1,56 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+)
+
+func TestArchValueSemanticEquals(t *testing.T) {
+	tests := []struct {
+		prior, next string
+		want        bool
+	}{
+		{prior: "x86_64", next: "x86_64", want: true},
+		{prior: "x86_64", next: "amd64", want: true},
+		{prior: "amd64", next: "x86_64", want: true},
+		{prior: "aarch64", next: "arm64", want: true},
+		{prior: "x86_64", next: "aarch64", want: false},
+		{prior: "amd64", next: "arm64", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.prior+"/"+tc.next, func(t *testing.T) {
+			prior := archValue{StringValue: basetypes.NewStringValue(tc.prior)}
+			next := archValue{StringValue: basetypes.NewStringValue(tc.next)}
+
+			got, diags := prior.StringSemanticEquals(t.Context(), next)
+			if diags.HasError() {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if got != tc.want {
+				t.Errorf("StringSemanticEquals() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalArch(t *testing.T) {
+	for in, want := range map[string]string{
+		"":        "",
+		"amd64":   "x86_64",
+		"x86_64":  "x86_64",
+		"arm64":   "aarch64",
+		"aarch64": "aarch64",
+		"armv7":   "armv7",
+	} {
+		if got := canonicalArch(in); got != want {
+			t.Errorf("canonicalArch(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
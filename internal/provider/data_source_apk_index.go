@@ -0,0 +1,186 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &apkIndexDataSource{}
+	_ datasource.DataSourceWithConfigure = &apkIndexDataSource{}
+)
+
+// NewAPKIndexDataSource is a helper function to simplify the provider implementation.
+func NewAPKIndexDataSource() datasource.DataSource {
+	return &apkIndexDataSource{}
+}
+
+// apkIndexDataSource is the data source implementation.
+type apkIndexDataSource struct {
+	client *helmClient
+}
+
+// apkIndexDataSourceModel maps the data source schema data.
+type apkIndexDataSourceModel struct {
+	Repositories types.List           `tfsdk:"repositories"`
+	Arch         archValue            `tfsdk:"arch"`
+	Packages     []apkIndexEntryModel `tfsdk:"packages"`
+}
+
+// apkIndexEntryModel maps a single package in the index.
+type apkIndexEntryModel struct {
+	Name         types.String `tfsdk:"name"`
+	Version      types.String `tfsdk:"version"`
+	Arch         types.String `tfsdk:"arch"`
+	Description  types.String `tfsdk:"description"`
+	Dependencies types.List   `tfsdk:"dependencies"`
+	Repository   types.String `tfsdk:"repository"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *apkIndexDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *apkIndexDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_apk_index"
+}
+
+// Schema defines the schema for the data source.
+func (d *apkIndexDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Lists the packages in the APKINDEX of one or more package repositories.",
+		Attributes: map[string]schema.Attribute{
+			"repositories": schema.ListAttribute{
+				Optional:    true,
+				Description: "The URLs of the package repositories to read. Defaults to the provider's `extra_repositories` and `build_repositories`. Keys and the other resolution settings are still the provider's, so for another ecosystem's repositories, use a provider alias configured for them.",
+				ElementType: types.StringType,
+			},
+			"arch": schema.StringAttribute{
+				Optional:    true,
+				Description: "The architecture whose index to read. If not specified, uses the provider default_arch or falls back to system defaults.",
+				CustomType:  archType{},
+				Validators: []validator.String{
+					archValidator{},
+				},
+			},
+			"packages": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The packages in the index, sorted by name and then version.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Computed:    true,
+							Description: "The package name.",
+						},
+						"version": schema.StringAttribute{
+							Computed:    true,
+							Description: "The full package version, including the revision.",
+						},
+						"arch": schema.StringAttribute{
+							Computed:    true,
+							Description: "The package architecture.",
+						},
+						"description": schema.StringAttribute{
+							Computed:    true,
+							Description: "The package description.",
+						},
+						"dependencies": schema.ListAttribute{
+							Computed:    true,
+							Description: "The package's runtime dependencies.",
+							ElementType: types.StringType,
+						},
+						"repository": schema.StringAttribute{
+							Computed:    true,
+							Description: "The repository whose index lists the package.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *apkIndexDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data apkIndexDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, diags := d.client.indexConfig(ctx, data.Repositories, data.Arch)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	entries, err := chart.ListIndex(ctx, config)
+	if err != nil {
+		resp.Diagnostics.AddError("listing package index", err.Error())
+		return
+	}
+
+	data.Packages = make([]apkIndexEntryModel, 0, len(entries))
+	for _, e := range entries {
+		deps, diags := types.ListValueFrom(ctx, types.StringType, e.Dependencies)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		data.Packages = append(data.Packages, apkIndexEntryModel{
+			Name:         types.StringValue(e.Name),
+			Version:      types.StringValue(e.Version),
+			Arch:         types.StringValue(e.Arch),
+			Description:  types.StringValue(e.Description),
+			Dependencies: deps,
+			Repository:   types.StringValue(e.Repository),
+		})
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// indexConfig returns the settings for reading package indexes. repos
+// overrides the provider's repositories when set, and arch its default_arch.
+// Keys are still the provider's, so repos from another ecosystem are better
+// read through a provider alias for it.
+func (c *helmClient) indexConfig(ctx context.Context, repos types.List, arch archValue) (*chart.BuildConfig, diag.Diagnostics) {
+	config := c.resolveConfig(arch.Canonical())
+	if !repos.IsNull() {
+		var rs []string
+		if diags := repos.ElementsAs(ctx, &rs, false); diags.HasError() {
+			return nil, diags
+		}
+		config.RuntimeRepos = rs
+		config.BuildRepos = nil
+	}
+	return config, nil
+}
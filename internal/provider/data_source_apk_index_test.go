@@ -0,0 +1,59 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccAPKIndexDataSource(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	for _, v := range []string{"0.0.2-r0", "0.0.1-r0"} {
+		if err := repo.AddChart(testkit.ChartPackage{
+			Name:    "chart-versioned",
+			Version: v,
+			Chart:   os.DirFS("../../testdata/charts/versioned"),
+		}); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_keyrings = [%q]
+}
+
+data "helm_apk_index" "test" {
+  repositories = [%q]
+  arch         = "amd64"
+}
+`, repo.KeyPath(), repo.Path()),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.helm_apk_index.test", "packages.#", "2"),
+					resource.TestCheckResourceAttr("data.helm_apk_index.test", "packages.0.name", "chart-versioned"),
+					resource.TestCheckResourceAttr("data.helm_apk_index.test", "packages.0.version", "0.0.1-r0"),
+					resource.TestCheckResourceAttr("data.helm_apk_index.test", "packages.0.arch", "x86_64"),
+					resource.TestCheckResourceAttr("data.helm_apk_index.test", "packages.1.version", "0.0.2-r0"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &chartExistsDataSource{}
+	_ datasource.DataSourceWithConfigure = &chartExistsDataSource{}
+)
+
+// NewChartExistsDataSource is a helper function to simplify the provider implementation.
+func NewChartExistsDataSource() datasource.DataSource {
+	return &chartExistsDataSource{}
+}
+
+// chartExistsDataSource is the data source implementation.
+type chartExistsDataSource struct {
+	client *helmClient
+}
+
+// chartExistsDataSourceModel maps the data source schema data.
+type chartExistsDataSourceModel struct {
+	Ref    types.String `tfsdk:"ref"`
+	Exists types.Bool   `tfsdk:"exists"`
+	Digest types.String `tfsdk:"digest"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *chartExistsDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *chartExistsDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_exists"
+}
+
+// Schema defines the schema for the data source.
+func (d *chartExistsDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Checks whether a chart reference exists in a registry, without pulling it.",
+		Attributes: map[string]schema.Attribute{
+			"ref": schema.StringAttribute{
+				Required:    true,
+				Description: "The reference to check, by tag (`registry.example.com/charts/foo:1.2.3`) or sha256 or sha512 digest (`registry.example.com/charts/foo@sha256:...`).",
+			},
+			"exists": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the registry has the reference.",
+			},
+			"digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest the reference resolves to, or null if it doesn't exist.",
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *chartExistsDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data chartExistsDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseReference(data.Ref.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing chart reference", err.Error())
+		return
+	}
+
+	data.Exists = types.BoolValue(false)
+	data.Digest = types.StringNull()
+
+	desc, err := remote.Head(ref, d.client.remoteOpts(ctx)...)
+	if err != nil {
+		var terr *transport.Error
+		if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+			resp.Diagnostics.AddError("checking chart in registry", err.Error())
+			return
+		}
+	} else {
+		data.Exists = types.BoolValue(true)
+		data.Digest = types.StringValue(desc.Digest.String())
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccChartExistsDataSource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %[1]q
+  package_name = "chart-basic"
+  tags         = ["0.0.1"]
+}
+
+data "helm_chart_exists" "tag" {
+  ref = "%[1]s:${helm_chart.test.chart_version}"
+}
+
+data "helm_chart_exists" "digest" {
+  ref = helm_chart.test.id
+}
+
+data "helm_chart_exists" "missing" {
+  ref        = "%[1]s:9.9.9"
+  depends_on = [helm_chart.test]
+}
+`, reg.Repo("exists")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.helm_chart_exists.tag", "exists", "true"),
+					resource.TestCheckResourceAttrPair("data.helm_chart_exists.tag", "digest", "helm_chart.test", "digest"),
+					resource.TestCheckResourceAttr("data.helm_chart_exists.digest", "exists", "true"),
+					resource.TestCheckResourceAttr("data.helm_chart_exists.missing", "exists", "false"),
+					resource.TestCheckNoResourceAttr("data.helm_chart_exists.missing", "digest"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &chartManifestDataSource{}
+	_ datasource.DataSourceWithConfigure = &chartManifestDataSource{}
+)
+
+// NewChartManifestDataSource is a helper function to simplify the provider implementation.
+func NewChartManifestDataSource() datasource.DataSource {
+	return &chartManifestDataSource{}
+}
+
+// chartManifestDataSource is the data source implementation.
+type chartManifestDataSource struct {
+	client *helmClient
+}
+
+// chartManifestDataSourceModel maps the data source schema data.
+type chartManifestDataSourceModel struct {
+	Ref          types.String    `tfsdk:"ref"`
+	Digest       types.String    `tfsdk:"digest"`
+	ManifestJSON types.String    `tfsdk:"manifest_json"`
+	ConfigJSON   types.String    `tfsdk:"config_json"`
+	Annotations  types.Map       `tfsdk:"annotations"`
+	Referrers    []referrerModel `tfsdk:"referrers"`
+}
+
+// referrerModel maps a single artifact attached to the chart.
+type referrerModel struct {
+	Digest       types.String `tfsdk:"digest"`
+	MediaType    types.String `tfsdk:"media_type"`
+	ArtifactType types.String `tfsdk:"artifact_type"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *chartManifestDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *chartManifestDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_manifest"
+}
+
+// Schema defines the schema for the data source.
+func (d *chartManifestDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Reads a published chart's manifest, config and annotations, and lists what is attached to it, such as signatures and SBOMs, for audit reports.",
+		Attributes: map[string]schema.Attribute{
+			"ref": schema.StringAttribute{
+				Required:    true,
+				Description: "The chart to read, by tag (`registry.example.com/charts/foo:1.2.3`) or sha256 or sha512 digest (`registry.example.com/charts/foo@sha256:...`).",
+			},
+			"digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the chart's manifest.",
+			},
+			"manifest_json": schema.StringAttribute{
+				Computed:    true,
+				Description: "The chart's manifest, exactly as it is in the registry.",
+			},
+			"config_json": schema.StringAttribute{
+				Computed:    true,
+				Description: "The chart's config blob, the JSON form of its Chart.yaml, exactly as it is in the registry.",
+			},
+			"annotations": schema.MapAttribute{
+				Computed:    true,
+				Description: "The annotations on the chart's manifest.",
+				ElementType: types.StringType,
+			},
+			"referrers": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The artifacts attached to the chart: those the OCI referrers API, or its fallback tag, lists, then those cosign attached under its `sha256-<hex>.sig`, `.att` and `.sbom` tags. Attachments of attachments, like a signature on an SBOM, aren't listed.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"digest": schema.StringAttribute{
+							Computed:    true,
+							Description: "The digest of the attached artifact's manifest.",
+						},
+						"media_type": schema.StringAttribute{
+							Computed:    true,
+							Description: "The media type of the attached artifact's manifest.",
+						},
+						"artifact_type": schema.StringAttribute{
+							Computed:    true,
+							Description: "The type of the attached artifact, such as `application/spdx+json`, if the registry reports one. It is null for artifacts attached by cosign tag.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *chartManifestDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data chartManifestDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseReference(data.Ref.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing chart reference", err.Error())
+		return
+	}
+
+	ocichart, err := chart.Pull(ref, d.client.remoteOpts(ctx)...)
+	if err != nil {
+		resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+		return
+	}
+	digest, err := ocichart.Digest()
+	if err != nil {
+		resp.Diagnostics.AddError("getting chart digest", err.Error())
+		return
+	}
+	rawManifest, err := ocichart.RawManifest()
+	if err != nil {
+		resp.Diagnostics.AddError("getting chart manifest", err.Error())
+		return
+	}
+	m, err := ocichart.Manifest()
+	if err != nil {
+		resp.Diagnostics.AddError("getting chart manifest", err.Error())
+		return
+	}
+	rawConfig, err := ocichart.RawConfigFile()
+	if err != nil {
+		resp.Diagnostics.AddError("getting chart config", err.Error())
+		return
+	}
+
+	referrers, err := chart.Referrers(ref.Context().Digest(digest.String()), d.client.remoteOpts(ctx)...)
+	if err != nil {
+		resp.Diagnostics.AddError("listing chart referrers", err.Error())
+		return
+	}
+
+	data.Digest = types.StringValue(digest.String())
+	data.ManifestJSON = types.StringValue(string(rawManifest))
+	data.ConfigJSON = types.StringValue(string(rawConfig))
+	annotations, diags := types.MapValueFrom(ctx, types.StringType, m.Annotations)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.Annotations = annotations
+	data.Referrers = []referrerModel{}
+	for _, r := range referrers {
+		artifactType := types.StringNull()
+		if r.ArtifactType != "" {
+			artifactType = types.StringValue(r.ArtifactType)
+		}
+		data.Referrers = append(data.Referrers, referrerModel{
+			Digest:       types.StringValue(r.Digest.String()),
+			MediaType:    types.StringValue(string(r.MediaType)),
+			ArtifactType: artifactType,
+		})
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
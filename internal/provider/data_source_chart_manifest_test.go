@@ -0,0 +1,56 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccChartManifestDataSource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %[1]q
+  package_name = "chart-basic"
+  tags         = ["0.0.1"]
+  scan = {
+    fail_on = "CRITICAL"
+    attest  = true
+  }
+}
+
+data "helm_chart_manifest" "test" {
+  ref = "%[1]s:${helm_chart.test.chart_version}"
+}
+`, reg.Repo("manifest")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("data.helm_chart_manifest.test", "digest", "helm_chart.test", "digest"),
+					resource.TestCheckResourceAttrPair("data.helm_chart_manifest.test", "manifest_json", "helm_chart.test", "manifest_json"),
+					resource.TestCheckResourceAttrPair("data.helm_chart_manifest.test", "config_json", "helm_chart.test", "config_json"),
+					resource.TestCheckResourceAttr("data.helm_chart_manifest.test", "annotations.org.opencontainers.image.title", "basic"),
+					resource.TestCheckResourceAttr("data.helm_chart_manifest.test", "referrers.#", "1"),
+					resource.TestCheckResourceAttrPair("data.helm_chart_manifest.test", "referrers.0.digest", "helm_chart.test", "scan_attestation"),
+					resource.TestCheckResourceAttr("data.helm_chart_manifest.test", "referrers.0.artifact_type", "application/vnd.in-toto+json"),
+				),
+			},
+		},
+	})
+}
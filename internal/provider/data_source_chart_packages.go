@@ -0,0 +1,191 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &chartPackagesDataSource{}
+	_ datasource.DataSourceWithConfigure = &chartPackagesDataSource{}
+)
+
+// NewChartPackagesDataSource is a helper function to simplify the provider implementation.
+func NewChartPackagesDataSource() datasource.DataSource {
+	return &chartPackagesDataSource{}
+}
+
+// chartPackagesDataSource is the data source implementation.
+type chartPackagesDataSource struct {
+	client *helmClient
+}
+
+// chartPackagesDataSourceModel maps the data source schema data.
+type chartPackagesDataSourceModel struct {
+	Pattern      types.String        `tfsdk:"pattern"`
+	Repositories types.List          `tfsdk:"repositories"`
+	Arch         archValue           `tfsdk:"arch"`
+	Names        types.List          `tfsdk:"names"`
+	Packages     []chartPackageModel `tfsdk:"packages"`
+}
+
+// chartPackageModel maps a single discovered package.
+type chartPackageModel struct {
+	Name    types.String `tfsdk:"name"`
+	Version types.String `tfsdk:"version"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *chartPackagesDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *chartPackagesDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_packages"
+}
+
+// Schema defines the schema for the data source.
+func (d *chartPackagesDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Discovers the chart packages in one or more package repositories by name, so a whole catalog can be published with for_each.",
+		Attributes: map[string]schema.Attribute{
+			"pattern": schema.StringAttribute{
+				Required:    true,
+				Description: "A shell glob, as understood by Go's path.Match, that package names must match, such as `chart-*`. Repositories name chart packages differently, so there is no default.",
+				Validators: []validator.String{
+					globValidator{},
+				},
+			},
+			"repositories": schema.ListAttribute{
+				Optional:    true,
+				Description: "The URLs of the package repositories to search. Defaults to the provider's `extra_repositories` and `build_repositories`. Keys and the other resolution settings are still the provider's, so for another ecosystem's repositories, use a provider alias configured for them.",
+				ElementType: types.StringType,
+			},
+			"arch": schema.StringAttribute{
+				Optional:    true,
+				Description: "The architecture whose index to search. If not specified, uses the provider default_arch or falls back to system defaults.",
+				CustomType:  archType{},
+				Validators: []validator.String{
+					archValidator{},
+				},
+			},
+			"names": schema.ListAttribute{
+				Computed:    true,
+				Description: "The names of the matching packages, sorted. Use `toset()` to pass them to for_each.",
+				ElementType: types.StringType,
+			},
+			"packages": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The matching packages, sorted by name.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Computed:    true,
+							Description: "The package name.",
+						},
+						"version": schema.StringAttribute{
+							Computed:    true,
+							Description: "The newest available version of the package, including the revision.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *chartPackagesDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data chartPackagesDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, diags := d.client.indexConfig(ctx, data.Repositories, data.Arch)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	entries, err := chart.ListIndex(ctx, config)
+	if err != nil {
+		resp.Diagnostics.AddError("listing package index", err.Error())
+		return
+	}
+
+	var names []string
+	data.Packages = []chartPackageModel{}
+	for _, e := range discoverChartPackages(entries, data.Pattern.ValueString()) {
+		names = append(names, e.Name)
+		data.Packages = append(data.Packages, chartPackageModel{
+			Name:    types.StringValue(e.Name),
+			Version: types.StringValue(e.Version),
+		})
+	}
+
+	data.Names, diags = types.ListValueFrom(ctx, types.StringType, names)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// discoverChartPackages returns the newest entry for each package name in
+// entries that matches pattern. entries must be sorted as ListIndex sorts them.
+func discoverChartPackages(entries []chart.IndexEntry, pattern string) []chart.IndexEntry {
+	var out []chart.IndexEntry
+	for i, e := range entries {
+		// The last entry for each name is its newest version.
+		if i+1 < len(entries) && entries[i+1].Name == e.Name {
+			continue
+		}
+		if ok, _ := path.Match(pattern, e.Name); !ok {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// unpublishedDependencies returns the deps matching pattern that aren't in
+// published.
+func unpublishedDependencies(deps []string, pattern string, published []string) []string {
+	var out []string
+	for _, d := range deps {
+		if ok, _ := path.Match(pattern, d); ok && !slices.Contains(published, d) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccChartPackagesDataSource(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-versioned", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/versioned")},
+		{Name: "chart-versioned", Version: "0.0.2-r0", Chart: os.DirFS("../../testdata/charts/versioned")},
+		{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")},
+		{Name: "basic-notachart", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	config := func(pattern string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+data "helm_chart_packages" "test" {
+  %s
+}
+`, repo.Path(), repo.KeyPath(), pattern)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(""),
+				ExpectError: regexp.MustCompile(`"pattern" is required`),
+			},
+			{
+				Config: config(`pattern = "chart-*"`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "names.#", "2"),
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "names.0", "chart-basic"),
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "names.1", "chart-versioned"),
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "packages.1.version", "0.0.2-r0"),
+				),
+			},
+			{
+				Config: config(`pattern = "*-basic"`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "names.#", "1"),
+					resource.TestCheckResourceAttr("data.helm_chart_packages.test", "names.0", "chart-basic"),
+				),
+			},
+		},
+	})
+}
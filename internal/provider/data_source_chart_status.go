@@ -0,0 +1,184 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &chartStatusDataSource{}
+	_ datasource.DataSourceWithConfigure = &chartStatusDataSource{}
+)
+
+// NewChartStatusDataSource is a helper function to simplify the provider implementation.
+func NewChartStatusDataSource() datasource.DataSource {
+	return &chartStatusDataSource{}
+}
+
+// chartStatusDataSource is the data source implementation.
+type chartStatusDataSource struct {
+	client *helmClient
+}
+
+// chartStatusDataSourceModel maps the data source schema data.
+type chartStatusDataSourceModel struct {
+	Ref            types.String `tfsdk:"ref"`
+	ExpectedDigest types.String `tfsdk:"expected_digest"`
+	Exists         types.Bool   `tfsdk:"exists"`
+	Digest         types.String `tfsdk:"digest"`
+	DigestMatches  types.Bool   `tfsdk:"digest_matches"`
+	Signed         types.Bool   `tfsdk:"signed"`
+	HasSBOM        types.Bool   `tfsdk:"has_sbom"`
+	Attested       types.Bool   `tfsdk:"attested"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *chartStatusDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *chartStatusDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_status"
+}
+
+// Schema defines the schema for the data source.
+func (d *chartStatusDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Reports whether a published chart exists, is at the expected digest, and is signed, has an SBOM and is attested, for assertions in `check` blocks. Only manifests are requested, never the chart or its attachments, so it is cheap to read on every refresh. Nothing is verified, only looked for; use `verify` on `helm_chart_promotion` to verify signatures.",
+		Attributes: map[string]schema.Attribute{
+			"ref": schema.StringAttribute{
+				Required:    true,
+				Description: "The chart to check, by tag (`registry.example.com/charts/foo:1.2.3`) or sha256 or sha512 digest (`registry.example.com/charts/foo@sha256:...`).",
+			},
+			"expected_digest": schema.StringAttribute{
+				Optional:    true,
+				Description: "The digest `ref` should resolve to, such as a `helm_chart`'s `digest`, for `digest_matches`.",
+			},
+			"exists": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the registry has the chart. When it doesn't, the other checks are false.",
+			},
+			"digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest the reference resolves to, or null if it doesn't exist.",
+			},
+			"digest_matches": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the reference resolves to `expected_digest`, or null if that isn't set.",
+			},
+			"signed": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether a Notary Project or cosign signature is attached to the chart.",
+			},
+			"has_sbom": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether an SPDX, CycloneDX or Syft SBOM is attached to the chart.",
+			},
+			"attested": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether an in-toto attestation, such as a `scan` report, is attached to the chart.",
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *chartStatusDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data chartStatusDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseReference(data.Ref.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing chart reference", err.Error())
+		return
+	}
+
+	data.Exists = types.BoolValue(false)
+	data.Digest = types.StringNull()
+	data.DigestMatches = types.BoolNull()
+	if !data.ExpectedDigest.IsNull() {
+		data.DigestMatches = types.BoolValue(false)
+	}
+	data.Signed = types.BoolValue(false)
+	data.HasSBOM = types.BoolValue(false)
+	data.Attested = types.BoolValue(false)
+
+	desc, err := remote.Head(ref, d.client.remoteOpts(ctx)...)
+	if err != nil {
+		var terr *transport.Error
+		if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+			resp.Diagnostics.AddError("checking chart in registry", err.Error())
+			return
+		}
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	}
+	data.Exists = types.BoolValue(true)
+	data.Digest = types.StringValue(desc.Digest.String())
+	if want := data.ExpectedDigest.ValueString(); !data.ExpectedDigest.IsNull() {
+		got := desc.Digest.String()
+		// The registry reports sha256 digests, so others are computed from
+		// the manifest.
+		if alg, _, _ := strings.Cut(want, ":"); alg != desc.Digest.Algorithm {
+			if got, err = manifestDigest(ctx, d.client, ref, alg); err != nil {
+				resp.Diagnostics.AddError("checking chart digest", err.Error())
+				return
+			}
+		}
+		data.DigestMatches = types.BoolValue(want == got)
+	}
+
+	attached, err := chart.Attachments(ref.Context().Digest(desc.Digest.String()), d.client.remoteOpts(ctx)...)
+	if err != nil {
+		resp.Diagnostics.AddError("listing chart attachments", err.Error())
+		return
+	}
+	data.Signed = types.BoolValue(attached.Signed)
+	data.HasSBOM = types.BoolValue(attached.SBOM)
+	data.Attested = types.BoolValue(attached.Attested)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// manifestDigest returns the digest by algorithm of the manifest at ref.
+func manifestDigest(ctx context.Context, client *helmClient, ref name.Reference, algorithm string) (string, error) {
+	desc, err := remote.Get(ref, client.remoteOpts(ctx)...)
+	if err != nil {
+		return "", err
+	}
+	return chart.ManifestDigest(desc.Manifest, algorithm)
+}
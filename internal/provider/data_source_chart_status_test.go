@@ -0,0 +1,66 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccChartStatusDataSource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %[1]q
+  package_name = "chart-basic"
+}
+
+data "helm_chart_status" "published" {
+  ref             = "%[1]s:${helm_chart.test.chart_version}"
+  expected_digest = helm_chart.test.digest
+}
+
+data "helm_chart_status" "missing" {
+  ref             = "%[1]s:9.9.9"
+  expected_digest = helm_chart.test.digest
+}
+
+check "published" {
+  assert {
+    condition     = data.helm_chart_status.published.digest_matches
+    error_message = "The published chart isn't the one in state."
+  }
+}
+`, reg.Repo("status")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.helm_chart_status.published", "exists", "true"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.published", "digest_matches", "true"),
+					resource.TestCheckResourceAttrPair("data.helm_chart_status.published", "digest", "helm_chart.test", "digest"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.published", "signed", "false"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.published", "has_sbom", "false"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.published", "attested", "false"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.missing", "exists", "false"),
+					resource.TestCheckResourceAttr("data.helm_chart_status.missing", "digest_matches", "false"),
+					resource.TestCheckNoResourceAttr("data.helm_chart_status.missing", "digest"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &chartValuesSchemaDataSource{}
+	_ datasource.DataSourceWithConfigure = &chartValuesSchemaDataSource{}
+)
+
+// NewChartValuesSchemaDataSource is a helper function to simplify the provider implementation.
+func NewChartValuesSchemaDataSource() datasource.DataSource {
+	return &chartValuesSchemaDataSource{}
+}
+
+// chartValuesSchemaDataSource is the data source implementation.
+type chartValuesSchemaDataSource struct {
+	client *helmClient
+}
+
+// chartValuesSchemaDataSourceModel maps the data source schema data.
+type chartValuesSchemaDataSourceModel struct {
+	Ref      types.String `tfsdk:"ref"`
+	Digest   types.String `tfsdk:"digest"`
+	Schema   types.String `tfsdk:"schema"`
+	Inferred types.Bool   `tfsdk:"inferred"`
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *chartValuesSchemaDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+// Metadata returns the data source type name.
+func (d *chartValuesSchemaDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_values_schema"
+}
+
+// Schema defines the schema for the data source.
+func (d *chartValuesSchemaDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Reads the JSON schema of a published chart's values, for generating installation forms: the chart's `values.schema.json`, or one inferred from its `values.yaml` if it has none.",
+		Attributes: map[string]schema.Attribute{
+			"ref": schema.StringAttribute{
+				Required:    true,
+				Description: "The chart to read, by tag (`registry.example.com/charts/foo:1.2.3`) or sha256 or sha512 digest (`registry.example.com/charts/foo@sha256:...`).",
+			},
+			"digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the chart's manifest.",
+			},
+			"schema": schema.StringAttribute{
+				Computed:    true,
+				Description: "The JSON schema. An inferred schema is a draft-07 schema typing each value by its default in `values.yaml`, with the default and any helm-docs `# --` description; nothing is required, and values defaulting to null may be anything.",
+			},
+			"inferred": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether `schema` was inferred from `values.yaml`, because the chart has no `values.schema.json`.",
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *chartValuesSchemaDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data chartValuesSchemaDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseReference(data.Ref.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing chart reference", err.Error())
+		return
+	}
+
+	ocichart, err := chart.Pull(ref, d.client.remoteOpts(ctx)...)
+	if err != nil {
+		resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+		return
+	}
+	digest, err := ocichart.Digest()
+	if err != nil {
+		resp.Diagnostics.AddError("getting chart digest", err.Error())
+		return
+	}
+	valuesSchema, inferred, err := chart.ValuesSchema(ocichart)
+	if err != nil {
+		resp.Diagnostics.AddError("reading chart values schema", err.Error())
+		return
+	}
+
+	data.Digest = types.StringValue(digest.String())
+	data.Schema = types.StringValue(string(valuesSchema))
+	data.Inferred = types.BoolValue(inferred)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccChartValuesSchemaDataSource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+}
+
+data "helm_chart_values_schema" "test" {
+  ref = helm_chart.test.id
+}
+`, reg.Repo("values-schema")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("data.helm_chart_values_schema.test", "digest", "helm_chart.test", "digest"),
+					resource.TestCheckResourceAttr("data.helm_chart_values_schema.test", "inferred", "true"),
+					resource.TestCheckResourceAttrWith("data.helm_chart_values_schema.test", "schema", func(v string) error {
+						var schema struct {
+							Properties map[string]any `json:"properties"`
+						}
+						if err := json.Unmarshal([]byte(v), &schema); err != nil {
+							return fmt.Errorf("parsing schema: %w", err)
+						}
+						if _, ok := schema.Properties["image"]; !ok {
+							return fmt.Errorf("schema has no image property: %s", v)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
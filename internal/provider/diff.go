@@ -0,0 +1,135 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// chartDiffType is the type of chart_diff.
+var chartDiffType = types.ObjectType{AttrTypes: map[string]attr.Type{
+	"previous_digest": types.StringType,
+	"added":           types.ListType{ElemType: types.StringType},
+	"removed":         types.ListType{ElemType: types.StringType},
+	"changed":         types.ListType{ElemType: types.StringType},
+}}
+
+// comparePlanned builds the chart plan would rebuild and compares it to the
+// chart in state, warning about upgrade problems with check_upgrades set and
+// recording the changed files in chart_diff with diff_previous set. Its
+// annotations are checked against max_annotation_size too. It is skipped
+// while any of the configuration is unknown, leaving chart_diff to be filled
+// in at apply. So is a chart built from melange packages, which are only
+// built at apply.
+func (r *helmChartResource) comparePlanned(ctx context.Context, config tfsdk.Config, plan, state *helmChartResourceModel) diag.Diagnostics {
+	if !plan.CheckUpgrades.ValueBool() && !plan.DiffPrevious.ValueBool() {
+		return nil
+	}
+	if plan.SkipIfExists.ValueBool() || state.Digest.ValueString() == "" || !config.Raw.IsFullyKnown() || !plan.Melange.IsNull() {
+		return nil
+	}
+	attribute := "check_upgrades"
+	if !plan.CheckUpgrades.ValueBool() {
+		attribute = "diff_previous"
+	}
+	warn := func(err error) diag.Diagnostics {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root(attribute), "comparing planned chart", err.Error())}
+	}
+
+	ref, err := chart.ParseDigest(state.Repo.ValueString() + "@" + state.Digest.ValueString())
+	if err != nil {
+		return warn(err)
+	}
+	prev, err := chart.Pull(ref, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		return warn(fmt.Errorf("pulling published chart: %w", err))
+	}
+	bc, diags := r.chartBuildConfig(ctx, plan)
+	if diags.HasError() {
+		return diags
+	}
+	next, err := r.client.build(ctx, plan.PackageName.ValueString(), bc)
+	if err != nil {
+		return warn(fmt.Errorf("building planned chart: %w", err))
+	}
+	defer next.Close()
+
+	ds := checkAnnotationSizes(plan, next)
+	if plan.CheckUpgrades.ValueBool() {
+		ds = append(ds, checkUpgrade(prev, next, ref)...)
+	}
+	if plan.DiffPrevious.ValueBool() {
+		d, err := chart.Diff(prev, next)
+		if err != nil {
+			return append(ds, diag.NewAttributeWarningDiagnostic(path.Root("diff_previous"), "comparing planned chart", err.Error()))
+		}
+		plan.ChartDiff, diags = chartDiffValue(ctx, state.Digest.ValueString(), d)
+		ds = append(ds, diags...)
+	}
+	return ds
+}
+
+// diffPrior sets chart_diff on data, with diff_previous set, to how built
+// differs from the chart in prior. A diff already worked out at plan time is
+// kept, and it is null when there is no prior chart to compare against.
+func (r *helmChartResource) diffPrior(ctx context.Context, data, prior *helmChartResourceModel, built chart.Chart) diag.Diagnostics {
+	if !data.DiffPrevious.ValueBool() {
+		data.ChartDiff = types.ObjectNull(chartDiffType.AttrTypes)
+		return nil
+	}
+	if !data.ChartDiff.IsUnknown() {
+		return nil
+	}
+	data.ChartDiff = types.ObjectNull(chartDiffType.AttrTypes)
+	if prior == nil || prior.Digest.ValueString() == "" {
+		return nil
+	}
+
+	ref, err := chart.ParseDigest(prior.Repo.ValueString() + "@" + prior.Digest.ValueString())
+	if err != nil {
+		return diag.Diagnostics{diag.NewErrorDiagnostic("parsing previous chart reference", err.Error())}
+	}
+	prev, err := chart.Pull(ref, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		return diag.Diagnostics{diag.NewErrorDiagnostic("pulling previous chart", err.Error())}
+	}
+	d, err := chart.Diff(prev, built)
+	if err != nil {
+		return diag.Diagnostics{diag.NewErrorDiagnostic("comparing to previous chart", err.Error())}
+	}
+	var diags diag.Diagnostics
+	data.ChartDiff, diags = chartDiffValue(ctx, prior.Digest.ValueString(), d)
+	return diags
+}
+
+// chartDiffValue converts d, a comparison against the chart at digest, to
+// chart_diff's type.
+func chartDiffValue(ctx context.Context, digest string, d *chart.FileDiff) (types.Object, diag.Diagnostics) {
+	var ds diag.Diagnostics
+	added, diags := types.ListValueFrom(ctx, types.StringType, d.Added)
+	ds = append(ds, diags...)
+	removed, diags := types.ListValueFrom(ctx, types.StringType, d.Removed)
+	ds = append(ds, diags...)
+	changed, diags := types.ListValueFrom(ctx, types.StringType, d.Changed)
+	ds = append(ds, diags...)
+	if ds.HasError() {
+		return types.ObjectNull(chartDiffType.AttrTypes), ds
+	}
+	return types.ObjectValue(chartDiffType.AttrTypes, map[string]attr.Value{
+		"previous_digest": types.StringValue(digest),
+		"added":           added,
+		"removed":         removed,
+		"changed":         changed,
+	})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ ephemeral.EphemeralResource              = &registryTokenEphemeralResource{}
+	_ ephemeral.EphemeralResourceWithConfigure = &registryTokenEphemeralResource{}
+)
+
+// NewRegistryTokenEphemeralResource is a helper function to simplify the provider implementation.
+func NewRegistryTokenEphemeralResource() ephemeral.EphemeralResource {
+	return &registryTokenEphemeralResource{}
+}
+
+// registryTokenEphemeralResource is the ephemeral resource implementation.
+type registryTokenEphemeralResource struct {
+	client *helmClient
+}
+
+// registryTokenEphemeralResourceModel maps the ephemeral resource schema data.
+type registryTokenEphemeralResourceModel struct {
+	Registry types.String `tfsdk:"registry"`
+	Username types.String `tfsdk:"username"`
+	Password types.String `tfsdk:"password"`
+}
+
+// Configure adds the provider configured client to the ephemeral resource.
+func (e *registryTokenEphemeralResource) Configure(_ context.Context, req ephemeral.ConfigureRequest, resp *ephemeral.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Ephemeral Resource Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	e.client = client
+}
+
+// Metadata returns the ephemeral resource type name.
+func (e *registryTokenEphemeralResource) Metadata(_ context.Context, req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_registry_token"
+}
+
+// Schema defines the schema for the ephemeral resource.
+func (e *registryTokenEphemeralResource) Schema(_ context.Context, _ ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Mints credentials for a registry the way the provider authenticates to it, such as an ECR password from the AWS CLI, a token for an impersonated Google service account, or a Chainguard token from its docker credential helper, for passing to other providers without writing them to state. Requires Terraform 1.10 or later.",
+		Attributes: map[string]schema.Attribute{
+			"registry": schema.StringAttribute{
+				Required:    true,
+				Description: "The registry's host, e.g. `123456789012.dkr.ecr.us-east-1.amazonaws.com` or `cgr.dev`.",
+			},
+			"username": schema.StringAttribute{
+				Computed:    true,
+				Description: "The username to authenticate as.",
+			},
+			"password": schema.StringAttribute{
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The password or token to authenticate with. Many are short-lived, so use them within the run.",
+			},
+		},
+	}
+}
+
+// Open resolves the credentials for the registry.
+func (e *registryTokenEphemeralResource) Open(ctx context.Context, req ephemeral.OpenRequest, resp *ephemeral.OpenResponse) {
+	// The provider isn't configured while its own config is unknown, as in
+	// validation or a plan whose provider config depends on other resources.
+	if e.client == nil {
+		resp.Diagnostics.AddError("provider not configured", "Registry credentials can't be resolved before the provider is configured.")
+		return
+	}
+
+	var data registryTokenEphemeralResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	reg, err := name.NewRegistry(data.Registry.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("registry"), "parsing registry", err.Error())
+		return
+	}
+	username, password, err := registryCredentials(ctx, e.client.keychain, reg)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("registry"), "getting registry credentials", err.Error())
+		return
+	}
+	data.Username = types.StringValue(username)
+	data.Password = types.StringValue(password)
+
+	resp.Diagnostics.Append(resp.Result.Set(ctx, &data)...)
+}
+
+// registryCredentials returns the username and password kc authenticates to
+// reg with. Identity tokens are returned as docker login takes them, with
+// the username "<token>".
+func registryCredentials(ctx context.Context, kc authn.Keychain, reg name.Registry) (string, string, error) {
+	auth, err := authn.Resolve(ctx, kc, reg)
+	if err != nil {
+		return "", "", err
+	}
+	cfg, err := authn.Authorization(ctx, auth)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case cfg.IdentityToken != "":
+		return "<token>", cfg.IdentityToken, nil
+	case cfg.Password != "":
+		return cfg.Username, cfg.Password, nil
+	}
+	return "", "", fmt.Errorf("no credentials are configured for %s", reg)
+}
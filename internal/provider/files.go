@@ -0,0 +1,224 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+)
+
+// chartFileModel maps an attribute that puts a file in the chart.
+type chartFileModel struct {
+	Content types.String `tfsdk:"content"`
+	File    types.String `tfsdk:"file"`
+	Append  types.Bool   `tfsdk:"append"`
+}
+
+// chartFileSchema returns an attribute that replaces or appends to the
+// chart's file at rel.
+func chartFileSchema(rel, what string) schema.SingleNestedAttribute {
+	return schema.SingleNestedAttribute{
+		Optional:    true,
+		Description: "Replace the chart's `" + rel + "`, or add one if it has none, with " + what + ". `${name}` and `${version}` in the content are replaced with the chart's name and version (write `$${name}` in Terraform strings).",
+		Attributes: map[string]schema.Attribute{
+			"content": schema.StringAttribute{
+				Optional:    true,
+				Description: "The content. Exactly one of `content` or `file` must be set.",
+			},
+			"file": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path to a file holding the content, read when the chart is built. Changes to the file alone don't rebuild the chart; use `content = file(...)` for that.",
+			},
+			"append": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Append the content to the chart's `" + rel + "` instead of replacing it.",
+			},
+		},
+		Validators: []validator.Object{
+			exactlyOneOfValidator{names: []string{"content", "file"}},
+		},
+	}
+}
+
+// chartFiles returns the files to put in the chart, by path, for each of the
+// given attributes that is set.
+func chartFiles(ctx context.Context, attrs map[string]types.Object) (map[string]chart.File, diag.Diagnostics) {
+	files := map[string]chart.File{}
+	for attr, obj := range attrs {
+		if obj.IsNull() || obj.IsUnknown() {
+			continue
+		}
+		var f chartFileModel
+		if diags := obj.As(ctx, &f, basetypes.ObjectAsOptions{}); diags.HasError() {
+			return nil, diags
+		}
+		content := []byte(f.Content.ValueString())
+		if p := f.File.ValueString(); p != "" {
+			var err error
+			if content, err = os.ReadFile(p); err != nil {
+				return nil, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root(attr).AtName("file"), "reading file", err.Error())}
+			}
+		}
+		files[chartFilePaths[attr]] = chart.File{Content: content, Append: f.Append.ValueBool()}
+	}
+	return files, nil
+}
+
+// extraLayerModel maps an element of extra_layers.
+type extraLayerModel struct {
+	MediaType types.String `tfsdk:"media_type"`
+	Content   types.String `tfsdk:"content"`
+	File      types.String `tfsdk:"file"`
+	Title     types.String `tfsdk:"title"`
+}
+
+// extraLayers returns the layers to publish after the chart's content, or
+// nil if list is not set.
+func extraLayers(ctx context.Context, list types.List) ([]chart.Layer, diag.Diagnostics) {
+	if list.IsNull() || list.IsUnknown() {
+		return nil, nil
+	}
+	var ls []extraLayerModel
+	if diags := list.ElementsAs(ctx, &ls, false); diags.HasError() {
+		return nil, diags
+	}
+	layers := make([]chart.Layer, 0, len(ls))
+	for i, l := range ls {
+		content := []byte(l.Content.ValueString())
+		if p := l.File.ValueString(); p != "" {
+			var err error
+			if content, err = os.ReadFile(p); err != nil {
+				return nil, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("extra_layers").AtListIndex(i).AtName("file"), "reading file", err.Error())}
+			}
+		}
+		layers = append(layers, chart.Layer{MediaType: l.MediaType.ValueString(), Content: content, Title: l.Title.ValueString()})
+	}
+	return layers, nil
+}
+
+// iconModel maps the icon attribute.
+type iconModel struct {
+	URL  types.String `tfsdk:"url"`
+	File types.String `tfsdk:"file"`
+}
+
+// chartIcon returns the icon URL to put in Chart.yaml, embedding the icon's
+// file as a data URI if it names one. It is empty if icon is not set.
+func chartIcon(ctx context.Context, obj types.Object) (string, diag.Diagnostics) {
+	if obj.IsNull() || obj.IsUnknown() {
+		return "", nil
+	}
+	var icon iconModel
+	if diags := obj.As(ctx, &icon, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return "", diags
+	}
+	p := icon.File.ValueString()
+	if p == "" {
+		return icon.URL.ValueString(), nil
+	}
+	uri, err := chart.IconDataURI(p)
+	if err != nil {
+		return "", diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("icon").AtName("file"), "reading icon", err.Error())}
+	}
+	return uri, nil
+}
+
+// chartFilePaths maps each chart file attribute to the file it sets.
+var chartFilePaths = map[string]string{
+	"readme":  "README.md",
+	"notes":   "templates/NOTES.txt",
+	"license": "LICENSE",
+}
+
+// licenseAnnotations are the manifest annotations require_license accepts,
+// in the order they are reported. Annotations in Chart.yaml are copied to
+// the manifest.
+var licenseAnnotations = []string{"org.opencontainers.image.licenses", "licenses", "artifacthub.io/license"}
+
+// checkLicense fails unless c's manifest has a non-empty license annotation.
+func checkLicense(c chart.Chart) error {
+	m, err := c.Manifest()
+	if err != nil {
+		return err
+	}
+	for _, k := range licenseAnnotations {
+		if strings.TrimSpace(m.Annotations[k]) != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("the chart has none of the %s annotations; add one to the annotations in its Chart.yaml, e.g. with json_patches", strings.Join(licenseAnnotations, ", "))
+}
+
+// checkNotLibrary fails if c is a library chart, which can only be depended
+// on, not installed.
+func checkNotLibrary(c chart.Chart) error {
+	md, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+	if md.Type == "library" {
+		return fmt.Errorf("%s is a library chart (its Chart.yaml type is library), which can't be installed", md.Name)
+	}
+	return nil
+}
+
+// defaultMaxFileSize is the max_file_size, in bytes, when it isn't set: the
+// most a Helm release, which holds its chart, can be, as releases are kept
+// in Secrets.
+const defaultMaxFileSize = 1 << 20
+
+// checkSuspectFiles warns, or fails with fail_on_suspect_files, when c has
+// files larger than max_file_size or binary files allowed_binary_files
+// doesn't allow.
+func checkSuspectFiles(ctx context.Context, data *helmChartResourceModel, c chart.Chart) diag.Diagnostics {
+	maxSize := int64(defaultMaxFileSize)
+	if !data.MaxFileSize.IsNull() {
+		maxSize = data.MaxFileSize.ValueInt64()
+	}
+	allow, diags := optionalStrings(ctx, data.AllowedBinary)
+	if diags.HasError() {
+		return diags
+	}
+	files, err := chart.SuspectFiles(c, maxSize, allow)
+	if err != nil {
+		return diag.Diagnostics{diag.NewErrorDiagnostic("reading chart files", err.Error())}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	var large, binary []string
+	for _, f := range files {
+		if f.Large {
+			large = append(large, fmt.Sprintf("%s (%d bytes)", f.Path, f.Size))
+		}
+		if f.Binary {
+			binary = append(binary, f.Path)
+		}
+	}
+	var b strings.Builder
+	if len(large) > 0 {
+		fmt.Fprintf(&b, "These files are larger than %d bytes: %s. ", maxSize, strings.Join(large, ", "))
+	}
+	if len(binary) > 0 {
+		fmt.Fprintf(&b, "These files look binary: %s. ", strings.Join(binary, ", "))
+	}
+	b.WriteString("They may have been packaged by accident, like images or vendored archives, and every pull of the chart downloads them. If they belong in the chart, raise max_file_size or add them to allowed_binary_files.")
+	if data.FailSuspectFiles.ValueBool() {
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("fail_on_suspect_files"), "chart has suspect files", b.String()+"\n\nThe chart was not pushed.")}
+	}
+	return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("max_file_size"), "chart has suspect files", b.String())}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+var _ function.Function = &chartVersionFromAPKFunction{}
+
+// NewChartVersionFromAPKFunction is a helper function to simplify the provider implementation.
+func NewChartVersionFromAPKFunction() function.Function {
+	return &chartVersionFromAPKFunction{}
+}
+
+// chartVersionFromAPKFunction translates APK versions into chart versions.
+type chartVersionFromAPKFunction struct{}
+
+func (f *chartVersionFromAPKFunction) Metadata(_ context.Context, _ function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "chart_version_from_apk"
+}
+
+func (f *chartVersionFromAPKFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     "Translate an APK version into a chart version.",
+		Description: "Translates an APK package version into a semver chart version. Missing minor and patch components are filled with zeros, pre-release suffixes (`_alpha`, `_beta`, `_pre`, `_rc`) become semver pre-releases, and the package revision becomes build metadata, so `1.2.3_rc1-r4` becomes `1.2.3-rc1+r4`.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "version",
+				Description: "The APK package version, e.g. `1.2.3-r4`.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *chartVersionFromAPKFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var version string
+	resp.Error = function.ConcatFuncErrors(resp.Error, req.Arguments.Get(ctx, &version))
+	if resp.Error != nil {
+		return
+	}
+
+	out, err := chart.ChartVersionFromAPK(version)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewArgumentFuncError(0, err.Error()))
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Error, resp.Result.Set(ctx, out))
+}
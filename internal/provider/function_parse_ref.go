@@ -0,0 +1,113 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var _ function.Function = &parseRefFunction{}
+
+// NewParseRefFunction is a helper function to simplify the provider implementation.
+func NewParseRefFunction() function.Function {
+	return &parseRefFunction{}
+}
+
+// parseRefFunction splits an OCI reference into its components.
+type parseRefFunction struct{}
+
+var parseRefAttrTypes = map[string]attr.Type{
+	"registry":   types.StringType,
+	"repository": types.StringType,
+	"repo":       types.StringType,
+	"tag":        types.StringType,
+	"digest":     types.StringType,
+}
+
+// parsedRef maps the parse_ref return object.
+type parsedRef struct {
+	Registry   string `tfsdk:"registry"`
+	Repository string `tfsdk:"repository"`
+	Repo       string `tfsdk:"repo"`
+	Tag        string `tfsdk:"tag"`
+	Digest     string `tfsdk:"digest"`
+}
+
+func (f *parseRefFunction) Metadata(_ context.Context, _ function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "parse_ref"
+}
+
+func (f *parseRefFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     "Parse an OCI reference into its components.",
+		Description: "Parses an OCI reference such as `cgr.dev/foo/bar:1.2.3@sha256:...`, by sha256 or sha512 digest, and returns its `registry`, `repository`, `repo` (registry and repository joined, suitable for `helm_chart.repo`), `tag`, and `digest`. Components absent from the reference are returned as empty strings.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "ref",
+				Description: "The OCI reference to parse.",
+			},
+		},
+		Return: function.ObjectReturn{
+			AttributeTypes: parseRefAttrTypes,
+		},
+	}
+}
+
+func (f *parseRefFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var ref string
+	resp.Error = function.ConcatFuncErrors(resp.Error, req.Arguments.Get(ctx, &ref))
+	if resp.Error != nil {
+		return
+	}
+
+	parsed, err := parseRef(ref)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewArgumentFuncError(0, err.Error()))
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Error, resp.Result.Set(ctx, parsed))
+}
+
+// parseRef parses ref, keeping both the tag and digest when both are present;
+// name.ParseReference drops the tag of a tag@digest reference.
+func parseRef(ref string) (*parsedRef, error) {
+	base, _, hasDigest := strings.Cut(ref, "@")
+
+	out := &parsedRef{}
+	if hasDigest {
+		d, err := chart.ParseDigest(ref)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reference %q: %w", ref, err)
+		}
+		out.Digest = d.Identifier()
+	}
+
+	var repo name.Repository
+	if t, err := name.NewTag(base, name.StrictValidation); err == nil {
+		repo = t.Repository
+		out.Tag = t.TagStr()
+	} else {
+		r, err := name.NewRepository(base)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reference %q: %w", ref, err)
+		}
+		repo = r
+	}
+
+	out.Registry = repo.RegistryStr()
+	out.Repository = repo.RepositoryStr()
+	out.Repo = repo.Name()
+	return out, nil
+}
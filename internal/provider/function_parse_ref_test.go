@@ -0,0 +1,84 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestParseRefFunction(t *testing.T) {
+	const dgst = "sha256:abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234"
+
+	tests := []struct {
+		ref     string
+		want    *parsedRef
+		wantErr bool
+	}{{
+		ref:  "cgr.dev/foo/bar:1.2.3@" + dgst,
+		want: &parsedRef{Registry: "cgr.dev", Repository: "foo/bar", Repo: "cgr.dev/foo/bar", Tag: "1.2.3", Digest: dgst},
+	}, {
+		ref:  "cgr.dev/foo/bar@" + dgst,
+		want: &parsedRef{Registry: "cgr.dev", Repository: "foo/bar", Repo: "cgr.dev/foo/bar", Digest: dgst},
+	}, {
+		ref:  "cgr.dev/foo/bar:1.2.3",
+		want: &parsedRef{Registry: "cgr.dev", Repository: "foo/bar", Repo: "cgr.dev/foo/bar", Tag: "1.2.3"},
+	}, {
+		ref:  "localhost:5000/charts/bar",
+		want: &parsedRef{Registry: "localhost:5000", Repository: "charts/bar", Repo: "localhost:5000/charts/bar"},
+	}, {
+		ref:     "cgr.dev/foo/bar@sha256:nothex",
+		wantErr: true,
+	}, {
+		ref:  "cgr.dev/foo/bar:1.2.3@sha512:" + strings.Repeat("a", 128),
+		want: &parsedRef{Registry: "cgr.dev", Repository: "foo/bar", Repo: "cgr.dev/foo/bar", Tag: "1.2.3", Digest: "sha512:" + strings.Repeat("a", 128)},
+	}, {
+		ref:     "cgr.dev/foo/bar@sha512:" + strings.Repeat("a", 64),
+		wantErr: true,
+	}, {
+		ref:     "cgr.dev/foo/bar@sha384:" + strings.Repeat("a", 96),
+		wantErr: true,
+	}, {
+		ref:     "cgr.dev/Foo/bar",
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			req := function.RunRequest{
+				Arguments: function.NewArgumentsData([]attr.Value{types.StringValue(tc.ref)}),
+			}
+			resp := &function.RunResponse{
+				Result: function.NewResultData(types.ObjectUnknown(parseRefAttrTypes)),
+			}
+
+			NewParseRefFunction().Run(t.Context(), req, resp)
+
+			if tc.wantErr {
+				if resp.Error == nil {
+					t.Fatal("expected error, got none")
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("unexpected error: %v", resp.Error)
+			}
+
+			want, diags := types.ObjectValueFrom(t.Context(), parseRefAttrTypes, tc.want)
+			if diags.HasError() {
+				t.Fatalf("building expected value: %v", diags)
+			}
+			if diff := cmp.Diff(want, resp.Result.Value()); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+var _ function.Function = &semverGTFunction{}
+
+// NewSemverGTFunction is a helper function to simplify the provider implementation.
+func NewSemverGTFunction() function.Function {
+	return &semverGTFunction{}
+}
+
+// semverGTFunction compares two chart versions using semver precedence.
+type semverGTFunction struct{}
+
+func (f *semverGTFunction) Metadata(_ context.Context, _ function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "semver_gt"
+}
+
+func (f *semverGTFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     "Compare two chart versions.",
+		Description: "Returns true if chart version `a` has higher semver precedence than `b`. Build metadata is ignored, as Helm does when ordering versions.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "a",
+				Description: "The chart version to compare.",
+			},
+			function.StringParameter{
+				Name:        "b",
+				Description: "The chart version to compare against.",
+			},
+		},
+		Return: function.BoolReturn{},
+	}
+}
+
+func (f *semverGTFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var a, b string
+	resp.Error = function.ConcatFuncErrors(resp.Error, req.Arguments.Get(ctx, &a, &b))
+	if resp.Error != nil {
+		return
+	}
+
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewArgumentFuncError(0, fmt.Sprintf("parsing version %q: %v", a, err)))
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewArgumentFuncError(1, fmt.Sprintf("parsing version %q: %v", b, err)))
+	}
+	if resp.Error != nil {
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Error, resp.Result.Set(ctx, va.GreaterThan(vb)))
+}
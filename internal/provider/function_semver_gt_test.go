@@ -0,0 +1,56 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestSemverGTFunction(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    bool
+		wantErr bool
+	}{
+		{a: "1.2.4", b: "1.2.3", want: true},
+		{a: "1.2.3", b: "1.2.4", want: false},
+		{a: "1.2.3", b: "1.2.3", want: false},
+		{a: "1.10.0", b: "1.9.0", want: true},
+		{a: "1.2.3", b: "1.2.3-rc1", want: true},
+		{a: "1.2.3+r1", b: "1.2.3+r0", want: false},
+		{a: "not-a-version", b: "1.2.3", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+">"+tc.b, func(t *testing.T) {
+			req := function.RunRequest{
+				Arguments: function.NewArgumentsData([]attr.Value{types.StringValue(tc.a), types.StringValue(tc.b)}),
+			}
+			resp := &function.RunResponse{
+				Result: function.NewResultData(types.BoolUnknown()),
+			}
+
+			NewSemverGTFunction().Run(t.Context(), req, resp)
+
+			if tc.wantErr {
+				if resp.Error == nil {
+					t.Fatal("expected error, got none")
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("unexpected error: %v", resp.Error)
+			}
+			if got := resp.Result.Value(); !got.Equal(types.BoolValue(tc.want)) {
+				t.Errorf("semver_gt(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
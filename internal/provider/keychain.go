@@ -0,0 +1,221 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"google.golang.org/api/impersonate"
+)
+
+// newKeychain returns the keychain the provider authenticates to registries
+// with: the credentials registry_auth gives them, the GCP service accounts
+// and AWS roles configured for them, then the ambient credentials. The AWS
+// CLI is only asked for ECR passwords when nothing else has credentials for
+// the registry, unless roles are assumed for it.
+func newKeychain(static staticKeychain, gcpServiceAccounts, awsRoles []string) authn.Keychain {
+	var keychains []authn.Keychain
+	if len(static) > 0 {
+		keychains = append(keychains, static)
+	}
+	if len(gcpServiceAccounts) > 0 {
+		keychains = append(keychains, &impersonatingKeychain{serviceAccounts: gcpServiceAccounts})
+	}
+	if len(awsRoles) > 0 {
+		keychains = append(keychains, &awsCLIKeychain{roles: awsRoles})
+	}
+	keychains = append(keychains, google.Keychain, authn.RefreshingKeychain(authn.DefaultKeychain, 30*time.Minute))
+	if len(awsRoles) == 0 {
+		keychains = append(keychains, &awsCLIKeychain{})
+	}
+	return authn.NewMultiKeychain(keychains...)
+}
+
+// ecrHost matches the hosts of private ECR registries, capturing the region.
+var ecrHost = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ecrPublicHost is the host of ECR Public.
+const ecrPublicHost = "public.ecr.aws"
+
+// ecrTokenTTL is how long an ECR password is reused. They are valid for 12
+// hours; this leaves a margin for long applies.
+const ecrTokenTTL = 11 * time.Hour
+
+// awsCLIKeychain authenticates to ECR and ECR Public with passwords from the
+// AWS CLI's get-login-password, so pushing there doesn't need a docker login
+// first. It resolves nothing for other registries. Without roles, it also
+// resolves nothing when the CLI isn't installed; with them, it fails rather
+// than fall back to other credentials.
+type awsCLIKeychain struct {
+	// roles are assumed in turn, each with the credentials of the one before,
+	// to get the password with the last's.
+	roles []string
+
+	mu        sync.Mutex
+	passwords map[string]ecrPassword
+}
+
+// ecrPassword is a password get-login-password returned, and when it was.
+type ecrPassword struct {
+	password string
+	fetched  time.Time
+}
+
+func (k *awsCLIKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	host := target.RegistryStr()
+	var args []string
+	switch m := ecrHost.FindStringSubmatch(host); {
+	case host == ecrPublicHost:
+		// ECR Public's API is only in us-east-1, wherever it is pulled from.
+		args = []string{"ecr-public", "get-login-password", "--region", "us-east-1"}
+	case m != nil:
+		args = []string{"ecr", "get-login-password", "--region", m[1]}
+	default:
+		return authn.Anonymous, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if p, ok := k.passwords[host]; ok && time.Since(p.fetched) < ecrTokenTTL {
+		return &authn.Basic{Username: "AWS", Password: p.password}, nil
+	}
+
+	password, err := k.loginPassword(args)
+	if err != nil {
+		// ECR Public allows anonymous pulls, so only its pushes need a login.
+		if len(k.roles) == 0 && (host == ecrPublicHost || errors.Is(err, exec.ErrNotFound)) {
+			return authn.Anonymous, nil
+		}
+		return nil, fmt.Errorf("getting a password for %s from the AWS CLI: %w", host, err)
+	}
+	if k.passwords == nil {
+		k.passwords = map[string]ecrPassword{}
+	}
+	k.passwords[host] = ecrPassword{password: password, fetched: time.Now()}
+	return &authn.Basic{Username: "AWS", Password: password}, nil
+}
+
+// loginPassword assumes k.roles, then runs get-login-password, as args, with
+// the last role's credentials.
+func (k *awsCLIKeychain) loginPassword(args []string) (string, error) {
+	var env []string
+	for _, role := range k.roles {
+		out, err := awsCLI(env, "sts", "assume-role", "--role-arn", role, "--role-session-name", "terraform-provider-helm", "--query", "Credentials", "--output", "json")
+		if err != nil {
+			return "", fmt.Errorf("assuming %s: %w", role, err)
+		}
+		var creds struct {
+			AccessKeyID     string `json:"AccessKeyId"`
+			SecretAccessKey string `json:"SecretAccessKey"`
+			SessionToken    string `json:"SessionToken"`
+		}
+		if err := json.Unmarshal([]byte(out), &creds); err != nil {
+			return "", fmt.Errorf("parsing credentials for %s: %w", role, err)
+		}
+		env = []string{
+			"AWS_ACCESS_KEY_ID=" + creds.AccessKeyID,
+			"AWS_SECRET_ACCESS_KEY=" + creds.SecretAccessKey,
+			"AWS_SESSION_TOKEN=" + creds.SessionToken,
+		}
+	}
+
+	password, err := awsCLI(env, args...)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("aws printed no password")
+	}
+	return password, nil
+}
+
+// awsCLI runs the AWS CLI with args, and env over the provider's own
+// environment, returning what it prints.
+func awsCLI(env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("aws", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// cloudPlatformScope is the OAuth scope registry tokens are requested with.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// impersonatingKeychain authenticates to GCR and Artifact Registry as a
+// service account, impersonated with the ambient Google credentials. It
+// resolves nothing for other registries.
+type impersonatingKeychain struct {
+	// serviceAccounts are impersonated in turn; the last is the one
+	// authenticated as, and the rest are its delegates.
+	serviceAccounts []string
+
+	once sync.Once
+	auth authn.Authenticator
+	err  error
+}
+
+func (k *impersonatingKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if !isGoogleRegistry(target.RegistryStr()) {
+		return authn.Anonymous, nil
+	}
+	k.once.Do(func() {
+		last := len(k.serviceAccounts) - 1
+		ts, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: k.serviceAccounts[last],
+			Delegates:       k.serviceAccounts[:last],
+			Scopes:          []string{cloudPlatformScope},
+		})
+		if err != nil {
+			k.err = fmt.Errorf("impersonating %s: %w", k.serviceAccounts[last], err)
+			return
+		}
+		k.auth = google.NewTokenSourceAuthenticator(ts)
+	})
+	return k.auth, k.err
+}
+
+// isGoogleRegistry reports whether host is GCR or Artifact Registry, as
+// google.Keychain decides.
+func isGoogleRegistry(host string) bool {
+	return host == "gcr.io" ||
+		strings.HasSuffix(host, ".gcr.io") ||
+		strings.HasSuffix(host, ".pkg.dev") ||
+		strings.HasSuffix(host, ".google.com")
+}
+
+// staticKeychain authenticates to registries with the credentials
+// registry_auth gives them, by host. It resolves nothing for other
+// registries.
+type staticKeychain map[string]authn.AuthConfig
+
+func (k staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	cfg, ok := k[target.RegistryStr()]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(cfg), nil
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// fakeAWS puts an aws script on PATH that runs script, logging its arguments
+// to the returned file.
+func fakeAWS(t *testing.T, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	body := "#!/bin/sh\necho \"$@\" >> " + log + "\n" + script + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "aws"), []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return log
+}
+
+func TestAWSCLIKeychain(t *testing.T) {
+	resolve := func(t *testing.T, k *awsCLIKeychain, repo string) (*authn.AuthConfig, error) {
+		t.Helper()
+		r, err := name.NewRepository(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := k.Resolve(r)
+		if err != nil {
+			return nil, err
+		}
+		return auth.Authorization()
+	}
+
+	t.Run("private", func(t *testing.T) {
+		log := fakeAWS(t, "echo secret")
+		k := &awsCLIKeychain{}
+		for range 2 {
+			cfg, err := resolve(t, k, "123456789012.dkr.ecr.eu-west-1.amazonaws.com/charts/foo")
+			if err != nil {
+				t.Fatalf("Resolve() = %v", err)
+			}
+			if cfg.Username != "AWS" || cfg.Password != "secret" {
+				t.Errorf("Resolve() = %s:%s, want AWS:secret", cfg.Username, cfg.Password)
+			}
+		}
+		calls, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The password is reused rather than fetched again.
+		if want := "ecr get-login-password --region eu-west-1\n"; string(calls) != want {
+			t.Errorf("aws calls = %q, want %q", calls, want)
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		log := fakeAWS(t, "echo secret")
+		cfg, err := resolve(t, &awsCLIKeychain{}, "public.ecr.aws/example/foo")
+		if err != nil {
+			t.Fatalf("Resolve() = %v", err)
+		}
+		if cfg.Password != "secret" {
+			t.Errorf("Resolve() password = %q, want %q", cfg.Password, "secret")
+		}
+		calls, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "ecr-public get-login-password --region us-east-1\n"; string(calls) != want {
+			t.Errorf("aws calls = %q, want %q", calls, want)
+		}
+	})
+
+	t.Run("other registries", func(t *testing.T) {
+		log := fakeAWS(t, "echo secret")
+		for _, repo := range []string{"ghcr.io/example/foo", "us-docker.pkg.dev/project/repo/foo", "ecr.example.com/foo"} {
+			cfg, err := resolve(t, &awsCLIKeychain{}, repo)
+			if err != nil {
+				t.Fatalf("Resolve(%s) = %v", repo, err)
+			}
+			if *cfg != (authn.AuthConfig{}) {
+				t.Errorf("Resolve(%s) = %+v, want anonymous", repo, cfg)
+			}
+		}
+		if _, err := os.Stat(log); !os.IsNotExist(err) {
+			t.Errorf("aws was run for other registries")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		fakeAWS(t, "echo 'Unable to locate credentials' >&2; exit 255")
+		_, err := resolve(t, &awsCLIKeychain{}, "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo")
+		if err == nil || !strings.Contains(err.Error(), "Unable to locate credentials") {
+			t.Errorf("Resolve() = %v, want the AWS CLI's error", err)
+		}
+		// ECR Public can still be pulled from anonymously.
+		cfg, err := resolve(t, &awsCLIKeychain{}, "public.ecr.aws/example/foo")
+		if err != nil || *cfg != (authn.AuthConfig{}) {
+			t.Errorf("Resolve() = %+v, %v, want anonymous", cfg, err)
+		}
+	})
+
+	t.Run("no cli", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		cfg, err := resolve(t, &awsCLIKeychain{}, "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo")
+		if err != nil || *cfg != (authn.AuthConfig{}) {
+			t.Errorf("Resolve() = %+v, %v, want anonymous", cfg, err)
+		}
+	})
+	t.Run("roles", func(t *testing.T) {
+		// Each role's key is its ARN's last part plus the key it was assumed
+		// with, and the password is the key it is fetched with.
+		log := fakeAWS(t, `case "$1" in
+sts) echo "{\"AccessKeyId\": \"${4##*/}${AWS_ACCESS_KEY_ID}\", \"SecretAccessKey\": \"s\", \"SessionToken\": \"t\"}" ;;
+*) echo "$AWS_ACCESS_KEY_ID" ;;
+esac`)
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		k := &awsCLIKeychain{roles: []string{"arn:aws:iam::123456789012:role/a", "arn:aws:iam::123456789012:role/b"}}
+		cfg, err := resolve(t, k, "123456789012.dkr.ecr.eu-west-1.amazonaws.com/charts/foo")
+		if err != nil {
+			t.Fatalf("Resolve() = %v", err)
+		}
+		if cfg.Password != "ba" {
+			t.Errorf("Resolve() password = %q, want %q", cfg.Password, "ba")
+		}
+		calls, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "sts assume-role --role-arn arn:aws:iam::123456789012:role/a --role-session-name terraform-provider-helm --query Credentials --output json\n" +
+			"sts assume-role --role-arn arn:aws:iam::123456789012:role/b --role-session-name terraform-provider-helm --query Credentials --output json\n" +
+			"ecr get-login-password --region eu-west-1\n"
+		if string(calls) != want {
+			t.Errorf("aws calls = %q, want %q", calls, want)
+		}
+	})
+
+	t.Run("roles failure", func(t *testing.T) {
+		fakeAWS(t, "echo 'AccessDenied' >&2; exit 254")
+		k := &awsCLIKeychain{roles: []string{"arn:aws:iam::123456789012:role/a"}}
+		// With a role to publish as, nothing falls back to anonymous.
+		for _, repo := range []string{"123456789012.dkr.ecr.us-east-1.amazonaws.com/foo", "public.ecr.aws/example/foo"} {
+			if _, err := resolve(t, k, repo); err == nil || !strings.Contains(err.Error(), "assuming arn:aws:iam::123456789012:role/a") {
+				t.Errorf("Resolve(%s) = %v, want an error assuming the role", repo, err)
+			}
+		}
+		t.Setenv("PATH", t.TempDir())
+		if _, err := resolve(t, k, "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo"); err == nil {
+			t.Errorf("Resolve() without the CLI = nil, want an error")
+		}
+	})
+}
+
+func TestImpersonatingKeychain(t *testing.T) {
+	for host, want := range map[string]bool{
+		"gcr.io":              true,
+		"us.gcr.io":           true,
+		"us-docker.pkg.dev":   true,
+		"docker.pkg.dev":      true,
+		"ghcr.io":             false,
+		"pkg.dev.example.com": false,
+	} {
+		if got := isGoogleRegistry(host); got != want {
+			t.Errorf("isGoogleRegistry(%s) = %t, want %t", host, got, want)
+		}
+	}
+
+	// Other registries are left to other keychains without impersonating.
+	k := &impersonatingKeychain{serviceAccounts: []string{"publisher@project.iam.gserviceaccount.com"}}
+	r, err := name.NewRepository("ghcr.io/example/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := k.Resolve(r)
+	if err != nil || auth != authn.Anonymous {
+		t.Errorf("Resolve(ghcr.io) = %v, %v, want anonymous", auth, err)
+	}
+}
+
+func TestStaticKeychain(t *testing.T) {
+	k := staticKeychain{"cgr.dev": {Username: "user", Password: "token"}}
+	// Other keychains come after it, for the registries it has nothing for.
+	kc := authn.NewMultiKeychain(k, staticKeychain{"ghcr.io": {IdentityToken: "identity"}})
+
+	for _, tc := range []struct {
+		registry           string
+		username, password string
+		wantErr            bool
+	}{
+		{registry: "cgr.dev", username: "user", password: "token"},
+		{registry: "ghcr.io", username: "<token>", password: "identity"},
+		{registry: "registry.example.com", wantErr: true},
+	} {
+		reg, err := name.NewRegistry(tc.registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		username, password, err := registryCredentials(t.Context(), kc, reg)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("registryCredentials(%s) = %q, %q, want an error", tc.registry, username, password)
+			}
+			continue
+		}
+		if err != nil || username != tc.username || password != tc.password {
+			t.Errorf("registryCredentials(%s) = %q, %q, %v, want %q, %q", tc.registry, username, password, err, tc.username, tc.password)
+		}
+	}
+}
+
+func TestNewKeychain(t *testing.T) {
+	fakeAWS(t, "echo secret")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	reg, err := name.NewRegistry("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ECR is reached without any registry settings, as the sweeper does.
+	username, password, err := registryCredentials(t.Context(), newKeychain(nil, nil, nil), reg)
+	if err != nil || username != "AWS" || password != "secret" {
+		t.Errorf("registryCredentials() = %q, %q, %v, want AWS, secret", username, password, err)
+	}
+
+	// registry_auth comes before the AWS CLI.
+	static := staticKeychain{reg.RegistryStr(): {Username: "user", Password: "token"}}
+	username, password, err = registryCredentials(t.Context(), newKeychain(static, nil, nil), reg)
+	if err != nil || username != "user" || password != "token" {
+		t.Errorf("registryCredentials() = %q, %q, %v, want user, token", username, password, err)
+	}
+}
+
+func TestRegistryTokenUnconfigured(t *testing.T) {
+	e := &registryTokenEphemeralResource{}
+	var sr ephemeral.SchemaResponse
+	e.Schema(t.Context(), ephemeral.SchemaRequest{}, &sr)
+	typ := sr.Schema.Type().TerraformType(t.Context())
+	config := tftypes.NewValue(typ, map[string]tftypes.Value{
+		"registry": tftypes.NewValue(tftypes.String, "cgr.dev"),
+		"username": tftypes.NewValue(tftypes.String, nil),
+		"password": tftypes.NewValue(tftypes.String, nil),
+	})
+
+	resp := ephemeral.OpenResponse{Result: tfsdk.EphemeralResultData{Schema: sr.Schema, Raw: tftypes.NewValue(typ, nil)}}
+	e.Open(t.Context(), ephemeral.OpenRequest{Config: tfsdk.Config{Schema: sr.Schema, Raw: config}}, &resp)
+	if !resp.Diagnostics.HasError() {
+		t.Error("Open() before the provider is configured succeeded")
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/scratch"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// melangeModel maps the melange attribute.
+type melangeModel struct {
+	Config     types.String `tfsdk:"config"`
+	SourceDir  types.String `tfsdk:"source_dir"`
+	SigningKey types.String `tfsdk:"signing_key"`
+}
+
+// melangeRepo is a repository of packages melange built, and the public key
+// they are signed with.
+type melangeRepo struct {
+	dir string
+	key string
+}
+
+// melangeBuild is a build of one melange config, shared by the resources
+// that need it within a provider run. A build whose context was canceled is
+// not kept, so the next one runs it again.
+type melangeBuild struct {
+	mu   sync.Mutex
+	done bool
+	repo melangeRepo
+	err  error
+}
+
+// melangeArgs returns the arguments to melange that build m's config for
+// archs into outDir, signed with key.
+func melangeArgs(m melangeModel, archs []string, outDir, key string) []string {
+	args := []string{"build", m.Config.ValueString(), "--arch", strings.Join(archs, ","), "--out-dir", outDir, "--signing-key", key}
+	if s := m.SourceDir.ValueString(); s != "" {
+		args = append(args, "--source-dir", s)
+	}
+	return args
+}
+
+// melangeDir returns the directory the packages built from m for archs are
+// kept in. It is the same across runs, so a generated signing key is reused
+// and unchanged packages build to the same checksums.
+func melangeDir(m melangeModel, archs []string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, p := range []string{m.Config.ValueString(), m.SourceDir.ValueString(), m.SigningKey.ValueString()} {
+		if p != "" {
+			if p, err = filepath.Abs(p); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(h, "%s\x00", p)
+	}
+	fmt.Fprint(h, strings.Join(archs, ","))
+	return filepath.Join(cache, "terraform-provider-helm", "melange", hex.EncodeToString(h.Sum(nil))[:16]), nil
+}
+
+// buildMelange builds the packages of the melange config obj describes for
+// archs, once per provider run, and returns the repository they are in.
+func (c *helmClient) buildMelange(ctx context.Context, obj types.Object, archs []string) (melangeRepo, diag.Diagnostics) {
+	var m melangeModel
+	if diags := obj.As(ctx, &m, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return melangeRepo{}, diags
+	}
+	dir, err := melangeDir(m, archs)
+	if err != nil {
+		return melangeRepo{}, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("melange"), "building package with melange", err.Error())}
+	}
+
+	c.melangeMu.Lock()
+	if c.melangeBuilds == nil {
+		c.melangeBuilds = map[string]*melangeBuild{}
+	}
+	b, ok := c.melangeBuilds[dir]
+	if !ok {
+		b = &melangeBuild{}
+		c.melangeBuilds[dir] = b
+	}
+	c.melangeMu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.done {
+		b.repo, b.err = runMelange(ctx, m, archs, dir)
+		b.done = b.err == nil || ctx.Err() == nil
+	}
+	if b.err != nil {
+		return melangeRepo{}, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("melange"), "building package with melange", b.err.Error())}
+	}
+	return b.repo, nil
+}
+
+// runMelange builds m's packages for archs into a fresh repository under
+// dir, signing them with m's key or, if it has none, one generated in dir.
+// Builds go to a temp dir of their own, renamed into dir once done, and hold
+// dir's lock throughout, so providers run at once with the same config don't
+// build over each other.
+func runMelange(ctx context.Context, m melangeModel, archs []string, dir string) (melangeRepo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return melangeRepo{}, err
+	}
+	unlock, err := lockDir(ctx, dir)
+	if err != nil {
+		return melangeRepo{}, fmt.Errorf("locking %s: %w", dir, err)
+	}
+	defer unlock()
+
+	// The temp dir is in dir so the build can be renamed into place.
+	scratchDir := scratch.New(ctx, dir)
+	defer scratchDir.Close()
+	tmp, err := scratchDir.Path()
+	if err != nil {
+		return melangeRepo{}, err
+	}
+
+	key := m.SigningKey.ValueString()
+	if key == "" {
+		key = filepath.Join(dir, "melange.rsa")
+		if _, err := os.Stat(key); errors.Is(err, fs.ErrNotExist) {
+			generated := filepath.Join(tmp, "melange.rsa")
+			if err := runMelangeCLI(ctx, "keygen", generated); err != nil {
+				return melangeRepo{}, err
+			}
+			// The public key goes first: the private key is what marks
+			// the pair as generated.
+			if err := os.Rename(generated+".pub", key+".pub"); err != nil {
+				return melangeRepo{}, err
+			}
+			if err := os.Rename(generated, key); err != nil {
+				return melangeRepo{}, err
+			}
+		}
+	}
+
+	tflog.Info(ctx, "building package with melange", map[string]any{"config": m.Config.ValueString(), "archs": archs})
+	built := filepath.Join(tmp, "packages")
+	if err := runMelangeCLI(ctx, melangeArgs(m, archs, built, key)...); err != nil {
+		return melangeRepo{}, err
+	}
+	// Packages from earlier builds would otherwise still be resolvable, so
+	// they are moved out of the way, to be removed with tmp.
+	out := filepath.Join(dir, "packages")
+	if err := os.Rename(out, filepath.Join(tmp, "previous")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return melangeRepo{}, err
+	}
+	if err := os.Rename(built, out); err != nil {
+		return melangeRepo{}, err
+	}
+	return melangeRepo{dir: out, key: key + ".pub"}, nil
+}
+
+// lockDir takes an exclusive lock on dir, held against other processes too
+// until the returned func is called, waiting for it until ctx is done.
+func lockDir(ctx context.Context, dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, "lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() { f.Close() }, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// runMelangeCLI runs melange with args, returning its output on failure.
+func runMelangeCLI(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "melange", args...)
+	var out tailBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("melange %s: %w\n\n%s", strings.Join(args, " "), err, out.String())
+	}
+	return nil
+}
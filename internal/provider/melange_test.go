@@ -0,0 +1,157 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestMelangeArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m    melangeModel
+		want []string
+	}{{
+		name: "config",
+		m:    melangeModel{Config: types.StringValue("foo.yaml"), SourceDir: types.StringNull(), SigningKey: types.StringNull()},
+		want: []string{"build", "foo.yaml", "--arch", "x86_64,aarch64", "--out-dir", "/out", "--signing-key", "/key.rsa"},
+	}, {
+		name: "source dir",
+		m:    melangeModel{Config: types.StringValue("foo.yaml"), SourceDir: types.StringValue("src"), SigningKey: types.StringNull()},
+		want: []string{"build", "foo.yaml", "--arch", "x86_64,aarch64", "--out-dir", "/out", "--signing-key", "/key.rsa", "--source-dir", "src"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := melangeArgs(tc.m, []string{"x86_64", "aarch64"}, "/out", "/key.rsa"); !slices.Equal(got, tc.want) {
+				t.Errorf("melangeArgs() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildMelange(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	// keygen writes the key pair, and build the repository to --out-dir.
+	script := `#!/bin/sh
+echo "$1" >> ` + log + `
+case "$1" in
+keygen) touch "$2" "$2.pub" ;;
+build)
+	while [ $# -gt 0 ]; do
+		[ "$1" = --out-dir ] && mkdir -p "$2"
+		shift
+	done ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "melange"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	obj := types.ObjectValueMust(map[string]attr.Type{
+		"config":      types.StringType,
+		"source_dir":  types.StringType,
+		"signing_key": types.StringType,
+	}, map[string]attr.Value{
+		"config":      types.StringValue(filepath.Join(dir, "foo.yaml")),
+		"source_dir":  types.StringNull(),
+		"signing_key": types.StringNull(),
+	})
+
+	c := &helmClient{}
+	repo, diags := c.buildMelange(t.Context(), obj, []string{"x86_64"})
+	if diags.HasError() {
+		t.Fatalf("buildMelange() = %v", diags)
+	}
+	if _, err := os.Stat(repo.dir); err != nil {
+		t.Errorf("repository: %v", err)
+	}
+	if _, err := os.Stat(repo.key); err != nil {
+		t.Errorf("key: %v", err)
+	}
+
+	// The same client builds once; another reuses the generated key.
+	if _, diags := c.buildMelange(t.Context(), obj, []string{"x86_64"}); diags.HasError() {
+		t.Fatalf("buildMelange() = %v", diags)
+	}
+	again, diags := (&helmClient{}).buildMelange(t.Context(), obj, []string{"x86_64"})
+	if diags.HasError() {
+		t.Fatalf("buildMelange() = %v", diags)
+	}
+	if again != repo {
+		t.Errorf("second run built %+v, want %+v", again, repo)
+	}
+
+	// A canceled build isn't kept, so the next one runs.
+	c = &helmClient{}
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, diags := c.buildMelange(canceled, obj, []string{"x86_64"}); !diags.HasError() {
+		t.Fatal("buildMelange() with a canceled context succeeded")
+	}
+	if _, diags := c.buildMelange(t.Context(), obj, []string{"x86_64"}); diags.HasError() {
+		t.Fatalf("buildMelange() after a canceled build = %v", diags)
+	}
+
+	// Each build's temp dir is gone, leaving the repository and the key.
+	cached, err := melangeDir(melangeModel{Config: types.StringValue(filepath.Join(dir, "foo.yaml"))}, []string{"x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"lock", "melange.rsa", "melange.rsa.pub", "packages"}; !slices.Equal(names, want) {
+		t.Errorf("cache has %q, want %q", names, want)
+	}
+
+	calls, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Fields(string(calls)), []string{"keygen", "build", "build", "build"}; !slices.Equal(got, want) {
+		t.Errorf("melange calls = %q, want %q", got, want)
+	}
+}
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	unlock, err := lockDir(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("lockDir() = %v", err)
+	}
+
+	// The lock is exclusive, even within a process.
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := lockDir(ctx, dir); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lockDir() while locked = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+	unlock, err = lockDir(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("lockDir() once unlocked = %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+)
+
+// maintainerModel maps an element of maintainers.
+type maintainerModel struct {
+	Name  types.String `tfsdk:"name"`
+	Email types.String `tfsdk:"email"`
+	URL   types.String `tfsdk:"url"`
+}
+
+// chartMaintainers returns the maintainers to put in Chart.yaml, or nil if
+// maintainers is not set.
+func chartMaintainers(ctx context.Context, list types.List) ([]*helmchart.Maintainer, diag.Diagnostics) {
+	if list.IsNull() || list.IsUnknown() {
+		return nil, nil
+	}
+	var ms []maintainerModel
+	if diags := list.ElementsAs(ctx, &ms, false); diags.HasError() {
+		return nil, diags
+	}
+	maintainers := make([]*helmchart.Maintainer, 0, len(ms))
+	for _, m := range ms {
+		maintainers = append(maintainers, &helmchart.Maintainer{
+			Name:  m.Name.ValueString(),
+			Email: m.Email.ValueString(),
+			URL:   m.URL.ValueString(),
+		})
+	}
+	return maintainers, nil
+}
+
+// optionalStrings returns the elements of list, or nil if it is not set. A
+// set, empty list gives an empty, non-nil slice, to clear the field.
+func optionalStrings(ctx context.Context, list types.List) ([]string, diag.Diagnostics) {
+	if list.IsNull() || list.IsUnknown() {
+		return nil, nil
+	}
+	ss := []string{}
+	if diags := list.ElementsAs(ctx, &ss, false); diags.HasError() {
+		return nil, diags
+	}
+	return ss, nil
+}
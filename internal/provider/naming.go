@@ -0,0 +1,96 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+)
+
+// chartNamingModel maps the package_to_chart_name attribute.
+type chartNamingModel struct {
+	StripPrefixes types.List   `tfsdk:"strip_prefixes"`
+	StripSuffixes types.List   `tfsdk:"strip_suffixes"`
+	Case          types.String `tfsdk:"case"`
+}
+
+// chartNaming is how the charts built from packages are expected to be
+// named after them.
+type chartNaming struct {
+	stripPrefixes []string
+	stripSuffixes []string
+	lower         bool
+}
+
+// parseChartNaming returns the naming obj, a package_to_chart_name value,
+// describes, or nil if it is null.
+func parseChartNaming(ctx context.Context, obj types.Object) (*chartNaming, diag.Diagnostics) {
+	if obj.IsNull() || obj.IsUnknown() {
+		return nil, nil
+	}
+	var m chartNamingModel
+	if diags := obj.As(ctx, &m, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return nil, diags
+	}
+	n := &chartNaming{lower: m.Case.ValueString() == "lower"}
+	if !m.StripPrefixes.IsNull() {
+		if diags := m.StripPrefixes.ElementsAs(ctx, &n.stripPrefixes, false); diags.HasError() {
+			return nil, diags
+		}
+	}
+	if !m.StripSuffixes.IsNull() {
+		if diags := m.StripSuffixes.ElementsAs(ctx, &n.stripSuffixes, false); diags.HasError() {
+			return nil, diags
+		}
+	}
+	return n, nil
+}
+
+// expected returns the name of the chart pkg is expected to build: pkg less
+// the first of stripPrefixes it starts with and the first of stripSuffixes
+// it ends with, lowercased if lower is set.
+func (n *chartNaming) expected(pkg string) string {
+	name := pkg
+	for _, p := range n.stripPrefixes {
+		if s, ok := strings.CutPrefix(name, p); ok && s != "" {
+			name = s
+			break
+		}
+	}
+	for _, p := range n.stripSuffixes {
+		if s, ok := strings.CutSuffix(name, p); ok && s != "" {
+			name = s
+			break
+		}
+	}
+	if n.lower {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// check returns an error if the Chart.yaml name of c isn't the one expected
+// of the package it was built from. Any name is accepted if n is nil.
+func (n *chartNaming) check(c chart.BuiltChart) error {
+	if n == nil {
+		return nil
+	}
+	md, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+	pkg := c.Package().Name
+	if got, want := md.Name, n.expected(pkg); got != want {
+		return fmt.Errorf("package %s builds a chart named %q, but package_to_chart_name expects %q. Check that the package is the one intended, or change package_to_chart_name", pkg, got, want)
+	}
+	return nil
+}
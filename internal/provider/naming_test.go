@@ -0,0 +1,37 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import "testing"
+
+func TestChartNamingExpected(t *testing.T) {
+	n := &chartNaming{
+		stripPrefixes: []string{"helm-"},
+		stripSuffixes: []string{"-charts", "-chart"},
+	}
+	lower := &chartNaming{stripSuffixes: []string{"-chart"}, lower: true}
+	for _, tc := range []struct {
+		n    *chartNaming
+		pkg  string
+		want string
+	}{
+		{n, "nginx", "nginx"},
+		{n, "nginx-chart", "nginx"},
+		{n, "nginx-charts", "nginx"},
+		{n, "helm-nginx-chart", "nginx"},
+		// Only the first matching suffix is removed.
+		{n, "nginx-chart-charts", "nginx-chart"},
+		// Names are never stripped to nothing.
+		{n, "-chart", "-chart"},
+		{n, "helm-", "helm-"},
+		{lower, "Nginx-chart", "nginx"},
+		{&chartNaming{}, "Nginx", "Nginx"},
+	} {
+		if got := tc.n.expected(tc.pkg); got != tc.want {
+			t.Errorf("expected(%q) = %q, want %q", tc.pkg, got, tc.want)
+		}
+	}
+}
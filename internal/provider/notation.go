@@ -0,0 +1,115 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// notarySignatureType is the artifact type of Notary Project signatures.
+const notarySignatureType = "application/vnd.cncf.notary.signature"
+
+// notationModel maps the notation attribute.
+type notationModel struct {
+	Key             types.String `tfsdk:"key"`
+	PluginConfig    types.Map    `tfsdk:"plugin_config"`
+	SignatureFormat types.String `tfsdk:"signature_format"`
+}
+
+// notationArgs returns the arguments to notation that sign ref as n says.
+func notationArgs(ctx context.Context, n notationModel, ref name.Digest) ([]string, diag.Diagnostics) {
+	args := []string{"sign", "--key", n.Key.ValueString()}
+	if f := n.SignatureFormat.ValueString(); f != "" {
+		args = append(args, "--signature-format", f)
+	}
+	if !n.PluginConfig.IsNull() && !n.PluginConfig.IsUnknown() {
+		var config map[string]string
+		if diags := n.PluginConfig.ElementsAs(ctx, &config, false); diags.HasError() {
+			return nil, diags
+		}
+		keys := make([]string, 0, len(config))
+		for k := range config {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			args = append(args, "--plugin-config", k+"="+config[k])
+		}
+	}
+	return append(args, ref.String()), nil
+}
+
+// notationSign signs ref with the notation CLI, as configured by obj, and
+// returns the digest of the signature it attached. notation pushes the
+// signature with its own registry credentials.
+func (c *helmClient) notationSign(ctx context.Context, obj types.Object, ref name.Digest) (types.String, diag.Diagnostics) {
+	var n notationModel
+	if diags := obj.As(ctx, &n, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return types.StringNull(), diags
+	}
+	args, diags := notationArgs(ctx, n, ref)
+	if diags.HasError() {
+		return types.StringNull(), diags
+	}
+
+	// notation doesn't say which signature it attached, so it is the one
+	// that wasn't there before.
+	before, err := c.notarySignatures(ctx, ref)
+	if err != nil {
+		return types.StringNull(), diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("notation"), "listing chart signatures", err.Error())}
+	}
+
+	cmd := exec.CommandContext(ctx, "notation", args...)
+	var out tailBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	tflog.Info(ctx, "signing chart with notation", map[string]any{"ref": ref.String(), "key": n.Key.ValueString()})
+	if err := cmd.Run(); err != nil {
+		return types.StringNull(), diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("notation"), "signing chart with notation",
+			fmt.Sprintf("notation %s: %v\n\n%s\n\nThe chart was pushed but not tagged.", strings.Join(args, " "), err, out.String()))}
+	}
+
+	after, err := c.notarySignatures(ctx, ref)
+	if err != nil {
+		return types.StringNull(), diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("notation"), "listing chart signatures", err.Error())}
+	}
+	for _, d := range after {
+		if !slices.Contains(before, d) {
+			tflog.Info(ctx, "signed chart with notation", map[string]any{"ref": ref.String(), "signature": d})
+			return types.StringValue(d), nil
+		}
+	}
+	return types.StringNull(), diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("notation"), "signing chart with notation",
+		fmt.Sprintf("notation succeeded, but no new signature is attached to %s.\n\n%s", ref, out.String()))}
+}
+
+// notarySignatures returns the digests of the Notary Project signatures
+// attached to ref.
+func (c *helmClient) notarySignatures(ctx context.Context, ref name.Digest) ([]string, error) {
+	referrers, err := chart.Referrers(ref, c.remoteOpts(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, r := range referrers {
+		if r.ArtifactType == notarySignatureType {
+			out = append(out, r.Digest.String())
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestNotationArgs(t *testing.T) {
+	ref, err := name.NewDigest("registry.example.com/charts/foo@sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		n    notationModel
+		want []string
+	}{{
+		name: "key",
+		n:    notationModel{Key: types.StringValue("release"), PluginConfig: types.MapNull(types.StringType), SignatureFormat: types.StringNull()},
+		want: []string{"sign", "--key", "release", ref.String()},
+	}, {
+		name: "plugin",
+		n: notationModel{
+			Key: types.StringValue("akv"),
+			PluginConfig: types.MapValueMust(types.StringType, map[string]attr.Value{
+				"self_signed": types.StringValue("true"),
+				"ca_certs":    types.StringValue("/etc/ca.pem"),
+			}),
+			SignatureFormat: types.StringValue("cose"),
+		},
+		// Plugin config is passed in a stable order.
+		want: []string{"sign", "--key", "akv", "--signature-format", "cose", "--plugin-config", "ca_certs=/etc/ca.pem", "--plugin-config", "self_signed=true", ref.String()},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, diags := notationArgs(t.Context(), tc.n, ref)
+			if diags.HasError() {
+				t.Fatalf("notationArgs() = %v", diags)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("notationArgs() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// defaultNotifyPayload is sent when notify sets no payload.
+const defaultNotifyPayload = `{"name":{{ json .Name }},"version":{{ json .Version }},"digest":{{ json .Digest }},"repo":{{ json .Repo }}}`
+
+// notifyTimeout bounds each notification, so a slow webhook can't hold up
+// the apply.
+const notifyTimeout = 30 * time.Second
+
+// notifyModel maps the notify attribute.
+type notifyModel struct {
+	URL     types.String `tfsdk:"url"`
+	Payload types.String `tfsdk:"payload"`
+}
+
+// notifyEvent is what a notify payload template is executed against.
+type notifyEvent struct {
+	Name           string
+	Version        string
+	Digest         string
+	Repo           string
+	Ref            string
+	Tags           []string
+	PackageName    string
+	PackageVersion string
+}
+
+// notifySchema returns the notify attribute, describing the event it fires on.
+func notifySchema(event string) schema.SingleNestedAttribute {
+	return schema.SingleNestedAttribute{
+		Optional:    true,
+		Description: "A webhook to POST a JSON payload to " + event + ". A failed notification is reported as a warning, since the chart is already published.",
+		Attributes: map[string]schema.Attribute{
+			"url": schema.StringAttribute{
+				Required:    true,
+				Description: "The http or https URL to POST to.",
+				Sensitive:   true,
+				Validators: []validator.String{
+					webhookURLValidator{},
+				},
+			},
+			"payload": schema.StringAttribute{
+				Optional:    true,
+				Description: "A Go template for the JSON payload, given the chart's `.Name`, `.Version`, `.Digest`, `.Repo`, `.Ref` (`<repo>@<digest>`) and `.Tags`, and, for charts built from packages, `.PackageName` and `.PackageVersion`. The `json` function quotes a value for JSON. Defaults to `" + defaultNotifyPayload + "`.",
+				Validators: []validator.String{
+					payloadTemplateValidator{},
+				},
+			},
+		},
+	}
+}
+
+// renderNotifyPayload executes a payload template, or the default one, and
+// checks the result is JSON.
+func renderNotifyPayload(tmpl string, ev notifyEvent) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = defaultNotifyPayload
+	}
+	t, err := template.New("payload").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ev); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("payload is not valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// notify sends ev to the webhook configured by obj, if any. Failures are
+// returned as warnings attributed to the notify attribute.
+func notify(ctx context.Context, obj types.Object, ev notifyEvent) diag.Diagnostics {
+	if obj.IsNull() || obj.IsUnknown() {
+		return nil
+	}
+	var n notifyModel
+	if diags := obj.As(ctx, &n, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return diags
+	}
+
+	warn := func(err error) diag.Diagnostics {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("notify"), "notification failed", err.Error())}
+	}
+
+	payload, err := renderNotifyPayload(n.Payload.ValueString(), ev)
+	if err != nil {
+		return warn(fmt.Errorf("rendering payload: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	// The URL is sensitive, and often a secret in itself, so keep it out of
+	// the diagnostics.
+	redact := func(err error) error {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL.ValueString(), bytes.NewReader(payload))
+	if err != nil {
+		return warn(fmt.Errorf("building request: %w", redact(err)))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return warn(fmt.Errorf("sending notification: %w", redact(err)))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return warn(fmt.Errorf("webhook responded %s: %s", resp.Status, strings.TrimSpace(string(body))))
+	}
+	tflog.Info(ctx, "sent notification", map[string]any{"ref": ev.Ref})
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// maxPrePushOutput bounds how much of a pre-push command's output is kept
+// for diagnostics. The end of the output is kept, since that is where tools
+// usually summarize what went wrong.
+const maxPrePushOutput = 16 << 10
+
+// runPrePushCommand runs argv with the chart's archive appended as its last
+// argument. The archive is at $CHART_TGZ and its extracted contents are at
+// $CHART_DIR, both removed once the command exits. A nonzero exit is an
+// error carrying the command's combined output.
+func runPrePushCommand(ctx context.Context, argv []string, c chart.Chart) error {
+	md, err := c.Metadata()
+	if err != nil {
+		return fmt.Errorf("getting chart metadata: %w", err)
+	}
+	ls, err := c.Layers()
+	if err != nil {
+		return fmt.Errorf("getting chart layers: %w", err)
+	}
+	if len(ls) == 0 {
+		return errors.New("chart has no content layer")
+	}
+
+	tmp, err := os.MkdirTemp("", "helm-pre-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		return fmt.Errorf("reading chart archive: %w", err)
+	}
+	archive, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("reading chart archive: %w", err)
+	}
+	tgz := filepath.Join(tmp, md.Name+"-"+md.Version+".tgz")
+	if err := os.WriteFile(tgz, archive, 0o644); err != nil {
+		return err
+	}
+	dir := filepath.Join(tmp, "chart")
+	if err := extractChart(archive, dir); err != nil {
+		return fmt.Errorf("extracting chart archive: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], append(argv[1:], tgz)...)
+	// Charts are archived under a directory named for the chart.
+	cmd.Env = append(os.Environ(), "CHART_TGZ="+tgz, "CHART_DIR="+filepath.Join(dir, md.Name))
+	cmd.Dir = tmp
+	var out tailBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	tflog.Info(ctx, "running pre-push command", map[string]any{"command": argv[0], "chart": tgz})
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w\n\n%s", strings.Join(argv, " "), err, out.String())
+	}
+	tflog.Debug(ctx, "pre-push command succeeded", map[string]any{"output": out.String()})
+	return nil
+}
+
+// extractChart unpacks a chart archive into dir, refusing entries that would
+// land outside it.
+func extractChart(archive []byte, dir string) error {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		p := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside the chart", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tailBuffer keeps the last maxPrePushOutput bytes written to it.
+type tailBuffer struct {
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - maxPrePushOutput; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	s := strings.TrimSpace(string(b.buf))
+	if b.truncated {
+		return "[output truncated]\n" + s
+	}
+	return s
+}
@@ -7,21 +7,37 @@ package provider
 
 import (
 	"context"
-	"time"
+	"crypto/fips140"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
 	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"golang.org/x/time/rate"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
 var (
-	_ provider.Provider = &helmProvider{}
+	_ provider.Provider                       = &helmProvider{}
+	_ provider.ProviderWithFunctions          = &helmProvider{}
+	_ provider.ProviderWithEphemeralResources = &helmProvider{}
 )
 
 // New is a helper function to simplify provider server and testing implementation.
@@ -50,7 +66,12 @@ func (p *helmProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp
 		Description: "The Helm provider offers resources to work with OCI Helm charts and APK repositories.",
 		Attributes: map[string]schema.Attribute{
 			"extra_repositories": schema.ListAttribute{
-				Description: "A list of URLs for package repositories to use for fetching APK packages.",
+				Description: "A list of URLs for package repositories to use for fetching APK packages. Local directories, or `file://` URLs, of `.apk` files without an `APKINDEX.tar.gz`, and globs of `.apk` files, are indexed by the provider when `allow_unsigned_packages` is set.",
+				Optional:    true,
+				ElementType: types.StringType,
+			},
+			"build_repositories": schema.ListAttribute{
+				Description: "A list of URLs for package repositories to use only while resolving and fetching APK packages. Unlike `extra_repositories`, these are never recorded in chart metadata or annotations, so private bootstrap repositories aren't leaked.",
 				Optional:    true,
 				ElementType: types.StringType,
 			},
@@ -59,19 +80,149 @@ func (p *helmProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp
 				Optional:    true,
 				ElementType: types.StringType,
 			},
+			"disable_ambient_keyrings": schema.BoolAttribute{
+				Description: "Verify package repository indexes with only the keys in `extra_keyrings`. By default, the keys Wolfi, Chainguard and Alpine repositories publish are fetched from them and trusted too, so a repository whose key isn't listed still verifies. Requires `extra_keyrings`.",
+				Optional:    true,
+			},
+			"allow_unsigned_packages": schema.BoolAttribute{
+				Description: "**Insecure.** Skip verifying package repository index signatures, so packages can be charted from local melange output before signing keys are set up. Anyone able to change a repository can then change the charts built from it, so this is for development only, and every run using it warns. Conflicts with `disable_ambient_keyrings`.",
+				Optional:    true,
+			},
+			"max_concurrent_builds": schema.Int64Attribute{
+				Description: fmt.Sprintf("The maximum number of charts to build at once. Each build buffers its package in memory, so this bounds the provider's memory use regardless of Terraform's -parallelism; pushes are not limited. Defaults to %d.", defaultMaxConcurrentBuilds),
+				Optional:    true,
+			},
+			"user_agent": schema.StringAttribute{
+				Description: "A product token, such as `my-pipeline/1.0`, to put at the front of the User-Agent sent to registries, ahead of the provider's own.",
+				Optional:    true,
+			},
+			"registry_headers": schema.MapAttribute{
+				Description: "Static headers to send with every registry request, e.g. `X-Request-Source`. `Authorization` and `User-Agent` can't be set here.",
+				Optional:    true,
+				ElementType: types.StringType,
+			},
+			"registry_requests_per_second": schema.Float64Attribute{
+				Description: "The maximum rate of requests to registries, shared by every resource using the provider. Requests over the limit wait rather than fail. Unlimited by default.",
+				Optional:    true,
+			},
+			"registry_burst": schema.Int64Attribute{
+				Description: "How many registry requests may be sent at once before `registry_requests_per_second` applies. Defaults to 1.",
+				Optional:    true,
+			},
+			"registry_auth": schema.ListNestedAttribute{
+				Description: "Credentials for registries, used ahead of any others for them. Meant for short-lived tokens from ephemeral resources, such as `aws_ecr_authorization_token`, which are never written to state or plan.",
+				Optional:    true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"registry": schema.StringAttribute{
+							Description: "The registry's host, e.g. `123456789012.dkr.ecr.us-east-1.amazonaws.com` or `cgr.dev`.",
+							Required:    true,
+						},
+						"username": schema.StringAttribute{
+							Description: "The username to authenticate as.",
+							Required:    true,
+						},
+						"password": schema.StringAttribute{
+							Description: "The password or token to authenticate with.",
+							Required:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+			"registry_aws_assume_roles": schema.ListAttribute{
+				Description: "ARNs of IAM roles to assume, in turn, for ECR and ECR Public, so charts are published by a different identity than the rest of the run. Each is assumed with the credentials of the one before it, the first with the AWS CLI's own, and the last gets the registry password. These take precedence over docker credentials for ECR, and failing to assume them fails the operation rather than falling back.",
+				Optional:    true,
+				ElementType: types.StringType,
+			},
+			"registry_gcp_impersonate_service_accounts": schema.ListAttribute{
+				Description: "Emails of service accounts to impersonate, in turn, for GCR and Artifact Registry, so charts are published by a different identity than the rest of the run. The last is the one authenticated as and the rest are its delegates, each of which must be allowed to impersonate the next; the first is impersonated with Application Default Credentials. These take precedence over gcloud and docker credentials for Google registries.",
+				Optional:    true,
+				ElementType: types.StringType,
+			},
+			"copy_chart_annotations": schema.ListAttribute{
+				Description: "Patterns, as understood by Go's path.Match, of the Chart.yaml annotations to copy to the manifests of charts built by this provider, e.g. `[\"artifacthub.io/*\"]`. All are copied if this isn't set, and none if it is empty, since some upstream annotations exceed registries' annotation size limits, such as ECR's. Changing it applies to charts built afterwards.",
+				Optional:    true,
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: globValidator{}},
+				},
+			},
+			"debug_dir": schema.StringAttribute{
+				Description: "A directory to write each chart build's intermediate artifacts to, for diagnosing what patches and other changes did: the package as fetched, the chart before and after changes, and its manifest. Each build's are written to a subdirectory named for the repo and package, replacing those of earlier builds. The artifacts are never cleaned up, so this is best left unset outside of debugging.",
+				Optional:    true,
+			},
+			"publish_report": schema.StringAttribute{
+				Description: "A file to write a JSON report of the charts published in a run to: each chart's repo, name, version and digest, the package it was built from, the bytes pushed, the blobs the registry already had, and how long publishing took. Since providers aren't told when an apply ends, the file is rewritten after each chart is published with every one so far. Each chart published is also logged at INFO.",
+				Optional:    true,
+			},
+			"package_to_chart_name": schema.SingleNestedAttribute{
+				Description: "How the charts built from packages are named after them, e.g. `nginx-chart` building a chart named `nginx`. When set, building a chart whose Chart.yaml name isn't the one expected of its package fails before anything is pushed, since the chart would otherwise be published under a name nobody expects. Unset, charts may have any name.",
+				Optional:    true,
+				Attributes: map[string]schema.Attribute{
+					"strip_prefixes": schema.ListAttribute{
+						Description: "Prefixes removed from package names, the first that matches only, e.g. `[\"helm-\"]`.",
+						Optional:    true,
+						ElementType: types.StringType,
+					},
+					"strip_suffixes": schema.ListAttribute{
+						Description: "Suffixes removed from package names, the first that matches only, e.g. `[\"-charts\", \"-chart\"]`.",
+						Optional:    true,
+						ElementType: types.StringType,
+					},
+					"case": schema.StringAttribute{
+						Description: "`lower` to lowercase package names, or `preserve` to keep them as they are. Defaults to `preserve`.",
+						Optional:    true,
+						Validators: []validator.String{
+							oneOfValidator{values: []string{"lower", "preserve"}},
+						},
+					},
+				},
+			},
+			"require_fips": schema.BoolAttribute{
+				Description: "Fail unless the provider is running in FIPS 140-3 mode, so every digest and signature check uses Go's validated cryptographic module. The `fips` release builds run in it by default; other builds do when run with `GODEBUG=fips140=on`. `fips140=only` isn't supported, since APK checksums are SHA-1.",
+				Optional:    true,
+			},
 			"default_arch": schema.StringAttribute{
-				Description: "The default architecture to use for package fetching. Can be overridden at the resource level.",
+				Description: "The default architecture to use for package fetching. Can be overridden at the resource level. Go architecture names (`amd64`, `arm64`) are accepted and normalized to their APK names (`x86_64`, `aarch64`).",
 				Optional:    true,
+				CustomType:  archType{},
+				Validators: []validator.String{
+					archValidator{},
+				},
 			},
 		},
 	}
 }
 
+// registryAuthModel maps a registry_auth entry.
+type registryAuthModel struct {
+	Registry types.String `tfsdk:"registry"`
+	Username types.String `tfsdk:"username"`
+	Password types.String `tfsdk:"password"`
+}
+
 // providerData can be used to store data from the Terraform configuration.
 type providerData struct {
-	ExtraRepositories types.List   `tfsdk:"extra_repositories"`
-	ExtraKeyrings     types.List   `tfsdk:"extra_keyrings"`
-	DefaultArch       types.String `tfsdk:"default_arch"`
+	ExtraRepositories types.List    `tfsdk:"extra_repositories"`
+	BuildRepositories types.List    `tfsdk:"build_repositories"`
+	ExtraKeyrings     types.List    `tfsdk:"extra_keyrings"`
+	NoAmbientKeyrings types.Bool    `tfsdk:"disable_ambient_keyrings"`
+	AllowUnsigned     types.Bool    `tfsdk:"allow_unsigned_packages"`
+	DefaultArch       archValue     `tfsdk:"default_arch"`
+	MaxBuilds         types.Int64   `tfsdk:"max_concurrent_builds"`
+	UserAgent         types.String  `tfsdk:"user_agent"`
+	RegistryHeaders   types.Map     `tfsdk:"registry_headers"`
+	RequestsPerSecond types.Float64 `tfsdk:"registry_requests_per_second"`
+	Burst             types.Int64   `tfsdk:"registry_burst"`
+	CopyAnnotations   types.List    `tfsdk:"copy_chart_annotations"`
+	AWSAssumeRoles    types.List    `tfsdk:"registry_aws_assume_roles"`
+	GCPImpersonate    types.List    `tfsdk:"registry_gcp_impersonate_service_accounts"`
+	RegistryAuth      types.List    `tfsdk:"registry_auth"`
+	DebugDir          types.String  `tfsdk:"debug_dir"`
+	PublishReport     types.String  `tfsdk:"publish_report"`
+	RequireFIPS       types.Bool    `tfsdk:"require_fips"`
+	ChartNaming       types.Object  `tfsdk:"package_to_chart_name"`
 }
 
 func (p *helmProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
@@ -82,7 +233,14 @@ func (p *helmProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 		return
 	}
 
+	if config.RequireFIPS.ValueBool() && !fips140.Enabled() {
+		resp.Diagnostics.AddAttributeError(path.Root("require_fips"), "FIPS 140-3 mode required",
+			"The provider isn't running in FIPS 140-3 mode. Use a fips release build, or run Terraform with GODEBUG=fips140=on.")
+		return
+	}
+
 	extraRepositories := []string{}
+	buildRepositories := []string{}
 	extraKeyrings := []string{}
 	// Default arch is empty by default, will use chart.DefaultArch if not specified
 	defaultArch := ""
@@ -97,6 +255,16 @@ func (p *helmProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 		extraRepositories = append(extraRepositories, repos...)
 	}
 
+	if !config.BuildRepositories.IsNull() {
+		var repos []string
+		diags = config.BuildRepositories.ElementsAs(ctx, &repos, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		buildRepositories = append(buildRepositories, repos...)
+	}
+
 	// Parse the keys from the list
 	if !config.ExtraKeyrings.IsNull() {
 		var keys []string
@@ -107,17 +275,142 @@ func (p *helmProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 		}
 		extraKeyrings = append(extraKeyrings, keys...)
 	}
+	resp.Diagnostics.Append(checkEcosystems(extraRepositories, buildRepositories)...)
+
+	onlyConfiguredKeys := config.NoAmbientKeyrings.ValueBool()
+	if onlyConfiguredKeys && len(extraKeyrings) == 0 {
+		resp.Diagnostics.AddAttributeError(path.Root("disable_ambient_keyrings"), "Invalid disable_ambient_keyrings", "disable_ambient_keyrings requires extra_keyrings, or no repository index could be verified.")
+		return
+	}
+	allowUnsigned := config.AllowUnsigned.ValueBool()
+	if allowUnsigned {
+		if onlyConfiguredKeys {
+			resp.Diagnostics.AddAttributeError(path.Root("allow_unsigned_packages"), "Invalid allow_unsigned_packages", "allow_unsigned_packages and disable_ambient_keyrings can't both be set: no key is trusted when signatures aren't verified.")
+			return
+		}
+		resp.Diagnostics.AddAttributeWarning(path.Root("allow_unsigned_packages"), "package signatures are not verified",
+			"allow_unsigned_packages is set, so package repository indexes are trusted without checking their signatures, and anyone able to change a repository can change the charts built from it. Only use this for local development, and never to publish charts others consume.")
+	}
+
+	// Nil copies every annotation, unlike an empty list.
+	var copyAnnotations []string
+	if !config.CopyAnnotations.IsNull() {
+		copyAnnotations = []string{}
+		diags = config.CopyAnnotations.ElementsAs(ctx, &copyAnnotations, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	var registryAuth []registryAuthModel
+	if !config.RegistryAuth.IsNull() {
+		diags = config.RegistryAuth.ElementsAs(ctx, &registryAuth, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+	static := staticKeychain{}
+	for i, a := range registryAuth {
+		host := a.Registry.ValueString()
+		if _, err := name.NewRegistry(host); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("registry_auth").AtListIndex(i).AtName("registry"), "Invalid registry_auth", fmt.Sprintf("%q isn't a registry host: %v", host, err))
+			return
+		}
+		if _, ok := static[host]; ok {
+			resp.Diagnostics.AddAttributeError(path.Root("registry_auth").AtListIndex(i).AtName("registry"), "Invalid registry_auth", fmt.Sprintf("%s is given credentials more than once.", host))
+			return
+		}
+		static[host] = authn.AuthConfig{Username: a.Username.ValueString(), Password: a.Password.ValueString()}
+	}
+
+	var awsRoles, gcpServiceAccounts []string
+	if !config.AWSAssumeRoles.IsNull() {
+		diags = config.AWSAssumeRoles.ElementsAs(ctx, &awsRoles, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+	if !config.GCPImpersonate.IsNull() {
+		diags = config.GCPImpersonate.ElementsAs(ctx, &gcpServiceAccounts, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	naming, diags := parseChartNaming(ctx, config.ChartNaming)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
 	// Get default architecture if specified
 	if !config.DefaultArch.IsNull() {
-		defaultArch = config.DefaultArch.ValueString()
+		defaultArch = config.DefaultArch.Canonical()
+	}
+
+	maxBuilds := int64(defaultMaxConcurrentBuilds)
+	if !config.MaxBuilds.IsNull() {
+		maxBuilds = config.MaxBuilds.ValueInt64()
+		if maxBuilds < 1 {
+			resp.Diagnostics.AddAttributeError(path.Root("max_concurrent_builds"), "Invalid max_concurrent_builds", fmt.Sprintf("max_concurrent_builds must be at least 1, got %d.", maxBuilds))
+			return
+		}
+	}
+
+	userAgent := "terraform-provider-helm/" + p.version
+	if ua := config.UserAgent.ValueString(); ua != "" {
+		userAgent = ua + " " + userAgent
+	}
+
+	var headers map[string]string
+	if !config.RegistryHeaders.IsNull() {
+		diags = config.RegistryHeaders.ElementsAs(ctx, &headers, false)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		for k := range headers {
+			if h := http.CanonicalHeaderKey(k); h == "Authorization" || h == "User-Agent" {
+				resp.Diagnostics.AddAttributeError(path.Root("registry_headers"), "Invalid registry_headers", fmt.Sprintf("%s can't be set in registry_headers.", h))
+				return
+			}
+		}
+	}
+
+	var transport http.RoundTripper = remote.DefaultTransport
+	if !config.RequestsPerSecond.IsNull() {
+		rps := config.RequestsPerSecond.ValueFloat64()
+		if rps <= 0 {
+			resp.Diagnostics.AddAttributeError(path.Root("registry_requests_per_second"), "Invalid registry_requests_per_second", fmt.Sprintf("registry_requests_per_second must be positive, got %g.", rps))
+			return
+		}
+		burst := int64(1)
+		if !config.Burst.IsNull() {
+			burst = config.Burst.ValueInt64()
+		}
+		if burst < 1 {
+			resp.Diagnostics.AddAttributeError(path.Root("registry_burst"), "Invalid registry_burst", fmt.Sprintf("registry_burst must be at least 1, got %d.", burst))
+			return
+		}
+		transport = &rateLimitTransport{limiter: rate.NewLimiter(rate.Limit(rps), int(burst)), base: transport}
 	}
 
-	kc := authn.NewMultiKeychain(google.Keychain, authn.RefreshingKeychain(authn.DefaultKeychain, 30*time.Minute))
+	kc := newKeychain(static, gcpServiceAccounts, awsRoles)
 	ropts := []remote.Option{
 		remote.WithAuthFromKeychain(kc),
-		remote.WithUserAgent("terraform-provider-helm/" + p.version),
+		remote.WithUserAgent(userAgent),
 	}
+	// Uploads are counted for each attempt, so retries are counted too.
+	transport = &transferTransport{base: transport}
+	transport = &retryAfterTransport{base: transport}
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, base: transport}
+	}
+	ropts = append(ropts, remote.WithTransport(transport))
 
 	puller, err := remote.NewPuller(ropts...)
 	if err != nil {
@@ -133,32 +426,183 @@ func (p *helmProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 
 	// Make the OCI client available during Resource and DataSource Configure methods
 	client := &helmClient{
-		extraRepositories: extraRepositories,
-		extraKeyrings:     extraKeyrings,
-		defaultArch:       defaultArch,
-		ropts:             ropts,
+		extraRepositories:  extraRepositories,
+		buildRepositories:  buildRepositories,
+		extraKeyrings:      extraKeyrings,
+		onlyConfiguredKeys: onlyConfiguredKeys,
+		allowUnsigned:      allowUnsigned,
+		defaultArch:        defaultArch,
+		copyAnnotations:    copyAnnotations,
+		debugDir:           config.DebugDir.ValueString(),
+		publishReport:      config.PublishReport.ValueString(),
+		naming:             naming,
+		keychain:           kc,
+		ropts:              ropts,
+		builds:             make(chan struct{}, maxBuilds),
 	}
 
 	resp.DataSourceData = client
 	resp.ResourceData = client
+	resp.EphemeralResourceData = client
 }
 
 // DataSources defines the data sources implemented in the provider.
 func (p *helmProvider) DataSources(_ context.Context) []func() datasource.DataSource {
-	return []func() datasource.DataSource{}
+	return []func() datasource.DataSource{
+		NewAPKIndexDataSource,
+		NewChartPackagesDataSource,
+		NewChartExistsDataSource,
+		NewChartStatusDataSource,
+		NewChartManifestDataSource,
+		NewChartValuesSchemaDataSource,
+	}
 }
 
 // Resources defines the resources implemented in the provider.
 func (p *helmProvider) Resources(_ context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
 		NewHelmChartResource,
+		NewHelmChartCatalogResource,
+		NewHelmChartPromotionResource,
+		NewHelmChartRollbackResource,
+	}
+}
+
+// EphemeralResources defines the ephemeral resources implemented in the provider.
+func (p *helmProvider) EphemeralResources(_ context.Context) []func() ephemeral.EphemeralResource {
+	return []func() ephemeral.EphemeralResource{
+		NewRegistryTokenEphemeralResource,
+	}
+}
+
+// Functions defines the provider-defined functions implemented in the provider.
+func (p *helmProvider) Functions(_ context.Context) []func() function.Function {
+	return []func() function.Function{
+		NewParseRefFunction,
+		NewSemverGTFunction,
+		NewChartVersionFromAPKFunction,
 	}
 }
 
 // helmClient is a client to interact with OCI Helm charts.
 type helmClient struct {
 	extraRepositories []string
+	buildRepositories []string
 	extraKeyrings     []string
-	defaultArch       string
-	ropts             []remote.Option
+	// onlyConfiguredKeys verifies indexes with extraKeyrings alone.
+	onlyConfiguredKeys bool
+	// allowUnsigned skips verifying index signatures.
+	allowUnsigned bool
+	defaultArch   string
+	// copyAnnotations are the patterns of the Chart.yaml annotations built
+	// charts copy to their manifests, or nil to copy them all.
+	copyAnnotations []string
+	// naming is how built charts are expected to be named after their
+	// packages, or nil if they may have any name.
+	naming *chartNaming
+	// debugDir is where builds write their intermediate artifacts, if set.
+	debugDir string
+	// publishReport is the file the charts published are reported in, if
+	// set, and published those reported so far.
+	publishReport string
+	reportMu      sync.Mutex
+	published     []publishRecord
+	// keychain resolves the credentials registry requests are made with.
+	keychain authn.Keychain
+	ropts    []remote.Option
+	// builds is a semaphore bounding concurrent chart builds.
+	builds chan struct{}
+
+	// melangeBuilds are the melange builds made in this run, by directory.
+	melangeMu     sync.Mutex
+	melangeBuilds map[string]*melangeBuild
+}
+
+// remoteOpts returns the registry options bound to ctx, so requests are
+// abandoned when an operation is cancelled.
+func (c *helmClient) remoteOpts(ctx context.Context) []remote.Option {
+	return append(slices.Clip(c.ropts), remote.WithContext(ctx))
+}
+
+// resolveConfig returns the provider's package resolution settings for arch,
+// or default_arch if it is empty. Every package lookup starts from these, so
+// a provider alias's settings apply wholesale to everything using it.
+func (c *helmClient) resolveConfig(arch string) *chart.BuildConfig {
+	if arch == "" {
+		arch = c.defaultArch
+	}
+	return &chart.BuildConfig{
+		Keys:               c.extraKeyrings,
+		OnlyConfiguredKeys: c.onlyConfiguredKeys,
+		AllowUnsigned:      c.allowUnsigned,
+		RuntimeRepos:       c.extraRepositories,
+		BuildRepos:         c.buildRepositories,
+		Arch:               arch,
+	}
+}
+
+// repoEcosystem returns the package ecosystem repo belongs to, or "" if it
+// isn't a known one. Chainguard's repositories build on Wolfi's, so they
+// count as Wolfi.
+func repoEcosystem(repo string) string {
+	u, err := url.Parse(repo)
+	if err != nil {
+		return ""
+	}
+	switch host := u.Hostname(); {
+	case host == "packages.wolfi.dev", host == "apk.cgr.dev", host == "packages.cgr.dev":
+		return "Wolfi"
+	case host == "alpinelinux.org", strings.HasSuffix(host, ".alpinelinux.org"):
+		return "Alpine"
+	}
+	return ""
+}
+
+// checkEcosystems warns about repositories that mix package ecosystems, whose
+// packages and keys don't work together, or that are listed as both runtime
+// and build-only.
+func checkEcosystems(runtime, build []string) diag.Diagnostics {
+	var ds diag.Diagnostics
+	seen := map[string]string{}
+	for _, repo := range append(slices.Clip(runtime), build...) {
+		if e := repoEcosystem(repo); e != "" {
+			seen[e] = repo
+		}
+	}
+	if len(seen) > 1 {
+		ds.AddWarning("repositories mix package ecosystems",
+			fmt.Sprintf("%s (Wolfi) and %s (Alpine) are both configured, but their packages aren't built against each other, so a package may resolve dependencies from the wrong one. Configure a provider alias for each ecosystem, and set provider on the resources using each.", seen["Wolfi"], seen["Alpine"]))
+	}
+	for _, repo := range build {
+		if slices.Contains(runtime, repo) {
+			ds.AddAttributeWarning(path.Root("build_repositories"), "repository listed twice",
+				fmt.Sprintf("%s is in both extra_repositories and build_repositories. It is recorded in chart metadata as an extra repository, so build_repositories doesn't keep it private.", repo))
+		}
+	}
+	return ds
+}
+
+// debugPath returns the directory builds of the chart published to repo
+// write their intermediate artifacts to, or "" if they write none.
+func (c *helmClient) debugPath(repo string) string {
+	if c.debugDir == "" {
+		return ""
+	}
+	return filepath.Join(c.debugDir, strings.NewReplacer("/", "_", ":", "_").Replace(repo))
+}
+
+// defaultMaxConcurrentBuilds is the max_concurrent_builds default.
+const defaultMaxConcurrentBuilds = 4
+
+// build builds a chart once a build slot is free. The slot is released as
+// soon as the chart is built, so pushes overlap with other builds.
+func (c *helmClient) build(ctx context.Context, name string, config *chart.BuildConfig) (chart.BuiltChart, error) {
+	select {
+	case c.builds <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.builds }()
+
+	return chart.Build(ctx, name, config)
 }
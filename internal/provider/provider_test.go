@@ -0,0 +1,355 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/time/rate"
+)
+
+func TestClientBuildWaitsForSlot(t *testing.T) {
+	c := &helmClient{builds: make(chan struct{}, 1)}
+
+	// Occupy the only slot, so the next build must wait for it.
+	c.builds <- struct{}{}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := c.build(ctx, "chart-basic", &chart.BuildConfig{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("build() error = %v, want %v", err, context.Canceled)
+	}
+	if got := len(c.builds); got != 1 {
+		t.Errorf("build slots in use = %d, want 1", got)
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []http.Header
+	)
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Clone())
+		mu.Unlock()
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(s.URL, "http://") + "/headers")
+	if err != nil {
+		t.Fatalf("failed to parse repository: %v", err)
+	}
+	_, _ = remote.List(repo,
+		remote.WithUserAgent("my-pipeline/1.0 terraform-provider-helm/test"),
+		remote.WithTransport(&headerTransport{headers: map[string]string{"X-Request-Source": "ci"}, base: remote.DefaultTransport}),
+	)
+
+	if len(seen) == 0 {
+		t.Fatal("registry saw no requests")
+	}
+	for _, h := range seen {
+		if got := h.Get("X-Request-Source"); got != "ci" {
+			t.Errorf("X-Request-Source = %q, want ci", got)
+		}
+		if got := h.Get("User-Agent"); !strings.HasPrefix(got, "my-pipeline/1.0 terraform-provider-helm/test") {
+			t.Errorf("User-Agent = %q, want it to start with the configured product", got)
+		}
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer s.Close()
+
+	// One request an hour: the first is let through, the second must wait.
+	client := &http.Client{Transport: &rateLimitTransport{limiter: rate.NewLimiter(rate.Every(time.Hour), 1), base: http.DefaultTransport}}
+
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("second request was not held by the rate limit")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: ""},
+		{value: "soon"},
+		{value: "5", want: 5 * time.Second, wantOK: true},
+		{value: "-5", want: 0, wantOK: true},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOK: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+	}
+	for _, tc := range tests {
+		got, ok := retryAfter(tc.value, now)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tc.value, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.URL.Path == "/later":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case calls == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer s.Close()
+
+	client := &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+	ctx, throttled := withThrottleLog(t.Context())
+
+	get := func(path string) int {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get("/"); got != http.StatusOK {
+		t.Errorf("throttled request = %d, want it retried to %d", got, http.StatusOK)
+	}
+	// Waits beyond maxRetryAfter are passed back rather than waited out.
+	if got := get("/later"); got != http.StatusTooManyRequests {
+		t.Errorf("long Retry-After request = %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	diags := throttled.diagnostics()
+	if len(diags) != 1 || !strings.Contains(diags[0].Detail(), "2 times") {
+		t.Errorf("diagnostics = %v, want one warning counting 2 throttled responses", diags)
+	}
+}
+
+func TestTransferTransport(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(s.URL, "http://") + "/transfer:latest")
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+	img, err := random.Image(4096, 2)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	// Random layers don't compress, so two of 4096 bytes push at least
+	// that much, and less is pushed without them.
+	size := int64(4096)
+
+	push := func(img v1.Image) *transferLog {
+		ctx, transferred := withTransferLog(t.Context())
+		if err := remote.Write(ref, img, remote.WithContext(ctx), remote.WithTransport(&transferTransport{base: remote.DefaultTransport})); err != nil {
+			t.Fatalf("failed to push: %v", err)
+		}
+		return transferred
+	}
+
+	first := push(img)
+	if got := first.bytes.Load(); got < size {
+		t.Errorf("first push uploaded %d bytes, want at least %d", got, size)
+	}
+	if got := first.hits.Load(); got != 0 {
+		t.Errorf("first push had %d cache hits, want 0", got)
+	}
+	// The first image's layers are there already, so only the new layer,
+	// config and manifest are uploaded.
+	layer, err := random.Layer(16, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+	next, err := mutate.AppendLayers(img, layer)
+	if err != nil {
+		t.Fatalf("failed to append layer: %v", err)
+	}
+	second := push(next)
+	if got := second.bytes.Load(); got >= size {
+		t.Errorf("second push uploaded %d bytes, want less than %d", got, size)
+	}
+	if got := second.hits.Load(); got != 2 {
+		t.Errorf("second push had %d cache hits, want one for each of the first image's layers", got)
+	}
+}
+
+func TestRegistryUnreachable(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/test/chart:missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The registry answers that the chart is missing.
+	_, err = remote.Head(ref)
+	if err == nil || registryUnreachable(err) {
+		t.Errorf("registryUnreachable(%v) = true, want false", err)
+	}
+
+	// Nothing answers at all.
+	srv.Close()
+	_, err = remote.Head(ref)
+	if err == nil || !registryUnreachable(err) {
+		t.Errorf("registryUnreachable(%v) = false, want true", err)
+	}
+}
+
+func TestKeepUnresolved(t *testing.T) {
+	// An index the repository returned but that doesn't resolve fails.
+	if ds := keepUnresolved(t.Context(), errors.New("no package chart-basic"), "it is skipped"); ds != nil {
+		t.Errorf("keepUnresolved() = %v, want nil", ds)
+	}
+	// A repository that can't be reached only warns.
+	err := fmt.Errorf("getting repository indexes: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+	ds := keepUnresolved(t.Context(), err, "it is skipped")
+	if len(ds) != 1 || ds.HasError() || !strings.Contains(ds[0].Detail(), "so it is skipped") {
+		t.Errorf("keepUnresolved() = %v, want a warning", ds)
+	}
+}
+
+func TestCheckEcosystems(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		runtime, build []string
+		want           []string
+	}{{
+		name:    "wolfi and chainguard",
+		runtime: []string{"https://packages.wolfi.dev/os"},
+		build:   []string{"https://apk.cgr.dev/chainguard-private"},
+	}, {
+		name:    "wolfi and alpine",
+		runtime: []string{"https://packages.wolfi.dev/os", "https://dl-cdn.alpinelinux.org/alpine/edge/main"},
+		want:    []string{"repositories mix package ecosystems"},
+	}, {
+		name:    "alpine build repository",
+		runtime: []string{"https://packages.wolfi.dev/os"},
+		build:   []string{"https://dl-cdn.alpinelinux.org/alpine/edge/main"},
+		want:    []string{"repositories mix package ecosystems"},
+	}, {
+		name:    "local and listed twice",
+		runtime: []string{"/srv/packages", "https://example.com/os"},
+		build:   []string{"https://example.com/os"},
+		want:    []string{"repository listed twice"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, d := range checkEcosystems(tc.runtime, tc.build) {
+				got = append(got, d.Summary())
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("checkEcosystems() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRecordPublish(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.json")
+	c := &helmClient{publishReport: report}
+	for _, rec := range []publishRecord{
+		{Repo: "example.com/charts/a", Name: "a", Version: "1.0.0", BytesPushed: 10},
+		{Repo: "example.com/charts/b", Name: "b", Version: "2.0.0", CacheHits: 3},
+	} {
+		if diags := c.recordPublish(t.Context(), rec); diags.HasError() {
+			t.Fatalf("recordPublish() = %v", diags)
+		}
+	}
+
+	raw, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got publishReport
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, raw)
+	}
+	if len(got.Charts) != 2 || got.Charts[0].Name != "a" || got.Charts[1].CacheHits != 3 {
+		t.Errorf("report = %+v, want both charts", got)
+	}
+}
+
+func TestRenderNotifyPayload(t *testing.T) {
+	ev := notifyEvent{
+		Name:    "example",
+		Version: "1.2.3",
+		Digest:  "sha256:abc",
+		Repo:    "registry.example.com/charts/example",
+		Tags:    []string{"stable", "1.2"},
+	}
+
+	got, err := renderNotifyPayload("", ev)
+	if err != nil {
+		t.Fatalf("rendering default payload: %v", err)
+	}
+	if want := `{"name":"example","version":"1.2.3","digest":"sha256:abc","repo":"registry.example.com/charts/example"}`; string(got) != want {
+		t.Errorf("default payload = %s, want %s", got, want)
+	}
+
+	got, err = renderNotifyPayload(`{"text": {{ json (printf "%s %s released" .Name .Version) }}, "tags": {{ json .Tags }}}`, ev)
+	if err != nil {
+		t.Fatalf("rendering payload: %v", err)
+	}
+	if want := `{"text": "example 1.2.3 released", "tags": ["stable","1.2"]}`; string(got) != want {
+		t.Errorf("payload = %s, want %s", got, want)
+	}
+
+	if _, err := renderNotifyPayload(`{"name": {{ .Name }}}`, ev); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("unquoted payload error = %v, want invalid JSON", err)
+	}
+	if _, err := renderNotifyPayload(`{{ .Missing }}`, ev); err == nil {
+		t.Error("payload with unknown field rendered")
+	}
+}
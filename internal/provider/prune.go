@@ -0,0 +1,116 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// pruneDigests, with keep_digests set, records digest as the newest of
+// retained_digests and deletes the digests published to repo before the
+// newest keep_digests. Digests any tag in repo still points at are left in
+// place, as are all of them if the tags can't be looked up. Digests the registry won't
+// delete, or that are still tagged, are dropped from retained_digests, so
+// they aren't retried on every push.
+func (r *helmChartResource) pruneDigests(ctx context.Context, data, prior *helmChartResourceModel, repo name.Repository, digest string) diag.Diagnostics {
+	data.RetainedDigests = types.ListNull(types.StringType)
+	if data.KeepDigests.IsNull() || data.KeepDigests.IsUnknown() {
+		return nil
+	}
+	keep := int(data.KeepDigests.ValueInt64())
+
+	retained := []string{digest}
+	// Only what was published to this repo is pruned; after a move the old
+	// repo is left as it is.
+	if prior != nil && !prior.Repo.Equal(data.Repo) {
+		prior = nil
+	}
+	if prior != nil {
+		var before []string
+		if !prior.RetainedDigests.IsNull() && !prior.RetainedDigests.IsUnknown() {
+			if diags := prior.RetainedDigests.ElementsAs(ctx, &before, false); diags.HasError() {
+				return diags
+			}
+		} else if d := prior.Digest.ValueString(); d != "" {
+			before = []string{d}
+		}
+		for _, d := range before {
+			if d != digest {
+				retained = append(retained, d)
+			}
+		}
+	}
+
+	var ds diag.Diagnostics
+	if len(retained) > keep {
+		tagged, err := r.taggedDigests(ctx, repo)
+		if err != nil {
+			ds = append(ds, diag.NewAttributeWarningDiagnostic(path.Root("keep_digests"), "looking up tags to prune around",
+				fmt.Sprintf("No digests were deleted, since the tags that might still point at them couldn't be looked up: %v", err)))
+		} else {
+			for _, d := range retained[keep:] {
+				if tagged[d] {
+					tflog.Info(ctx, "keeping superseded digest that is still tagged", map[string]any{"digest": d})
+					continue
+				}
+				if err := remote.Delete(chart.DigestRef(repo, d), r.client.remoteOpts(ctx)...); err != nil {
+					var terr *transport.Error
+					if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+						continue
+					}
+					ds = append(ds, diag.NewAttributeWarningDiagnostic(path.Root("keep_digests"), "deleting superseded digest",
+						fmt.Sprintf("%s was left in the registry: %v", chart.DigestRef(repo, d), err)))
+				}
+			}
+			retained = retained[:keep]
+		}
+	}
+
+	list, diags := types.ListValueFrom(ctx, types.StringType, retained)
+	data.RetainedDigests = list
+	return append(ds, diags...)
+}
+
+// taggedDigests returns the digests every tag in repo points at, by both
+// digest algorithms, whoever tagged them. Tags deleted while they are looked
+// up are skipped.
+func (r *helmChartResource) taggedDigests(ctx context.Context, repo name.Repository) (map[string]bool, error) {
+	tags, err := remote.List(repo, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+	tagged := map[string]bool{}
+	for _, t := range tags {
+		desc, err := remote.Get(repo.Tag(t), r.client.remoteOpts(ctx)...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, err
+		}
+		for _, alg := range chart.DigestAlgorithms() {
+			d, err := chart.ManifestDigest(desc.Manifest, alg)
+			if err != nil {
+				return nil, err
+			}
+			tagged[d] = true
+		}
+	}
+	return tagged, nil
+}
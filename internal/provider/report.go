@@ -0,0 +1,152 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// publishRecord is what publishing one chart did, as logged and written to
+// publish_report.
+type publishRecord struct {
+	Repo           string `json:"repo"`
+	Name           string `json:"name"`
+	Version        string `json:"version"`
+	Digest         string `json:"digest"`
+	Package        string `json:"package"`
+	PackageVersion string `json:"package_version"`
+	// BytesPushed is how much was uploaded to the registry, including any
+	// uploads retried.
+	BytesPushed int64 `json:"bytes_pushed"`
+	// CacheHits is how many blobs the registry already had, or mounted from
+	// another repo, so weren't uploaded.
+	CacheHits  int   `json:"cache_hits"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// publishReport is the content of publish_report.
+type publishReport struct {
+	Charts []publishRecord `json:"charts"`
+}
+
+// recordPublish logs rec, and adds it to publish_report if one is set. The
+// provider isn't told when an apply ends, so the report is rewritten with
+// every chart published so far in the run each time.
+func (c *helmClient) recordPublish(ctx context.Context, rec publishRecord) diag.Diagnostics {
+	tflog.Info(ctx, "published chart", map[string]any{
+		"repo":         rec.Repo,
+		"chart":        rec.Name,
+		"version":      rec.Version,
+		"digest":       rec.Digest,
+		"bytes_pushed": rec.BytesPushed,
+		"cache_hits":   rec.CacheHits,
+		"duration":     (time.Duration(rec.DurationMS) * time.Millisecond).String(),
+	})
+	if c.publishReport == "" {
+		return nil
+	}
+
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+	c.published = append(c.published, rec)
+	raw, err := json.MarshalIndent(publishReport{Charts: c.published}, "", "  ")
+	if err == nil {
+		// Written whole and renamed into place, so readers never see it
+		// half written.
+		tmp := fmt.Sprintf("%s.%d.tmp", c.publishReport, os.Getpid())
+		if err = os.WriteFile(tmp, append(raw, '\n'), 0o644); err == nil {
+			err = os.Rename(tmp, c.publishReport)
+		}
+	}
+	if err != nil {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("publish_report"), "writing publish report", err.Error())}
+	}
+	return nil
+}
+
+// transferLog records the registry traffic of one operation.
+type transferLog struct {
+	bytes atomic.Int64
+	hits  atomic.Int64
+}
+
+type transferLogKey struct{}
+
+// withTransferLog returns a context whose registry requests record what
+// they upload in the returned log.
+func withTransferLog(ctx context.Context) (context.Context, *transferLog) {
+	l := &transferLog{}
+	return context.WithValue(ctx, transferLogKey{}, l), l
+}
+
+// record returns a record of what l recorded, for an operation started at
+// start.
+func (l *transferLog) record(start time.Time) publishRecord {
+	return publishRecord{
+		BytesPushed: l.bytes.Load(),
+		CacheHits:   int(l.hits.Load()),
+		DurationMS:  time.Since(start).Milliseconds(),
+	}
+}
+
+// transferTransport records the bytes each registry request uploads, and
+// the blobs the registry already has, in the request context's transferLog,
+// if any.
+type transferTransport struct {
+	base http.RoundTripper
+}
+
+func (t *transferTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log, _ := req.Context().Value(transferLogKey{}).(*transferLog)
+	if log == nil {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &countingBody{ReadCloser: req.Body, n: &log.bytes}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && blobSkipped(req, resp) {
+		log.hits.Add(1)
+	}
+	return resp, err
+}
+
+// blobSkipped reports whether resp says a blob needn't be uploaded: that the
+// registry has it, or mounted it from another repo.
+func blobSkipped(req *http.Request, resp *http.Response) bool {
+	switch {
+	case req.Method == http.MethodHead && strings.Contains(req.URL.Path, "/blobs/sha256:"):
+		return resp.StatusCode == http.StatusOK
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/blobs/uploads/") && req.URL.Query().Has("mount"):
+		return resp.StatusCode == http.StatusCreated
+	}
+	return false
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
@@ -7,24 +7,54 @@ package provider
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 
+	"chainguard.dev/apko/pkg/apk/apk"
 	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/sync/errgroup"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
 var (
-	_ resource.Resource              = &helmChartResource{}
-	_ resource.ResourceWithConfigure = &helmChartResource{}
+	_ resource.Resource                   = &helmChartResource{}
+	_ resource.ResourceWithConfigure      = &helmChartResource{}
+	_ resource.ResourceWithModifyPlan     = &helmChartResource{}
+	_ resource.ResourceWithImportState    = &helmChartResource{}
+	_ resource.ResourceWithValidateConfig = &helmChartResource{}
+)
+
+const (
+	rebuildOnVersion  = "version"
+	rebuildOnRevision = "revision"
+
+	idFormatDigest = "digest"
+	idFormatChart  = "chart"
 )
 
 // NewHelmChartResource is a helper function to simplify the provider implementation.
@@ -39,16 +69,95 @@ type helmChartResource struct {
 
 // helmChartResourceModel maps the resource schema data.
 type helmChartResourceModel struct {
-	ID             types.String `tfsdk:"id"`
-	Repo           types.String `tfsdk:"repo"`
-	PackageName    types.String `tfsdk:"package_name"`
-	PackageVersion types.String `tfsdk:"package_version"`
-	PackageArch    types.String `tfsdk:"package_arch"`
-	Digest         types.String `tfsdk:"digest"`
-	Name           types.String `tfsdk:"name"`
-	ChartVersion   types.String `tfsdk:"chart_version"`
-	JSONPatches    types.Map    `tfsdk:"json_patches"`
-	Images         types.Map    `tfsdk:"images"`
+	ID               types.String `tfsdk:"id"`
+	Repo             types.String `tfsdk:"repo"`
+	PackageName      types.String `tfsdk:"package_name"`
+	PackageVersion   types.String `tfsdk:"package_version"`
+	PackageArch      archValue    `tfsdk:"package_arch"`
+	Melange          types.Object `tfsdk:"melange"`
+	PreferPackages   types.List   `tfsdk:"prefer_packages"`
+	BlockPackages    types.List   `tfsdk:"block_packages"`
+	Digest           types.String `tfsdk:"digest"`
+	PreviousDigest   types.String `tfsdk:"previous_digest"`
+	Name             types.String `tfsdk:"name"`
+	ChartVersion     types.String `tfsdk:"chart_version"`
+	IsLibrary        types.Bool   `tfsdk:"is_library"`
+	JSONPatches      types.Map    `tfsdk:"json_patches"`
+	Images           types.Map    `tfsdk:"images"`
+	Annotations      types.Map    `tfsdk:"annotations"`
+	ManifestJSON     types.String `tfsdk:"manifest_json"`
+	ConfigJSON       types.String `tfsdk:"config_json"`
+	LayerDigest      types.String `tfsdk:"layer_digest"`
+	RenderedSHA256   types.String `tfsdk:"rendered_manifest_sha256"`
+	LayerSize        types.Int64  `tfsdk:"layer_size"`
+	RevisionFormat   types.String `tfsdk:"chart_version_revision"`
+	ManifestFormat   types.String `tfsdk:"manifest_format"`
+	DigestAlgorithm  types.String `tfsdk:"digest_algorithm"`
+	ConfigMediaType  types.String `tfsdk:"config_media_type"`
+	ChartMediaType   types.String `tfsdk:"chart_layer_media_type"`
+	SourceAnnotation types.String `tfsdk:"source_annotation"`
+	Created          types.String `tfsdk:"created"`
+	// max_annotation_size defaults to the registry's known limit, if any.
+	MaxAnnotationSize   types.Int64 `tfsdk:"max_annotation_size"`
+	TruncateAnnotations types.Bool  `tfsdk:"truncate_annotations"`
+	MaxFileSize         types.Int64 `tfsdk:"max_file_size"`
+	AllowedBinary       types.List  `tfsdk:"allowed_binary_files"`
+	FailSuspectFiles    types.Bool  `tfsdk:"fail_on_suspect_files"`
+	// The APK version names mirror each other: package_version is the
+	// requested constraint, package_resolved_version what it resolved to.
+	ResolvedVersion   types.String `tfsdk:"package_resolved_version"`
+	ResolvedName      types.String `tfsdk:"package_resolved_name"`
+	Snapshot          types.String `tfsdk:"repository_snapshot"`
+	PackageRepo       types.String `tfsdk:"package_repository"`
+	PackageRepoTime   types.String `tfsdk:"package_repository_timestamp"`
+	RebuildOn         types.String `tfsdk:"rebuild_on"`
+	PackageChecksum   types.String `tfsdk:"package_checksum"`
+	Lockfile          types.String `tfsdk:"resolved_lockfile"`
+	OutputLockfile    types.String `tfsdk:"output_lockfile_path"`
+	RepositoryPin     types.String `tfsdk:"repository_pin"`
+	MaxVersions       types.Int64  `tfsdk:"max_versions_behind"`
+	MaxDays           types.Int64  `tfsdk:"max_days_behind"`
+	FailWhenStale     types.Bool   `tfsdk:"fail_when_stale"`
+	PublishedPackages types.List   `tfsdk:"published_packages"`
+	DependencyPattern types.String `tfsdk:"chart_dependency_pattern"`
+	FailUnpublished   types.Bool   `tfsdk:"fail_on_unpublished_dependencies"`
+	BundleDeps        types.Bool   `tfsdk:"bundle_dependencies"`
+	ChartRoots        types.List   `tfsdk:"chart_search_paths"`
+	MirrorRepos       types.List   `tfsdk:"mirror_repos"`
+	IDFormat          types.String `tfsdk:"id_format"`
+	Tags              types.List   `tfsdk:"tags"`
+	ImmutableTags     types.Bool   `tfsdk:"immutable_tags"`
+	VerifyArchs       types.List   `tfsdk:"verify_archs"`
+	SkipIfExists      types.Bool   `tfsdk:"skip_if_exists"`
+	Notify            types.Object `tfsdk:"notify"`
+	PrePushCommand    types.List   `tfsdk:"pre_push_command"`
+	Scan              types.Object `tfsdk:"scan"`
+	ScanFindings      types.List   `tfsdk:"scan_findings"`
+	ScanAttestation   types.String `tfsdk:"scan_attestation"`
+	Notation          types.Object `tfsdk:"notation"`
+	NotationSignature types.String `tfsdk:"notation_signature"`
+	Readme            types.Object `tfsdk:"readme"`
+	Notes             types.Object `tfsdk:"notes"`
+	Icon              types.Object `tfsdk:"icon"`
+	License           types.Object `tfsdk:"license"`
+	RequireLicense    types.Bool   `tfsdk:"require_license"`
+	ForbidLibrary     types.Bool   `tfsdk:"forbid_library_charts"`
+	Maintainers       types.List   `tfsdk:"maintainers"`
+	AppendMaintainers types.Bool   `tfsdk:"append_maintainers"`
+	Keywords          types.List   `tfsdk:"keywords"`
+	Home              types.String `tfsdk:"home"`
+	Sources           types.List   `tfsdk:"sources"`
+	Deprecated        types.Bool   `tfsdk:"deprecated"`
+	TombstoneTag      types.String `tfsdk:"tombstone_tag"`
+	ValuesDocs        types.Bool   `tfsdk:"values_docs"`
+	NormalizeModes    types.Bool   `tfsdk:"normalize_file_modes"`
+	ExtraLayers       types.List   `tfsdk:"extra_layers"`
+	UnitTests         types.Object `tfsdk:"unit_tests"`
+	CheckUpgrades     types.Bool   `tfsdk:"check_upgrades"`
+	DiffPrevious      types.Bool   `tfsdk:"diff_previous"`
+	KeepDigests       types.Int64  `tfsdk:"keep_digests"`
+	RetainedDigests   types.List   `tfsdk:"retained_digests"`
+	ChartDiff         types.Object `tfsdk:"chart_diff"`
 }
 
 // Configure adds the provider configured client to the resource.
@@ -86,9 +195,27 @@ func (r *helmChartResource) Schema(_ context.Context, _ resource.SchemaRequest,
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"id_format": schema.StringAttribute{
+				Optional:    true,
+				Description: "How `id` is formed. One of `digest` (default, `<repo>@<digest>`) or `chart` (`<chart name>:<chart version>`, which stays the same when the chart moves to another repo).",
+				Validators: []validator.String{
+					oneOfValidator{values: []string{idFormatDigest, idFormatChart}},
+				},
+			},
 			"repo": schema.StringAttribute{
 				Required:    true,
-				Description: "The repo in the OCI registry where the Helm chart will be pushed.",
+				Description: "The repo in the OCI registry where the Helm chart will be pushed. Must not include a tag or digest.",
+				Validators: []validator.String{
+					repoValidator{},
+				},
+			},
+			"mirror_repos": schema.ListAttribute{
+				Optional:    true,
+				Description: "Additional repos to push the chart to, by the same digest, after `repo`. Mirrors in the same registry as `repo` mount its blobs instead of uploading them again.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: repoValidator{}},
+				},
 			},
 			"package_name": schema.StringAttribute{
 				Required:    true,
@@ -96,15 +223,228 @@ func (r *helmChartResource) Schema(_ context.Context, _ resource.SchemaRequest,
 			},
 			"package_version": schema.StringAttribute{
 				Optional:    true,
-				Description: "The version of the package to fetch from the package repository, pinned via APK's `name=version` constraint syntax. If not specified, the latest available version will be used.",
+				Description: "The version of the package to fetch from the package repository, pinned via APK's `name=version` constraint syntax. A constraint operator (`~`, `>`, `>=`, `<`, `<=`) may prefix the version instead. If not specified, the latest available version will be used.",
+				Validators: []validator.String{
+					versionValidator{},
+				},
 			},
 			"package_arch": schema.StringAttribute{
 				Optional:    true,
-				Description: "The architecture of the package to fetch. If not specified, uses the provider default_arch or falls back to system defaults.",
+				Description: "The architecture of the package to fetch. If not specified, uses the provider default_arch or falls back to system defaults. Go architecture names (`amd64`, `arm64`) are treated as equivalent to their APK names (`x86_64`, `aarch64`).",
+				CustomType:  archType{},
+				Validators: []validator.String{
+					archValidator{},
+				},
+			},
+			"prefer_packages": schema.ListAttribute{
+				Optional:    true,
+				Description: "Packages to build in preference to others when several are named `package_name` or provide it, most preferred first. The first of these available in a version `package_version` allows is built; otherwise the choice is apko's, as without this. The package built is recorded in `package_resolved_name`.",
+				ElementType: types.StringType,
+			},
+			"block_packages": schema.ListAttribute{
+				Optional:    true,
+				Description: "Packages never to build, even when they are named `package_name` or provide it.",
+				ElementType: types.StringType,
+			},
+			"melange": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Build the package from a [melange](https://github.com/chainguard-dev/melange) config before charting it, so a package and its chart can be iterated on in one apply, e.g. against a registry in kind. The `melange` CLI must be installed, with a runner it can build with. The packages it builds are put in a repository consulted before the provider's, for the `package_arch` and `verify_archs`, and `package_name` is resolved as usual. They are built only at apply, never at plan, so every plan shows the chart as rebuilt, with its package resolution unknown, and `max_versions_behind`, `max_days_behind`, `published_packages`, `check_upgrades` and `diff_previous` aren't checked at plan. Builds should be reproducible, e.g. with `SOURCE_DATE_EPOCH` set, so an unchanged package pushes the same chart.",
+				Attributes: map[string]schema.Attribute{
+					"config": schema.StringAttribute{
+						Required:    true,
+						Description: "The path of the melange config to build.",
+					},
+					"source_dir": schema.StringAttribute{
+						Optional:    true,
+						Description: "The directory of the package's sources, passed as `--source-dir`. Defaults to melange's own default.",
+					},
+					"signing_key": schema.StringAttribute{
+						Optional:    true,
+						Description: "The path of the private key to sign the packages with, with its public key alongside as `<signing_key>.pub`. A key is generated, and kept in the user cache directory for later runs, if this isn't set. Either way, its public key is trusted for this chart's packages only.",
+					},
+				},
+			},
+			"verify_archs": schema.ListAttribute{
+				Optional:    true,
+				Description: "Other architectures to build the chart from, alongside `package_arch`, to check that every arch's package contains the same chart. The builds run in parallel and share repository lookups; the apply fails if any produces a different digest.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: archValidator{}},
+				},
+			},
+			"skip_if_exists": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Adopt the chart already published at `<repo>:<chart_version>` rather than building the package. The chart version is taken to be the package's upstream version, with its revision applied per `chart_version_revision`. If the tag exists its digest is used as is, so the settings that change the chart, like `json_patches`, `images` and `readme`, and `verify_archs` do not apply to it; `tags` and `mirror_repos` still do. With this set, the digest is only known after apply when anything changes.",
+			},
+			"pre_push_command": schema.ListAttribute{
+				Optional:    true,
+				Description: "A command, as a program and its arguments, to run on each newly built chart before it is pushed, e.g. `[\"helm\", \"lint\"]`. The path of the packaged chart archive is appended as the last argument, and is also in `$CHART_TGZ`; the unpacked chart directory is in `$CHART_DIR`. The command must exit 0 for the chart to be pushed; otherwise the apply fails with its output. It is not run for charts adopted by `skip_if_exists`.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					commandValidator{},
+				},
+			},
+			"check_upgrades": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Warn during plan when a planned rebuild of the chart changes fields Kubernetes won't update in place, like a Deployment's selector or a StatefulSet's `volumeClaimTemplates`, compared to the chart in state, since upgrading releases across such changes fails. Both charts are rendered with their default values. The planned chart is built to compare it, so the check is skipped while any of the configuration is unknown.",
+			},
+			"diff_previous": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Record in `chart_diff` which files a rebuild of the chart adds, removes and changes compared to the chart in state, so churn between package versions shows up in plans and can be checked by policy. The planned chart is built to compare it during plan; while any of the configuration is unknown, the comparison is made at apply instead.",
+			},
+			"chart_diff": schema.SingleNestedAttribute{
+				Computed:    true,
+				Description: "With `diff_previous` set, how the files of the chart differ from those of the chart it replaced, by path relative to the chart root. Null when the chart didn't replace one, and kept from the last rebuild while the chart isn't rebuilt.",
+				Attributes: map[string]schema.Attribute{
+					"previous_digest": schema.StringAttribute{
+						Computed:    true,
+						Description: "The digest of the chart compared against.",
+					},
+					"added": schema.ListAttribute{
+						Computed:    true,
+						Description: "Files only in the new chart.",
+						ElementType: types.StringType,
+					},
+					"removed": schema.ListAttribute{
+						Computed:    true,
+						Description: "Files only in the previous chart.",
+						ElementType: types.StringType,
+					},
+					"changed": schema.ListAttribute{
+						Computed:    true,
+						Description: "Files in both charts whose content differs.",
+						ElementType: types.StringType,
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"unit_tests": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Run helm-unittest style test suites against each newly built chart before it is pushed, so patched charts are regression-tested when they are published. The suites bundled in the chart as `tests/*_test.yaml` are run, then `suites`, and the apply fails without pushing if any test fails or there are no suites. Suites may use `templates`, `set` and `release`, and the `equal`, `isNull`, `isEmpty`, `exists`, `contains`, `isSubset`, `matchRegex`, `lengthEqual`, `isKind`, `isAPIVersion`, `hasDocuments` and `failedTemplate` assertions and their negations. Charts adopted by `skip_if_exists` are not tested.",
+				Attributes: map[string]schema.Attribute{
+					"suites": schema.MapAttribute{
+						Optional:    true,
+						Description: "More test suites to run, as YAML, by name, e.g. `{ \"deployment_test.yaml\" = file(\"tests/deployment_test.yaml\") }`.",
+						ElementType: types.StringType,
+					},
+				},
+			},
+			"scan": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Lint each newly built chart for common security misconfigurations before it is pushed, with a minimal built-in linter. The chart is rendered as for a fresh install, and each workload it renders is checked for privileged or root containers, privilege escalation, host namespaces and `hostPath` volumes, added or undropped capabilities, writable root file systems, missing CPU and memory limits and `:latest` images, and nothing else. It does not integrate Trivy, grype or any other scanner, and is no substitute for one run on the published chart. The findings are recorded in `scan_findings`. Charts adopted by `skip_if_exists` are not scanned.",
+				Attributes: map[string]schema.Attribute{
+					"fail_on": schema.StringAttribute{
+						Optional:    true,
+						Description: "Fail the apply, without pushing the chart, when any finding is at or above this severity. One of `LOW`, `MEDIUM`, `HIGH` (default) or `CRITICAL`.",
+						Validators: []validator.String{
+							oneOfValidator{values: chart.Severities()},
+						},
+					},
+					"warn_on": schema.StringAttribute{
+						Optional:    true,
+						Description: "Warn about findings at or above this severity that are below `fail_on`. One of `LOW`, `MEDIUM`, `HIGH` or `CRITICAL`. If not set, findings below `fail_on` are only recorded.",
+						Validators: []validator.String{
+							oneOfValidator{values: chart.Severities()},
+						},
+					},
+					"skip_checks": schema.ListAttribute{
+						Optional:    true,
+						Description: "IDs of checks to ignore, e.g. `writable-root-fs`.",
+						ElementType: types.StringType,
+					},
+					"values": schema.StringAttribute{
+						Optional:    true,
+						Description: "YAML values to render the chart with, over its defaults, for charts that need some values set to render.",
+						Validators: []validator.String{
+							yamlMapValidator{},
+						},
+					},
+					"attest": schema.BoolAttribute{
+						Optional:    true,
+						Description: "Attach the scan's findings to the pushed chart in `repo` as an in-toto attestation, with predicate type `" + chart.ScanPredicateType + "`, so admission controllers can check the chart was linted when it was published. The predicate names the built-in lint as its `linter` and lists the `checks` it ran, so it isn't mistaken for a scanner's report. The attestation is a referrer of the chart, found through the OCI referrers API or its fallback tag, and is not signed. Its digest is recorded in `scan_attestation`.",
+					},
+				},
+			},
+			"scan_findings": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The findings of the last `scan` of the chart, most severe first, excluding `skip_checks`. Null when the chart was not scanned.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.StringAttribute{
+							Computed:    true,
+							Description: "The ID of the failed check.",
+						},
+						"severity": schema.StringAttribute{
+							Computed:    true,
+							Description: "The severity of the failed check.",
+						},
+						"title": schema.StringAttribute{
+							Computed:    true,
+							Description: "What the check found.",
+						},
+						"resource": schema.StringAttribute{
+							Computed:    true,
+							Description: "The offending Kubernetes object, as `<kind>/<name>`.",
+						},
+						"container": schema.StringAttribute{
+							Computed:    true,
+							Description: "The offending container, or empty for checks of the whole pod.",
+						},
+					},
+				},
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"scan_attestation": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the scan attestation attached to the chart, when `scan.attest` is set.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"notation": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Sign the pushed chart with [Notation](https://notaryproject.dev), for clusters that verify charts with Ratify or other Notary Project tooling. The `notation` CLI must be installed, with the signing key configured, and runs with its own registry credentials. The signature is attached to the chart in `repo` as a referrer before the chart is tagged, and its digest is recorded in `notation_signature`. A chart that is pushed again unchanged isn't signed again.",
+				Attributes: map[string]schema.Attribute{
+					"key": schema.StringAttribute{
+						Required:    true,
+						Description: "The name of the signing key, as added with `notation key add`. Keys in Azure Key Vault, AWS KMS and other services are used through the notation plugin they were added with.",
+					},
+					"plugin_config": schema.MapAttribute{
+						Optional:    true,
+						Description: "Settings for the key's plugin, passed as `--plugin-config`, e.g. `{ self_signed = \"true\" }` for Azure Key Vault.",
+						ElementType: types.StringType,
+					},
+					"signature_format": schema.StringAttribute{
+						Optional:    true,
+						Description: "The signature envelope format, `jws` or `cose`. Defaults to notation's own default.",
+						Validators: []validator.String{
+							oneOfValidator{values: []string{"jws", "cose"}},
+						},
+					},
+				},
+			},
+			"notation_signature": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the Notary Project signature attached to the chart, when `notation` is set.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
+			"notify": notifySchema("after the chart is pushed, tagged and mirrored"),
 			"digest": schema.StringAttribute{
 				Computed:    true,
-				Description: "The SHA256 digest of the Helm chart after it is pushed to the registry.",
+				Description: "The digest of the Helm chart after it is pushed to the registry, by `digest_algorithm`. Known at plan time when only settings that do not affect the chart, like `repo`, change, in which case the chart is pushed again as it is rather than rebuilt.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"previous_digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest the chart had before the last apply that changed it, for rolling back to. Null until an update publishes a new digest.",
 				PlanModifiers: []planmodifier.String{
 					stringplanmodifier.UseStateForUnknown(),
 				},
@@ -123,6 +463,13 @@ func (r *helmChartResource) Schema(_ context.Context, _ resource.SchemaRequest,
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"is_library": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the chart's Chart.yaml `type` is `library`. Library charts can't be installed, only depended on, so this tells which charts to skip creating releases for.",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.UseStateForUnknown(),
+				},
+			},
 			"json_patches": schema.MapAttribute{
 				Optional:    true,
 				Description: "JSON RFC6902 patches to apply to the Helm chart, organized by the file to which the patch should be applied. Each file must contain the json representation of the JSON patch array to apply. It's easiest to use the jsonencode function to generate the JSON string.",
@@ -133,117 +480,1569 @@ func (r *helmChartResource) Schema(_ context.Context, _ resource.SchemaRequest,
 				Description: "Map of image IDs to full OCI references for resolving cg.json. When provided, the chart's values.yaml will be updated with the resolved image references.",
 				ElementType: types.StringType,
 			},
+			"readme":  chartFileSchema("README.md", "the given content, such as support contacts"),
+			"notes":   chartFileSchema("templates/NOTES.txt", "the given content, which Helm prints after installs and upgrades. The content is itself a Helm template"),
+			"license": chartFileSchema("LICENSE", "the given license text"),
+			"values_docs": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Generate a helm-docs compatible table of the chart's values from the `# --` comments in its values.yaml, after `json_patches` and `images` apply, and put it in the chart's README.md, after `readme` applies. The table fills in helm-docs' `chart.valuesSection` or `chart.valuesTable` templates if the README uses them, and otherwise replaces the README's `## Values` section or is appended as one.",
+			},
+			"normalize_file_modes": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Write the chart's directories with mode 0755 and its files with 0644, rather than the modes they have in the package, so odd modes don't trouble Helm and packages differing only in modes build the same chart.",
+			},
+			"extra_layers": schema.ListNestedAttribute{
+				Optional:    true,
+				Description: "Blobs to publish in the chart's manifest after its content, in order, for consumers that expect metadata packaged with the chart, like airgap bundle manifests. Helm ignores layers of media types it doesn't know, so the chart installs as before. Changing them changes the chart's digest but not `layer_digest`.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"media_type": schema.StringAttribute{
+							Required:    true,
+							Description: "The layer's media type, e.g. `application/vnd.example.bundle.v1+json`. The media types Helm reads charts from aren't allowed.",
+						},
+						"content": schema.StringAttribute{
+							Optional:    true,
+							Description: "The layer's content. Exactly one of `content` or `file` must be set.",
+						},
+						"file": schema.StringAttribute{
+							Optional:    true,
+							Description: "Path to a file holding the layer's content, read when the chart is built. Changes to the file alone don't rebuild the chart; use `content = file(...)` for that.",
+						},
+						"title": schema.StringAttribute{
+							Optional:    true,
+							Description: "The layer's `org.opencontainers.image.title` annotation, the file name tools like `oras pull` save it as.",
+						},
+					},
+					Validators: []validator.Object{
+						exactlyOneOfValidator{names: []string{"content", "file"}},
+					},
+				},
+			},
+			"require_license": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail, without pushing, when a newly built chart has no non-empty `org.opencontainers.image.licenses`, `licenses` or `artifacthub.io/license` annotation. Annotations in Chart.yaml are copied to the chart's manifest, so it can come from there.",
+			},
+			"forbid_library_charts": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail, without pushing, when a newly built chart is a library chart, whose Chart.yaml `type` is `library`, so repos meant for installable charts don't get charts that can only be depended on.",
+			},
+			"icon": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Replace the icon in the chart's Chart.yaml, for instance because the upstream icon is hosted somewhere customers can't reach.",
+				Attributes: map[string]schema.Attribute{
+					"url": schema.StringAttribute{
+						Optional:    true,
+						Description: "The icon URL, such as one on your own CDN. `${name}` and `${version}` are replaced with the chart's name and version (write `$${name}` in Terraform strings). Exactly one of `url` or `file` must be set.",
+					},
+					"file": schema.StringAttribute{
+						Optional:    true,
+						Description: "Path to an image to embed in Chart.yaml as a `data:` URI, read when the chart is built. Changes to the file alone don't rebuild the chart.",
+					},
+				},
+				Validators: []validator.Object{
+					exactlyOneOfValidator{names: []string{"url", "file"}},
+				},
+			},
+			"maintainers": schema.ListNestedAttribute{
+				Optional:    true,
+				Description: "Replace the maintainers in the chart's Chart.yaml, for instance so published charts list your support contacts instead of the upstream authors.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Required:    true,
+							Description: "The maintainer's name.",
+						},
+						"email": schema.StringAttribute{
+							Optional:    true,
+							Description: "The maintainer's email address.",
+						},
+						"url": schema.StringAttribute{
+							Optional:    true,
+							Description: "A URL for the maintainer.",
+						},
+					},
+				},
+			},
+			"append_maintainers": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Add `maintainers` after the chart's own maintainers instead of replacing them.",
+			},
+			"keywords": schema.ListAttribute{
+				Optional:    true,
+				Description: "Replace the keywords in the chart's Chart.yaml, which chart catalogs search. An empty list removes them.",
+				ElementType: types.StringType,
+			},
+			"home": schema.StringAttribute{
+				Optional:    true,
+				Description: "Replace the home URL in the chart's Chart.yaml. `${name}` and `${version}` are replaced with the chart's name and version (write `$${name}` in Terraform strings).",
+			},
+			"sources": schema.ListAttribute{
+				Optional:    true,
+				Description: "Replace the source URLs in the chart's Chart.yaml, with `${name}` and `${version}` replaced as in `home`. They are also carried into the manifest's `org.opencontainers.image.source` annotation, as `source_annotation` says. An empty list removes them.",
+				ElementType: types.StringType,
+			},
+			"source_annotation": schema.StringAttribute{
+				Optional:    true,
+				Description: "How the chart's sources are carried into the manifest's `org.opencontainers.image.source` annotation, which registries like GHCR use to link the chart to its repository. One of `join` (default, all of them joined with commas, as provenance tooling prefers), `first` (only the first, since GHCR only links a single repository URL), or any other value to use as the annotation instead, with `${name}` and `${version}` replaced as in `home`. Empty sources are skipped, and with none the annotation is left out.",
+			},
+			"created": schema.StringAttribute{
+				Optional:    true,
+				Description: "Add the manifest's `org.opencontainers.image.created` annotation, for registry retention policies based on creation time. One of `build` (the time the chart is built), `source_date_epoch` (the time in `$SOURCE_DATE_EPOCH`, so builds stay reproducible) or an RFC 3339 timestamp. It is recorded in UTC when the chart is built, and the chart isn't rebuilt just for time passing, nor by changes that don't affect it, like `tags`, which push it again as it is. An annotation of the same name in Chart.yaml takes precedence.",
+				Validators: []validator.String{
+					createdValidator{},
+				},
+			},
+			"max_annotation_size": schema.Int64Attribute{
+				Optional:    true,
+				Description: "The longest manifest annotation value, in bytes, the registry accepts. Defaults to 4096 for ECR, including ECR Public, and no limit for other registries. A newly built chart with a longer annotation fails, without being pushed, naming the annotations, unless `truncate_annotations` is set. When the chart is built during plan, for `check_upgrades` or `diff_previous`, the plan fails instead.",
+				Validators: []validator.Int64{
+					atLeastValidator{min: 1},
+				},
+			},
+			"truncate_annotations": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Cut manifest annotation values longer than `max_annotation_size` to fit, with a warning naming them, instead of failing.",
+			},
+			"max_file_size": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Warn when a newly built chart has a file larger than this many bytes, which may have been packaged by accident and bloats every pull of the chart. Defaults to 1048576, the most a Helm release, which holds its chart, can be. 0 turns the check off.",
+				Validators: []validator.Int64{
+					atLeastValidator{min: 0},
+				},
+			},
+			"allowed_binary_files": schema.ListAttribute{
+				Optional:    true,
+				Description: "Shell globs, as understood by Go's path.Match, of the files, by path relative to the chart root, that may be binary. A newly built chart with other binary files, like images or archives packaged by accident, is warned about. Packaged subcharts in `charts/` may always be binary.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: globValidator{}},
+				},
+			},
+			"fail_on_suspect_files": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail, without pushing, instead of warning when a newly built chart has files larger than `max_file_size` or binary files not in `allowed_binary_files`.",
+			},
+			"chart_version_revision": schema.StringAttribute{
+				Optional:    true,
+				Description: "How to carry the APK package revision (the `-rN` of the package version) into the published chart version, so rebuilds from a new package revision are distinguishable. One of `none` (default, publish the Chart.yaml version unchanged), `metadata` (append as semver build metadata, e.g. `1.2.3+r4`), or `suffix` (append as a semver pre-release, e.g. `1.2.3-r4`; note pre-releases sort before the release).",
+				Validators: []validator.String{
+					oneOfValidator{values: revisionFormats()},
+				},
+			},
+			"manifest_format": schema.StringAttribute{
+				Optional:    true,
+				Description: "The kind of manifest to publish the chart with. One of `oci` (default, an OCI image manifest, as `helm push` uses) or `docker` (a Docker v2 schema 2 manifest with the same Helm config and layer, for older registries, like some Nexus versions, that reject OCI manifests with a 400). Changing it changes the chart's digest.",
+				Validators: []validator.String{
+					oneOfValidator{values: manifestFormats()},
+				},
+			},
+			"digest_algorithm": schema.StringAttribute{
+				Optional:    true,
+				Description: "The algorithm the chart's manifest is addressed by, and `digest` and `id` computed with. One of `sha256` (default) or `sha512`, for registries that require sha512 manifest digests. Layers and the config are still addressed by sha256, and so are the scan attestation and signatures, which refer to the chart by its sha256 digest.",
+				Validators: []validator.String{
+					oneOfValidator{values: chart.DigestAlgorithms()},
+				},
+			},
+			"config_media_type": schema.StringAttribute{
+				Optional:    true,
+				Description: "The media type to publish the chart's config with, instead of Helm's `application/vnd.cncf.helm.config.v1+json`, for internal registries that only accept allow-listed media types. Helm only pulls charts with its own media types, so charts published with others are for clients that expect them. Changing it changes the chart's digest.",
+				Validators: []validator.String{
+					mediaTypeValidator{},
+				},
+			},
+			"chart_layer_media_type": schema.StringAttribute{
+				Optional:    true,
+				Description: "The media type to publish the chart's content layer with, instead of Helm's `application/vnd.cncf.helm.chart.content.v1.tar+gzip`, for internal registries that only accept allow-listed media types. As with `config_media_type`, Helm won't pull charts published with another. Changing it changes the chart's digest.",
+				Validators: []validator.String{
+					mediaTypeValidator{},
+				},
+			},
+			"package_resolved_version": schema.StringAttribute{
+				Computed:    true,
+				Description: "The full APK version, including the package revision, that the package resolved to when the chart was last built.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"package_resolved_name": schema.StringAttribute{
+				Computed:    true,
+				Description: "The name of the package the chart was last built from. It differs from `package_name` when that is provided by another package, as `prefer_packages` and `block_packages` steer.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"package_repository": schema.StringAttribute{
+				Computed:    true,
+				Description: "The repository, for the package's architecture, that the package was resolved and fetched from when the chart was last built, e.g. `https://packages.wolfi.dev/os/x86_64`. With several repositories configured, this tells which one provided it. For packages pinned by `resolved_lockfile`, it is the directory of the locked URL. Empty for packages from the provider's `build_repositories`, which are never recorded.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"package_repository_timestamp": schema.StringAttribute{
+				Computed:    true,
+				Description: "When the index of `package_repository` last changed before the chart was last built, as an RFC 3339 timestamp: the build time of the newest package the index lists, since APK indexes record no time of their own. Empty for packages pinned by `resolved_lockfile` or from `build_repositories`.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"repository_snapshot": schema.StringAttribute{
+				Computed:    true,
+				Description: "With `repository_pin` set, a digest of the repository indexes the package was resolved against when the pin was last changed.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"package_checksum": schema.StringAttribute{
+				Computed:    true,
+				Description: "The APKINDEX checksum of the package the chart was built from. If the package is rebuilt at the same version, the checksum changes and the chart is replaced.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"rebuild_on": schema.StringAttribute{
+				Optional:    true,
+				Description: "Which package changes cause the chart to be rebuilt and republished when the package resolves to a newer version during plan. One of `version` (default, only when the upstream version changes) or `revision` (also when only the package revision changes).",
+				Validators: []validator.String{
+					oneOfValidator{values: []string{rebuildOnVersion, rebuildOnRevision}},
+				},
+			},
+			"resolved_lockfile": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path to an apko lock file that pins the package. When set, the package is fetched from the URL in the lock and verified against its checksum instead of being resolved from the repository index, making builds reproducible and independent of live APKINDEX contents. The locked version must satisfy `package_version` if both are set.",
+			},
+			"repository_pin": schema.StringAttribute{
+				Optional:    true,
+				Description: "Hold the package at what it resolved to against the repository indexes recorded in `repository_snapshot`, so upstream package updates only flow into rebuilds when this value is changed, e.g. to the date of the bump. While it is unchanged, newer versions are ignored, a pinned package rebuilt in place fails the plan, and so does changing how the package is resolved, such as `package_version`. Changing it resolves the package against the current indexes and records a new snapshot.",
+			},
+			"output_lockfile_path": schema.StringAttribute{
+				Optional:    true,
+				Description: "Path to write a JSON lock file to after each build, recording the resolved package name, version, checksum, and repository plus the SHA-256 of each JSON patch. The file is in apko lock format, so it can be committed and passed back through `resolved_lockfile` for hermetic rebuilds.",
+			},
+			"max_versions_behind": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Warn during plan when more than this many newer versions of the package are available than the one it resolves to.",
+			},
+			"max_days_behind": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Warn during plan when the newest available version of the package was built more than this many days after the one it resolves to.",
+			},
+			"fail_when_stale": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail the plan instead of warning when `max_versions_behind` or `max_days_behind` is exceeded.",
+			},
+			"published_packages": schema.ListAttribute{
+				Optional:    true,
+				Description: "The chart packages this configuration publishes, such as the `names` of a `helm_chart_packages` data source the charts are created for with `for_each`. When set, the plan warns if the package depends, directly or not, on a chart package that isn't one of these, like a `-crds` package its chart needs installed first, so an incomplete catalog is caught before it is published.",
+				ElementType: types.StringType,
+			},
+			"chart_dependency_pattern": schema.StringAttribute{
+				Optional:    true,
+				Description: "A shell glob, as understood by Go's path.Match, that the names of the dependencies checked against `published_packages` or bundled by `bundle_dependencies` must match, such as `chart-*`. Other dependencies aren't charts and are ignored. Required when either is set.",
+				Validators: []validator.String{
+					globValidator{},
+				},
+			},
+			"fail_on_unpublished_dependencies": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail the plan instead of warning when the package depends on a chart package not in `published_packages`.",
+			},
+			"bundle_dependencies": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Vendor the charts of the chart packages the package depends on, directly or not, into the chart's `charts/` directory, so it installs as a complete unit. Which dependencies are charts is decided by `chart_dependency_pattern`. The dependencies are those resolved when the chart is built; a new version of one alone doesn't rebuild the chart. Can't be used with `resolved_lockfile`.",
+			},
+			"chart_search_paths": schema.ListAttribute{
+				Optional:    true,
+				Description: "The directories of the package, relative to its root, whose subdirectories are searched for the chart's Chart.yaml, most preferred first, with `.` the top level. The chart is rooted at its own directory whichever it is found in, so one installed to `usr/share/helm/charts/foo/` builds the same as one at `foo/`. Defaults to `[\".\", \"usr/share/helm/charts\"]`.",
+				ElementType: types.StringType,
+			},
+			"tags": schema.ListAttribute{
+				Optional:    true,
+				Description: "Tags to point at the chart in `repo` after it is pushed. Charts are pushed by digest only unless tags are set. Moving a tag that already points at a different digest emits a warning naming both digests. Removing a tag from this list leaves it in the registry.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: tagValidator{}},
+				},
+			},
+			"deprecated": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Mark the chart deprecated, to sunset it from catalogs. This sets `deprecated: true` in the chart's Chart.yaml, which Helm and Artifact Hub show to users, and the `io.artifacthub.package.deprecated` annotation on its manifest.",
+			},
+			"tombstone_tag": schema.StringAttribute{
+				Optional:    true,
+				Description: "A tag, such as `latest`, to point at the chart while `deprecated` is set, so anyone following the tag lands on the deprecated release and sees the deprecation. Unlike `tags`, it is moved without a warning, even with `immutable_tags` set and even if it is also in `tags`.",
+				Validators: []validator.String{
+					tagValidator{},
+				},
+			},
+			"immutable_tags": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail instead of warning when one of `tags` already points at a different digest. Checked before anything is pushed.",
+			},
+			"keep_digests": schema.Int64Attribute{
+				Optional:    true,
+				Description: "After each push, delete the digests this resource published to `repo` before the newest this many, counting the one just pushed, since registries otherwise keep untagged digests indefinitely. Set it to at least 2 to keep `previous_digest` for `helm_chart_rollback`. Digests any tag in `repo` still points at, whether this resource's or another's, are left in place and dropped from `retained_digests`, and nothing is deleted if the repo's tags can't be listed. Where the registry doesn't support deletes, a warning names the digest left behind. Mirrors and repos the chart moved away from are left alone.",
+				Validators: []validator.Int64{
+					atLeastValidator{min: 1},
+				},
+			},
+			"retained_digests": schema.ListAttribute{
+				Computed:    true,
+				Description: "With `keep_digests` set, the digests this resource published to `repo` and hasn't deleted, newest first.",
+				ElementType: types.StringType,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"annotations": schema.MapAttribute{
+				Computed:    true,
+				Description: "The annotations on the pushed OCI manifest, including those copied from the chart metadata.",
+				ElementType: types.StringType,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"manifest_json": schema.StringAttribute{
+				Computed:    true,
+				Description: "The pushed manifest, exactly as it is in the registry, so its digest is `digest`.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"config_json": schema.StringAttribute{
+				Computed:    true,
+				Description: "The chart's config blob, the JSON form of its Chart.yaml, exactly as it is in the registry.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"layer_digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the chart's content blob, the packaged chart, as opposed to `digest`, the manifest's. Charts with the same content share the blob in a registry even when their manifests differ.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"layer_size": schema.Int64Attribute{
+				Computed:    true,
+				Description: "The size, in bytes, of the chart's content blob as it is stored in the registry.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"rendered_manifest_sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "The hex SHA-256 of what the chart renders as with its default values, as `helm template` prints it, so automation can tell when the chart's output changed though its version didn't, as with changes from `json_patches` or `images`. Library charts render nothing. Null when the chart can't be rendered with its default values alone, as when it requires values to be set.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
 		},
 	}
 }
 
-// Create is called when the provider must create a new resource.
-func (r *helmChartResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+// ValidateConfig checks that the dependencies that are charts can be told
+// apart when they are checked or bundled.
+func (r *helmChartResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
 	var data helmChartResourceModel
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
-	if resp.Diagnostics.HasError() {
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() || !data.DependencyPattern.IsNull() {
 		return
 	}
 
-	resp.Diagnostics.Append(r.do(ctx, &data)...)
-	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if (!data.PublishedPackages.IsNull() && !data.PublishedPackages.IsUnknown()) || data.BundleDeps.ValueBool() {
+		resp.Diagnostics.AddAttributeError(path.Root("chart_dependency_pattern"), "Missing chart_dependency_pattern", "chart_dependency_pattern must be set with published_packages or bundle_dependencies, so the dependencies that are charts can be told apart.")
+	}
 }
 
-// Read refreshes the Terraform state with the latest data.
-func (r *helmChartResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
-	// Get current state
-	var state helmChartResourceModel
-	diags := req.State.Get(ctx, &state)
-	resp.Diagnostics.Append(diags...)
-	if resp.Diagnostics.HasError() {
+// ModifyPlan re-resolves the package so that a newer package version in the
+// repositories shows up as an update, per rebuild_on.
+func (r *helmChartResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to do on destroy.
+	if req.Plan.Raw.IsNull() || r.client == nil {
 		return
 	}
 
-	// Check if the Helm chart exists in the registry
-	// In a production setting, you'd check if the chart exists and update its digest
-	// For now, we keep the state as is
-
-	// State already contains name and version values from the create/update operation
-	// We don't need to set default values here as they should already be populated
-	// from the Chart.yaml metadata
+	var plan helmChartResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-	// Set refreshed state
-	diags = resp.State.Set(ctx, &state)
-	resp.Diagnostics.Append(diags...)
+	resp.Diagnostics.Append(r.checkStaleness(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	resp.Diagnostics.Append(r.checkDependencies(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Nothing to compare against on create.
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var state helmChartResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	unreachable, diags := takeUnreachable(ctx, req.Private, resp.Private)
+	resp.Diagnostics.Append(diags...)
+
+	// A snapshot is recorded while repository_pin is set, anew each time it
+	// changes, and holds the package to what it resolved to until then.
+	pinned := false
+	switch {
+	case plan.RepositoryPin.IsNull():
+		plan.Snapshot = types.StringNull()
+	case !plan.RepositoryPin.Equal(state.RepositoryPin) || state.Snapshot.IsNull() || state.ResolvedVersion.ValueString() == "":
+		plan.Snapshot = types.StringUnknown()
+	default:
+		pinned = true
+	}
+	if !plan.Snapshot.Equal(state.Snapshot) {
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+
+	// A change to anything the chart is built from rebuilds it, so everything
+	// derived from the build is unknown until apply.
+	// With skip_if_exists, whatever is published at apply time is adopted.
+	if !req.Plan.Raw.Equal(req.State.Raw) && (!sameBuildInputs(&plan, &state) || plan.SkipIfExists.ValueBool()) {
+		// A pinned package is rebuilt from as it was, and can't be resolved
+		// anew without bumping the pin.
+		if pinned && !sameResolution(&plan, &state) {
+			resp.Diagnostics.AddAttributeError(path.Root("repository_pin"), "package resolution changed while pinned",
+				"How the package is resolved has changed, but repository_pin hasn't, so it can't be resolved against the current index. Change repository_pin as well.")
+			return
+		}
+		if !pinned {
+			plan.ResolvedVersion = types.StringUnknown()
+			plan.ResolvedName = types.StringUnknown()
+			plan.PackageChecksum = types.StringUnknown()
+		}
+		markRebuild(&plan)
+		resp.Diagnostics.Append(r.comparePlanned(ctx, req.Config, &plan, &state)...)
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	// A chart that couldn't be refreshed is kept as it was, but whether it
+	// is still published can't be told until apply, which pushes the chart
+	// in state again. Only its digest and ID are left unknown until then,
+	// since a chart gone from the registry can't be pushed again as is.
+	if unreachable {
+		plan.ID = types.StringUnknown()
+		plan.Digest = types.StringUnknown()
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+
+	// Otherwise the chart in state is pushed again rather than rebuilt, so
+	// the digest carries over from state and only the ID and, with new scan
+	// settings, the findings may change.
+	if !plan.Scan.Equal(state.Scan) {
+		plan.ScanFindings = types.ListUnknown(scanFindingType)
+		plan.ScanAttestation = types.StringUnknown()
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+	if !plan.Notation.Equal(state.Notation) || !plan.Repo.Equal(state.Repo) {
+		plan.NotationSignature = types.StringUnknown()
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+	if !plan.Repo.Equal(state.Repo) || !plan.KeepDigests.Equal(state.KeepDigests) {
+		plan.RetainedDigests = types.ListUnknown(types.StringType)
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+	if !plan.Repo.Equal(state.Repo) || !plan.IDFormat.Equal(state.IDFormat) {
+		plan.ID = types.StringUnknown()
+		if repo, err := name.NewRepository(plan.Repo.ValueString()); err == nil && !plan.IDFormat.IsUnknown() && state.Digest.ValueString() != "" {
+			plan.ID = types.StringValue(chartID(plan.IDFormat.ValueString(), chart.DigestRef(repo, state.Digest.ValueString()), state.Name.ValueString(), state.ChartVersion.ValueString()))
+		}
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	}
+
+	// Melange packages are only built at apply, so whether they changed
+	// isn't known until then, and the chart is rebuilt from them each time.
+	if !plan.Melange.IsNull() {
+		if !pinned {
+			plan.ResolvedVersion = types.StringUnknown()
+			plan.ResolvedName = types.StringUnknown()
+			plan.PackageChecksum = types.StringUnknown()
+		}
+		markRebuild(&plan)
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	if pinned {
+		resp.Diagnostics.Append(r.checkPinned(ctx, &plan, &state)...)
+		return
+	}
+
+	bc, diags := r.buildConfig(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	pkg, err := chart.Resolve(ctx, plan.PackageName.ValueString(), bc)
+	if err != nil {
+		if ds := keepUnresolved(ctx, err, "the package it last resolved to is kept"); ds != nil {
+			resp.Diagnostics.Append(ds...)
+			return
+		}
+		resp.Diagnostics.AddError("resolving package", err.Error())
+		return
+	}
+
+	// State written before package_resolved_version existed has nothing to
+	// compare against; it is recorded on the next rebuild.
+	prior := state.ResolvedVersion.ValueString()
+	if prior == "" {
+		return
+	}
+
+	// Another package now provides package_name, e.g. a newly published
+	// implementation apko ranks higher.
+	if priorName := state.ResolvedName.ValueString(); priorName != "" && pkg.Name != priorName {
+		tflog.Info(ctx, "package resolves to another package", map[string]any{"prior": priorName, "resolved": pkg.Name})
+		plan.ResolvedName = types.StringValue(pkg.Name)
+		plan.ResolvedVersion = types.StringValue(pkg.Version)
+		plan.PackageChecksum = types.StringValue(pkg.Checksum)
+		markRebuild(&plan)
+		resp.Diagnostics.Append(r.comparePlanned(ctx, req.Config, &plan, &state)...)
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	// The same version with different content means the package was rebuilt
+	// in place; replace the chart so the new content is published.
+	if pkg.Version == prior {
+		if priorChecksum := state.PackageChecksum.ValueString(); priorChecksum != "" && pkg.Checksum != priorChecksum {
+			tflog.Info(ctx, "package checksum changed", map[string]any{"prior": priorChecksum, "resolved": pkg.Checksum})
+			plan.PackageChecksum = types.StringValue(pkg.Checksum)
+			markRebuild(&plan)
+			resp.RequiresReplace = append(resp.RequiresReplace, path.Root("package_checksum"))
+			resp.Diagnostics.Append(r.comparePlanned(ctx, req.Config, &plan, &state)...)
+			resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		}
+		return
+	}
+
+	if plan.RebuildOn.ValueString() != rebuildOnRevision && chart.UpstreamVersion(pkg.Version) == chart.UpstreamVersion(prior) {
+		tflog.Info(ctx, "ignoring new package revision", map[string]any{"prior": prior, "resolved": pkg.Version})
+		return
+	}
+
+	plan.ResolvedVersion = types.StringValue(pkg.Version)
+	plan.PackageChecksum = types.StringValue(pkg.Checksum)
+	markRebuild(&plan)
+	resp.Diagnostics.Append(r.comparePlanned(ctx, req.Config, &plan, &state)...)
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// checkPinned checks that the package state resolved to, which
+// repository_pin holds it to, is still available unchanged.
+func (r *helmChartResource) checkPinned(ctx context.Context, plan, state *helmChartResourceModel) diag.Diagnostics {
+	bc, diags := r.buildConfig(ctx, plan)
+	if diags.HasError() {
+		return diags
+	}
+	bc.Version = "=" + state.ResolvedVersion.ValueString()
+	if n := state.ResolvedName.ValueString(); n != "" {
+		bc.PreferPackages = append([]string{n}, bc.PreferPackages...)
+	}
+	pkg, err := chart.Resolve(ctx, plan.PackageName.ValueString(), bc)
+	if err != nil {
+		if ds := keepUnresolved(ctx, err, "the pinned package isn't checked"); ds != nil {
+			return ds
+		}
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("repository_pin"), "resolving pinned package",
+			fmt.Sprintf("The package repository_pin holds %s to, version %s, can't be resolved: %v. Change repository_pin to resolve against the current index.", plan.PackageName.ValueString(), state.ResolvedVersion.ValueString(), err))}
+	}
+	if c := state.PackageChecksum.ValueString(); c != "" && pkg.Checksum != c {
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("repository_pin"), "pinned package was rebuilt",
+			fmt.Sprintf("%s-%s has been rebuilt in place since it was pinned (checksum %s, was %s). Change repository_pin to accept it.", pkg.Name, pkg.Version, pkg.Checksum, c))}
+	}
+	return nil
+}
+
+// checkStaleness reports when the package resolves to a version further behind
+// the newest available than max_versions_behind or max_days_behind allow.
+func (r *helmChartResource) checkStaleness(ctx context.Context, plan *helmChartResourceModel) diag.Diagnostics {
+	if plan.MaxVersions.IsNull() && plan.MaxDays.IsNull() {
+		return nil
+	}
+	// Inputs computed by other resources aren't known until apply, nor are
+	// melange packages, which are only built then.
+	if plan.PackageName.IsUnknown() || plan.PackageVersion.IsUnknown() || plan.PackageArch.IsUnknown() || plan.Lockfile.IsUnknown() || !plan.Melange.IsNull() {
+		return nil
+	}
+
+	bc, diags := r.buildConfig(ctx, plan)
+	if diags.HasError() {
+		return diags
+	}
+	s, err := chart.CheckStaleness(ctx, plan.PackageName.ValueString(), bc)
+	if err != nil {
+		if ds := keepUnresolved(ctx, err, "its staleness isn't checked"); ds != nil {
+			return ds
+		}
+		return diag.Diagnostics{diag.NewErrorDiagnostic("checking package staleness", err.Error())}
+	}
+
+	var problems []string
+	if limit := plan.MaxVersions; !limit.IsNull() && !limit.IsUnknown() && int64(s.VersionsBehind) > limit.ValueInt64() {
+		problems = append(problems, fmt.Sprintf("%d newer versions are available (max_versions_behind = %d)", s.VersionsBehind, limit.ValueInt64()))
+	}
+	if limit := plan.MaxDays; !limit.IsNull() && !limit.IsUnknown() && s.Behind > time.Duration(limit.ValueInt64())*24*time.Hour {
+		problems = append(problems, fmt.Sprintf("the newest version was built %d days later (max_days_behind = %d)", int64(s.Behind/(24*time.Hour)), limit.ValueInt64()))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	summary := "package is stale"
+	detail := fmt.Sprintf("%s resolves to %s, but %s is available: %s.", s.Resolved.Name, s.Resolved.Version, s.Latest.Version, strings.Join(problems, "; "))
+	if plan.FailWhenStale.ValueBool() {
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("package_version"), summary, detail)}
+	}
+	return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("package_version"), summary, detail)}
+}
+
+// checkDependencies reports the chart packages the planned package depends
+// on that aren't in published_packages, as an error if
+// fail_on_unpublished_dependencies is set and otherwise as a warning.
+func (r *helmChartResource) checkDependencies(ctx context.Context, plan *helmChartResourceModel) diag.Diagnostics {
+	// Bundled dependencies are published inside the chart.
+	if plan.PublishedPackages.IsNull() || plan.BundleDeps.ValueBool() {
+		return nil
+	}
+	// Inputs computed by other resources aren't known until apply, nor are
+	// melange packages, which are only built then.
+	if plan.PublishedPackages.IsUnknown() || plan.DependencyPattern.IsUnknown() || plan.PackageName.IsUnknown() || plan.PackageVersion.IsUnknown() || plan.PackageArch.IsUnknown() || plan.Lockfile.IsUnknown() || !plan.Melange.IsNull() {
+		return nil
+	}
+
+	published, diags := optionalStrings(ctx, plan.PublishedPackages)
+	if diags.HasError() {
+		return diags
+	}
+	bc, diags := r.buildConfig(ctx, plan)
+	if diags.HasError() {
+		return diags
+	}
+	pkg, err := chart.Resolve(ctx, plan.PackageName.ValueString(), bc)
+	if err != nil {
+		if ds := keepUnresolved(ctx, err, "its dependencies aren't checked against published_packages"); ds != nil {
+			return ds
+		}
+		return diag.Diagnostics{diag.NewErrorDiagnostic("resolving package", err.Error())}
+	}
+	missing := unpublishedDependencies(pkg.Dependencies, plan.DependencyPattern.ValueString(), published)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	summary := "package depends on unpublished charts"
+	detail := fmt.Sprintf("%s-%s depends on %s, which aren't in published_packages. Charts installed from this catalog may be missing what they need.", pkg.Name, pkg.Version, strings.Join(missing, ", "))
+	if plan.FailUnpublished.ValueBool() {
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("published_packages"), summary, detail)}
+	}
+	return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("published_packages"), summary, detail)}
+}
+
+// buildVerified builds the chart from bc.Arch and, in parallel, from each of
+// archs, and fails unless every build produces the same chart. The caller
+// closes the chart; the others are closed once compared.
+func (r *helmChartResource) buildVerified(ctx context.Context, pkg string, bc *chart.BuildConfig, archs []string) (_ chart.BuiltChart, err error) {
+	if len(archs) == 0 {
+		return r.client.build(ctx, pkg, bc)
+	}
+
+	bc.Cache = apk.NewCache(false)
+	// Every build records the same build time, or they could differ by
+	// crossing a second.
+	if bc.Created == chart.CreatedBuildTime {
+		bc.Created = time.Now().UTC().Format(time.RFC3339)
+	}
+	configs := []*chart.BuildConfig{bc}
+	for _, arch := range archs {
+		vc := *bc
+		vc.Arch = canonicalArch(arch)
+		configs = append(configs, &vc)
+	}
+
+	// Not errgroup.WithContext: built layers are bound to the context they
+	// were built with, and must outlive this function to be pushed.
+	var g errgroup.Group
+	charts := make([]chart.BuiltChart, len(configs))
+	defer func() {
+		for i, c := range charts {
+			if c != nil && (i > 0 || err != nil) {
+				c.Close()
+			}
+		}
+	}()
+	for i, c := range configs {
+		g.Go(func() (err error) {
+			charts[i], err = r.client.build(ctx, pkg, c)
+			if err != nil && i > 0 {
+				return fmt.Errorf("building for %s: %w", c.Arch, err)
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	want, err := charts[0].Digest()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range charts[1:] {
+		got, err := c.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			p, vp := charts[0].Package(), c.Package()
+			return nil, fmt.Errorf("chart built from %s-%s (%s) is %s, but from %s-%s (%s) it is %s", p.Name, p.Version, p.Arch, want, vp.Name, vp.Version, vp.Arch, got)
+		}
+	}
+	return charts[0], nil
+}
+
+// published returns the chart already in repo for the package bc resolves
+// pkgName to, along with that package. The chart is nil if nothing is tagged
+// with the chart version the package would build, or if that version can't be
+// worked out.
+func (r *helmChartResource) published(ctx context.Context, repo name.Repository, pkgName string, bc *chart.BuildConfig) (chart.Chart, *chart.Package, error) {
+	pkg, err := chart.Resolve(ctx, pkgName, bc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving package: %w", err)
+	}
+	version, err := chart.ExpectedChartVersion(pkg, bc.RevisionFormat)
+	if err != nil {
+		tflog.Info(ctx, "building chart, cannot tell its version", map[string]any{"package": pkg.Version, "error": err.Error()})
+		return nil, pkg, nil
+	}
+
+	// Helm tags build metadata with '_', since tags can't contain '+'.
+	ref := repo.Tag(strings.ReplaceAll(version, "+", "_"))
+	if _, err := remote.Head(ref, r.client.remoteOpts(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			tflog.Info(ctx, "building chart, none published", map[string]any{"ref": ref.String()})
+			return nil, pkg, nil
+		}
+		return nil, nil, err
+	}
+	c, err := chart.Pull(ref, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	tflog.Info(ctx, "adopting published chart", map[string]any{"ref": ref.String()})
+	return c, pkg, nil
+}
+
+// checkTags reports tags in repo that already point at a digest other than
+// digest: as warnings, or as errors when immutable.
+func (c *helmClient) checkTags(ctx context.Context, repo name.Repository, tags []string, digest string, immutable bool) (ds diag.Diagnostics) {
+	for _, t := range tags {
+		ref := repo.Tag(t)
+		desc, err := remote.Head(ref, c.remoteOpts(ctx)...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			ds = append(ds, diag.NewErrorDiagnostic("checking existing tag", err.Error()))
+			return ds
+		}
+		if desc.Digest.String() == digest {
+			continue
+		}
+
+		detail := fmt.Sprintf("%s points at %s; pushing the chart moves it to %s.", ref, desc.Digest, digest)
+		if immutable {
+			ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("tags"), "tag already exists", detail+" Tags are immutable, so the chart was not pushed."))
+			continue
+		}
+		ds = append(ds, diag.NewAttributeWarningDiagnostic(path.Root("tags"), "overwriting existing tag", detail))
+	}
+	return ds
+}
+
+// chartID returns the resource ID of the chart pushed to ref, per id_format.
+func chartID(format string, ref name.Reference, chartName, chartVersion string) string {
+	if format == idFormatChart {
+		return chartName + ":" + chartVersion
+	}
+	return ref.String()
+}
+
+// sameResolution reports whether a and b resolve the package the same way.
+func sameResolution(a, b *helmChartResourceModel) bool {
+	return a.PackageName.Equal(b.PackageName) &&
+		a.PackageVersion.Equal(b.PackageVersion) &&
+		a.PackageArch.Equal(b.PackageArch) &&
+		a.PreferPackages.Equal(b.PreferPackages) &&
+		a.BlockPackages.Equal(b.BlockPackages) &&
+		a.Melange.Equal(b.Melange) &&
+		a.Lockfile.Equal(b.Lockfile)
+}
+
+// sameBuildInputs reports whether a and b build the same chart from the same
+// package. Where the chart is pushed, and plan-time checks like staleness,
+// don't affect its content.
+func sameBuildInputs(a, b *helmChartResourceModel) bool {
+	return a.PackageName.Equal(b.PackageName) &&
+		a.PackageVersion.Equal(b.PackageVersion) &&
+		a.PackageArch.Equal(b.PackageArch) &&
+		a.Melange.Equal(b.Melange) &&
+		a.PreferPackages.Equal(b.PreferPackages) &&
+		a.BlockPackages.Equal(b.BlockPackages) &&
+		a.BundleDeps.Equal(b.BundleDeps) &&
+		(!a.BundleDeps.ValueBool() || a.DependencyPattern.Equal(b.DependencyPattern)) &&
+		a.ChartRoots.Equal(b.ChartRoots) &&
+		a.JSONPatches.Equal(b.JSONPatches) &&
+		a.Images.Equal(b.Images) &&
+		a.Readme.Equal(b.Readme) &&
+		a.Notes.Equal(b.Notes) &&
+		a.Icon.Equal(b.Icon) &&
+		a.License.Equal(b.License) &&
+		a.Maintainers.Equal(b.Maintainers) &&
+		a.AppendMaintainers.Equal(b.AppendMaintainers) &&
+		a.Keywords.Equal(b.Keywords) &&
+		a.Home.Equal(b.Home) &&
+		a.Sources.Equal(b.Sources) &&
+		a.Deprecated.Equal(b.Deprecated) &&
+		a.ValuesDocs.Equal(b.ValuesDocs) &&
+		a.NormalizeModes.Equal(b.NormalizeModes) &&
+		a.ExtraLayers.Equal(b.ExtraLayers) &&
+		a.RevisionFormat.Equal(b.RevisionFormat) &&
+		a.ManifestFormat.Equal(b.ManifestFormat) &&
+		a.DigestAlgorithm.Equal(b.DigestAlgorithm) &&
+		a.ConfigMediaType.Equal(b.ConfigMediaType) &&
+		a.ChartMediaType.Equal(b.ChartMediaType) &&
+		a.SourceAnnotation.Equal(b.SourceAnnotation) &&
+		a.Created.Equal(b.Created) &&
+		a.MaxAnnotationSize.Equal(b.MaxAnnotationSize) &&
+		a.TruncateAnnotations.Equal(b.TruncateAnnotations) &&
+		a.Lockfile.Equal(b.Lockfile)
+}
+
+// markRebuild marks the attributes derived from the built chart unknown.
+func markRebuild(plan *helmChartResourceModel) {
+	plan.ID = types.StringUnknown()
+	plan.Digest = types.StringUnknown()
+	plan.PreviousDigest = types.StringUnknown()
+	plan.RetainedDigests = types.ListUnknown(types.StringType)
+	plan.Name = types.StringUnknown()
+	plan.ChartVersion = types.StringUnknown()
+	plan.IsLibrary = types.BoolUnknown()
+	plan.Annotations = types.MapUnknown(types.StringType)
+	plan.ManifestJSON = types.StringUnknown()
+	plan.ConfigJSON = types.StringUnknown()
+	plan.LayerDigest = types.StringUnknown()
+	plan.LayerSize = types.Int64Unknown()
+	plan.RenderedSHA256 = types.StringUnknown()
+	plan.ScanFindings = types.ListUnknown(scanFindingType)
+	plan.ScanAttestation = types.StringUnknown()
+	plan.NotationSignature = types.StringUnknown()
+	plan.ChartDiff = types.ObjectUnknown(chartDiffType.AttrTypes)
+	plan.PackageRepo = types.StringUnknown()
+	plan.PackageRepoTime = types.StringUnknown()
+}
+
+// Create is called when the provider must create a new resource.
+func (r *helmChartResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data helmChartResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(r.do(ctx, &data, nil)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *helmChartResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	// Get current state
+	var state helmChartResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if state.Digest.IsNull() || state.Digest.ValueString() == "" {
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	repo, err := name.NewRepository(state.Repo.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing repository reference", err.Error())
+		return
+	}
+
+	// Refresh everything we know about the chart from the registry, so state
+	// reflects the artifact as it exists now rather than as we last pushed it.
+	ocichart, err := chart.Pull(chart.DigestRef(repo, state.Digest.ValueString()), r.client.remoteOpts(ctx)...)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			tflog.Warn(ctx, "chart no longer exists in registry, removing from state", map[string]any{"ref": state.ID.ValueString()})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		if registryUnreachable(err) {
+			resp.Diagnostics.Append(keepUnrefreshed(ctx, resp.Private, state.ID.ValueString(), err)...)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+			return
+		}
+		resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+		return
+	}
+	resp.Diagnostics.Append(resp.Private.SetKey(ctx, unreachableKey, nil)...)
+
+	resp.Diagnostics.Append(setChartMetadata(ctx, &state, ocichart)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Set refreshed state
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
 }
 
 // Update updates the resource and sets the updated Terraform state on success.
 func (r *helmChartResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data helmChartResourceModel
+	var data, state helmChartResourceModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	resp.Diagnostics.Append(r.do(ctx, &data)...)
+	diags := r.do(ctx, &data, &state)
+	resp.Diagnostics.Append(diags...)
+	if diags.HasError() {
+		// Keep the prior state rather than the partly applied plan, whose
+		// unknowns would be saved as nulls.
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
-func (r *helmChartResource) do(ctx context.Context, data *helmChartResourceModel) (ds diag.Diagnostics) {
-	arch := data.PackageArch.ValueString()
-	if arch == "" {
-		// Pull from the provider scoped default arch, if arch is still empty, the pkg default will be used
-		arch = r.client.defaultArch
+// do builds and pushes the chart described by data. prior is the state being
+// replaced, if any; blobs already pushed there are mounted rather than
+// uploaded again.
+func (r *helmChartResource) do(ctx context.Context, data, prior *helmChartResourceModel) (ds diag.Diagnostics) {
+	ctx, throttled := withThrottleLog(ctx)
+	defer func() { ds = append(ds, throttled.diagnostics()...) }()
+
+	start := time.Now()
+	ctx, transferred := withTransferLog(ctx)
+	defer func() {
+		if ds.HasError() {
+			return
+		}
+		rec := transferred.record(start)
+		rec.Repo, rec.Name, rec.Version, rec.Digest = data.Repo.ValueString(), data.Name.ValueString(), data.ChartVersion.ValueString(), data.Digest.ValueString()
+		rec.Package, rec.PackageVersion = data.ResolvedName.ValueString(), data.ResolvedVersion.ValueString()
+		ds = append(ds, r.client.recordPublish(ctx, rec)...)
+	}()
+
+	// When the plan carried the digest over from state, nothing the chart is
+	// built from changed, so the chart in state is pushed again as is. It
+	// isn't rebuilt, since content read from files, melange packages and
+	// build times wouldn't reproduce it. The package is only resolved again
+	// if a snapshot or lockfile is to be recorded of it. A plan that left
+	// only the digest unknown, not the manifest, is checking that a chart
+	// that couldn't be refreshed is still published, and pushes it again too.
+	recheck := data.Digest.IsUnknown() && !data.ManifestJSON.IsUnknown()
+	republish := prior != nil && prior.Digest.ValueString() != "" && (data.Digest.Equal(prior.Digest) || recheck)
+	var (
+		bc    *chart.BuildConfig
+		diags diag.Diagnostics
+	)
+	if !republish || data.Snapshot.IsUnknown() || data.OutputLockfile.ValueString() != "" {
+		if bc, diags = r.chartBuildConfig(ctx, data); diags.HasError() {
+			return diags
+		}
+	}
+
+	var archs []string
+	if !data.VerifyArchs.IsNull() && !data.VerifyArchs.IsUnknown() {
+		if diags := data.VerifyArchs.ElementsAs(ctx, &archs, false); diags != nil {
+			return diags
+		}
+	}
+
+	var prePush []string
+	if !data.PrePushCommand.IsNull() && !data.PrePushCommand.IsUnknown() {
+		if diags := data.PrePushCommand.ElementsAs(ctx, &prePush, false); diags != nil {
+			return diags
+		}
+	}
+
+	repo, err := name.NewRepository(data.Repo.ValueString())
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("parsing repository reference", err.Error()))
+		return ds
+	}
+
+	var (
+		ocichart chart.Chart
+		pkg      *chart.Package
+	)
+	if republish {
+		if ocichart, pkg, ds = r.priorChart(ctx, data, prior, bc); ds.HasError() {
+			return ds
+		}
+	} else if data.SkipIfExists.ValueBool() {
+		if ocichart, pkg, err = r.published(ctx, repo, data.PackageName.ValueString(), bc); err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("checking for published chart", err.Error()))
+			return ds
+		}
+	}
+	var report *chart.ScanReport
+	// A republished chart keeps its findings unless the scan settings
+	// changed, in which case it is scanned again.
+	if republish && data.ScanFindings.IsUnknown() {
+		var findings types.List
+		findings, report, diags = scanChart(ctx, data.Scan, ocichart)
+		ds = append(ds, diags...)
+		if ds.HasError() {
+			return ds
+		}
+		data.ScanFindings = findings
+		data.ScanAttestation = types.StringNull()
+	}
+	if !republish {
+		data.ScanFindings = types.ListNull(scanFindingType)
+		data.ScanAttestation = types.StringNull()
+	}
+	if ocichart == nil {
+		built, err := r.buildVerified(ctx, data.PackageName.ValueString(), bc, archs)
+		if err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("building chart", err.Error()))
+			return ds
+		}
+		defer built.Close()
+		ocichart, pkg = built, built.Package()
+
+		if err := r.client.naming.check(built); err != nil {
+			ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("package_name"), "chart name doesn't match package", err.Error()+"\n\nThe chart was not pushed."))
+			return ds
+		}
+
+		ds = append(ds, checkAnnotationSizes(data, built)...)
+		if ds.HasError() {
+			return ds
+		}
+
+		ds = append(ds, checkSuspectFiles(ctx, data, built)...)
+		if ds.HasError() {
+			return ds
+		}
+
+		if data.ForbidLibrary.ValueBool() {
+			if err := checkNotLibrary(built); err != nil {
+				ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("forbid_library_charts"), "library charts are forbidden", err.Error()+"\n\nThe chart was not pushed."))
+				return ds
+			}
+		}
+
+		if data.RequireLicense.ValueBool() {
+			if err := checkLicense(built); err != nil {
+				ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("require_license"), "chart has no license", err.Error()+"\n\nThe chart was not pushed."))
+				return ds
+			}
+		}
+
+		if diags := runUnitTests(ctx, data.UnitTests, built); diags.HasError() {
+			return append(ds, diags...)
+		}
+
+		var findings types.List
+		findings, report, diags = scanChart(ctx, data.Scan, built)
+		ds = append(ds, diags...)
+		if ds.HasError() {
+			return ds
+		}
+		data.ScanFindings = findings
+
+		if len(prePush) > 0 {
+			if err := runPrePushCommand(ctx, prePush, built); err != nil {
+				ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("pre_push_command"), "pre-push command failed", err.Error()+"\n\nThe chart was not pushed."))
+				return ds
+			}
+		}
+	}
+	data.ResolvedVersion = types.StringValue(pkg.Version)
+	data.ResolvedName = types.StringValue(pkg.Name)
+	// Like the snapshot, these describe the build that published the chart,
+	// and are kept while it isn't rebuilt.
+	if data.PackageRepo.IsUnknown() {
+		data.PackageRepo = types.StringValue(pkg.Repository)
+	}
+	if data.PackageRepoTime.IsUnknown() {
+		data.PackageRepoTime = types.StringValue("")
+		if !pkg.RepositoryUpdated.IsZero() {
+			data.PackageRepoTime = types.StringValue(pkg.RepositoryUpdated.UTC().Format(time.RFC3339))
+		}
+	}
+	switch {
+	case data.RepositoryPin.IsNull():
+		data.Snapshot = types.StringNull()
+	case data.Snapshot.IsUnknown():
+		data.Snapshot = types.StringValue(pkg.IndexDigest)
+	}
+	data.PackageChecksum = types.StringValue(pkg.Checksum)
+
+	if diags := r.diffPrior(ctx, data, prior, ocichart); diags.HasError() {
+		return append(ds, diags...)
+	}
+
+	if diags := setChartMetadata(ctx, data, ocichart); diags.HasError() {
+		return diags
+	}
+	if data.RenderedSHA256.IsUnknown() {
+		data.RenderedSHA256 = renderedSHA256(ctx, ocichart)
 	}
 
+	digest, err := ocichart.Digest()
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("getting chart digest", err.Error()))
+		return ds
+	}
+	// The chart is pushed by, and recorded with, the digest by
+	// digest_algorithm. Tags are compared, and the chart attested to and
+	// signed, by its sha256 digest, which is all the registry client knows.
+	pushed := digest.String()
+	if alg := data.DigestAlgorithm.ValueString(); alg != "" && alg != chart.SHA256 {
+		raw, err := ocichart.RawManifest()
+		if err == nil {
+			pushed, err = chart.ManifestDigest(raw, alg)
+		}
+		if err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("getting chart digest", err.Error()))
+			return ds
+		}
+	}
+	ref := chart.DigestRef(repo, pushed)
+	// Registries skip blobs the target repo already has, so re-pushing to the
+	// same repo only uploads what changed. When the repo moved within the same
+	// registry, ask for the old repo's blobs to be mounted instead. An
+	// adopted chart is already in repo, so this pushes nothing.
+	push := ocichart
+	if prior != nil && prior.Repo.ValueString() != data.Repo.ValueString() && prior.Digest.ValueString() != "" {
+		if from, err := name.NewRepository(prior.Repo.ValueString()); err == nil && from.Registry == repo.Registry {
+			push = chart.MountFrom(ocichart, from)
+		}
+	}
+
+	var tags []string
+	if !data.Tags.IsNull() && !data.Tags.IsUnknown() {
+		if diags := data.Tags.ElementsAs(ctx, &tags, false); diags != nil {
+			return diags
+		}
+	}
+	// The tombstone tag is there to be moved onto the deprecated chart, so
+	// isn't checked, even if it is also in tags.
+	tombstone := data.TombstoneTag.ValueString()
+	if !data.Deprecated.ValueBool() {
+		tombstone = ""
+	}
+	if tombstone != "" {
+		tags = slices.DeleteFunc(tags, func(t string) bool { return t == tombstone })
+	}
+	// Check every tag up front, so immutable_tags fails before anything is
+	// pushed rather than partway through.
+	ds = append(ds, r.client.checkTags(ctx, repo, tags, digest.String(), data.ImmutableTags.ValueBool())...)
+	if ds.HasError() {
+		return ds
+	}
+	if tombstone != "" {
+		tags = append(tags, tombstone)
+	}
+	data.Digest = types.StringValue(pushed)
+	// A rebuild to the same digest leaves the one it replaced as is.
+	data.PreviousDigest = types.StringNull()
+	if prior != nil {
+		data.PreviousDigest = prior.PreviousDigest
+		if d := prior.Digest.ValueString(); d != "" && d != pushed {
+			data.PreviousDigest = types.StringValue(d)
+		}
+	}
+
+	if err := remote.Write(ref, push, r.client.remoteOpts(ctx)...); err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("pushing chart to registry", err.Error()))
+		return ds
+	}
+
+	// Attest before tagging, so anything that finds the chart by tag can
+	// already find the attestation.
+	if report != nil {
+		if data.ScanAttestation, diags = r.client.attestScan(ctx, repo.Digest(digest.String()), report); diags.HasError() {
+			return append(ds, diags...)
+		}
+	}
+
+	// Sign before tagging too, for admission controllers that verify by tag.
+	// Signing the same digest again would only add a duplicate signature.
+	data.NotationSignature = types.StringNull()
+	if !data.Notation.IsNull() {
+		if prior != nil && prior.Digest.ValueString() == pushed && prior.Repo.Equal(data.Repo) && prior.Notation.Equal(data.Notation) && !prior.NotationSignature.IsNull() {
+			data.NotationSignature = prior.NotationSignature
+		} else if data.NotationSignature, diags = r.client.notationSign(ctx, data.Notation, repo.Digest(digest.String())); diags.HasError() {
+			return append(ds, diags...)
+		}
+	}
+
+	for _, t := range tags {
+		if err := remote.Tag(repo.Tag(t), ocichart, r.client.remoteOpts(ctx)...); err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("tagging chart", err.Error()))
+			return ds
+		}
+	}
+
+	data.ID = types.StringValue(chartID(data.IDFormat.ValueString(), ref, data.Name.ValueString(), data.ChartVersion.ValueString()))
+
+	var mirrors []string
+	if !data.MirrorRepos.IsNull() && !data.MirrorRepos.IsUnknown() {
+		if diags := data.MirrorRepos.ElementsAs(ctx, &mirrors, false); diags != nil {
+			return diags
+		}
+	}
+	for _, m := range mirrors {
+		mirror, err := name.NewRepository(m)
+		if err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("parsing mirror repository reference", err.Error()))
+			return ds
+		}
+		// The chart's blobs are all in repo now, so mirrors in the same
+		// registry can mount them rather than upload them again.
+		if err := remote.Write(chart.DigestRef(mirror, pushed), chart.MountFrom(ocichart, repo), r.client.remoteOpts(ctx)...); err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("pushing chart to mirror", err.Error()))
+			return ds
+		}
+	}
+
+	ds = append(ds, r.pruneDigests(ctx, data, prior, repo, pushed)...)
+
+	if p := data.OutputLockfile.ValueString(); p != "" {
+		if err := chart.NewLock(pkg, bc).SaveToFile(p); err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("writing output lockfile", err.Error()))
+			return ds
+		}
+	}
+
+	ds = append(ds, notify(ctx, data.Notify, notifyEvent{
+		Name:           data.Name.ValueString(),
+		Version:        data.ChartVersion.ValueString(),
+		Digest:         pushed,
+		Repo:           repo.String(),
+		Ref:            ref.String(),
+		Tags:           tags,
+		PackageName:    pkg.Name,
+		PackageVersion: pkg.Version,
+	})...)
+	return ds
+}
+
+// priorChart returns the chart prior pushed, for pushing again unchanged,
+// and the package it was built from: as recorded in prior, or, if bc is set,
+// resolved again to exactly that package.
+func (r *helmChartResource) priorChart(ctx context.Context, data, prior *helmChartResourceModel, bc *chart.BuildConfig) (chart.Chart, *chart.Package, diag.Diagnostics) {
+	ref, err := chart.ParseDigest(prior.Repo.ValueString() + "@" + prior.Digest.ValueString())
+	if err != nil {
+		return nil, nil, diag.Diagnostics{diag.NewErrorDiagnostic("parsing previous chart reference", err.Error())}
+	}
+	c, err := chart.Pull(ref, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return nil, nil, diag.Diagnostics{diag.NewErrorDiagnostic("previous chart is gone",
+				fmt.Sprintf("%s is no longer in the registry, so it can't be pushed again as is. Run terraform apply again: its refresh removes the chart from state, and it is built anew.", ref))}
+		}
+		return nil, nil, diag.Diagnostics{diag.NewErrorDiagnostic("pulling previous chart", err.Error())}
+	}
+	tflog.Info(ctx, "pushing chart from state, its build inputs are unchanged", map[string]any{"ref": ref.String()})
+
+	pkg := &chart.Package{
+		Name:     prior.ResolvedName.ValueString(),
+		Version:  prior.ResolvedVersion.ValueString(),
+		Checksum: prior.PackageChecksum.ValueString(),
+	}
+	if bc == nil {
+		return c, pkg, nil
+	}
+	// chartBuildConfig pins the version and name state resolved to.
+	resolved, err := chart.Resolve(ctx, data.PackageName.ValueString(), bc)
+	if err != nil {
+		return nil, nil, diag.Diagnostics{diag.NewErrorDiagnostic("resolving package", err.Error())}
+	}
+	if resolved.Name != pkg.Name || resolved.Version != pkg.Version || resolved.Checksum != pkg.Checksum {
+		return nil, nil, diag.Diagnostics{diag.NewErrorDiagnostic("package changed since plan",
+			fmt.Sprintf("The chart was built from %s-%s (%s), but it now resolves to %s-%s (%s). Run terraform apply again to rebuild it.", pkg.Name, pkg.Version, pkg.Checksum, resolved.Name, resolved.Version, resolved.Checksum))}
+	}
+	return c, resolved, nil
+}
+
+// chartBuildConfig returns the config to build the chart described by data
+// with, including everything that changes the chart.
+func (r *helmChartResource) chartBuildConfig(ctx context.Context, data *helmChartResourceModel) (*chart.BuildConfig, diag.Diagnostics) {
 	patches, diags := toJsonPatch(ctx, data.JSONPatches)
 	if diags != nil {
-		return diags
+		return nil, diags
 	}
 
 	var images map[string]string
 	if !data.Images.IsNull() && !data.Images.IsUnknown() {
 		if diags := data.Images.ElementsAs(ctx, &images, false); diags != nil {
-			return diags
+			return nil, diags
 		}
 	}
 
-	ocichart, err := chart.Build(ctx, data.PackageName.ValueString(), &chart.BuildConfig{
-		Keys:               r.client.extraKeyrings,
-		RuntimeRepos:       r.client.extraRepositories,
-		Arch:               arch,
-		Version:            data.PackageVersion.ValueString(),
-		JSONRFC6902Patches: patches,
-		Images:             images,
-	})
+	files, diags := chartFiles(ctx, map[string]types.Object{"readme": data.Readme, "notes": data.Notes, "license": data.License})
+	if diags.HasError() {
+		return nil, diags
+	}
+	icon, diags := chartIcon(ctx, data.Icon)
+	if diags.HasError() {
+		return nil, diags
+	}
+	maintainers, diags := chartMaintainers(ctx, data.Maintainers)
+	if diags.HasError() {
+		return nil, diags
+	}
+	keywords, diags := optionalStrings(ctx, data.Keywords)
+	if diags.HasError() {
+		return nil, diags
+	}
+	sources, diags := optionalStrings(ctx, data.Sources)
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	bc, diags := r.buildConfig(ctx, data)
+	if diags.HasError() {
+		return nil, diags
+	}
+	bc.JSONRFC6902Patches = patches
+	bc.Images = images
+	bc.Files = files
+	bc.Icon = icon
+	bc.Maintainers = maintainers
+	bc.AppendMaintainers = data.AppendMaintainers.ValueBool()
+	bc.Keywords = keywords
+	bc.Home = data.Home.ValueString()
+	bc.Sources = sources
+	bc.Deprecated = data.Deprecated.ValueBool()
+	bc.ValuesDocs = data.ValuesDocs.ValueBool()
+	bc.NormalizeModes = data.NormalizeModes.ValueBool()
+	if bc.Layers, diags = extraLayers(ctx, data.ExtraLayers); diags.HasError() {
+		return nil, diags
+	}
+	// Build exactly the version planned, if one was, so a package published
+	// between plan and apply can't change the digest.
+	if v := data.ResolvedVersion; !v.IsUnknown() && v.ValueString() != "" {
+		bc.Version = "=" + v.ValueString()
+	}
+	if n := data.ResolvedName; !n.IsUnknown() && n.ValueString() != "" {
+		bc.PreferPackages = append([]string{n.ValueString()}, bc.PreferPackages...)
+	}
+	return bc, nil
+}
+
+// buildConfig returns the package resolution settings for data, building
+// its melange packages first if it has any. Chart mutations like patches are
+// left for the caller to fill in.
+func (r *helmChartResource) buildConfig(ctx context.Context, data *helmChartResourceModel) (*chart.BuildConfig, diag.Diagnostics) {
+	// Only truncated charts depend on the limit; the rest are checked after
+	// they are built.
+	maxAnnotationSize := 0
+	if data.TruncateAnnotations.ValueBool() {
+		maxAnnotationSize = annotationLimit(data)
+	}
+
+	// If arch is still empty after default_arch, the package's default is used.
+	bc := r.client.resolveConfig(data.PackageArch.Canonical())
+	bc.Version = data.PackageVersion.ValueString()
+	bc.RevisionFormat = chart.RevisionFormat(data.RevisionFormat.ValueString())
+	bc.ManifestFormat = chart.ManifestFormat(data.ManifestFormat.ValueString())
+	bc.ConfigMediaType = data.ConfigMediaType.ValueString()
+	bc.ChartMediaType = data.ChartMediaType.ValueString()
+	bc.SourceAnnotation = data.SourceAnnotation.ValueString()
+	bc.Created = data.Created.ValueString()
+	bc.CopyAnnotations = r.client.copyAnnotations
+	bc.MaxAnnotationSize = maxAnnotationSize
+	bc.Lockfile = data.Lockfile.ValueString()
+	bc.DebugDir = r.client.debugPath(data.Repo.ValueString())
+	if data.BundleDeps.ValueBool() {
+		bc.BundlePattern = data.DependencyPattern.ValueString()
+	}
+	var diags diag.Diagnostics
+	if bc.PreferPackages, diags = optionalStrings(ctx, data.PreferPackages); diags.HasError() {
+		return nil, diags
+	}
+	if bc.BlockPackages, diags = optionalStrings(ctx, data.BlockPackages); diags.HasError() {
+		return nil, diags
+	}
+	if bc.ChartRoots, diags = optionalStrings(ctx, data.ChartRoots); diags.HasError() {
+		return nil, diags
+	}
+	if data.Melange.IsNull() {
+		return bc, nil
+	}
+
+	// Build for every arch the chart is built from.
+	archs := []string{bc.Arch}
+	if bc.Arch == "" {
+		archs = []string{canonicalArch(runtime.GOARCH)}
+	}
+	var verify []string
+	if !data.VerifyArchs.IsNull() && !data.VerifyArchs.IsUnknown() {
+		if diags := data.VerifyArchs.ElementsAs(ctx, &verify, false); diags.HasError() {
+			return nil, diags
+		}
+	}
+	for _, a := range verify {
+		if a = canonicalArch(a); !slices.Contains(archs, a) {
+			archs = append(archs, a)
+		}
+	}
+	repo, diags := r.client.buildMelange(ctx, data.Melange, archs)
+	if diags.HasError() {
+		return nil, diags
+	}
+	bc.BuildRepos = append([]string{repo.dir}, bc.BuildRepos...)
+	bc.Keys = append(slices.Clip(bc.Keys), repo.key)
+	return bc, nil
+}
+
+// revisionFormats returns the accepted chart_version_revision values.
+func revisionFormats() []string {
+	out := make([]string, 0, len(chart.RevisionFormats))
+	for _, f := range chart.RevisionFormats {
+		out = append(out, string(f))
+	}
+	return out
+}
+
+// manifestFormats returns the accepted manifest_format values.
+func manifestFormats() []string {
+	out := make([]string, 0, len(chart.ManifestFormats))
+	for _, f := range chart.ManifestFormats {
+		out = append(out, string(f))
+	}
+	return out
+}
+
+// renderedSHA256 returns the hex SHA-256 of what c renders as with its
+// default values, or null if it can't be rendered with them.
+func renderedSHA256(ctx context.Context, c chart.Chart) types.String {
+	out, err := chart.RenderedManifest(c)
 	if err != nil {
-		ds = append(ds, diag.NewErrorDiagnostic("building chart", err.Error()))
-		return ds
+		tflog.Warn(ctx, "chart doesn't render with its default values", map[string]any{"error": err.Error()})
+		return types.StringNull()
 	}
+	h := sha256.Sum256([]byte(out))
+	return types.StringValue(hex.EncodeToString(h[:]))
+}
 
+// setChartMetadata populates the attributes derived from the chart's config
+// blob and manifest, including their raw JSON.
+func setChartMetadata(ctx context.Context, data *helmChartResourceModel, ocichart chart.Chart) diag.Diagnostics {
 	metadata, err := ocichart.Metadata()
 	if err != nil {
-		ds = append(ds, diag.NewErrorDiagnostic("getting chart metadata", err.Error()))
-		return ds
+		return diag.Diagnostics{diag.NewErrorDiagnostic("getting chart metadata", err.Error())}
 	}
 	data.Name = types.StringValue(metadata.Name)
 	data.ChartVersion = types.StringValue(metadata.Version)
+	data.IsLibrary = types.BoolValue(metadata.Type == "library")
 
-	ref, err := name.ParseReference(data.Repo.ValueString())
+	m, err := ocichart.Manifest()
 	if err != nil {
-		ds = append(ds, diag.NewErrorDiagnostic("parsing repository reference", err.Error()))
-		return ds
+		return diag.Diagnostics{diag.NewErrorDiagnostic("getting chart manifest", err.Error())}
+	}
+	annotations, diags := types.MapValueFrom(ctx, types.StringType, m.Annotations)
+	data.Annotations = annotations
+	if len(m.Layers) == 0 {
+		return append(diags, diag.NewErrorDiagnostic("getting chart manifest", "the manifest has no content layer"))
 	}
+	data.LayerDigest = types.StringValue(m.Layers[0].Digest.String())
+	data.LayerSize = types.Int64Value(m.Layers[0].Size)
 
-	digest, err := ocichart.Digest()
+	rawManifest, err := ocichart.RawManifest()
 	if err != nil {
-		ds = append(ds, diag.NewErrorDiagnostic("getting chart digest", err.Error()))
-		return ds
+		return append(diags, diag.NewErrorDiagnostic("getting chart manifest", err.Error()))
 	}
-	data.Digest = types.StringValue(digest.String())
+	rawConfig, err := ocichart.RawConfigFile()
+	if err != nil {
+		return append(diags, diag.NewErrorDiagnostic("getting chart config", err.Error()))
+	}
+	data.ManifestJSON = types.StringValue(string(rawManifest))
+	data.ConfigJSON = types.StringValue(string(rawConfig))
+	return diags
+}
 
-	if err := remote.Write(ref.Context().Digest(digest.String()), ocichart, r.client.ropts...); err != nil {
-		ds = append(ds, diag.NewErrorDiagnostic("pushing chart to registry", err.Error()))
-		return ds
+// ImportState adopts a chart already in a registry, given as <repo>@<digest>,
+// or by its version tag as <repo>:<chart version>, or as
+// <repo>,<chart name>:<chart version> for id_format = "chart". Tags are
+// resolved to the digest they point at now. The next apply rebuilds the
+// chart from the configured package.
+func (r *helmChartResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	const usage = "expected <repo>@<digest>, <repo>:<chart version> or <repo>,<chart name>:<chart version>"
+	id, format, chartID := req.ID, idFormatDigest, ""
+	// <repo>,<chart name>:<chart version> imports with id_format = "chart",
+	// finding the chart by its version tag.
+	if repo, rest, ok := strings.Cut(req.ID, ","); ok {
+		n, v, _ := strings.Cut(rest, ":")
+		if n == "" || v == "" {
+			resp.Diagnostics.AddError("parsing import ID", fmt.Sprintf("%s, got %q", usage, req.ID))
+			return
+		}
+		id, format, chartID = repo+":"+strings.ReplaceAll(v, "+", "_"), idFormatChart, rest
 	}
 
-	data.ID = types.StringValue(ref.Context().Digest(digest.String()).String())
-	return ds
+	var ref name.Reference
+	if strings.Contains(id, "@") {
+		var err error
+		if ref, err = chart.ParseDigest(id); err != nil {
+			resp.Diagnostics.AddError("parsing import ID", fmt.Sprintf("%s, got %q: %v", usage, req.ID, err))
+			return
+		}
+	} else {
+		// A tag must be given, rather than defaulting to latest.
+		tag, err := name.NewTag(id)
+		if err != nil || !strings.HasSuffix(id, ":"+tag.TagStr()) {
+			resp.Diagnostics.AddError("parsing import ID", fmt.Sprintf("%s, got %q", usage, req.ID))
+			return
+		}
+		desc, err := remote.Head(tag, r.client.remoteOpts(ctx)...)
+		if err != nil {
+			resp.Diagnostics.AddError("resolving import ID", fmt.Sprintf("resolving %s to a digest: %v", tag, err))
+			return
+		}
+		ref = tag.Context().Digest(desc.Digest.String())
+	}
+
+	if format == idFormatChart {
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), chartID)...)
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id_format"), format)...)
+	} else {
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), ref.String())...)
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("repo"), ref.Context().String())...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("digest"), ref.Identifier())...)
 }
 
 // Delete deletes the resource and removes the Terraform state on success.
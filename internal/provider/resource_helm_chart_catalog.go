@@ -0,0 +1,525 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/sync/errgroup"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource                   = &helmChartCatalogResource{}
+	_ resource.ResourceWithConfigure      = &helmChartCatalogResource{}
+	_ resource.ResourceWithModifyPlan     = &helmChartCatalogResource{}
+	_ resource.ResourceWithValidateConfig = &helmChartCatalogResource{}
+)
+
+// NewHelmChartCatalogResource is a helper function to simplify the provider implementation.
+func NewHelmChartCatalogResource() resource.Resource {
+	return &helmChartCatalogResource{}
+}
+
+// helmChartCatalogResource is the resource implementation.
+type helmChartCatalogResource struct {
+	client *helmClient
+}
+
+// helmChartCatalogResourceModel maps the resource schema data.
+type helmChartCatalogResourceModel struct {
+	ID            types.String `tfsdk:"id"`
+	Namespace     types.String `tfsdk:"namespace"`
+	RepoTemplate  types.String `tfsdk:"repo_template"`
+	Pattern       types.String `tfsdk:"pattern"`
+	Packages      types.List   `tfsdk:"packages"`
+	Arch          archValue    `tfsdk:"arch"`
+	ForbidLibrary types.Bool   `tfsdk:"forbid_library_charts"`
+	Charts        types.Map    `tfsdk:"charts"`
+}
+
+// catalogChartModel maps a single published chart.
+type catalogChartModel struct {
+	Repo            types.String `tfsdk:"repo"`
+	Digest          types.String `tfsdk:"digest"`
+	Name            types.String `tfsdk:"name"`
+	ChartVersion    types.String `tfsdk:"chart_version"`
+	PackageVersion  types.String `tfsdk:"package_version"`
+	PackageChecksum types.String `tfsdk:"package_checksum"`
+}
+
+var catalogChartAttrTypes = map[string]attr.Type{
+	"repo":             types.StringType,
+	"digest":           types.StringType,
+	"name":             types.StringType,
+	"chart_version":    types.StringType,
+	"package_version":  types.StringType,
+	"package_checksum": types.StringType,
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *helmChartCatalogResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// Metadata returns the resource type name.
+func (r *helmChartCatalogResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_catalog"
+}
+
+// Schema defines the schema for the resource.
+func (r *helmChartCatalogResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Publishes every chart package matching a pattern, or a list of them resolved together, as Helm charts under a common OCI namespace.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Identifier for this resource.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"namespace": schema.StringAttribute{
+				Optional:    true,
+				Description: "The OCI repository prefix to publish under. Each chart is pushed to `<namespace>/<chart name>`. Exactly one of `namespace` or `repo_template` must be set.",
+				Validators: []validator.String{
+					repoValidator{},
+				},
+			},
+			"repo_template": schema.StringAttribute{
+				Optional:    true,
+				Description: "A Go template for the repo each chart is pushed to, e.g. `registry.example.com/charts/{{ .Name }}`. The template is given the chart's `.Name` and `.Version` and the `.PackageName` and `.PackageVersion` it was built from. Exactly one of `namespace` or `repo_template` must be set.",
+				Validators: []validator.String{
+					repoTemplateValidator{},
+				},
+			},
+			"pattern": schema.StringAttribute{
+				Optional:    true,
+				Description: "A shell glob, as understood by Go's path.Match, that package names must match, such as `chart-*`. Exactly one of `pattern` or `packages` must be set.",
+				Validators: []validator.String{
+					globValidator{},
+				},
+			},
+			"packages": schema.ListAttribute{
+				Optional:    true,
+				Description: "The chart packages to publish instead of those matching `pattern`, as APK world entries like `istio-charts-base=1.20.3-r0` or `istio-charts-istiod`. They are resolved together, as apko would install them, from the same index, so related charts are published at versions consistent with each other and their dependencies.",
+				ElementType: types.StringType,
+			},
+			"arch": schema.StringAttribute{
+				Optional:    true,
+				Description: "The architecture of the packages to fetch. If not specified, uses the provider default_arch or falls back to system defaults.",
+				CustomType:  archType{},
+				Validators: []validator.String{
+					archValidator{},
+				},
+			},
+			"forbid_library_charts": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail, without pushing it, when a chart is a library chart, whose Chart.yaml `type` is `library`, so a namespace meant for installable charts doesn't get charts that can only be depended on. Other charts may still be published before the failure.",
+			},
+			"charts": schema.MapNestedAttribute{
+				Computed:    true,
+				Description: "The published charts, keyed by package name. The newest version of each matching package, or the version each of `packages` resolves to, is published; a new version or a package rebuilt in place republishes the catalog.",
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.UseStateForUnknown(),
+				},
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"repo": schema.StringAttribute{
+							Computed:    true,
+							Description: "The repo the chart was pushed to.",
+						},
+						"digest": schema.StringAttribute{
+							Computed:    true,
+							Description: "The SHA256 digest of the pushed chart.",
+						},
+						"name": schema.StringAttribute{
+							Computed:    true,
+							Description: "The name of the Helm chart extracted from the chart metadata.",
+						},
+						"chart_version": schema.StringAttribute{
+							Computed:    true,
+							Description: "The chart version of the Helm chart extracted from the chart metadata.",
+						},
+						"package_version": schema.StringAttribute{
+							Computed:    true,
+							Description: "The full APK version the chart was built from.",
+						},
+						"package_checksum": schema.StringAttribute{
+							Computed:    true,
+							Description: "The APKINDEX checksum of the package the chart was built from.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks that exactly one destination is configured, and
+// that packages are either matched or listed.
+func (r *helmChartCatalogResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data helmChartCatalogResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.Pattern.IsNull() && !data.Packages.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("packages"), "Conflicting packages", "Only one of pattern or packages may be set.")
+	}
+	if data.Pattern.IsNull() && data.Packages.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("pattern"), "Missing packages", "Exactly one of pattern or packages must be set.")
+	}
+	if data.Namespace.IsUnknown() || data.RepoTemplate.IsUnknown() {
+		return
+	}
+	if data.Namespace.IsNull() == data.RepoTemplate.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("namespace"), "Invalid destination", "Exactly one of namespace or repo_template must be set.")
+	}
+}
+
+// ModifyPlan republishes the catalog when the set of matching packages, or
+// any of their newest versions, has changed since it was last published.
+func (r *helmChartCatalogResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to compare against on create, and nothing to do on destroy.
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() || r.client == nil {
+		return
+	}
+
+	var plan, state helmChartCatalogResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Charts that couldn't be refreshed are kept as they were, rather than
+	// all published again; those found gone once a refresh reaches the
+	// registry are dropped then, and the next plan republishes them.
+	_, diags := takeUnreachable(ctx, req.Private, resp.Private)
+	resp.Diagnostics.Append(diags...)
+	if !req.Plan.Raw.Equal(req.State.Raw) {
+		plan.Charts = types.MapUnknown(types.ObjectType{AttrTypes: catalogChartAttrTypes})
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	pkgs, diags := r.discover(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var published map[string]catalogChartModel
+	resp.Diagnostics.Append(state.Charts.ElementsAs(ctx, &published, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	changed := len(pkgs) != len(published)
+	for _, p := range pkgs {
+		if c, ok := published[p.Name]; !ok || c.PackageChecksum.ValueString() != p.Checksum {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	tflog.Info(ctx, "catalog packages changed", map[string]any{"namespace": plan.Namespace.ValueString()})
+	plan.Charts = types.MapUnknown(types.ObjectType{AttrTypes: catalogChartAttrTypes})
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// Create is called when the provider must create a new resource.
+func (r *helmChartCatalogResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data helmChartCatalogResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(r.do(ctx, &data)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *helmChartCatalogResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state helmChartCatalogResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var published map[string]catalogChartModel
+	resp.Diagnostics.Append(state.Charts.ElementsAs(ctx, &published, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Drop charts that have gone missing from the registry, so the next plan
+	// sees the catalog as changed and republishes them. Those that can't be
+	// checked are kept as they are.
+	unreachable := false
+	for pkg, c := range published {
+		repo, err := name.NewRepository(c.Repo.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("parsing repository reference", err.Error())
+			return
+		}
+		if _, err := remote.Head(repo.Digest(c.Digest.ValueString()), r.client.remoteOpts(ctx)...); err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				tflog.Warn(ctx, "chart no longer exists in registry, removing from state", map[string]any{"package": pkg})
+				delete(published, pkg)
+				continue
+			}
+			if registryUnreachable(err) {
+				if !unreachable {
+					resp.Diagnostics.Append(keepUnrefreshed(ctx, resp.Private, c.Repo.ValueString(), err)...)
+				}
+				unreachable = true
+				continue
+			}
+			resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+			return
+		}
+	}
+	if !unreachable {
+		resp.Diagnostics.Append(resp.Private.SetKey(ctx, unreachableKey, nil)...)
+	}
+
+	charts, diags := types.MapValueFrom(ctx, types.ObjectType{AttrTypes: catalogChartAttrTypes}, published)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	state.Charts = charts
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *helmChartCatalogResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data helmChartCatalogResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(r.do(ctx, &data)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Delete removes the resource from state. Like helm_chart, published charts
+// are left in the registry.
+func (r *helmChartCatalogResource) Delete(context.Context, resource.DeleteRequest, *resource.DeleteResponse) {
+}
+
+// discover lists the newest version of every package matching the pattern,
+// or what the listed packages resolve to.
+func (r *helmChartCatalogResource) discover(ctx context.Context, data *helmChartCatalogResourceModel) ([]chart.IndexEntry, diag.Diagnostics) {
+	config, diags := r.client.indexConfig(ctx, types.ListNull(types.StringType), data.Arch)
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	if !data.Packages.IsNull() {
+		var world []string
+		if diags := data.Packages.ElementsAs(ctx, &world, false); diags.HasError() {
+			return nil, diags
+		}
+		entries, err := chart.ResolveWorld(ctx, config, world)
+		if err != nil {
+			return nil, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("packages"), "resolving packages", err.Error())}
+		}
+		return entries, nil
+	}
+
+	entries, err := chart.ListIndex(ctx, config)
+	if err != nil {
+		return nil, diag.Diagnostics{diag.NewErrorDiagnostic("listing package index", err.Error())}
+	}
+
+	return discoverChartPackages(entries, data.Pattern.ValueString()), nil
+}
+
+func (r *helmChartCatalogResource) do(ctx context.Context, data *helmChartCatalogResourceModel) (ds diag.Diagnostics) {
+	ctx, throttled := withThrottleLog(ctx)
+	defer func() { ds = append(ds, throttled.diagnostics()...) }()
+
+	pkgs, diags := r.discover(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	// Publish concurrently; the client's build semaphore bounds how many
+	// charts are held in memory at once while pushes overlap with builds.
+	var (
+		mu        sync.Mutex
+		published = make(map[string]catalogChartModel, len(pkgs))
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	for _, p := range pkgs {
+		g.Go(func() error {
+			start := time.Now()
+			pctx, transferred := withTransferLog(gctx)
+			c, err := r.publish(pctx, data, p)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.Name, err)
+			}
+			rec := transferred.record(start)
+			rec.Repo, rec.Name, rec.Version, rec.Digest = c.Repo.ValueString(), c.Name.ValueString(), c.ChartVersion.ValueString(), c.Digest.ValueString()
+			rec.Package, rec.PackageVersion = p.Name, c.PackageVersion.ValueString()
+			diags := r.client.recordPublish(ctx, rec)
+			mu.Lock()
+			defer mu.Unlock()
+			published[p.Name] = c
+			ds = append(ds, diags...)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return append(ds, diag.NewErrorDiagnostic("publishing catalog", err.Error()))
+	}
+
+	charts, diags := types.MapValueFrom(ctx, types.ObjectType{AttrTypes: catalogChartAttrTypes}, published)
+	if diags.HasError() {
+		return append(ds, diags...)
+	}
+	data.Charts = charts
+	if data.RepoTemplate.IsNull() {
+		data.ID = types.StringValue(data.Namespace.ValueString())
+	} else {
+		data.ID = types.StringValue(data.RepoTemplate.ValueString())
+	}
+	return ds
+}
+
+// publish builds and pushes the chart for a single discovered package.
+func (r *helmChartCatalogResource) publish(ctx context.Context, data *helmChartCatalogResourceModel, p chart.IndexEntry) (catalogChartModel, error) {
+	config, diags := r.client.indexConfig(ctx, types.ListNull(types.StringType), data.Arch)
+	if diags.HasError() {
+		return catalogChartModel{}, fmt.Errorf("configuring build: %v", diags)
+	}
+	// Pin to what was discovered so the catalog is internally consistent
+	// even if the index changes mid-apply.
+	config.Version = "=" + p.Version
+	config.DebugDir = r.client.debugPath(data.Namespace.ValueString())
+
+	ocichart, err := r.client.build(ctx, p.Name, config)
+	if err != nil {
+		return catalogChartModel{}, fmt.Errorf("building chart: %w", err)
+	}
+	defer ocichart.Close()
+	if err := r.client.naming.check(ocichart); err != nil {
+		return catalogChartModel{}, err
+	}
+	if data.ForbidLibrary.ValueBool() {
+		if err := checkNotLibrary(ocichart); err != nil {
+			return catalogChartModel{}, fmt.Errorf("forbid_library_charts: %w", err)
+		}
+	}
+
+	metadata, err := ocichart.Metadata()
+	if err != nil {
+		return catalogChartModel{}, fmt.Errorf("getting chart metadata: %w", err)
+	}
+
+	dest := data.Namespace.ValueString() + "/" + metadata.Name
+	if !data.RepoTemplate.IsNull() {
+		dest, err = renderRepoTemplate(data.RepoTemplate.ValueString(), repoTemplateData{
+			Name:           metadata.Name,
+			Version:        metadata.Version,
+			PackageName:    p.Name,
+			PackageVersion: ocichart.Package().Version,
+		})
+		if err != nil {
+			return catalogChartModel{}, fmt.Errorf("rendering repo_template: %w", err)
+		}
+	}
+
+	repo, err := name.NewRepository(dest)
+	if err != nil {
+		return catalogChartModel{}, fmt.Errorf("parsing repository reference: %w", err)
+	}
+
+	digest, err := ocichart.Digest()
+	if err != nil {
+		return catalogChartModel{}, fmt.Errorf("getting chart digest: %w", err)
+	}
+
+	if err := remote.Write(repo.Digest(digest.String()), ocichart, r.client.remoteOpts(ctx)...); err != nil {
+		return catalogChartModel{}, fmt.Errorf("pushing chart to registry: %w", err)
+	}
+
+	return catalogChartModel{
+		Repo:            types.StringValue(repo.String()),
+		Digest:          types.StringValue(digest.String()),
+		Name:            types.StringValue(metadata.Name),
+		ChartVersion:    types.StringValue(metadata.Version),
+		PackageVersion:  types.StringValue(ocichart.Package().Version),
+		PackageChecksum: types.StringValue(ocichart.Package().Checksum),
+	}, nil
+}
+
+// repoTemplateData is what repo_template is executed against.
+type repoTemplateData struct {
+	Name           string
+	Version        string
+	PackageName    string
+	PackageVersion string
+}
+
+// renderRepoTemplate executes a repo_template for a single chart.
+func renderRepoTemplate(tmpl string, data repoTemplateData) (string, error) {
+	t, err := template.New("repo_template").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccHelmChartCatalogResource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart_catalog.test"
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	add := func(p testkit.ChartPackage) {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatalf("failed to write repository: %v", err)
+		}
+	}
+	add(testkit.ChartPackage{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")})
+	add(testkit.ChartPackage{Name: "chart-versioned", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/versioned")})
+
+	config := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart_catalog" "test" {
+  namespace = %q
+  pattern   = "chart-*"
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("catalog"))
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "charts.%", "2"),
+					resource.TestCheckResourceAttr(resourceName, "charts.chart-basic.repo", reg.Repo("catalog/basic")),
+					resource.TestCheckResourceAttr(resourceName, "charts.chart-basic.name", "basic"),
+					resource.TestCheckResourceAttrSet(resourceName, "charts.chart-basic.digest"),
+					resource.TestCheckResourceAttr(resourceName, "charts.chart-versioned.package_version", "0.0.1-r0"),
+				),
+			},
+			{
+				PreConfig: func() {
+					add(testkit.ChartPackage{Name: "chart-versioned", Version: "0.0.2-r0", Chart: os.DirFS("../../testdata/charts/versioned")})
+				},
+				Config: config,
+				Check:  resource.TestCheckResourceAttr(resourceName, "charts.chart-versioned.package_version", "0.0.2-r0"),
+			},
+			{
+				Config:   config,
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestAccHelmChartCatalogResourceRepoTemplate(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")}); err != nil {
+		t.Fatalf("failed to add package: %v", err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	provider := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+`, repo.Path(), repo.KeyPath())
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: provider + `
+resource "helm_chart_catalog" "test" {
+  pattern = "chart-*"
+}
+`,
+				ExpectError: regexp.MustCompile(`Exactly one of namespace or repo_template`),
+			},
+			{
+				Config: provider + fmt.Sprintf(`
+resource "helm_chart_catalog" "test" {
+  repo_template = "%s/templated/{{ .Name }}-{{ .PackageName }}"
+  pattern       = "chart-*"
+}
+`, reg.Host()),
+				Check: resource.TestCheckResourceAttr("helm_chart_catalog.test", "charts.chart-basic.repo", reg.Repo("templated/basic-chart-basic")),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartCatalogResourcePackages(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")},
+		{Name: "chart-basic", Version: "0.0.2-r0", Chart: os.DirFS("../../testdata/charts/basic")},
+		{Name: "chart-versioned", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/versioned"), Depends: []string{"chart-basic=0.0.1-r0"}},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	provider := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+`, repo.Path(), repo.KeyPath())
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: provider + fmt.Sprintf(`
+resource "helm_chart_catalog" "test" {
+  namespace = %q
+  pattern   = "chart-*"
+  packages  = ["chart-basic"]
+}
+`, reg.Repo("world")),
+				ExpectError: regexp.MustCompile(`Only one of pattern or packages`),
+			},
+			{
+				Config: provider + fmt.Sprintf(`
+resource "helm_chart_catalog" "test" {
+  namespace = %q
+}
+`, reg.Repo("world")),
+				ExpectError: regexp.MustCompile(`Exactly one of pattern or packages`),
+			},
+			{
+				Config: provider + fmt.Sprintf(`
+resource "helm_chart_catalog" "test" {
+  namespace = %q
+  packages  = ["chart-basic", "chart-versioned"]
+}
+`, reg.Repo("world")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart_catalog.test", "charts.%", "2"),
+					// Held back to the version chart-versioned depends on.
+					resource.TestCheckResourceAttr("helm_chart_catalog.test", "charts.chart-basic.package_version", "0.0.1-r0"),
+				),
+			},
+		},
+	})
+}
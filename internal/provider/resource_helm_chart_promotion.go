@@ -0,0 +1,616 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource                   = &helmChartPromotionResource{}
+	_ resource.ResourceWithConfigure      = &helmChartPromotionResource{}
+	_ resource.ResourceWithModifyPlan     = &helmChartPromotionResource{}
+	_ resource.ResourceWithValidateConfig = &helmChartPromotionResource{}
+)
+
+// NewHelmChartPromotionResource is a helper function to simplify the provider implementation.
+func NewHelmChartPromotionResource() resource.Resource {
+	return &helmChartPromotionResource{}
+}
+
+// helmChartPromotionResource is the resource implementation.
+type helmChartPromotionResource struct {
+	client *helmClient
+}
+
+// helmChartPromotionResourceModel maps the resource schema data.
+type helmChartPromotionResourceModel struct {
+	ID            types.String `tfsdk:"id"`
+	Source        types.String `tfsdk:"source"`
+	Repo          types.String `tfsdk:"repo"`
+	Tags          types.List   `tfsdk:"tags"`
+	ImmutableTags types.Bool   `tfsdk:"immutable_tags"`
+	Digest        types.String `tfsdk:"digest"`
+	Target        types.String `tfsdk:"target"`
+	Referrers     types.List   `tfsdk:"referrers"`
+	Verify        types.Object `tfsdk:"verify"`
+	Notify        types.Object `tfsdk:"notify"`
+	TargetExists  types.Bool   `tfsdk:"target_exists"`
+	MovedTags     types.Map    `tfsdk:"moved_tags"`
+}
+
+// promotionVerifyModel maps the verify policy.
+type promotionVerifyModel struct {
+	PublicKey          types.String `tfsdk:"public_key"`
+	CertificateRoots   types.String `tfsdk:"certificate_roots"`
+	CertificateID      types.String `tfsdk:"certificate_identity"`
+	CertificateIDRegex types.String `tfsdk:"certificate_identity_regexp"`
+	CertificateIssuer  types.String `tfsdk:"certificate_oidc_issuer"`
+	CTLogPublicKeys    types.String `tfsdk:"ct_log_public_keys"`
+	RequiredPredicates types.List   `tfsdk:"required_predicates"`
+	RekorPublicKey     types.String `tfsdk:"rekor_public_key"`
+	TimestampRoots     types.String `tfsdk:"timestamp_authority_roots"`
+	TimestampCerts     types.String `tfsdk:"timestamp_authority_certificates"`
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *helmChartPromotionResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// Metadata returns the resource type name.
+func (r *helmChartPromotionResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_promotion"
+}
+
+// Schema defines the schema for the resource.
+func (r *helmChartPromotionResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Promotes a published chart to another repo by digest, along with everything attached to it: signatures, SBOMs and attestations, whether attached as OCI referrers or under cosign's tag scheme.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Identifier for this resource, the same as `target`.",
+			},
+			"source": schema.StringAttribute{
+				Required:    true,
+				Description: "The chart to promote, by digest: `<repo>@sha256:<hex>`, e.g. a `helm_chart` resource's `id`.",
+				Validators: []validator.String{
+					digestRefValidator{},
+				},
+			},
+			"repo": schema.StringAttribute{
+				Required:    true,
+				Description: "The repo to promote the chart to. Must not include a tag or digest.",
+				Validators: []validator.String{
+					repoValidator{},
+				},
+			},
+			"tags": schema.ListAttribute{
+				Optional:    true,
+				Description: "Tags to point at the chart in `repo` once it and its attachments are copied. Moving a tag that already points at a different digest emits a warning naming both digests. Removing a tag from this list leaves it in the registry.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: tagValidator{}},
+				},
+			},
+			"immutable_tags": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail instead of warning when one of `tags` already points at a different digest. Checked before anything is copied.",
+			},
+			"digest": schema.StringAttribute{
+				Computed:    true,
+				Description: "The digest of the promoted chart, the same in both repos.",
+			},
+			"target": schema.StringAttribute{
+				Computed:    true,
+				Description: "The promoted chart, by digest: `<repo>@<digest>`.",
+			},
+			"referrers": schema.ListAttribute{
+				Computed:    true,
+				Description: "The digests of the attachments copied along with the chart, including attachments of attachments such as a signature on an SBOM.",
+				ElementType: types.StringType,
+			},
+			"target_exists": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the chart was already in `repo` when the promotion was planned, in which case only tags and missing attachments change.",
+			},
+			"moved_tags": schema.MapAttribute{
+				Computed:    true,
+				Description: "The tags that pointed at another chart when the promotion was planned, by the digest they pointed at. Applying moves them to `target`.",
+				ElementType: types.StringType,
+			},
+			"notify": notifySchema("after the chart is promoted and tagged"),
+			"verify": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "A policy the source chart must meet before anything is copied, failing the apply if it doesn't. Signatures and attestations are read from cosign's `.sig` and `.att` tags. Exactly one of `public_key` or `certificate_roots` must be set.",
+				Attributes: map[string]schema.Attribute{
+					"public_key": schema.StringAttribute{
+						Optional:    true,
+						Description: "A PEM-encoded public key, as written by `cosign generate-key-pair`, that the chart's signature must verify with.",
+					},
+					"certificate_roots": schema.StringAttribute{
+						Optional:    true,
+						Description: "PEM-encoded CA certificates, such as the root and intermediates of the public or a private Fulcio, that keyless signing certificates must chain to. Requires `ct_log_public_keys`, and `rekor_public_key` or `timestamp_authority_roots`, to prove each signature was made while its short-lived certificate was valid.",
+					},
+					"certificate_identity": schema.StringAttribute{
+						Optional:    true,
+						Description: "The subject alternative name, an email address or URI, keyless signing certificates must be issued to. Exactly one of it or `certificate_identity_regexp` is required with `certificate_roots`.",
+					},
+					"certificate_identity_regexp": schema.StringAttribute{
+						Optional:    true,
+						Description: "A regular expression, in Go's syntax, one of the subject alternative names of keyless signing certificates must match, as with cosign's `--certificate-identity-regexp`, e.g. for workflows signing from any tag. It matches anywhere in the name unless anchored with `^` and `$`.",
+					},
+					"certificate_oidc_issuer": schema.StringAttribute{
+						Optional:    true,
+						Description: "The OIDC issuer keyless signing certificates must record, e.g. `https://token.actions.githubusercontent.com`.",
+					},
+					"ct_log_public_keys": schema.StringAttribute{
+						Optional:    true,
+						Description: "The PEM-encoded public keys of the certificate transparency logs, public or private, keyless signing certificates must carry a signed certificate timestamp from, as Fulcio embeds in the certificates it issues. Required with `certificate_roots`, so certificates a compromised or misissuing Fulcio kept out of the public record are refused.",
+					},
+					"required_predicates": schema.ListAttribute{
+						Optional:    true,
+						Description: "In-toto predicate types, e.g. `https://spdx.dev/Document`, that must each be attested to about the chart, signed to the same policy.",
+						ElementType: types.StringType,
+					},
+					"rekor_public_key": schema.StringAttribute{
+						Optional:    true,
+						Description: "The PEM-encoded public key of the Rekor transparency log, public or private, signatures and attestations must have been entered in. Entries are proven offline, by the bundle cosign attaches to them, so the log isn't contacted, and keyless certificates are checked as of when their entry was logged.",
+					},
+					"timestamp_authority_certificates": schema.StringAttribute{
+						Optional:    true,
+						Description: "PEM-encoded signing certificates, and intermediates, of timestamp authorities that leave them out of their timestamps. Each must still chain to `timestamp_authority_roots`.",
+					},
+					"timestamp_authority_roots": schema.StringAttribute{
+						Optional:    true,
+						Description: "PEM-encoded CA certificates of the RFC 3161 timestamp authorities signatures and attestations must have been countersigned by, as cosign records with `--timestamp-server-url`. Keyless certificates are checked as of the timestamp, so signatures stay verifiable long after their short-lived certificates expire.",
+					},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks that the verify policy names exactly one way of
+// trusting signatures, and that keyless ones can be proven to have been made
+// in time.
+func (r *helmChartPromotionResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data helmChartPromotionResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() || data.Verify.IsNull() || data.Verify.IsUnknown() {
+		return
+	}
+
+	var v promotionVerifyModel
+	resp.Diagnostics.Append(data.Verify.As(ctx, &v, basetypes.ObjectAsOptions{})...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if v.PublicKey.IsUnknown() || v.CertificateRoots.IsUnknown() || v.CertificateID.IsUnknown() || v.CertificateIDRegex.IsUnknown() || v.CTLogPublicKeys.IsUnknown() || v.RekorPublicKey.IsUnknown() || v.TimestampRoots.IsUnknown() {
+		return
+	}
+
+	p := path.Root("verify")
+	if v.PublicKey.IsNull() == v.CertificateRoots.IsNull() {
+		resp.Diagnostics.AddAttributeError(p, "Invalid verify policy", "Exactly one of public_key or certificate_roots must be set.")
+		return
+	}
+	if !v.CertificateRoots.IsNull() && v.CertificateID.IsNull() == v.CertificateIDRegex.IsNull() {
+		resp.Diagnostics.AddAttributeError(p.AtName("certificate_identity"), "Invalid verify policy", "Exactly one of certificate_identity or certificate_identity_regexp must be set with certificate_roots, or any certificate the roots issued would be trusted.")
+	}
+	if re := v.CertificateIDRegex.ValueString(); re != "" {
+		if _, err := regexp.Compile(re); err != nil {
+			resp.Diagnostics.AddAttributeError(p.AtName("certificate_identity_regexp"), "Invalid verify policy", err.Error())
+		}
+	}
+	if !v.CertificateRoots.IsNull() && v.CTLogPublicKeys.IsNull() {
+		resp.Diagnostics.AddAttributeError(p.AtName("ct_log_public_keys"), "Invalid verify policy", "ct_log_public_keys must be set with certificate_roots, to check keyless certificates were publicly logged when issued.")
+	}
+	if !v.CertificateRoots.IsNull() && v.RekorPublicKey.IsNull() && v.TimestampRoots.IsNull() {
+		resp.Diagnostics.AddAttributeError(p.AtName("certificate_roots"), "Invalid verify policy", "certificate_roots needs rekor_public_key or timestamp_authority_roots too. Keyless certificates expire minutes after they are issued, so without a log entry or timestamp nothing proves a signature was made while its certificate was valid.")
+	}
+	if !v.PublicKey.IsNull() && (!v.CertificateID.IsNull() || !v.CertificateIDRegex.IsNull() || !v.CertificateIssuer.IsNull() || !v.CTLogPublicKeys.IsNull()) {
+		resp.Diagnostics.AddAttributeError(p, "Invalid verify policy", "certificate_identity, certificate_identity_regexp, certificate_oidc_issuer and ct_log_public_keys only apply with certificate_roots.")
+	}
+}
+
+// ModifyPlan fills in the target reference, which only depends on the
+// configuration, and, when something is to be applied, looks at the target
+// repo so the plan shows whether the chart is already there and which tags
+// will move.
+func (r *helmChartPromotionResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to do on destroy.
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan helmChartPromotionResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.Source.IsUnknown() || plan.Repo.IsUnknown() {
+		return
+	}
+	src, err := chart.ParseDigest(plan.Source.ValueString())
+	if err != nil {
+		return
+	}
+	repo, err := name.NewRepository(plan.Repo.ValueString())
+	if err != nil {
+		return
+	}
+	target := chart.DigestRef(repo, src.Identifier())
+	plan.Digest = types.StringValue(src.Identifier())
+	plan.Target = types.StringValue(target.String())
+	plan.ID = types.StringValue(target.String())
+
+	// A target that couldn't be refreshed may be gone from the registry, so
+	// apply promotes it again.
+	unreachable, diags := takeUnreachable(ctx, req.Private, resp.Private)
+	resp.Diagnostics.Append(diags...)
+	if unreachable {
+		plan.TargetExists = types.BoolUnknown()
+		plan.MovedTags = types.MapUnknown(types.StringType)
+	}
+
+	// A registry that can't be read now may be by apply, which fills in
+	// whatever is left unknown.
+	if r.client != nil && !plan.Tags.IsUnknown() && (req.State.Raw.IsNull() || !req.Plan.Raw.Equal(req.State.Raw)) {
+		var tags []string
+		if !plan.Tags.IsNull() {
+			resp.Diagnostics.Append(plan.Tags.ElementsAs(ctx, &tags, false)...)
+		}
+		// Tags are compared by the sha256 digest, whichever the source is
+		// given by.
+		byDigest, err := chart.SHA256Digest(src, r.client.remoteOpts(ctx)...)
+		if err == nil {
+			err = r.preview(ctx, &plan, repo.Digest(byDigest.DigestStr()), tags)
+		}
+		if err != nil {
+			tflog.Warn(ctx, "previewing promotion", map[string]any{"error": err.Error()})
+		}
+	}
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// preview fills in target_exists and moved_tags, if they aren't already
+// known, from what is in the target repo now.
+func (r *helmChartPromotionResource) preview(ctx context.Context, data *helmChartPromotionResourceModel, target name.Digest, tags []string) error {
+	if data.TargetExists.IsUnknown() {
+		_, err := remote.Head(target, r.client.remoteOpts(ctx)...)
+		var terr *transport.Error
+		switch {
+		case err == nil:
+			data.TargetExists = types.BoolValue(true)
+		case errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound:
+			data.TargetExists = types.BoolValue(false)
+		default:
+			return fmt.Errorf("checking for %s: %w", target, err)
+		}
+	}
+
+	if data.MovedTags.IsUnknown() {
+		moved := map[string]attr.Value{}
+		for _, t := range tags {
+			desc, err := remote.Head(target.Context().Tag(t), r.client.remoteOpts(ctx)...)
+			if err != nil {
+				var terr *transport.Error
+				if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+					continue
+				}
+				return fmt.Errorf("checking existing tag: %w", err)
+			}
+			if desc.Digest.String() != target.DigestStr() {
+				moved[t] = types.StringValue(desc.Digest.String())
+			}
+		}
+		data.MovedTags = types.MapValueMust(types.StringType, moved)
+	}
+	return nil
+}
+
+// Create is called when the provider must create a new resource.
+func (r *helmChartPromotionResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data helmChartPromotionResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	diags := r.do(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if diags.HasError() {
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *helmChartPromotionResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state helmChartPromotionResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseDigest(state.Target.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing target reference", err.Error())
+		return
+	}
+	if _, err := remote.Head(ref, r.client.remoteOpts(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			tflog.Warn(ctx, "promoted chart no longer exists in registry, removing from state", map[string]any{"ref": ref.String()})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		if registryUnreachable(err) {
+			resp.Diagnostics.Append(keepUnrefreshed(ctx, resp.Private, ref.String(), err)...)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+			return
+		}
+		resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+		return
+	}
+	resp.Diagnostics.Append(resp.Private.SetKey(ctx, unreachableKey, nil)...)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *helmChartPromotionResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data, state helmChartPromotionResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	diags := r.do(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if diags.HasError() {
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Delete removes the resource from state. Like helm_chart, promoted charts
+// are left in the registry.
+func (r *helmChartPromotionResource) Delete(context.Context, resource.DeleteRequest, *resource.DeleteResponse) {
+}
+
+func (r *helmChartPromotionResource) do(ctx context.Context, data *helmChartPromotionResourceModel) (ds diag.Diagnostics) {
+	ctx, throttled := withThrottleLog(ctx)
+	defer func() { ds = append(ds, throttled.diagnostics()...) }()
+
+	ref, err := chart.ParseDigest(data.Source.ValueString())
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("parsing source reference", err.Error()))
+		return ds
+	}
+	repo, err := name.NewRepository(data.Repo.ValueString())
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("parsing repository reference", err.Error()))
+		return ds
+	}
+	// Signatures and referrers are found by the sha256 digest, whichever
+	// the source is given by.
+	src, err := chart.SHA256Digest(ref, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("fetching source chart", err.Error()))
+		return ds
+	}
+
+	if !data.Verify.IsNull() && !data.Verify.IsUnknown() {
+		policy, diags := verifyPolicy(ctx, data.Verify)
+		if diags.HasError() {
+			return append(ds, diags...)
+		}
+		if err := chart.Verify(src, policy, r.client.remoteOpts(ctx)...); err != nil {
+			ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("verify"), "source chart fails verification", err.Error()+" Nothing was promoted."))
+			return ds
+		}
+	}
+
+	var tags []string
+	if !data.Tags.IsNull() && !data.Tags.IsUnknown() {
+		if diags := data.Tags.ElementsAs(ctx, &tags, false); diags != nil {
+			return diags
+		}
+	}
+	ds = append(ds, r.client.checkTags(ctx, repo, tags, src.DigestStr(), data.ImmutableTags.ValueBool())...)
+	if ds.HasError() {
+		return ds
+	}
+	// Record what was there before anything is copied, unless the plan did.
+	if err := r.preview(ctx, data, repo.Digest(src.DigestStr()), tags); err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("checking promotion target", err.Error()))
+		return ds
+	}
+
+	copied, err := chart.Copy(src, repo, r.client.remoteOpts(ctx)...)
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("promoting chart", err.Error()))
+		return ds
+	}
+
+	// A source given by sha512 digest is promoted to be found by it too.
+	target := chart.DigestRef(repo, ref.Identifier())
+	if len(tags) > 0 || ref.Identifier() != src.DigestStr() {
+		desc, err := remote.Get(repo.Digest(src.DigestStr()), r.client.remoteOpts(ctx)...)
+		if err != nil {
+			ds = append(ds, diag.NewErrorDiagnostic("fetching promoted chart", err.Error()))
+			return ds
+		}
+		if ref.Identifier() != src.DigestStr() {
+			if err := remote.Put(target, desc, r.client.remoteOpts(ctx)...); err != nil {
+				ds = append(ds, diag.NewErrorDiagnostic("promoting chart", err.Error()))
+				return ds
+			}
+		}
+		for _, t := range tags {
+			if err := remote.Tag(repo.Tag(t), desc, r.client.remoteOpts(ctx)...); err != nil {
+				ds = append(ds, diag.NewErrorDiagnostic("tagging chart", err.Error()))
+				return ds
+			}
+		}
+	}
+
+	referrers := make([]string, 0, len(copied))
+	for _, h := range copied {
+		referrers = append(referrers, h.String())
+	}
+	list, diags := types.ListValueFrom(ctx, types.StringType, referrers)
+	if diags.HasError() {
+		return append(ds, diags...)
+	}
+	data.Referrers = list
+	data.Digest = types.StringValue(ref.Identifier())
+	data.Target = types.StringValue(target.String())
+	data.ID = data.Target
+
+	if !data.Notify.IsNull() {
+		ds = append(ds, r.notify(ctx, data, target, tags)...)
+	}
+	return ds
+}
+
+// notify sends the promotion notification, reading the chart's name and
+// version from the promoted chart.
+func (r *helmChartPromotionResource) notify(ctx context.Context, data *helmChartPromotionResourceModel, target name.Reference, tags []string) diag.Diagnostics {
+	ev := notifyEvent{
+		Digest: target.Identifier(),
+		Repo:   target.Context().String(),
+		Ref:    target.String(),
+		Tags:   tags,
+	}
+	c, err := chart.Pull(target, r.client.remoteOpts(ctx)...)
+	if err == nil {
+		var md *helmchart.Metadata
+		if md, err = c.Metadata(); err == nil {
+			ev.Name, ev.Version = md.Name, md.Version
+		}
+	}
+	if err != nil {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("notify"), "notification failed", fmt.Sprintf("reading chart metadata: %v", err))}
+	}
+	return notify(ctx, data.Notify, ev)
+}
+
+// verifyPolicy converts the verify attribute to the policy chart.Verify
+// enforces.
+func verifyPolicy(ctx context.Context, obj types.Object) (chart.Policy, diag.Diagnostics) {
+	var v promotionVerifyModel
+	if diags := obj.As(ctx, &v, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return chart.Policy{}, diags
+	}
+
+	var p chart.Policy
+	if k := v.PublicKey.ValueString(); k != "" {
+		pub, err := chart.ParsePublicKey([]byte(k))
+		if err != nil {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("public_key"), "parsing public key", err.Error())}
+		}
+		p.PublicKey = pub
+	}
+	if roots := v.CertificateRoots.ValueString(); roots != "" {
+		p.Roots = x509.NewCertPool()
+		if !p.Roots.AppendCertsFromPEM([]byte(roots)) {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("certificate_roots"), "parsing certificate roots", "no PEM-encoded certificates found")}
+		}
+	}
+	if k := v.RekorPublicKey.ValueString(); k != "" {
+		pub, err := chart.ParsePublicKey([]byte(k))
+		if err != nil {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("rekor_public_key"), "parsing Rekor public key", err.Error())}
+		}
+		p.RekorKey = pub
+	}
+	if roots := v.TimestampRoots.ValueString(); roots != "" {
+		p.TimestampRoots = x509.NewCertPool()
+		if !p.TimestampRoots.AppendCertsFromPEM([]byte(roots)) {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("timestamp_authority_roots"), "parsing timestamp authority roots", "no PEM-encoded certificates found")}
+		}
+	}
+	if k := v.CTLogPublicKeys.ValueString(); k != "" {
+		keys, err := chart.ParsePublicKeys([]byte(k))
+		if err != nil {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("ct_log_public_keys"), "parsing certificate transparency log keys", err.Error())}
+		}
+		p.CTLogKeys = keys
+	}
+	if certs := v.TimestampCerts.ValueString(); certs != "" {
+		rest := []byte(certs)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("timestamp_authority_certificates"), "parsing timestamp authority certificates", err.Error())}
+			}
+			p.TimestampCerts = append(p.TimestampCerts, c)
+		}
+		if p.TimestampCerts == nil {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("timestamp_authority_certificates"), "parsing timestamp authority certificates", "no PEM-encoded certificates found")}
+		}
+	}
+	p.Identity = v.CertificateID.ValueString()
+	if re := v.CertificateIDRegex.ValueString(); re != "" {
+		var err error
+		if p.IdentityRegexp, err = regexp.Compile(re); err != nil {
+			return p, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("verify").AtName("certificate_identity_regexp"), "parsing certificate identity regexp", err.Error())}
+		}
+	}
+	p.Issuer = v.CertificateIssuer.ValueString()
+	if !v.RequiredPredicates.IsNull() && !v.RequiredPredicates.IsUnknown() {
+		if diags := v.RequiredPredicates.ElementsAs(ctx, &p.Predicates, false); diags.HasError() {
+			return p, diags
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/knownvalue"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/hashicorp/terraform-plugin-testing/tfjsonpath"
+)
+
+func TestAccHelmChartPromotionResource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	staging := reg.Repo("staging/chart")
+	release := reg.Repo("release/chart")
+
+	var sbom, sig v1.Hash
+	// attach signs the staged chart and attaches an SBOM to it, the way a
+	// release pipeline would between build and promotion.
+	attach := func(s *terraform.State) error {
+		ref, err := name.NewDigest(s.RootModule().Resources["helm_chart.staged"].Primary.Attributes["id"])
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(ref)
+		if err != nil {
+			return err
+		}
+		fallback := strings.Replace(ref.DigestStr(), ":", "-", 1)
+
+		img, ok := mutate.Subject(mutate.ConfigMediaType(empty.Image, "application/spdx+json"), *desc).(v1.Image)
+		if !ok {
+			return errors.New("SBOM with a subject isn't an image")
+		}
+		d, err := partial.Descriptor(img)
+		if err != nil {
+			return err
+		}
+		if err := remote.Write(ref.Context().Digest(d.Digest.String()), img); err != nil {
+			return err
+		}
+		d.ArtifactType = "application/spdx+json"
+		if err := remote.Put(ref.Context().Tag(fallback), mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img, Descriptor: *d})); err != nil {
+			return err
+		}
+		sbom = d.Digest
+
+		signature, err := random.Image(16, 1)
+		if err != nil {
+			return err
+		}
+		if sig, err = signature.Digest(); err != nil {
+			return err
+		}
+		return remote.Write(ref.Context().Tag(fallback+".sig"), signature)
+	}
+
+	config := func(promote bool) string {
+		c := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "staged" {
+  repo         = %q
+  package_name = "chart-basic"
+}
+`, staging)
+		if promote {
+			c += fmt.Sprintf(`
+resource "helm_chart_promotion" "test" {
+  source = helm_chart.staged.id
+  repo   = %q
+  tags   = ["stable"]
+}
+`, release)
+		}
+		return c
+	}
+
+	promoted := func(s *terraform.State) error {
+		target := s.RootModule().Resources["helm_chart_promotion.test"].Primary.Attributes["target"]
+		ref, err := name.NewDigest(target)
+		if err != nil {
+			return err
+		}
+
+		desc, err := remote.Head(ref.Context().Tag("stable"))
+		if err != nil {
+			return fmt.Errorf("fetching tag: %w", err)
+		}
+		if desc.Digest.String() != ref.DigestStr() {
+			return fmt.Errorf("stable = %s, want %s", desc.Digest, ref.DigestStr())
+		}
+
+		idx, err := remote.Referrers(ref)
+		if err != nil {
+			return fmt.Errorf("listing referrers: %w", err)
+		}
+		m, err := idx.IndexManifest()
+		if err != nil {
+			return err
+		}
+		if len(m.Manifests) != 1 || m.Manifests[0].Digest != sbom {
+			return fmt.Errorf("referrers = %v, want %s", m.Manifests, sbom)
+		}
+
+		desc, err = remote.Head(ref.Context().Tag(strings.Replace(ref.DigestStr(), ":", "-", 1) + ".sig"))
+		if err != nil {
+			return fmt.Errorf("fetching signature: %w", err)
+		}
+		if desc.Digest != sig {
+			return fmt.Errorf("signature = %s, want %s", desc.Digest, sig)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check:  attach,
+			},
+			{
+				Config: config(true),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("helm_chart_promotion.test", "digest", "helm_chart.staged", "digest"),
+					resource.TestCheckResourceAttrPair("helm_chart_promotion.test", "source", "helm_chart.staged", "id"),
+					resource.TestCheckResourceAttr("helm_chart_promotion.test", "referrers.#", "2"),
+					resource.TestCheckResourceAttrWith("helm_chart_promotion.test", "target", func(v string) error {
+						if !strings.HasPrefix(v, release+"@sha256:") {
+							return fmt.Errorf("target = %s, want it in %s", v, release)
+						}
+						return nil
+					}),
+					promoted,
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartPromotionResourcePreview(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	release := reg.Repo("release/chart")
+	old, err := random.Image(16, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	stable, err := name.NewTag(release + ":stable")
+	if err != nil {
+		t.Fatalf("failed to parse tag: %v", err)
+	}
+	if err := remote.Write(stable, old); err != nil {
+		t.Fatalf("failed to push image: %v", err)
+	}
+	oldDigest, err := old.Digest()
+	if err != nil {
+		t.Fatalf("failed to get digest: %v", err)
+	}
+
+	config := func(tags string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "staged" {
+  repo         = %q
+  package_name = "chart-basic"
+}
+
+resource "helm_chart_promotion" "test" {
+  source = helm_chart.staged.id
+  repo   = %q
+  tags   = %s
+}
+`, reg.Repo("staging/chart"), release, tags)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// The source is only known once the chart is built, so the
+				// target is looked at during apply.
+				Config: config(`["stable"]`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart_promotion.test", "target_exists", "false"),
+					resource.TestCheckResourceAttr("helm_chart_promotion.test", "moved_tags.stable", oldDigest.String()),
+				),
+			},
+			{
+				Config: config(`["stable", "latest"]`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectKnownValue("helm_chart_promotion.test", tfjsonpath.New("target_exists"), knownvalue.Bool(true)),
+						plancheck.ExpectKnownValue("helm_chart_promotion.test", tfjsonpath.New("moved_tags"), knownvalue.MapExact(map[string]knownvalue.Check{})),
+					},
+				},
+			},
+			{
+				Config:   config(`["stable", "latest"]`),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestAccHelmChartPromotionResourceVerify(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer := testkit.Signer{Key: key}
+	pub, err := signer.PublicKeyPEM()
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	var staged name.Digest
+	capture := func(s *terraform.State) (err error) {
+		staged, err = name.NewDigest(s.RootModule().Resources["helm_chart.staged"].Primary.Attributes["id"])
+		return err
+	}
+
+	config := func(promote bool) string {
+		c := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "staged" {
+  repo         = %q
+  package_name = "chart-basic"
+}
+`, reg.Repo("staging/chart"))
+		if promote {
+			c += fmt.Sprintf(`
+resource "helm_chart_promotion" "test" {
+  source = helm_chart.staged.id
+  repo   = %q
+  tags   = ["stable"]
+
+  verify = {
+    public_key          = %q
+    required_predicates = ["https://spdx.dev/Document"]
+  }
+}
+`, reg.Repo("release/chart"), pub)
+		}
+		return c
+	}
+
+	notPromoted := func(*terraform.State) error {
+		ref, err := name.NewTag(reg.Repo("release/chart") + ":stable")
+		if err != nil {
+			return err
+		}
+		if _, err := remote.Head(ref); err == nil {
+			return fmt.Errorf("chart was promoted without passing verification")
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check:  capture,
+			},
+			{
+				Config:      config(true),
+				ExpectError: regexp.MustCompile("is not signed"),
+			},
+			{
+				PreConfig: func() {
+					if err := signer.Sign(staged); err != nil {
+						t.Fatalf("failed to sign chart: %v", err)
+					}
+				},
+				Config:      config(true),
+				ExpectError: regexp.MustCompile("has no https://spdx.dev/Document"),
+			},
+			{
+				Config: config(false),
+				Check:  notPromoted,
+			},
+			{
+				PreConfig: func() {
+					if err := signer.Attest(staged, "https://spdx.dev/Document", map[string]string{"spdxVersion": "SPDX-2.3"}); err != nil {
+						t.Fatalf("failed to attest chart: %v", err)
+					}
+				},
+				Config: config(true),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("helm_chart_promotion.test", "digest", "helm_chart.staged", "digest"),
+					resource.TestCheckResourceAttr("helm_chart_promotion.test", "referrers.#", "2"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartPromotionResourceKeylessNeedsProof(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+resource "helm_chart_promotion" "test" {
+  source = %q
+  repo   = %q
+
+  verify = {
+    certificate_roots    = "roots"
+    certificate_identity = "https://github.com/example/repo/.github/workflows/release.yaml@refs/heads/main"
+    ct_log_public_keys   = "keys"
+  }
+}
+`, reg.Repo("staging/chart")+"@sha256:"+strings.Repeat("0", 64), reg.Repo("release/chart")),
+			ExpectError: regexp.MustCompile("certificate_roots needs rekor_public_key"),
+		}},
+	})
+}
+
+func TestAccHelmChartPromotionResourceKeylessNeedsCTLog(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+resource "helm_chart_promotion" "test" {
+  source = %q
+  repo   = %q
+
+  verify = {
+    certificate_roots           = "roots"
+    certificate_identity_regexp = "^https://github\\.com/example/repo/"
+    rekor_public_key            = "key"
+  }
+}
+`, reg.Repo("staging/chart")+"@sha256:"+strings.Repeat("0", 64), reg.Repo("release/chart")),
+			ExpectError: regexp.MustCompile("ct_log_public_keys must be set with certificate_roots"),
+		}},
+	})
+}
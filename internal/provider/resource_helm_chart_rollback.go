@@ -0,0 +1,239 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource              = &helmChartRollbackResource{}
+	_ resource.ResourceWithConfigure = &helmChartRollbackResource{}
+)
+
+// NewHelmChartRollbackResource is a helper function to simplify the provider implementation.
+func NewHelmChartRollbackResource() resource.Resource {
+	return &helmChartRollbackResource{}
+}
+
+// helmChartRollbackResource is the resource implementation.
+type helmChartRollbackResource struct {
+	client *helmClient
+}
+
+// helmChartRollbackResourceModel maps the resource schema data.
+type helmChartRollbackResourceModel struct {
+	ID       types.String `tfsdk:"id"`
+	Target   types.String `tfsdk:"target"`
+	Tags     types.List   `tfsdk:"tags"`
+	Replaced types.Map    `tfsdk:"replaced"`
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *helmChartRollbackResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*helmClient)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *helmClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// Metadata returns the resource type name.
+func (r *helmChartRollbackResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_chart_rollback"
+}
+
+// Schema defines the schema for the resource.
+func (r *helmChartRollbackResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Points tags back at an earlier chart, such as a `helm_chart` resource's `previous_digest`, for break-glass rollbacks. The chart and every tag are checked before any tag is moved, so a missing chart or an unreachable tag moves none of them. Tags moved later, for instance by the next release, are left alone.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Identifier for this resource, the same as `target`.",
+			},
+			"target": schema.StringAttribute{
+				Required:    true,
+				Description: "The chart to roll back to, by digest: `<repo>@sha256:<hex>`, e.g. `\"${helm_chart.example.repo}@${helm_chart.example.previous_digest}\"`. It must already be in the repo.",
+				Validators: []validator.String{
+					digestRefValidator{},
+				},
+			},
+			"tags": schema.ListAttribute{
+				Required:    true,
+				Description: "Tags in the target's repo to point at it.",
+				ElementType: types.StringType,
+				Validators: []validator.List{
+					elementsValidator{elem: tagValidator{}},
+				},
+			},
+			"replaced": schema.MapAttribute{
+				Computed:    true,
+				Description: "The digest each of `tags` pointed at before it was moved, for rolling forward again. Tags that didn't exist or already pointed at `target` are left out.",
+				ElementType: types.StringType,
+			},
+		},
+	}
+}
+
+// Create is called when the provider must create a new resource.
+func (r *helmChartRollbackResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data helmChartRollbackResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	diags := r.do(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if diags.HasError() {
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *helmChartRollbackResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state helmChartRollbackResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ref, err := chart.ParseDigest(state.Target.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("parsing target reference", err.Error())
+		return
+	}
+	if _, err := remote.Head(ref, r.client.remoteOpts(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			tflog.Warn(ctx, "rollback target no longer exists in registry, removing from state", map[string]any{"ref": ref.String()})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		if registryUnreachable(err) {
+			resp.Diagnostics.Append(keepUnrefreshed(ctx, resp.Private, ref.String(), err)...)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+			return
+		}
+		resp.Diagnostics.AddError("fetching chart from registry", err.Error())
+		return
+	}
+	resp.Diagnostics.Append(resp.Private.SetKey(ctx, unreachableKey, nil)...)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *helmChartRollbackResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data, state helmChartRollbackResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	diags := r.do(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if diags.HasError() {
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Delete removes the resource from state. The tags are left where they are.
+func (r *helmChartRollbackResource) Delete(context.Context, resource.DeleteRequest, *resource.DeleteResponse) {
+}
+
+func (r *helmChartRollbackResource) do(ctx context.Context, data *helmChartRollbackResourceModel) (ds diag.Diagnostics) {
+	ctx, throttled := withThrottleLog(ctx)
+	defer func() { ds = append(ds, throttled.diagnostics()...) }()
+
+	target, err := chart.ParseDigest(data.Target.ValueString())
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("parsing target reference", err.Error()))
+		return ds
+	}
+	var tags []string
+	if diags := data.Tags.ElementsAs(ctx, &tags, false); diags.HasError() {
+		return diags
+	}
+
+	desc, err := remote.Get(target, r.client.remoteOpts(ctx)...)
+	if err == nil {
+		err = chart.CheckManifest(target, desc.Manifest)
+	}
+	if err != nil {
+		ds = append(ds, diag.NewErrorDiagnostic("fetching rollback target", err.Error()+" No tags were moved."))
+		return ds
+	}
+
+	// Look every tag up before moving any, so a failure leaves them all as
+	// they were.
+	replaced := map[string]string{}
+	for _, t := range tags {
+		cur, err := remote.Head(target.Context().Tag(t), r.client.remoteOpts(ctx)...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			ds = append(ds, diag.NewErrorDiagnostic("checking existing tag", err.Error()+" No tags were moved."))
+			return ds
+		}
+		if cur.Digest != desc.Digest {
+			replaced[t] = cur.Digest.String()
+		}
+	}
+
+	var moved []string
+	for _, t := range tags {
+		if err := remote.Tag(target.Context().Tag(t), desc, r.client.remoteOpts(ctx)...); err != nil {
+			detail := err.Error()
+			if len(moved) > 0 {
+				detail += fmt.Sprintf(" These tags were already moved: %s.", strings.Join(moved, ", "))
+			}
+			ds = append(ds, diag.NewErrorDiagnostic("tagging chart", detail))
+			return ds
+		}
+		moved = append(moved, t)
+		tflog.Info(ctx, "rolled back tag", map[string]any{"tag": t, "digest": desc.Digest.String(), "replaced": replaced[t]})
+	}
+
+	m, diags := types.MapValueFrom(ctx, types.StringType, replaced)
+	if diags.HasError() {
+		return append(ds, diags...)
+	}
+	data.Replaced = m
+	data.ID = types.StringValue(target.String())
+	return ds
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+)
+
+func TestAccHelmChartRollbackResource(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(tag string, rollback bool) string {
+		c := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  tags         = ["stable"]
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = %q }])
+  }
+}
+`, reg.Repo("rollback"), tag)
+		if rollback {
+			c += `
+resource "helm_chart_rollback" "test" {
+  target = "${helm_chart.test.repo}@${helm_chart.test.previous_digest}"
+  tags   = ["stable"]
+}
+`
+		}
+		return c
+	}
+
+	// rolledBack checks that stable points at the chart's previous digest,
+	// and that the rollback recorded the current one as replaced.
+	rolledBack := func(s *terraform.State) error {
+		chart := s.RootModule().Resources["helm_chart.test"].Primary.Attributes
+		ref, err := name.NewDigest(chart["repo"] + "@" + chart["previous_digest"])
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(ref.Context().Tag("stable"))
+		if err != nil {
+			return fmt.Errorf("fetching tag: %w", err)
+		}
+		if desc.Digest.String() != ref.DigestStr() {
+			return fmt.Errorf("stable = %s, want %s", desc.Digest, ref.DigestStr())
+		}
+		if got := s.RootModule().Resources["helm_chart_rollback.test"].Primary.Attributes["replaced.stable"]; got != chart["digest"] {
+			return fmt.Errorf("replaced.stable = %q, want %q", got, chart["digest"])
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("v1", false),
+			},
+			{
+				Config: config("v2", false),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "previous_digest"),
+			},
+			{
+				Config: config("v2", true),
+				Check:  rolledBack,
+			},
+		},
+	})
+}
@@ -6,20 +6,38 @@ SPDX-License-Identifier: Apache-2.0
 package provider_test
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
 	helmprovider "github.com/chainguard-dev/terraform-provider-helm/internal/provider"
-	"github.com/chainguard-dev/terraform-provider-helm/internal/testutil"
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
 	"github.com/google/go-containerregistry/pkg/name"
 	registry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/knownvalue"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
 	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/hashicorp/terraform-plugin-testing/tfjsonpath"
 )
 
 var testAccProtoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServer, error){
@@ -47,7 +65,14 @@ func TestAccHelmChartResource(t *testing.T) {
 						resource.TestCheckResourceAttrSet(resourceName, "digest"),
 						resource.TestCheckResourceAttrSet(resourceName, "name"),
 						resource.TestCheckResourceAttrSet(resourceName, "chart_version"),
-						testAccCheckHelmChartExists(resourceName, "basic"),
+						resource.TestCheckResourceAttr(resourceName, "is_library", "false"),
+						resource.TestMatchResourceAttr(resourceName, "rendered_manifest_sha256", regexp.MustCompile("^[0-9a-f]{64}$")),
+						resource.TestCheckResourceAttr(resourceName, "annotations.thisshould", "bepreserved"),
+						resource.TestCheckResourceAttr(resourceName, "package_resolved_version", "0.0.1-r0"),
+						resource.TestCheckResourceAttrSet(resourceName, "package_checksum"),
+						resource.TestCheckResourceAttr(resourceName, "annotations.org.opencontainers.image.title", "basic"),
+						testAccCheckManifestJSON(resourceName),
+						testAccCheckHelmChartExists(t, resourceName, "basic"),
 					),
 				},
 			},
@@ -63,7 +88,8 @@ func TestAccHelmChartResource(t *testing.T) {
 						resource.TestCheckResourceAttrSet(resourceName, "digest"),
 						resource.TestCheckResourceAttrSet(resourceName, "name"),
 						resource.TestCheckResourceAttrSet(resourceName, "chart_version"),
-						testAccCheckHelmChartExists(resourceName, "basiclib"),
+						resource.TestCheckResourceAttr(resourceName, "is_library", "true"),
+						testAccCheckHelmChartExists(t, resourceName, "basiclib"),
 					),
 				},
 			},
@@ -122,7 +148,7 @@ resource "helm_chart" "test" {
 							ociRef := fmt.Sprintf("oci://%s@%s", repo, digest)
 
 							// Use shared test utility to pull and template the chart
-							helmChart, _, err := testutil.TestPullAndTemplateChart(ociRef, "basic", false)
+							helmChart, _, err := testkit.TestPullAndTemplateChart(t, ociRef, "basic", false)
 							if err != nil {
 								return err
 							}
@@ -199,7 +225,7 @@ resource "helm_chart" "test" {
 							digest := rs.Primary.Attributes["digest"]
 							ociRef := fmt.Sprintf("oci://%s@%s", repo, digest)
 
-							helmChart, _, err := testutil.TestPullAndTemplateChart(ociRef, "withimages", false)
+							helmChart, _, err := testkit.TestPullAndTemplateChart(t, ociRef, "withimages", false)
 							if err != nil {
 								return err
 							}
@@ -276,7 +302,47 @@ resource "helm_chart" "test" {
 
 // testAccCheckHelmChartExists verifies the chart was pushed correctly by using
 // helm libraries to pull and template the chart.
-func testAccCheckHelmChartExists(resourceName, expectedChartName string) resource.TestCheckFunc {
+// testAccCheckManifestJSON checks that manifest_json is the manifest at
+// digest, and that config_json is the config blob it references.
+func testAccCheckManifestJSON(resourceName string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+		raw := rs.Primary.Attributes["manifest_json"]
+		if got, want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(raw))), rs.Primary.Attributes["digest"]; got != want {
+			return fmt.Errorf("manifest_json digest = %s, want %s", got, want)
+		}
+		var m struct {
+			Config struct {
+				Digest string `json:"digest"`
+			} `json:"config"`
+			Layers []struct {
+				Digest string `json:"digest"`
+				Size   int64  `json:"size"`
+			} `json:"layers"`
+		}
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			return fmt.Errorf("parsing manifest_json: %w", err)
+		}
+		if got := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(rs.Primary.Attributes["config_json"]))); got != m.Config.Digest {
+			return fmt.Errorf("config_json digest = %s, want %s", got, m.Config.Digest)
+		}
+		if len(m.Layers) == 0 {
+			return fmt.Errorf("manifest_json has no layers")
+		}
+		if got, want := rs.Primary.Attributes["layer_digest"], m.Layers[0].Digest; got != want {
+			return fmt.Errorf("layer_digest = %s, want %s", got, want)
+		}
+		if got, want := rs.Primary.Attributes["layer_size"], fmt.Sprint(m.Layers[0].Size); got != want {
+			return fmt.Errorf("layer_size = %s, want %s", got, want)
+		}
+		return nil
+	}
+}
+
+func testAccCheckHelmChartExists(t *testing.T, resourceName, expectedChartName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		rs, ok := s.RootModule().Resources[resourceName]
 		if !ok {
@@ -295,7 +361,7 @@ func testAccCheckHelmChartExists(resourceName, expectedChartName string) resourc
 		ociRef := fmt.Sprintf("oci://%s@%s", repo, digest)
 
 		// Use shared test utility to pull and template the chart
-		helmChart, rel, err := testutil.TestPullAndTemplateChart(ociRef, expectedChartName, false)
+		helmChart, rel, err := testkit.TestPullAndTemplateChart(t, ociRef, expectedChartName, false)
 		if err != nil {
 			return err
 		}
@@ -323,3 +389,2267 @@ func testAccCheckHelmChartExists(resourceName, expectedChartName string) resourc
 		return nil
 	}
 }
+
+func TestAccHelmChartResourceRebuildOn(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	for _, tc := range []struct {
+		rebuildOn   string
+		wantRebuild bool
+	}{
+		{rebuildOn: "version", wantRebuild: false},
+		{rebuildOn: "revision", wantRebuild: true},
+	} {
+		t.Run(tc.rebuildOn, func(t *testing.T) {
+			repo, err := testkit.NewRepository(t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+			addRevision := func(version string) {
+				if err := repo.AddChart(testkit.ChartPackage{
+					Name:    "chart-versioned",
+					Version: version,
+					Chart:   os.DirFS("../../testdata/charts/versioned"),
+				}); err != nil {
+					t.Fatalf("failed to add package: %v", err)
+				}
+				if err := repo.Write(); err != nil {
+					t.Fatalf("failed to write repository: %v", err)
+				}
+			}
+			addRevision("0.0.1-r0")
+
+			config := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-versioned"
+  rebuild_on   = %q
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("rebuild-"+tc.rebuildOn), tc.rebuildOn)
+
+			resolved := "0.0.1-r0"
+			if tc.wantRebuild {
+				resolved = "0.0.1-r1"
+			}
+
+			resource.Test(t, resource.TestCase{
+				ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+				Steps: []resource.TestStep{
+					{
+						Config: config,
+						Check:  resource.TestCheckResourceAttr(resourceName, "package_resolved_version", "0.0.1-r0"),
+					},
+					{
+						PreConfig: func() { addRevision("0.0.1-r1") },
+						Config:    config,
+						PlanOnly:  !tc.wantRebuild,
+					},
+					{
+						Config: config,
+						Check:  resource.TestCheckResourceAttr(resourceName, "package_resolved_version", resolved),
+					},
+				},
+			})
+		})
+	}
+}
+
+func TestAccHelmChartResourceRepositoryPin(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	add := func(version string) {
+		if err := repo.AddChart(testkit.ChartPackage{
+			Name:    "chart-versioned",
+			Version: version,
+			Chart:   os.DirFS("../../testdata/charts/versioned"),
+		}); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatalf("failed to write repository: %v", err)
+		}
+	}
+	add("0.0.1-r0")
+
+	config := func(pin, version string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo            = %q
+  package_name    = "chart-versioned"
+  package_version = %s
+  repository_pin  = %q
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("pin"), version, pin)
+	}
+
+	var snapshot string
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("2026-01", "null"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "package_resolved_version", "0.0.1-r0"),
+					resource.TestCheckResourceAttr(resourceName, "package_repository", repo.Path()+"/"+testkit.DefaultArch),
+					resource.TestCheckResourceAttrWith(resourceName, "repository_snapshot", func(v string) error {
+						snapshot = v
+						return nil
+					}),
+				),
+			},
+			{
+				// The new version is held back by the pin.
+				PreConfig: func() { add("0.0.2-r0") },
+				Config:    config("2026-01", "null"),
+				PlanOnly:  true,
+			},
+			{
+				Config:      config("2026-01", `">=0.0.2"`),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`Change repository_pin as well`),
+			},
+			{
+				Config: config("2026-02", "null"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "package_resolved_version", "0.0.2-r0"),
+					resource.TestCheckResourceAttrWith(resourceName, "repository_snapshot", func(v string) error {
+						if v == snapshot {
+							return fmt.Errorf("repository_snapshot unchanged after bumping the pin: %s", v)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourcePackageChecksum(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	build := func(description string) {
+		if err := repo.AddChart(testkit.ChartPackage{
+			Name:    "chart-rebuilt",
+			Version: "0.0.1-r0",
+			Chart: fstest.MapFS{
+				"Chart.yaml": {Data: []byte("apiVersion: v2\nname: rebuilt\nversion: 0.0.1\ndescription: " + description + "\n")},
+			},
+		}); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatalf("failed to write repository: %v", err)
+		}
+	}
+	build("first build")
+
+	config := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-rebuilt"
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("checksum"))
+
+	var first string
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.TestCheckResourceAttrWith(resourceName, "package_checksum", func(v string) error {
+					first = v
+					return nil
+				}),
+			},
+			{
+				PreConfig: func() { build("second build") },
+				Config:    config,
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectResourceAction(resourceName, plancheck.ResourceActionReplace),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "package_resolved_version", "0.0.1-r0"),
+					resource.TestCheckResourceAttrWith(resourceName, "package_checksum", func(v string) error {
+						if v == first {
+							return fmt.Errorf("package_checksum unchanged after rebuild: %s", v)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceLockfile(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{
+		Name:    "chart-basic",
+		Version: "0.0.1-r0",
+		Chart:   os.DirFS("../../testdata/charts/basic"),
+	}); err != nil {
+		t.Fatalf("failed to add package: %v", err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	lockfile := filepath.Join(t.TempDir(), "chart.lock.json")
+
+	config := func(attr string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  %s = %q
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("lockfile"), attr, lockfile)
+	}
+
+	var digest string
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("output_lockfile_path"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrWith(resourceName, "digest", func(v string) error {
+						digest = v
+						return nil
+					}),
+					func(*terraform.State) error {
+						_, err := os.Stat(lockfile)
+						return err
+					},
+				),
+			},
+			{
+				// Removing the repository proves the rebuild comes from the lock.
+				PreConfig: func() {
+					if err := os.Remove(filepath.Join(repo.Path(), testkit.DefaultArch, "APKINDEX.tar.gz")); err != nil {
+						t.Fatalf("failed to remove index: %v", err)
+					}
+				},
+				Config: config("resolved_lockfile"),
+				Check: resource.TestCheckResourceAttrWith(resourceName, "digest", func(v string) error {
+					if v != digest {
+						return fmt.Errorf("digest rebuilt from lockfile = %s, want %s", v, digest)
+					}
+					return nil
+				}),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceMirrorRepos(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	mirrors := []string{reg.Repo("mirror/a"), reg.Repo("mirror/b")}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  mirror_repos = [%q, %q]
+  package_name = "chart-basic"
+}
+`, reg.Repo("primary"), mirrors[0], mirrors[1]),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckHelmChartExists(t, "helm_chart.test", "basic"),
+					func(s *terraform.State) error {
+						digest := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["digest"]
+						for _, m := range mirrors {
+							ref, err := name.NewDigest(m + "@" + digest)
+							if err != nil {
+								return err
+							}
+							if _, err := remote.Head(ref); err != nil {
+								return fmt.Errorf("chart not pushed to mirror %s: %w", m, err)
+							}
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceDigestKnownAtPlan(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	var digest string
+	sameDigest := knownvalue.StringFunc(func(v string) error {
+		if v != digest {
+			return fmt.Errorf("planned digest = %s, want %s", v, digest)
+		}
+		return nil
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmChartConfig(reg.Repo("before"), "chart-basic"),
+				Check: resource.TestCheckResourceAttrWith(resourceName, "digest", func(v string) error {
+					digest = v
+					return nil
+				}),
+			},
+			{
+				// Moving the chart doesn't change what's built, so the digest
+				// and the new ID are known before apply.
+				Config: testAccHelmChartConfig(reg.Repo("after"), "chart-basic"),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectResourceAction(resourceName, plancheck.ResourceActionUpdate),
+						plancheck.ExpectKnownValue(resourceName, tfjsonpath.New("digest"), sameDigest),
+						plancheck.ExpectKnownValue(resourceName, tfjsonpath.New("id"), knownvalue.StringFunc(func(v string) error {
+							if want := reg.Repo("after") + "@" + digest; v != want {
+								return fmt.Errorf("planned id = %s, want %s", v, want)
+							}
+							return nil
+						})),
+					},
+				},
+				Check: testAccCheckHelmChartExists(t, resourceName, "basic"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceRepublish(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	readme := filepath.Join(t.TempDir(), "README.md")
+	if err := os.WriteFile(readme, []byte("before\n"), 0o644); err != nil {
+		t.Fatalf("failed to write readme: %v", err)
+	}
+	config := func(repo string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+
+  readme = {
+    file = %q
+  }
+}
+`, repo, readme)
+	}
+
+	var digest string
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(reg.Repo("before")),
+				Check: resource.TestCheckResourceAttrWith("helm_chart.test", "digest", func(v string) error {
+					digest = v
+					return nil
+				}),
+			},
+			{
+				// A changed file alone doesn't rebuild the chart, so moving
+				// it pushes the chart in state, at the digest planned.
+				PreConfig: func() {
+					if err := os.WriteFile(readme, []byte("after\n"), 0o644); err != nil {
+						t.Fatalf("failed to write readme: %v", err)
+					}
+				},
+				Config: config(reg.Repo("after")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrWith("helm_chart.test", "digest", func(v string) error {
+						if v != digest {
+							return fmt.Errorf("digest = %s, want %s", v, digest)
+						}
+						return nil
+					}),
+					testAccCheckHelmChartExists(t, "helm_chart.test", "basic"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceCreatedBuildTime(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(tags string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  created      = "build"
+  tags         = %s
+}
+`, reg.Repo("created"), tags)
+	}
+
+	var digest, created string
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(`[]`),
+				Check: func(s *terraform.State) error {
+					attrs := s.RootModule().Resources["helm_chart.test"].Primary.Attributes
+					digest, created = attrs["digest"], attrs["annotations.org.opencontainers.image.created"]
+					if _, err := time.Parse(time.RFC3339, created); err != nil {
+						return fmt.Errorf("created annotation: %w", err)
+					}
+					return nil
+				},
+			},
+			{
+				// Tagging doesn't rebuild the chart, so it keeps its build
+				// time and digest.
+				PreConfig: func() { time.Sleep(time.Second) },
+				Config:    config(`["stable"]`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectKnownValue("helm_chart.test", tfjsonpath.New("digest"), knownvalue.StringFunc(func(v string) error {
+							if v != digest {
+								return fmt.Errorf("planned digest = %s, want %s", v, digest)
+							}
+							return nil
+						})),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrWith("helm_chart.test", "digest", func(v string) error {
+						if v != digest {
+							return fmt.Errorf("digest = %s, want %s", v, digest)
+						}
+						return nil
+					}),
+					resource.TestCheckResourceAttrWith("helm_chart.test", "annotations.org.opencontainers.image.created", func(v string) error {
+						if v != created {
+							return fmt.Errorf("created = %s, want %s", v, created)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceIDFormat(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+
+	config := func(repo string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  id_format    = "chart"
+  tags         = ["0.0.1"]
+}
+`, repo)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(reg.Repo("before")),
+				Check:  resource.TestCheckResourceAttr(resourceName, "id", "basic:0.0.1"),
+			},
+			{
+				Config: config(reg.Repo("after")),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectKnownValue(resourceName, tfjsonpath.New("id"), knownvalue.StringExact("basic:0.0.1")),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "id", "basic:0.0.1"),
+					testAccCheckHelmChartExists(t, resourceName, "basic"),
+				),
+			},
+			{
+				ResourceName: resourceName,
+				ImportState:  true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					rs := s.RootModule().Resources[resourceName]
+					return rs.Primary.Attributes["repo"] + "@" + rs.Primary.Attributes["digest"], nil
+				},
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					if len(states) != 1 {
+						return fmt.Errorf("imported %d resources, want 1", len(states))
+					}
+					if got, want := states[0].Attributes["repo"], reg.Repo("after"); got != want {
+						return fmt.Errorf("imported repo = %s, want %s", got, want)
+					}
+					if got := states[0].Attributes["name"]; got != "basic" {
+						return fmt.Errorf("imported name = %s, want basic", got)
+					}
+					return nil
+				},
+			},
+			{
+				// By version tag, with the chart-style ID.
+				ResourceName:  resourceName,
+				ImportState:   true,
+				ImportStateId: reg.Repo("after") + ",basic:0.0.1",
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					if len(states) != 1 {
+						return fmt.Errorf("imported %d resources, want 1", len(states))
+					}
+					attrs := states[0].Attributes
+					if attrs["id"] != "basic:0.0.1" || attrs["id_format"] != "chart" {
+						return fmt.Errorf("imported id = %s, id_format = %s, want basic:0.0.1 and chart", attrs["id"], attrs["id_format"])
+					}
+					if !strings.HasPrefix(attrs["digest"], "sha256:") {
+						return fmt.Errorf("imported digest = %s", attrs["digest"])
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceTags(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+	repo := reg.Repo("tags")
+
+	config := func(tag string, immutable bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo           = %q
+  package_name   = "chart-basic"
+  tags           = ["stable"]
+  immutable_tags = %t
+
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = %q }])
+  }
+}
+`, repo, immutable, tag)
+	}
+
+	tagged := func(s *terraform.State) error {
+		digest := s.RootModule().Resources[resourceName].Primary.Attributes["digest"]
+		ref, err := name.NewTag(repo + ":stable")
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(ref)
+		if err != nil {
+			return fmt.Errorf("fetching tag: %w", err)
+		}
+		if desc.Digest.String() != digest {
+			return fmt.Errorf("stable = %s, want %s", desc.Digest, digest)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("one", true),
+				Check:  tagged,
+			},
+			{
+				Config:      config("two", true),
+				ExpectError: regexp.MustCompile("tag already exists"),
+			},
+			{
+				Config: config("two", false),
+				Check:  tagged,
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceDeprecated(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resourceName := "helm_chart.test"
+	repo := reg.Repo("deprecated")
+
+	config := func(deprecated bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo           = %q
+  package_name   = "chart-basic"
+  tags           = ["latest"]
+  immutable_tags = true
+  deprecated     = %t
+  tombstone_tag  = "latest"
+}
+`, repo, deprecated)
+	}
+
+	var first string
+	tagged := func(s *terraform.State) error {
+		digest := s.RootModule().Resources[resourceName].Primary.Attributes["digest"]
+		if first == "" {
+			first = digest
+		}
+		ref, err := name.NewTag(repo + ":latest")
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(ref)
+		if err != nil {
+			return fmt.Errorf("fetching tag: %w", err)
+		}
+		if desc.Digest.String() != digest {
+			return fmt.Errorf("latest = %s, want %s", desc.Digest, digest)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckNoResourceAttr(resourceName, "annotations.io.artifacthub.package.deprecated"),
+					tagged,
+				),
+			},
+			{
+				// Deprecating rebuilds the chart, and the tombstone tag moves
+				// onto it despite immutable_tags.
+				Config: config(true),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "annotations.io.artifacthub.package.deprecated", "true"),
+					tagged,
+					func(s *terraform.State) error {
+						if s.RootModule().Resources[resourceName].Primary.Attributes["digest"] == first {
+							return fmt.Errorf("deprecating didn't change the digest")
+						}
+						id := s.RootModule().Resources[resourceName].Primary.Attributes["id"]
+						helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+						if err != nil {
+							return err
+						}
+						if !helmChart.Metadata.Deprecated {
+							return fmt.Errorf("chart is not deprecated")
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceSkipIfExists(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo := reg.Repo("skip-if-exists")
+	config := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "published" {
+  repo         = %[1]q
+  package_name = "chart-basic"
+  tags         = ["0.0.1"]
+
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = "one" }])
+  }
+}
+
+# Adopts the chart tagged above, so its patch is never applied.
+resource "helm_chart" "adopted" {
+  repo           = %[1]q
+  package_name   = "chart-basic"
+  skip_if_exists = true
+
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = "two" }])
+  }
+
+  depends_on = [helm_chart.published]
+}
+
+# Nothing is tagged here, so the chart is built.
+resource "helm_chart" "built" {
+  repo           = %[2]q
+  package_name   = "chart-basic"
+  skip_if_exists = true
+
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = "two" }])
+  }
+}
+`, repo, reg.Repo("skip-if-exists-empty"))
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("helm_chart.adopted", "digest", "helm_chart.published", "digest"),
+					resource.TestCheckResourceAttr("helm_chart.adopted", "chart_version", "0.0.1"),
+					resource.TestCheckResourceAttr("helm_chart.adopted", "package_resolved_version", "0.0.1-r0"),
+					func(s *terraform.State) error {
+						published := s.RootModule().Resources["helm_chart.published"].Primary.Attributes["digest"]
+						built := s.RootModule().Resources["helm_chart.built"].Primary.Attributes["digest"]
+						if built == "" || built == published {
+							return fmt.Errorf("built digest = %q, want one other than %s", built, published)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceNotify(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	var (
+		mu       sync.Mutex
+		received []map[string]any
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, body)
+	}))
+	defer hook.Close()
+
+	resourceName := "helm_chart.test"
+	repo := reg.Repo("notify")
+
+	notified := func(s *terraform.State) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(received) != 1 {
+			return fmt.Errorf("received %d notifications, want 1", len(received))
+		}
+		attrs := s.RootModule().Resources[resourceName].Primary.Attributes
+		want := map[string]any{
+			"text":   "basic " + attrs["chart_version"] + " from chart-basic-0.0.1-r0",
+			"ref":    repo + "@" + attrs["digest"],
+			"tags":   []any{"stable"},
+			"digest": attrs["digest"],
+		}
+		if got := received[0]; !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("notification = %v, want %v", got, want)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  tags         = ["stable"]
+
+  notify = {
+    url     = %q
+    payload = <<-EOT
+      {
+        "text": {{ json (printf "%%s %%s from %%s-%%s" .Name .Version .PackageName .PackageVersion) }},
+        "ref": {{ json .Ref }},
+        "tags": {{ json .Tags }},
+        "digest": {{ json .Digest }}
+      }
+    EOT
+  }
+}
+`, repo, hook.URL),
+				Check: notified,
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceReadmeNotes(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	notes := filepath.Join(t.TempDir(), "NOTES.txt")
+	if err := os.WriteFile(notes, []byte("${name} ${version} installed as {{ .Release.Name }}.\n"), 0o644); err != nil {
+		t.Fatalf("failed to write notes: %v", err)
+	}
+
+	config := fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+
+  readme = {
+    content = "# $${name}\n\nSupport: support@example.com\n"
+  }
+  notes = {
+    file   = %q
+    append = true
+  }
+}
+`, reg.Repo("readme"), notes)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: strings.Replace(config, `file   = `, `content = "x"
+    file    = `, 1),
+				ExpectError: regexp.MustCompile("Exactly one of content or file must be set"),
+			},
+			{
+				Config: config,
+				Check: func(s *terraform.State) error {
+					id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+					helmChart, rel, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", false)
+					if err != nil {
+						return err
+					}
+					var readme string
+					for _, f := range helmChart.Files {
+						if f.Name == "README.md" {
+							readme = string(f.Data)
+						}
+					}
+					if want := "# basic\n\nSupport: support@example.com\n"; readme != want {
+						return fmt.Errorf("README.md = %q, want %q", readme, want)
+					}
+					if want := "basic 0.0.1 installed as test-release."; strings.TrimSpace(rel.Info.Notes) != want {
+						return fmt.Errorf("notes = %q, want %q", rel.Info.Notes, want)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceValuesDocs(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  values_docs  = true
+
+  readme = {
+    content = "# $${name}\n\n{{ template \"chart.valuesSection\" . }}\n\nSupport: support@example.com\n"
+  }
+}
+`, reg.Repo("values-docs")),
+				Check: func(s *terraform.State) error {
+					id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+					helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+					if err != nil {
+						return err
+					}
+					for _, f := range helmChart.Files {
+						if f.Name != "README.md" {
+							continue
+						}
+						if !strings.Contains(string(f.Data), "## Values\n\n| Key | Type | Default | Description |") ||
+							!strings.Contains(string(f.Data), "| image.repository | string | `\"foobear\"` |  |") ||
+							!strings.HasSuffix(string(f.Data), "\nSupport: support@example.com\n") {
+							return fmt.Errorf("README.md has no values table:\n%s", f.Data)
+						}
+						return nil
+					}
+					return fmt.Errorf("chart has no README.md")
+				},
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceIcon(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"/>`
+	icon := filepath.Join(t.TempDir(), "icon.svg")
+	if err := os.WriteFile(icon, []byte(svg), 0o644); err != nil {
+		t.Fatalf("failed to write icon: %v", err)
+	}
+
+	config := func(icon string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  icon         = %s
+}
+`, reg.Repo("icon"), icon)
+	}
+
+	hasIcon := func(want string) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+			helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+			if err != nil {
+				return err
+			}
+			if helmChart.Metadata.Icon != want {
+				return fmt.Errorf("icon = %q, want %q", helmChart.Metadata.Icon, want)
+			}
+			return nil
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(fmt.Sprintf(`{ file = %q }`, icon)),
+				Check:  hasIcon("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))),
+			},
+			{
+				Config: config(`{ url = "https://cdn.example.com/icons/$${name}.svg" }`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectUnknownValue("helm_chart.test", tfjsonpath.New("digest")),
+					},
+				},
+				Check: hasIcon("https://cdn.example.com/icons/basic.svg"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceMaintainers(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(appendMaintainers bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo               = %q
+  package_name       = "chart-basic"
+  append_maintainers = %t
+  json_patches = {
+    "Chart.yaml" = jsonencode([{ op = "add", path = "/maintainers", value = [{ name = "upstream" }] }])
+  }
+
+  maintainers = [{
+    name  = "Support"
+    email = "support@example.com"
+  }]
+}
+`, reg.Repo("maintainers"), appendMaintainers)
+	}
+
+	hasMaintainers := func(want ...string) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+			helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+			if err != nil {
+				return err
+			}
+			var got []string
+			for _, m := range helmChart.Metadata.Maintainers {
+				got = append(got, m.Name)
+			}
+			if !slices.Equal(got, want) {
+				return fmt.Errorf("maintainers = %v, want %v", got, want)
+			}
+			return nil
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check:  hasMaintainers("Support"),
+			},
+			{
+				Config: config(true),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectUnknownValue("helm_chart.test", tfjsonpath.New("digest")),
+					},
+				},
+				Check: hasMaintainers("upstream", "Support"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceCatalogMetadata(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(keywords string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  keywords     = %s
+  home         = "https://example.com/charts/$${name}"
+  sources      = ["https://github.com/example/$${name}"]
+}
+`, reg.Repo("catalog"), keywords)
+	}
+
+	hasKeywords := func(want ...string) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+			helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+			if err != nil {
+				return err
+			}
+			md := helmChart.Metadata
+			if !slices.Equal(md.Keywords, want) {
+				return fmt.Errorf("keywords = %v, want %v", md.Keywords, want)
+			}
+			if md.Home != "https://example.com/charts/basic" {
+				return fmt.Errorf("home = %q", md.Home)
+			}
+			return nil
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(`["web", "hardened"]`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "annotations.org.opencontainers.image.source", "https://github.com/example/basic"),
+					hasKeywords("web", "hardened"),
+				),
+			},
+			{
+				Config: config(`[]`),
+				Check:  hasKeywords(),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceLicense(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(patches string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo            = %q
+  package_name    = "chart-basic"
+  require_license = true
+  json_patches    = %s
+
+  license = {
+    content = "Apache License, Version 2.0"
+  }
+}
+`, reg.Repo("license"), patches)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(`{}`),
+				ExpectError: regexp.MustCompile("chart has no license"),
+			},
+			{
+				Config: config(`{
+    "Chart.yaml" = jsonencode([{ op = "add", path = "/annotations/licenses", value = "Apache-2.0" }])
+  }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "annotations.licenses", "Apache-2.0"),
+					func(s *terraform.State) error {
+						id := s.RootModule().Resources["helm_chart.test"].Primary.Attributes["id"]
+						helmChart, _, err := testkit.TestPullAndTemplateChart(t, "oci://"+id, "basic", true)
+						if err != nil {
+							return err
+						}
+						for _, f := range helmChart.Files {
+							if f.Name == "LICENSE" && string(f.Data) == "Apache License, Version 2.0" {
+								return nil
+							}
+						}
+						return fmt.Errorf("chart has no LICENSE")
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceForbidLibrary(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(pkg string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo                  = %q
+  package_name          = %q
+  forbid_library_charts = true
+}
+`, reg.Repo("forbid-library"), pkg)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config("chart-basiclibrary"),
+				ExpectError: regexp.MustCompile("library charts are forbidden"),
+			},
+			{
+				Config: config("chart-basic"),
+				Check:  resource.TestCheckResourceAttr("helm_chart.test", "is_library", "false"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceCheckUpgrades(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(patches string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo           = %q
+  package_name   = "chart-withimages"
+  check_upgrades = true
+  json_patches   = %s
+}
+`, reg.Repo("check-upgrades"), patches)
+	}
+
+	// Which changes are flagged is tested in the chart package; this checks
+	// the planned chart is built and compared without getting in the way.
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(`{}`),
+			},
+			{
+				Config: config(`{
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = "v2" }])
+  }`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectUnknownValue("helm_chart.test", tfjsonpath.New("digest")),
+					},
+				},
+				Check: resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceDiffPrevious(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(patches string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo          = %q
+  package_name  = "chart-basic"
+  diff_previous = true
+  json_patches  = %s
+}
+`, reg.Repo("diff-previous"), patches)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(`{}`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckNoResourceAttr("helm_chart.test", "chart_diff"),
+					resource.TestCheckNoResourceAttr("helm_chart.test", "previous_digest"),
+				),
+			},
+			{
+				Config: config(`{
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = "v2" }])
+  }`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectKnownValue("helm_chart.test", tfjsonpath.New("chart_diff"), knownvalue.ObjectPartial(map[string]knownvalue.Check{
+							"added":   knownvalue.ListExact([]knownvalue.Check{}),
+							"removed": knownvalue.ListExact([]knownvalue.Check{}),
+							"changed": knownvalue.ListExact([]knownvalue.Check{knownvalue.StringExact("values.yaml")}),
+						})),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "chart_diff.changed.0", "values.yaml"),
+					resource.TestCheckResourceAttrPair("helm_chart.test", "previous_digest", "helm_chart.test", "chart_diff.previous_digest"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceKeepDigests(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(tag string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  keep_digests = 2
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = %q }])
+  }
+}
+`, reg.Repo("keep-digests"), tag)
+	}
+
+	var first string
+	pruned := func(s *terraform.State) error {
+		attrs := s.RootModule().Resources["helm_chart.test"].Primary.Attributes
+		ref, err := name.NewDigest(attrs["repo"] + "@" + first)
+		if err != nil {
+			return err
+		}
+		if _, err := remote.Head(ref); err == nil {
+			return fmt.Errorf("%s still exists", ref)
+		}
+		if attrs["retained_digests.0"] != attrs["digest"] || attrs["retained_digests.1"] != attrs["previous_digest"] {
+			return fmt.Errorf("retained_digests = [%s %s], want [%s %s]", attrs["retained_digests.0"], attrs["retained_digests.1"], attrs["digest"], attrs["previous_digest"])
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("v1"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "retained_digests.#", "1"),
+					func(s *terraform.State) error {
+						first = s.RootModule().Resources["helm_chart.test"].Primary.Attributes["digest"]
+						return nil
+					},
+				),
+			},
+			{
+				Config: config("v2"),
+				Check:  resource.TestCheckResourceAttr("helm_chart.test", "retained_digests.#", "2"),
+			},
+			{
+				Config: config("v3"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "retained_digests.#", "2"),
+					pruned,
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceKeepDigestsTagged(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(tag string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  keep_digests = 1
+  tags         = [%[2]q]
+  json_patches = {
+    "values.yaml" = jsonencode([{ op = "replace", path = "/image/tag", value = %[2]q }])
+  }
+}
+`, reg.Repo("keep-digests-tagged"), tag)
+	}
+
+	var first, second string
+	exists := func(digest *string) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			ref, err := name.NewDigest(s.RootModule().Resources["helm_chart.test"].Primary.Attributes["repo"] + "@" + *digest)
+			if err != nil {
+				return err
+			}
+			_, err = remote.Head(ref)
+			return err
+		}
+	}
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("v1"),
+				Check: func(s *terraform.State) error {
+					first = s.RootModule().Resources["helm_chart.test"].Primary.Attributes["digest"]
+					return nil
+				},
+			},
+			{
+				// v1 is still tagged, so isn't deleted, nor retained.
+				Config: config("v2"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "retained_digests.#", "1"),
+					exists(&first),
+					func(s *terraform.State) error {
+						second = s.RootModule().Resources["helm_chart.test"].Primary.Attributes["digest"]
+						return nil
+					},
+				),
+			},
+			{
+				// v2 is only tagged by someone else, which keeps it too.
+				PreConfig: func() {
+					ref, err := name.NewDigest(reg.Repo("keep-digests-tagged") + "@" + second)
+					if err != nil {
+						t.Fatal(err)
+					}
+					desc, err := remote.Get(ref)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := remote.Tag(ref.Context().Tag("pinned"), desc); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config("v3"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "retained_digests.#", "1"),
+					exists(&second),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceUnitTests(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(image string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+
+  unit_tests = {
+    suites = {
+      "deployment_test.yaml" = yamlencode({
+        suite = "deployment"
+        tests = [{
+          it      = "runs the image"
+          asserts = [{ equal = { path = "spec.template.spec.containers[0].image", value = %q } }]
+        }]
+      })
+    }
+  }
+}
+`, reg.Repo("unit-tests"), image)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config("nginx:latest"),
+				ExpectError: regexp.MustCompile(`(?s)chart fails unit tests.*deployment: runs the image: assertion 1 \(equal\)`),
+			},
+			{
+				Config: config("foobear:foobar"),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceScan(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(scan string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+  scan         = %s
+}
+`, reg.Repo("scan"), scan)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// The basic chart sets no security context, so its root
+				// file system is writable.
+				Config:      config(`{}`),
+				ExpectError: regexp.MustCompile(`(?s)chart fails misconfiguration lint.*writable-root-fs`),
+			},
+			{
+				Config: config(`{
+    fail_on     = "CRITICAL"
+    warn_on     = "MEDIUM"
+    skip_checks = ["capabilities-not-dropped"]
+  }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.#", "5"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.0.id", "writable-root-fs"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.0.severity", "HIGH"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.0.resource", "Deployment/release"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.0.container", "basic"),
+				),
+			},
+			{
+				// New scan settings rescan the same chart.
+				Config: config(`{
+    skip_checks = ["writable-root-fs"]
+    values      = yamlencode({ image = { tag = "latest" } })
+  }`),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectKnownValue("helm_chart.test", tfjsonpath.New("digest"), knownvalue.NotNull()),
+						plancheck.ExpectUnknownValue("helm_chart.test", tfjsonpath.New("scan_findings")),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.#", "6"),
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.0.id", "latest-tag"),
+					resource.TestCheckTypeSetElemNestedAttrs("helm_chart.test", "scan_findings.*", map[string]string{"id": "privilege-escalation"}),
+					resource.TestCheckNoResourceAttr("helm_chart.test", "scan_attestation"),
+				),
+			},
+			{
+				Config: config(`{
+    fail_on = "CRITICAL"
+    attest  = true
+  }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "scan_findings.#", "6"),
+					func(s *terraform.State) error {
+						attrs := s.RootModule().Resources["helm_chart.test"].Primary.Attributes
+						ref, err := name.NewDigest(attrs["id"])
+						if err != nil {
+							return err
+						}
+						idx, err := remote.Referrers(ref)
+						if err != nil {
+							return fmt.Errorf("listing referrers: %w", err)
+						}
+						m, err := idx.IndexManifest()
+						if err != nil {
+							return err
+						}
+						for _, d := range m.Manifests {
+							if d.Digest.String() == attrs["scan_attestation"] && d.ArtifactType == "application/vnd.in-toto+json" {
+								return nil
+							}
+						}
+						return fmt.Errorf("referrers = %v, want scan attestation %s", m.Manifests, attrs["scan_attestation"])
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourcePrePushCommand(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	out := filepath.Join(t.TempDir(), "checked")
+	config := func(script string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo             = %q
+  package_name     = "chart-basic"
+  pre_push_command = ["sh", "-c", %q, "check"]
+}
+`, reg.Repo("pre-push"), script)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(`echo "policy violation: no resource limits" >&2; exit 3`),
+				ExpectError: regexp.MustCompile("policy violation"),
+			},
+			{
+				// The archive is the last argument, and the same file as
+				// $CHART_TGZ, next to the unpacked chart.
+				Config: config(`test "$1" = "$CHART_TGZ" && tar -tzf "$1" >/dev/null && cp "$CHART_DIR/Chart.yaml" ` + out),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+					func(*terraform.State) error {
+						b, err := os.ReadFile(out)
+						if err != nil {
+							return fmt.Errorf("command did not see the chart: %w", err)
+						}
+						if !strings.Contains(string(b), "name: basic") {
+							return fmt.Errorf("CHART_DIR Chart.yaml = %q, want the basic chart", b)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceVerifyArchs(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	add := func(arch, description string) {
+		if err := repo.AddChart(testkit.ChartPackage{
+			Name:    "chart-multiarch",
+			Version: "0.0.1-r0",
+			Arch:    arch,
+			Chart: fstest.MapFS{
+				"Chart.yaml": {Data: []byte("apiVersion: v2\nname: multiarch\nversion: 0.0.1\ndescription: " + description + "\n")},
+			},
+		}); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+		if err := repo.Write(); err != nil {
+			t.Fatalf("failed to write repository: %v", err)
+		}
+	}
+	add("x86_64", "same")
+	add("aarch64", "different")
+
+	config := func(verify string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-multiarch"
+  package_arch = "x86_64"
+  verify_archs = %s
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("multiarch"), verify)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config("null"),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+			{
+				Config:      config(`["arm64"]`),
+				ExpectError: regexp.MustCompile(`chart-multiarch-0.0.1-r0 \(aarch64\) it is`),
+			},
+			{
+				PreConfig: func() { add("aarch64", "same") },
+				Config:    config(`["arm64"]`),
+				Check:     resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceStaleness(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	for _, v := range []string{"0.0.1-r0", "0.0.2-r0", "0.0.3-r0"} {
+		if err := repo.AddChart(testkit.ChartPackage{
+			Name:    "chart-versioned",
+			Version: v,
+			Chart:   os.DirFS("../../testdata/charts/versioned"),
+		}); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	config := func(maxBehind int, fail bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo                = %q
+  package_name        = "chart-versioned"
+  package_version     = "0.0.1-r0"
+  max_versions_behind = %d
+  fail_when_stale     = %t
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("staleness"), maxBehind, fail)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(1, true),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`package is stale`),
+			},
+			{
+				Config: config(2, true),
+				Check:  resource.TestCheckResourceAttr("helm_chart.test", "package_resolved_version", "0.0.1-r0"),
+			},
+			{
+				// Over the limit, but only warned about.
+				Config: config(0, false),
+				Check:  resource.TestCheckResourceAttr("helm_chart.test", "package_resolved_version", "0.0.1-r0"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceUnpublishedDependencies(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic"), Depends: []string{"chart-basic-crds"}},
+		{Name: "chart-basic-crds", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic")},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatalf("failed to add package: %v", err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	config := func(published, pattern string, fail, bundle bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo                             = %q
+  package_name                     = "chart-basic"
+  published_packages               = %s
+  chart_dependency_pattern         = %s
+  fail_on_unpublished_dependencies = %t
+  bundle_dependencies              = %t
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("dependencies"), published, pattern, fail, bundle)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(`["chart-basic"]`, "null", true, false),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`chart_dependency_pattern must be set`),
+			},
+			{
+				Config:      config(`["chart-basic"]`, `"chart-*"`, true, false),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`depends on chart-basic-crds`),
+			},
+			{
+				Config: config(`["chart-basic", "chart-basic-crds"]`, `"chart-*"`, true, false),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+			{
+				// Missing, but only warned about.
+				Config: config(`["chart-basic"]`, `"chart-*"`, false, false),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+			{
+				// Bundled into the chart, so not missing.
+				Config: config(`["chart-basic"]`, `"chart-*"`, true, true),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceChartSearchPaths(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../../testdata/charts/basic"), Dir: "opt/charts/basic"}); err != nil {
+		t.Fatalf("failed to add package: %v", err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	config := func(paths string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo               = %q
+  package_name       = "chart-basic"
+  chart_search_paths = %s
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("search-paths"), paths)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config("null"),
+				ExpectError: regexp.MustCompile(`"opt/charts"`),
+			},
+			{
+				Config: config(`["opt/charts"]`),
+				Check:  resource.TestCheckResourceAttr("helm_chart.test", "chart_version", "0.0.1"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceExtraLayers(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings     = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo         = %q
+  package_name = "chart-basic"
+
+  extra_layers = [{
+    media_type = "application/vnd.example.bundle.v1+json"
+    title      = "bundle.json"
+    content    = jsonencode({ images = [] })
+  }]
+}
+`, reg.Repo("extra-layers")),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				testAccCheckManifestJSON("helm_chart.test"),
+				resource.TestCheckResourceAttrWith("helm_chart.test", "manifest_json", func(raw string) error {
+					var m v1.Manifest
+					if err := json.Unmarshal([]byte(raw), &m); err != nil {
+						return err
+					}
+					if len(m.Layers) != 2 || m.Layers[1].MediaType != "application/vnd.example.bundle.v1+json" || m.Layers[1].Annotations["org.opencontainers.image.title"] != "bundle.json" {
+						return fmt.Errorf("manifest layers = %+v, want the chart's content then the bundle", m.Layers)
+					}
+					return nil
+				}),
+			),
+		}},
+	})
+}
+
+func TestAccHelmChartResourceSuspectFiles(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	chartYAML, err := os.ReadFile("../../testdata/charts/basic/Chart.yaml")
+	if err != nil {
+		t.Fatalf("failed to read chart: %v", err)
+	}
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := repo.AddChart(testkit.ChartPackage{
+		Name:    "chart-basic",
+		Version: "0.0.1-r0",
+		Chart:   fstest.MapFS{"Chart.yaml": {Data: chartYAML}, "files/image.tar": {Data: []byte("layer\x00")}},
+	}); err != nil {
+		t.Fatalf("failed to add package: %v", err)
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	config := func(allowed string) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = [%q]
+  extra_keyrings     = [%q]
+}
+
+resource "helm_chart" "test" {
+  repo                  = %q
+  package_name          = "chart-basic"
+  allowed_binary_files  = %s
+  fail_on_suspect_files = true
+}
+`, repo.Path(), repo.KeyPath(), reg.Repo("suspect"), allowed)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config("null"),
+				ExpectError: regexp.MustCompile(`files/image.tar`),
+			},
+			{
+				Config: config(`["files/*.tar"]`),
+				Check:  resource.TestCheckResourceAttrSet("helm_chart.test", "digest"),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceMaxAnnotationSize(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	config := func(truncate bool) string {
+		return fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo                 = %q
+  package_name         = "chart-basic"
+  max_annotation_size  = 8
+  truncate_annotations = %t
+}
+`, reg.Repo("annotation-size"), truncate)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(false),
+				ExpectError: regexp.MustCompile(`(?s)annotations too large.*thisshould`),
+			},
+			{
+				Config: config(true),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_chart.test", "annotations.thisshould", "bepreser"),
+					resource.TestCheckResourceAttr("helm_chart.test", "annotations.org.opencontainers.image.title", "basic"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccHelmChartResourceDigestAlgorithm(t *testing.T) {
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+provider "helm" {
+  extra_repositories = ["../../testdata/packages"]
+  extra_keyrings = ["../../testdata/packages/melange.rsa.pub"]
+}
+
+resource "helm_chart" "test" {
+  repo             = %q
+  package_name     = "chart-basic"
+  digest_algorithm = "sha512"
+}
+
+resource "helm_chart_promotion" "test" {
+  source = helm_chart.test.id
+  repo   = %q
+  tags   = ["stable"]
+}
+`, reg.Repo("sha512"), reg.Repo("release")),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestMatchResourceAttr("helm_chart.test", "digest", regexp.MustCompile(`^sha512:[0-9a-f]{128}$`)),
+				resource.TestCheckResourceAttrPair("helm_chart_promotion.test", "digest", "helm_chart.test", "digest"),
+				func(s *terraform.State) error {
+					// The chart can be pulled by its sha512 digest, both where
+					// it was pushed and where it was promoted to.
+					for _, n := range []string{"helm_chart.test", "helm_chart_promotion.test"} {
+						ref, err := chart.ParseDigest(s.RootModule().Resources[n].Primary.Attributes["id"])
+						if err != nil {
+							return err
+						}
+						if _, err := chart.Pull(ref); err != nil {
+							return fmt.Errorf("pulling %s: %w", ref, err)
+						}
+					}
+					return nil
+				},
+			),
+		}},
+	})
+}
+
+// TestHelmChartResourcePlanUnreachable plans an unchanged chart whose refresh
+// couldn't reach the registry, as recorded in private state, through the
+// provider server.
+func TestHelmChartResourcePlanUnreachable(t *testing.T) {
+	ctx := t.Context()
+	srv, err := providerserver.NewProtocol6WithError(helmprovider.New("dev")())()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := srv.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// withNulls returns an object of typ with attrs set, and null otherwise.
+	withNulls := func(typ tftypes.Object, attrs map[string]tftypes.Value) tftypes.Value {
+		vals := map[string]tftypes.Value{}
+		for k, at := range typ.AttributeTypes {
+			vals[k] = tftypes.NewValue(at, nil)
+			if v, ok := attrs[k]; ok {
+				vals[k] = v
+			}
+		}
+		return tftypes.NewValue(typ, vals)
+	}
+	dynamic := func(typ tftypes.Type, v tftypes.Value) *tfprotov6.DynamicValue {
+		dv, err := tfprotov6.NewDynamicValue(typ, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &dv
+	}
+	str := func(s string) tftypes.Value { return tftypes.NewValue(tftypes.String, s) }
+
+	ptyp, ok := schemas.Provider.ValueType().(tftypes.Object)
+	if !ok {
+		t.Fatalf("provider schema is a %v", schemas.Provider.ValueType())
+	}
+	configured, err := srv.ConfigureProvider(ctx, &tfprotov6.ConfigureProviderRequest{Config: dynamic(ptyp, withNulls(ptyp, map[string]tftypes.Value{
+		"extra_repositories": tftypes.NewValue(tftypes.List{ElementType: tftypes.String}, []tftypes.Value{str("../../testdata/packages")}),
+		"extra_keyrings":     tftypes.NewValue(tftypes.List{ElementType: tftypes.String}, []tftypes.Value{str("../../testdata/packages/melange.rsa.pub")}),
+	}))})
+	if err != nil || len(configured.Diagnostics) > 0 {
+		t.Fatalf("ConfigureProvider() = %v, %v", err, configured.Diagnostics)
+	}
+
+	typ, ok := schemas.ResourceSchemas["helm_chart"].ValueType().(tftypes.Object)
+	if !ok {
+		t.Fatalf("helm_chart schema is a %v", schemas.ResourceSchemas["helm_chart"].ValueType())
+	}
+	config := withNulls(typ, map[string]tftypes.Value{
+		"repo":         str("registry.invalid/charts/basic"),
+		"package_name": str("chart-basic"),
+	})
+	// Planning the chart's creation fills in defaults, leaving what is
+	// published unknown, which the prior state then has as published.
+	created, err := srv.PlanResourceChange(ctx, &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         "helm_chart",
+		PriorState:       dynamic(typ, tftypes.NewValue(typ, nil)),
+		ProposedNewState: dynamic(typ, config),
+		Config:           dynamic(typ, config),
+	})
+	if err != nil || len(created.Diagnostics) > 0 {
+		t.Fatalf("PlanResourceChange() on create = %v, %v", err, created.Diagnostics)
+	}
+	planned, err := created.PlannedState.Unmarshal(typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs map[string]tftypes.Value
+	if err := planned.As(&attrs); err != nil {
+		t.Fatal(err)
+	}
+	published := map[string]tftypes.Value{
+		"digest":        str("sha256:" + strings.Repeat("a", 64)),
+		"id":            str("registry.invalid/charts/basic@sha256:" + strings.Repeat("a", 64)),
+		"name":          str("basic"),
+		"chart_version": str("0.1.0"),
+		"manifest_json": str("{}"),
+	}
+	for k, v := range attrs {
+		if p, ok := published[k]; ok {
+			attrs[k] = p
+		} else if !v.IsKnown() {
+			attrs[k] = tftypes.NewValue(typ.AttributeTypes[k], nil)
+		}
+	}
+	prior := dynamic(typ, tftypes.NewValue(typ, attrs))
+
+	plan := func(private string) map[string]tftypes.Value {
+		t.Helper()
+		resp, err := srv.PlanResourceChange(ctx, &tfprotov6.PlanResourceChangeRequest{
+			TypeName:         "helm_chart",
+			PriorState:       prior,
+			ProposedNewState: prior,
+			Config:           dynamic(typ, config),
+			PriorPrivate:     []byte(private),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range resp.Diagnostics {
+			if d.Severity == tfprotov6.DiagnosticSeverityError {
+				t.Fatalf("PlanResourceChange() = %s: %s", d.Summary, d.Detail)
+			}
+		}
+		if len(resp.RequiresReplace) > 0 {
+			t.Errorf("PlanResourceChange() replaces %v", resp.RequiresReplace)
+		}
+		v, err := resp.PlannedState.Unmarshal(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]tftypes.Value
+		if err := v.As(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// A refreshed chart is planned as it is.
+	for k, v := range plan("") {
+		if !v.Equal(attrs[k]) {
+			t.Errorf("refreshed: planned %s = %v, want %v", k, v, attrs[k])
+		}
+	}
+
+	// One whose refresh couldn't reach the registry is kept, but for its
+	// digest and ID, which apply checks by pushing it again.
+	got := plan(`{"registry_unreachable":"` + base64.StdEncoding.EncodeToString([]byte("true")) + `"}`)
+	for k, v := range got {
+		switch k {
+		case "digest", "id":
+			if v.IsKnown() {
+				t.Errorf("unreachable: planned %s = %v, want unknown", k, v)
+			}
+		default:
+			if !v.Equal(attrs[k]) {
+				t.Errorf("unreachable: planned %s = %v, want %v", k, v, attrs[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"sigs.k8s.io/yaml"
+)
+
+// scanModel maps the scan attribute.
+type scanModel struct {
+	FailOn     types.String `tfsdk:"fail_on"`
+	WarnOn     types.String `tfsdk:"warn_on"`
+	SkipChecks types.List   `tfsdk:"skip_checks"`
+	Values     types.String `tfsdk:"values"`
+	Attest     types.Bool   `tfsdk:"attest"`
+}
+
+// scanFindingModel maps an element of scan_findings.
+type scanFindingModel struct {
+	ID        types.String `tfsdk:"id"`
+	Severity  types.String `tfsdk:"severity"`
+	Title     types.String `tfsdk:"title"`
+	Resource  types.String `tfsdk:"resource"`
+	Container types.String `tfsdk:"container"`
+}
+
+// scanFindingType is the element type of scan_findings.
+var scanFindingType = types.ObjectType{AttrTypes: map[string]attr.Type{
+	"id":        types.StringType,
+	"severity":  types.StringType,
+	"title":     types.StringType,
+	"resource":  types.StringType,
+	"container": types.StringType,
+}}
+
+// scanChart runs the misconfiguration scan configured by obj, if any, on c.
+// It returns the findings that weren't skipped, with an error if any are at
+// or above fail_on and a warning if any are at or above warn_on. With attest
+// set, it also returns the report to attest to.
+func scanChart(ctx context.Context, obj types.Object, c chart.Chart) (types.List, *chart.ScanReport, diag.Diagnostics) {
+	if obj.IsNull() || obj.IsUnknown() {
+		return types.ListNull(scanFindingType), nil, nil
+	}
+	var s scanModel
+	if diags := obj.As(ctx, &s, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return types.ListNull(scanFindingType), nil, diags
+	}
+
+	var skip []string
+	if !s.SkipChecks.IsNull() && !s.SkipChecks.IsUnknown() {
+		if diags := s.SkipChecks.ElementsAs(ctx, &skip, false); diags.HasError() {
+			return types.ListNull(scanFindingType), nil, diags
+		}
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal([]byte(s.Values.ValueString()), &values); err != nil {
+		return types.ListNull(scanFindingType), nil, diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("scan").AtName("values"), "parsing scan values", err.Error())}
+	}
+
+	all, err := chart.Scan(c, values)
+	if err != nil {
+		return types.ListNull(scanFindingType), nil, diag.Diagnostics{diag.NewErrorDiagnostic("scanning chart", err.Error())}
+	}
+
+	failOn := chart.SeverityHigh
+	if v := s.FailOn.ValueString(); v != "" {
+		failOn = chart.Severity(v)
+	}
+	var (
+		findings     []scanFindingModel
+		failed, warn []string
+	)
+	checks := slices.DeleteFunc(chart.ScanChecks(), func(id string) bool { return slices.Contains(skip, id) })
+	report := &chart.ScanReport{Linter: chart.ScanLinter, Checks: checks, FailOn: failOn, SkipChecks: skip, Findings: []chart.Finding{}}
+	for _, f := range all {
+		if slices.Contains(skip, f.ID) {
+			continue
+		}
+		report.Findings = append(report.Findings, f)
+		findings = append(findings, scanFindingModel{
+			ID:        types.StringValue(f.ID),
+			Severity:  types.StringValue(string(f.Severity)),
+			Title:     types.StringValue(f.Title),
+			Resource:  types.StringValue(f.Resource),
+			Container: types.StringValue(f.Container),
+		})
+		switch {
+		case f.Severity.AtLeast(failOn):
+			failed = append(failed, "- "+f.String())
+		case s.WarnOn.ValueString() != "" && f.Severity.AtLeast(chart.Severity(s.WarnOn.ValueString())):
+			warn = append(warn, "- "+f.String())
+		}
+	}
+	tflog.Info(ctx, "scanned chart", map[string]any{"findings": len(findings), "failed": len(failed)})
+
+	list, ds := types.ListValueFrom(ctx, scanFindingType, findings)
+	if len(failed) > 0 {
+		ds = append(ds, diag.NewAttributeErrorDiagnostic(path.Root("scan"), "chart fails misconfiguration lint",
+			fmt.Sprintf("%d findings are at or above %s:\n\n%s\n\nFix them in the chart, or list their IDs in skip_checks. The chart was not pushed.", len(failed), failOn, strings.Join(failed, "\n"))))
+	}
+	if len(warn) > 0 {
+		ds = append(ds, diag.NewAttributeWarningDiagnostic(path.Root("scan"), "chart has misconfigurations",
+			fmt.Sprintf("%d findings are at or above %s:\n\n%s", len(warn), s.WarnOn.ValueString(), strings.Join(warn, "\n"))))
+	}
+	if !s.Attest.ValueBool() {
+		report = nil
+	}
+	return list, report, ds
+}
+
+// attestScan attaches report to ref as an in-toto attestation, returning the
+// attestation's digest.
+func (c *helmClient) attestScan(ctx context.Context, ref name.Digest, report *chart.ScanReport) (types.String, diag.Diagnostics) {
+	h, err := chart.Attest(ref, chart.ScanPredicateType, report, c.remoteOpts(ctx)...)
+	if err != nil {
+		return types.StringNull(), diag.Diagnostics{diag.NewErrorDiagnostic("attesting scan", err.Error())}
+	}
+	tflog.Info(ctx, "attested scan", map[string]any{"ref": ref.String(), "attestation": h.String()})
+	return types.StringValue(h.String()), nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// sweepReposEnv names a comma-separated list of repos that acceptance tests
+// push to. Sweeping is a no-op unless it is set, so running -sweep can never
+// touch a registry that wasn't explicitly opted in.
+const sweepReposEnv = "HELM_SWEEP_REPOS"
+
+func TestMain(m *testing.M) {
+	resource.TestMain(m)
+}
+
+func init() {
+	resource.AddTestSweepers("helm_chart", &resource.Sweeper{
+		Name: "helm_chart",
+		F:    sweepHelmCharts,
+	})
+}
+
+// sweepHelmCharts deletes every manifest in the repos listed in HELM_SWEEP_REPOS.
+// The region argument is unused since registries aren't regional in this sense.
+func sweepHelmCharts(_ string) error {
+	raw := os.Getenv(sweepReposEnv)
+	if raw == "" {
+		log.Printf("[INFO] %s not set, skipping helm_chart sweeper", sweepReposEnv)
+		return nil
+	}
+
+	// Authenticate as the provider does without registry settings, so the
+	// sweeper reaches every registry the acceptance tests can push to.
+	kc := newKeychain(nil, nil, nil)
+
+	for r := range strings.SplitSeq(raw, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		repo, err := name.NewRepository(r)
+		if err != nil {
+			return fmt.Errorf("parsing sweep repo %q: %w", r, err)
+		}
+
+		digests, err := sweepDigests(repo, kc)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", repo, err)
+		}
+
+		for _, d := range digests {
+			log.Printf("[INFO] sweeping %s", d)
+			if err := remote.Delete(d, remote.WithAuthFromKeychain(kc)); err != nil {
+				return fmt.Errorf("deleting %s: %w", d, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sweepDigests returns every manifest digest reachable in repo. The provider
+// pushes by digest, so untagged manifests are only discoverable on registries
+// that report them in the tags list (GCR and Artifact Registry); elsewhere we
+// fall back to resolving tags.
+func sweepDigests(repo name.Repository, kc authn.Keychain) ([]name.Digest, error) {
+	tags, err := google.List(repo, google.WithAuthFromKeychain(kc))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var digests []name.Digest
+	add := func(d string) {
+		if seen[d] {
+			return
+		}
+		seen[d] = true
+		digests = append(digests, repo.Digest(d))
+	}
+
+	for d := range tags.Manifests {
+		add(d)
+	}
+
+	for _, t := range tags.Tags {
+		desc, err := remote.Head(repo.Tag(t), remote.WithAuthFromKeychain(kc))
+		if err != nil {
+			return nil, fmt.Errorf("resolving tag %s: %w", t, err)
+		}
+		add(desc.Digest.String())
+	}
+
+	return digests, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/time/rate"
+)
+
+// headerTransport sets static headers on every registry request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// rateLimitTransport holds each registry request until the limiter allows it.
+type rateLimitTransport struct {
+	limiter *rate.Limiter
+	base    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+const (
+	// maxRetryAfter is the longest Retry-After a throttled request waits out.
+	// Longer waits are left to ggcr's own retries, which back off and give up.
+	maxRetryAfter = time.Minute
+	// maxRetryAfterAttempts bounds how many times one request is retried.
+	maxRetryAfterAttempts = 5
+)
+
+// retryAfterTransport retries requests the registry throttles with a 429,
+// waiting as long as its Retry-After header asks, within bounds. Throttling is
+// recorded in the request context's throttleLog, if any.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log, _ := req.Context().Value(throttleLogKey{}).(*throttleLog)
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		// Streamed bodies can't be replayed, so leave those to the caller.
+		if !ok || wait > maxRetryAfter || attempt == maxRetryAfterAttempts || (req.Body != nil && req.GetBody == nil) {
+			log.record(0)
+			return resp, nil
+		}
+		log.record(wait)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// throttleLog records the throttling one operation ran into.
+type throttleLog struct {
+	mu        sync.Mutex
+	responses int
+	waited    time.Duration
+}
+
+type throttleLogKey struct{}
+
+// withThrottleLog returns a context whose registry requests record throttling
+// in the returned log.
+func withThrottleLog(ctx context.Context) (context.Context, *throttleLog) {
+	l := &throttleLog{}
+	return context.WithValue(ctx, throttleLogKey{}, l), l
+}
+
+func (l *throttleLog) record(wait time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.responses++
+	l.waited += wait
+}
+
+// diagnostics summarizes any throttling as a warning.
+func (l *throttleLog) diagnostics() diag.Diagnostics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.responses == 0 {
+		return nil
+	}
+	return diag.Diagnostics{diag.NewWarningDiagnostic("registry requests were throttled",
+		fmt.Sprintf("The registry responded 429 Too Many Requests %d times, and the provider waited %s in total as asked by Retry-After. Consider setting registry_requests_per_second.", l.responses, l.waited))}
+}
+
+// unreachableKey is the private state key Read sets when the registry
+// couldn't be reached to refresh a resource, so the plan leaves to apply
+// what it couldn't check.
+const unreachableKey = "registry_unreachable"
+
+// registryUnreachable reports whether err is a failure to reach the registry
+// at all, like a DNS or connection error or a timeout, rather than an answer
+// from it.
+func registryUnreachable(err error) bool {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// privateState is the private state of a resource's Read or plan response.
+type privateState interface {
+	GetKey(ctx context.Context, key string) ([]byte, diag.Diagnostics)
+	SetKey(ctx context.Context, key string, value []byte) diag.Diagnostics
+}
+
+// keepUnrefreshed records in private that ref couldn't be refreshed, since
+// err shows its registry is unreachable, and warns that its last known state
+// is kept.
+func keepUnrefreshed(ctx context.Context, private privateState, ref string, err error) diag.Diagnostics {
+	tflog.Warn(ctx, "registry unreachable, keeping last known state", map[string]any{"ref": ref, "error": err.Error()})
+	ds := private.SetKey(ctx, unreachableKey, []byte("true"))
+	return append(ds, diag.NewWarningDiagnostic("registry unreachable, state not refreshed",
+		fmt.Sprintf("%s couldn't be checked, so its last known state is kept, and anything planned that depends on it is checked at apply: %v", ref, err)))
+}
+
+// keepUnresolved warns, if err from resolving the package at plan time shows
+// its repositories are unreachable, that what needed the resolved package is
+// skipped, and returns nil otherwise. Network failures are told apart as for
+// registryUnreachable.
+func keepUnresolved(ctx context.Context, err error, skipped string) diag.Diagnostics {
+	if !registryUnreachable(err) {
+		return nil
+	}
+	tflog.Warn(ctx, "package repositories unreachable", map[string]any{"skipped": skipped, "error": err.Error()})
+	return diag.Diagnostics{diag.NewWarningDiagnostic("package repositories unreachable",
+		fmt.Sprintf("The package couldn't be resolved, so %s until a plan can reach its repositories: %v", skipped, err))}
+}
+
+// takeUnreachable reports whether the Read before this plan couldn't reach
+// the registry, clearing the mark in resp so it doesn't outlive the apply
+// that catches up.
+func takeUnreachable(ctx context.Context, req, resp privateState) (bool, diag.Diagnostics) {
+	v, ds := req.GetKey(ctx, unreachableKey)
+	if len(v) == 0 {
+		return false, ds
+	}
+	return true, append(ds, resp.SetKey(ctx, unreachableKey, nil)...)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// unitTestsModel maps the unit_tests attribute.
+type unitTestsModel struct {
+	Suites types.Map `tfsdk:"suites"`
+}
+
+// runUnitTests runs the unit tests configured by obj, if any, on c, with an
+// error if any fail.
+func runUnitTests(ctx context.Context, obj types.Object, c chart.Chart) diag.Diagnostics {
+	if obj.IsNull() || obj.IsUnknown() {
+		return nil
+	}
+	var ut unitTestsModel
+	if diags := obj.As(ctx, &ut, basetypes.ObjectAsOptions{}); diags.HasError() {
+		return diags
+	}
+	var suites map[string]string
+	if !ut.Suites.IsNull() && !ut.Suites.IsUnknown() {
+		if diags := ut.Suites.ElementsAs(ctx, &suites, false); diags.HasError() {
+			return diags
+		}
+	}
+	extra := make(map[string][]byte, len(suites))
+	for name, s := range suites {
+		extra[name] = []byte(s)
+	}
+
+	res, err := chart.UnitTest(c, extra)
+	if err != nil {
+		return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("unit_tests"), "running unit tests", err.Error()+"\n\nThe chart was not pushed.")}
+	}
+	tflog.Info(ctx, "ran unit tests", map[string]any{"suites": res.Suites, "tests": res.Tests, "failed": len(res.Failures)})
+	if len(res.Failures) == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(res.Failures))
+	for _, f := range res.Failures {
+		failed = append(failed, "- "+f.String())
+	}
+	return diag.Diagnostics{diag.NewAttributeErrorDiagnostic(path.Root("unit_tests"), "chart fails unit tests",
+		fmt.Sprintf("%d of %d tests failed:\n\n%s\n\nThe chart was not pushed.", len(failed), res.Tests, strings.Join(failed, "\n")))}
+}
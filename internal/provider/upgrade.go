@@ -0,0 +1,35 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+// checkUpgrade warns when next, the chart a plan would rebuild, changes
+// fields Kubernetes can't update in place from prev, the chart in state at
+// ref.
+func checkUpgrade(prev, next chart.Chart, ref name.Reference) diag.Diagnostics {
+	problems, err := chart.CheckUpgrade(prev, next, nil)
+	if err != nil {
+		return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("check_upgrades"), "checking upgrade compatibility", err.Error())}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(problems))
+	for _, p := range problems {
+		lines = append(lines, "- "+p.String())
+	}
+	return diag.Diagnostics{diag.NewAttributeWarningDiagnostic(path.Root("check_upgrades"), "chart change may break upgrades",
+		fmt.Sprintf("Compared to %s, the rebuilt chart changes fields Kubernetes can't update in place:\n\n%s\n\nUpgrading existing releases to it will likely fail until the objects are deleted or the releases reinstalled.", ref, strings.Join(lines, "\n")))}
+}
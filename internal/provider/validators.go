@@ -0,0 +1,519 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkotypes "chainguard.dev/apko/pkg/build/types"
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	_ validator.String = repoValidator{}
+	_ validator.String = archValidator{}
+	_ validator.String = versionValidator{}
+	_ validator.String = oneOfValidator{}
+)
+
+// repoValidator rejects repo values that carry a tag or digest. Charts are
+// always pushed by digest to the bare repository, so anything after the
+// repository name would be silently dropped.
+type repoValidator struct{}
+
+func (v repoValidator) Description(context.Context) string {
+	return "value must be an OCI repository without a tag or digest"
+}
+
+func (v repoValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v repoValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if d, err := chart.ParseDigest(val, name.StrictValidation); err == nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo",
+			fmt.Sprintf("repo %q includes the digest %q. Charts are pushed by digest to the repository, so set repo to %q.", val, d.Identifier(), d.Context().String()))
+		return
+	}
+
+	if t, err := name.NewTag(val, name.StrictValidation); err == nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo",
+			fmt.Sprintf("repo %q includes the tag %q. Charts are pushed by digest to the repository, so set repo to %q.", val, t.TagStr(), t.Context().String()))
+		return
+	}
+
+	repo, err := name.NewRepository(val)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo", fmt.Sprintf("repo %q is not a valid OCI repository: %v", val, err))
+		return
+	}
+	if msg := registryRepoProblem(repo); msg != "" {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo", msg)
+	}
+}
+
+// registryRepoProblem explains why repo doesn't fit the naming rules of its
+// registry, for registries known to have their own, or returns "".
+func registryRepoProblem(repo name.Repository) string {
+	parts := strings.Split(repo.RepositoryStr(), "/")
+	switch host := repo.RegistryStr(); {
+	case host == "docker.pkg.dev":
+		return fmt.Sprintf("repo %q has no location. Artifact Registry hosts are regional, like us-docker.pkg.dev or europe-west1-docker.pkg.dev.", repo)
+	case strings.HasSuffix(host, "-docker.pkg.dev") && len(parts) < 3:
+		return fmt.Sprintf("repo %q is too short. Artifact Registry repos are <location>-docker.pkg.dev/<project>/<repository>/<chart>.", repo)
+	case host == ecrPublicHost && len(parts) < 2:
+		return fmt.Sprintf("repo %q has no registry alias. ECR Public repos are public.ecr.aws/<alias>/<repository>.", repo)
+	}
+	return ""
+}
+
+// elementsValidator applies a string validator to each element of a list.
+type elementsValidator struct {
+	elem validator.String
+}
+
+func (v elementsValidator) Description(ctx context.Context) string {
+	return "each " + v.elem.Description(ctx)
+}
+
+func (v elementsValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v elementsValidator) ValidateList(ctx context.Context, req validator.ListRequest, resp *validator.ListResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	for i, e := range req.ConfigValue.Elements() {
+		s, ok := e.(types.String)
+		if !ok {
+			continue
+		}
+		sreq := validator.StringRequest{Path: req.Path.AtListIndex(i), ConfigValue: s}
+		sresp := &validator.StringResponse{}
+		v.elem.ValidateString(ctx, sreq, sresp)
+		resp.Diagnostics.Append(sresp.Diagnostics...)
+	}
+}
+
+// commandValidator checks that a list names a program to run, followed by
+// its arguments.
+type commandValidator struct{}
+
+func (v commandValidator) Description(context.Context) string {
+	return "value must be a program followed by its arguments"
+}
+
+func (v commandValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v commandValidator) ValidateList(_ context.Context, req validator.ListRequest, resp *validator.ListResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	elems := req.ConfigValue.Elements()
+	if len(elems) == 0 {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid command", "The command must name a program to run.")
+		return
+	}
+	if s, ok := elems[0].(types.String); ok && !s.IsUnknown() && s.ValueString() == "" {
+		resp.Diagnostics.AddAttributeError(req.Path.AtListIndex(0), "Invalid command", "The program to run must not be empty.")
+	}
+}
+
+// yamlMapValidator checks that a value is a YAML mapping.
+type yamlMapValidator struct{}
+
+func (v yamlMapValidator) Description(context.Context) string {
+	return "value must be a YAML mapping"
+}
+
+func (v yamlMapValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v yamlMapValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal([]byte(req.ConfigValue.ValueString()), &m); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid YAML", fmt.Sprintf("The value must be a YAML mapping: %v.", err))
+	}
+}
+
+// exactlyOneOfValidator checks that an object sets exactly one of the named
+// attributes.
+type exactlyOneOfValidator struct {
+	names []string
+}
+
+func (v exactlyOneOfValidator) Description(context.Context) string {
+	return "exactly one of " + strings.Join(v.names, " or ") + " must be set"
+}
+
+func (v exactlyOneOfValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v exactlyOneOfValidator) ValidateObject(_ context.Context, req validator.ObjectRequest, resp *validator.ObjectResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	set := 0
+	for _, n := range v.names {
+		a, ok := req.ConfigValue.Attributes()[n]
+		if !ok || a.IsUnknown() {
+			return
+		}
+		if !a.IsNull() {
+			set++
+		}
+	}
+	if set != 1 {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid attribute combination", fmt.Sprintf("Exactly one of %s must be set.", strings.Join(v.names, " or ")))
+	}
+}
+
+// tagValidator checks that a value is a valid OCI tag.
+type tagValidator struct{}
+
+func (v tagValidator) Description(context.Context) string {
+	return "value must be a valid OCI tag"
+}
+
+func (v tagValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v tagValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if _, err := name.NewTag("example.com/repo:"+val, name.StrictValidation); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid tag", fmt.Sprintf("%q is not a valid OCI tag: %v", val, err))
+	}
+}
+
+// digestRefValidator checks that a value is an OCI reference by digest.
+type digestRefValidator struct{}
+
+func (v digestRefValidator) Description(context.Context) string {
+	return "value must be an OCI reference by sha256 or sha512 digest, <repo>@<algorithm>:<hex>"
+}
+
+func (v digestRefValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v digestRefValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if _, err := chart.ParseDigest(val, name.StrictValidation); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid reference", fmt.Sprintf("%q is not a reference by digest: %v", val, err))
+	}
+}
+
+// archValidator accepts the architectures apko knows about, under either
+// their APK names (x86_64, aarch64) or their Go names (amd64, arm64).
+type archValidator struct{}
+
+func (v archValidator) Description(context.Context) string {
+	return "value must be a supported package architecture"
+}
+
+func (v archValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v archValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if slices.Contains(apkotypes.AllArchs, apkotypes.ParseArchitecture(val)) {
+		return
+	}
+
+	known := make([]string, 0, len(apkotypes.AllArchs))
+	for _, a := range apkotypes.AllArchs {
+		known = append(known, a.ToAPK())
+	}
+	resp.Diagnostics.AddAttributeError(req.Path, "Invalid architecture",
+		fmt.Sprintf("%q is not a supported architecture, must be one of: %s (Go names like amd64 and arm64 are also accepted).", val, strings.Join(known, ", ")))
+}
+
+// versionValidator accepts an APK version, optionally prefixed with one of
+// the constraint operators APK understands in a world entry. Numbers with
+// leading zeros are rejected: APK compares some of them as decimal
+// fractions, so 1.02.3 sorts before 1.1, which is rarely what was meant.
+type versionValidator struct{}
+
+func (v versionValidator) Description(context.Context) string {
+	return "value must be an APK version, optionally prefixed with a constraint operator"
+}
+
+func (v versionValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v versionValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	_, version := chart.SplitVersionConstraint(val)
+	if _, err := apk.ParseVersion(version); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid package version",
+			fmt.Sprintf("%q is not a valid APK version or constraint (e.g. 1.2.3-r0, ~1.2, >=1.2.3): %v", val, err))
+		return
+	}
+	if m := leadingZeroRegex.FindStringSubmatch(version); m != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid package version",
+			fmt.Sprintf("%q has the number %q with a leading zero. Drop the leading zero.", val, m[1]))
+	}
+}
+
+// leadingZeroRegex matches a number in a version that has a leading zero.
+var leadingZeroRegex = regexp.MustCompile(`(?:^|[^0-9])(0[0-9]+)`)
+
+// oneOfValidator accepts only the listed values.
+type oneOfValidator struct {
+	values []string
+}
+
+func (v oneOfValidator) Description(context.Context) string {
+	return fmt.Sprintf("value must be one of: %s", strings.Join(v.values, ", "))
+}
+
+func (v oneOfValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v oneOfValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if !slices.Contains(v.values, val) {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid value", fmt.Sprintf("%q is not valid, %s.", val, v.Description(ctx)))
+	}
+}
+
+type globValidator struct{}
+
+func (v globValidator) Description(context.Context) string {
+	return "value must be a valid glob pattern"
+}
+
+func (v globValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v globValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if _, err := path.Match(val, ""); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid glob pattern", fmt.Sprintf("%q is not a valid glob pattern: %v", val, err))
+	}
+}
+
+// mediaTypeValidator checks that a string is a media type, like
+// application/vnd.example.config.v1+json, without parameters.
+type mediaTypeValidator struct{}
+
+func (v mediaTypeValidator) Description(context.Context) string {
+	return "value must be a media type, without parameters"
+}
+
+func (v mediaTypeValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v mediaTypeValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	mt, params, err := mime.ParseMediaType(val)
+	if err == nil && (len(params) > 0 || mt != val || !strings.Contains(mt, "/")) {
+		err = fmt.Errorf("want type/subtype, in lowercase and without parameters")
+	}
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid media type", fmt.Sprintf("%q is not a valid media type: %v", val, err))
+	}
+}
+
+// repoTemplateValidator checks that a repo_template parses and renders to a
+// valid repository for a sample chart.
+type repoTemplateValidator struct{}
+
+func (v repoTemplateValidator) Description(context.Context) string {
+	return "value must be a Go template that renders to an OCI repository"
+}
+
+func (v repoTemplateValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v repoTemplateValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	repo, err := renderRepoTemplate(val, repoTemplateData{
+		Name:           "example",
+		Version:        "1.2.3",
+		PackageName:    "chart-example",
+		PackageVersion: "1.2.3-r0",
+	})
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo template", fmt.Sprintf("%q is not a valid template: %v", val, err))
+		return
+	}
+	if _, err := name.NewRepository(repo); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid repo template", fmt.Sprintf("%q renders to %q, which is not a valid repository: %v", val, repo, err))
+	}
+}
+
+// webhookURLValidator checks that a value is an absolute http or https URL.
+type webhookURLValidator struct{}
+
+func (v webhookURLValidator) Description(context.Context) string {
+	return "value must be an http or https URL"
+}
+
+func (v webhookURLValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v webhookURLValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	// The value is sensitive, so don't echo it back.
+	u, err := url.Parse(req.ConfigValue.ValueString())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid URL", "The webhook URL must be an absolute http or https URL.")
+	}
+}
+
+// payloadTemplateValidator checks that a value is a Go template that renders
+// to JSON.
+type payloadTemplateValidator struct{}
+
+func (v payloadTemplateValidator) Description(context.Context) string {
+	return "value must be a Go template that renders to JSON"
+}
+
+func (v payloadTemplateValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v payloadTemplateValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if _, err := renderNotifyPayload(val, notifyEvent{
+		Name:           "example",
+		Version:        "1.2.3",
+		Digest:         "sha256:" + strings.Repeat("0", 64),
+		Repo:           "registry.example.com/charts/example",
+		Ref:            "registry.example.com/charts/example@sha256:" + strings.Repeat("0", 64),
+		Tags:           []string{"stable"},
+		PackageName:    "chart-example",
+		PackageVersion: "1.2.3-r0",
+	}); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid payload template", fmt.Sprintf("%q is not a valid payload template: %v", val, err))
+	}
+}
+
+// atLeastValidator checks that a number is no less than min.
+type atLeastValidator struct {
+	min int64
+}
+
+func (v atLeastValidator) Description(context.Context) string {
+	return fmt.Sprintf("value must be at least %d", v.min)
+}
+
+func (v atLeastValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v atLeastValidator) ValidateInt64(ctx context.Context, req validator.Int64Request, resp *validator.Int64Response) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueInt64()
+
+	if val < v.min {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid value", fmt.Sprintf("%d is not valid, %s.", val, v.Description(ctx)))
+	}
+}
+
+// createdValidator checks that a value is one of the chart.Created* values or
+// an RFC 3339 timestamp.
+type createdValidator struct{}
+
+func (v createdValidator) Description(context.Context) string {
+	return fmt.Sprintf("value must be %q, %q or an RFC 3339 timestamp", chart.CreatedBuildTime, chart.CreatedSourceDateEpoch)
+}
+
+func (v createdValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v createdValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	val := req.ConfigValue.ValueString()
+
+	if val == chart.CreatedBuildTime || val == chart.CreatedSourceDateEpoch {
+		return
+	}
+	if _, err := time.Parse(time.RFC3339, val); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid value", fmt.Sprintf("%q is not valid, %s.", val, v.Description(ctx)))
+	}
+}
@@ -0,0 +1,466 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestRepoValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.String
+		wantErr string
+	}{
+		{name: "bare repo", value: types.StringValue("cgr.dev/foo/bar")},
+		{name: "registry with port", value: types.StringValue("localhost:5000/foo")},
+		{name: "null", value: types.StringNull()},
+		{name: "unknown", value: types.StringUnknown()},
+		{name: "tag", value: types.StringValue("cgr.dev/foo/bar:1.2.3"), wantErr: `includes the tag "1.2.3"`},
+		{name: "tag with port", value: types.StringValue("localhost:5000/foo:latest"), wantErr: `set repo to "localhost:5000/foo"`},
+		{name: "invalid repo", value: types.StringValue("cgr.dev/Foo/BAR"), wantErr: "is not a valid OCI repository"},
+		{name: "artifact registry", value: types.StringValue("us-docker.pkg.dev/project/charts/foo")},
+		{name: "artifact registry without chart", value: types.StringValue("europe-west1-docker.pkg.dev/project/charts"), wantErr: "<project>/<repository>/<chart>"},
+		{name: "artifact registry without location", value: types.StringValue("docker.pkg.dev/project/charts/foo"), wantErr: "has no location"},
+		{name: "ecr public", value: types.StringValue("public.ecr.aws/example/foo")},
+		{name: "ecr public without alias", value: types.StringValue("public.ecr.aws/foo"), wantErr: "has no registry alias"},
+		{
+			name:    "digest",
+			value:   types.StringValue("cgr.dev/foo/bar@sha256:abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234abcd1234"),
+			wantErr: `includes the digest "sha256:abcd1234`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("repo"), ConfigValue: tc.value}
+			resp := &validator.StringResponse{}
+			repoValidator{}.ValidateString(t.Context(), req, resp)
+
+			if tc.wantErr == "" {
+				if resp.Diagnostics.HasError() {
+					t.Fatalf("unexpected error: %v", resp.Diagnostics)
+				}
+				return
+			}
+
+			if !resp.Diagnostics.HasError() {
+				t.Fatalf("expected error containing %q, got none", tc.wantErr)
+			}
+			if got := resp.Diagnostics.Errors()[0].Detail(); !strings.Contains(got, tc.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", got, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestElementsValidator(t *testing.T) {
+	list := func(vs ...string) types.List {
+		elems := make([]attr.Value, 0, len(vs))
+		for _, v := range vs {
+			elems = append(elems, types.StringValue(v))
+		}
+		return types.ListValueMust(types.StringType, elems)
+	}
+
+	tests := []struct {
+		name     string
+		value    types.List
+		wantPath string
+	}{
+		{name: "repos", value: list("cgr.dev/foo/bar", "localhost:5000/foo")},
+		{name: "null", value: types.ListNull(types.StringType)},
+		{name: "tag", value: list("cgr.dev/foo/bar", "cgr.dev/foo/baz:1.2.3"), wantPath: "mirror_repos[1]"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.ListRequest{Path: path.Root("mirror_repos"), ConfigValue: tc.value}
+			resp := &validator.ListResponse{}
+			elementsValidator{elem: repoValidator{}}.ValidateList(t.Context(), req, resp)
+
+			if tc.wantPath == "" {
+				if resp.Diagnostics.HasError() {
+					t.Fatalf("unexpected error: %v", resp.Diagnostics)
+				}
+				return
+			}
+
+			if !resp.Diagnostics.HasError() {
+				t.Fatalf("expected error at %s, got none", tc.wantPath)
+			}
+			d, ok := resp.Diagnostics.Errors()[0].(diag.DiagnosticWithPath)
+			if !ok {
+				t.Fatalf("error has no path: %v", resp.Diagnostics)
+			}
+			if got := d.Path().String(); got != tc.wantPath {
+				t.Errorf("error path = %s, want %s", got, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestCommandValidator(t *testing.T) {
+	list := func(vs ...string) types.List {
+		elems := make([]attr.Value, 0, len(vs))
+		for _, v := range vs {
+			elems = append(elems, types.StringValue(v))
+		}
+		return types.ListValueMust(types.StringType, elems)
+	}
+
+	tests := []struct {
+		name     string
+		value    types.List
+		wantPath string
+	}{
+		{name: "program", value: list("helm")},
+		{name: "arguments", value: list("helm", "lint", "--strict")},
+		{name: "null", value: types.ListNull(types.StringType)},
+		{name: "empty", value: list(), wantPath: "pre_push_command"},
+		{name: "empty program", value: list("", "lint"), wantPath: "pre_push_command[0]"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.ListRequest{Path: path.Root("pre_push_command"), ConfigValue: tc.value}
+			resp := &validator.ListResponse{}
+			commandValidator{}.ValidateList(t.Context(), req, resp)
+
+			if tc.wantPath == "" {
+				if resp.Diagnostics.HasError() {
+					t.Fatalf("unexpected error: %v", resp.Diagnostics)
+				}
+				return
+			}
+
+			if !resp.Diagnostics.HasError() {
+				t.Fatalf("expected error at %s, got none", tc.wantPath)
+			}
+			d, ok := resp.Diagnostics.Errors()[0].(diag.DiagnosticWithPath)
+			if !ok {
+				t.Fatalf("error has no path: %v", resp.Diagnostics)
+			}
+			if got := d.Path().String(); got != tc.wantPath {
+				t.Errorf("error path = %s, want %s", got, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestYAMLMapValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.String
+		wantErr bool
+	}{
+		{name: "mapping", value: types.StringValue("image:\n  tag: latest\n")},
+		{name: "json", value: types.StringValue(`{"image":{"tag":"latest"}}`)},
+		{name: "empty", value: types.StringValue("")},
+		{name: "null", value: types.StringNull()},
+		{name: "list", value: types.StringValue("- a\n- b\n"), wantErr: true},
+		{name: "invalid", value: types.StringValue("image: [tag"), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("values"), ConfigValue: tc.value}
+			resp := &validator.StringResponse{}
+			yamlMapValidator{}.ValidateString(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestExactlyOneOfValidator(t *testing.T) {
+	obj := func(content, file types.String) types.Object {
+		return types.ObjectValueMust(map[string]attr.Type{
+			"content": types.StringType,
+			"file":    types.StringType,
+			"append":  types.BoolType,
+		}, map[string]attr.Value{
+			"content": content,
+			"file":    file,
+			"append":  types.BoolNull(),
+		})
+	}
+
+	tests := []struct {
+		name    string
+		value   types.Object
+		wantErr bool
+	}{
+		{name: "content", value: obj(types.StringValue("# README"), types.StringNull())},
+		{name: "file", value: obj(types.StringNull(), types.StringValue("README.md"))},
+		{name: "unknown", value: obj(types.StringUnknown(), types.StringValue("README.md"))},
+		{name: "null", value: types.ObjectNull(map[string]attr.Type{})},
+		{name: "both", value: obj(types.StringValue("# README"), types.StringValue("README.md")), wantErr: true},
+		{name: "neither", value: obj(types.StringNull(), types.StringNull()), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.ObjectRequest{Path: path.Root("readme"), ConfigValue: tc.value}
+			resp := &validator.ObjectResponse{}
+			exactlyOneOfValidator{names: []string{"content", "file"}}.ValidateObject(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestTagValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.String
+		wantErr bool
+	}{
+		{name: "version", value: types.StringValue("1.2.3")},
+		{name: "helm build metadata", value: types.StringValue("1.2.3_r4")},
+		{name: "null", value: types.StringNull()},
+		{name: "plus", value: types.StringValue("1.2.3+r4"), wantErr: true},
+		{name: "slash", value: types.StringValue("stable/1"), wantErr: true},
+		{name: "empty", value: types.StringValue(""), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("tags"), ConfigValue: tc.value}
+			resp := &validator.StringResponse{}
+			tagValidator{}.ValidateString(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestAtLeastValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.Int64
+		wantErr bool
+	}{
+		{name: "min", value: types.Int64Value(1)},
+		{name: "more", value: types.Int64Value(5)},
+		{name: "null", value: types.Int64Null()},
+		{name: "less", value: types.Int64Value(0), wantErr: true},
+		{name: "negative", value: types.Int64Value(-1), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.Int64Request{Path: path.Root("keep_digests"), ConfigValue: tc.value}
+			resp := &validator.Int64Response{}
+			atLeastValidator{min: 1}.ValidateInt64(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestCreatedValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.String
+		wantErr bool
+	}{
+		{name: "build", value: types.StringValue("build")},
+		{name: "source date epoch", value: types.StringValue("source_date_epoch")},
+		{name: "timestamp", value: types.StringValue("2024-01-02T03:04:05Z")},
+		{name: "offset", value: types.StringValue("2024-01-02T03:04:05+01:00")},
+		{name: "null", value: types.StringNull()},
+		{name: "date only", value: types.StringValue("2024-01-02"), wantErr: true},
+		{name: "epoch seconds", value: types.StringValue("1700000000"), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("created"), ConfigValue: tc.value}
+			resp := &validator.StringResponse{}
+			createdValidator{}.ValidateString(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestDigestRefValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   types.String
+		wantErr bool
+	}{
+		{name: "digest", value: types.StringValue("registry.example.com/charts/foo@sha256:" + strings.Repeat("a", 64))},
+		{name: "null", value: types.StringNull()},
+		{name: "tag", value: types.StringValue("registry.example.com/charts/foo:1.2.3"), wantErr: true},
+		{name: "repo", value: types.StringValue("registry.example.com/charts/foo"), wantErr: true},
+		{name: "short digest", value: types.StringValue("registry.example.com/charts/foo@sha256:abc"), wantErr: true},
+		{name: "sha512", value: types.StringValue("registry.example.com/charts/foo@sha512:" + strings.Repeat("a", 128))},
+		{name: "short sha512", value: types.StringValue("registry.example.com/charts/foo@sha512:" + strings.Repeat("a", 64)), wantErr: true},
+		{name: "sha384", value: types.StringValue("registry.example.com/charts/foo@sha384:" + strings.Repeat("a", 96)), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("source"), ConfigValue: tc.value}
+			resp := &validator.StringResponse{}
+			digestRefValidator{}.ValidateString(t.Context(), req, resp)
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestArchValidator(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "x86_64"},
+		{value: "amd64"},
+		{value: "aarch64"},
+		{value: "arm64"},
+		{value: "armv7"},
+		{value: "x86-64", wantErr: true},
+		{value: "sparc", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("package_arch"), ConfigValue: types.StringValue(tc.value)}
+			resp := &validator.StringResponse{}
+			archValidator{}.ValidateString(t.Context(), req, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestVersionValidator(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "1.20.3-r0"},
+		{value: "1.20.3"},
+		{value: "~1.20"},
+		{value: "=~1.20"},
+		{value: ">=1.2.3-r1"},
+		{value: "<2"},
+		{value: "1.2.3_rc1-r0"},
+		{value: "latest", wantErr: true},
+		{value: "v1.2.3", wantErr: true},
+		{value: ">=", wantErr: true},
+		{value: "1.02.3", wantErr: true},
+		{value: "~01.2", wantErr: true},
+		{value: "1.2.3-r01", wantErr: true},
+		{value: "0.1.0"},
+		{value: "1.0.10-r0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("package_version"), ConfigValue: types.StringValue(tc.value)}
+			resp := &validator.StringResponse{}
+			versionValidator{}.ValidateString(t.Context(), req, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestGlobValidator(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "chart-*"},
+		{value: "*-charts-*"},
+		{value: "chart-[a-m]*"},
+		{value: "chart-[", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("pattern"), ConfigValue: types.StringValue(tc.value)}
+			resp := &validator.StringResponse{}
+			globValidator{}.ValidateString(t.Context(), req, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestMediaTypeValidator(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "application/vnd.cncf.helm.config.v1+json"},
+		{value: "application/vnd.example.chart.v1.tar+gzip"},
+		{value: "application/json; charset=utf-8", wantErr: true},
+		{value: "Application/JSON", wantErr: true},
+		{value: "helm-chart", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("config_media_type"), ConfigValue: types.StringValue(tc.value)}
+			resp := &validator.StringResponse{}
+			mediaTypeValidator{}.ValidateString(t.Context(), req, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestRepoTemplateValidator(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "cgr.dev/org/charts/{{ .Name }}"},
+		{value: "cgr.dev/org/{{ .PackageName }}"},
+		{value: "cgr.dev/org/charts/{{ .Name", wantErr: true},
+		{value: "cgr.dev/org/charts/{{ .Nope }}", wantErr: true},
+		{value: "cgr.dev/org/charts/{{ .Name }}:{{ .Version }}", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			req := validator.StringRequest{Path: path.Root("repo_template"), ConfigValue: types.StringValue(tc.value)}
+			resp := &validator.StringResponse{}
+			repoTemplateValidator{}.ValidateString(t.Context(), req, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tc.wantErr {
+				t.Errorf("HasError() = %v, want %v: %v", got, tc.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
@@ -8,8 +8,12 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
 
+	"github.com/chainguard-dev/terraform-provider-helm/internal/cli"
 	"github.com/chainguard-dev/terraform-provider-helm/internal/provider"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
 )
@@ -31,6 +35,19 @@ var version string = "dev"
 // https://goreleaser.com/cookbooks/using-main.version/
 
 func main() {
+	// "terraform-provider-helm build|push|inspect ..." runs the chart
+	// pipeline directly, for reproducing builds without Terraform.
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := cli.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+		stop()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var debug bool
 
 	flag.BoolVar(&debug, "debug", false, "set to true to run the provider with support for debuggers like delve")
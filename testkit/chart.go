@@ -1,9 +1,10 @@
-package testutil
+package testkit
 
 import (
 	"fmt"
 	"os"
 	"strings"
+	"testing"
 
 	"helm.sh/helm/v3/pkg/action"
 	helmchart "helm.sh/helm/v3/pkg/chart"
@@ -15,7 +16,9 @@ import (
 
 // TestPullAndTemplateChart pulls a chart from an OCI registry and optionally templates it.
 // It returns the loaded chart and optionally the templated release if templating was requested.
-func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTemplating bool) (*helmchart.Chart, *release.Release, error) {
+// Progress is logged to t.
+func TestPullAndTemplateChart(t testing.TB, ociRef string, expectedChartName string, skipTemplating bool) (*helmchart.Chart, *release.Release, error) {
+	t.Helper()
 	// Setup helm environment
 	settings := cli.New()
 
@@ -33,7 +36,7 @@ func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTempl
 	// Initialize action configuration
 	actionConfig := new(action.Configuration)
 	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), func(format string, v ...any) {
-		fmt.Printf(format, v...)
+		t.Logf(format, v...)
 	}); err != nil {
 		return nil, nil, fmt.Errorf("failed to initialize action configuration: %w", err)
 	}
@@ -51,7 +54,7 @@ func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTempl
 	pull.PlainHTTP = true
 
 	// Pull the chart using OCI reference
-	fmt.Printf("Pulling chart from %s to %s\n", ociRef, tmpDir)
+	t.Logf("Pulling chart from %s to %s", ociRef, tmpDir)
 	if _, err := pull.Run(ociRef); err != nil {
 		return nil, nil, fmt.Errorf("failed to pull chart: %w", err)
 	}
@@ -64,7 +67,7 @@ func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTempl
 
 	var chartPath string
 	for _, entry := range entries {
-		fmt.Printf("Found file in temp dir: %s\n", entry.Name())
+		t.Logf("Found file in temp dir: %s", entry.Name())
 		if strings.HasSuffix(entry.Name(), ".tgz") {
 			chartPath = fmt.Sprintf("%s/%s", tmpDir, entry.Name())
 			break
@@ -75,7 +78,7 @@ func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTempl
 		return nil, nil, fmt.Errorf("no chart file found in directory %s", tmpDir)
 	}
 
-	fmt.Printf("Loading chart from: %s\n", chartPath)
+	t.Logf("Loading chart from: %s", chartPath)
 
 	// Load the chart
 	helmChart, err := loader.Load(chartPath)
@@ -84,7 +87,7 @@ func TestPullAndTemplateChart(ociRef string, expectedChartName string, skipTempl
 	}
 
 	// Debug chart info
-	fmt.Printf("Chart loaded: %s version %s\n", helmChart.Name(), helmChart.Metadata.Version)
+	t.Logf("Chart loaded: %s version %s", helmChart.Name(), helmChart.Metadata.Version)
 
 	// Verify the chart name
 	if expectedChartName != "" && helmChart.Metadata.Name != expectedChartName {
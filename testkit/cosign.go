@@ -0,0 +1,250 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Signer signs and attests to artifacts the way cosign does, storing the
+// results under cosign's sha256-<hex>.sig and .att tags. Each call replaces
+// whatever was stored there before.
+type Signer struct {
+	Key *ecdsa.PrivateKey
+	// Cert, if set, is attached to signatures as a keyless signing
+	// certificate for Key, with Chain as its intermediates.
+	Cert  *x509.Certificate
+	Chain []*x509.Certificate
+	// Rekor, if set, stands in for a transparency log's key: signatures
+	// get an offline bundle, signed with it, logging them at LoggedAt.
+	Rekor    *ecdsa.PrivateKey
+	LoggedAt time.Time
+	// LoggedAs, if set, is the certificate log entries name as the signer
+	// instead of Cert, standing in for an entry made by someone else.
+	LoggedAs *x509.Certificate
+	// TSA, if set, countersigns signatures with an RFC 3161 timestamp for
+	// TimestampedAt, as the timestamp authority TSACert is for. RSA keys
+	// sign with RSASSA-PSS. TSAOmitsCert leaves TSACert out of timestamps,
+	// as some authorities do.
+	TSA           crypto.Signer
+	TSACert       *x509.Certificate
+	TSAOmitsCert  bool
+	TimestampedAt time.Time
+}
+
+// PublicKeyPEM returns the signer's public key, PEM-encoded as cosign
+// writes it.
+func (s Signer) PublicKeyPEM() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.Key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// Sign signs ref with a simple signing payload.
+func (s Signer) Sign(ref name.Digest) error {
+	payload, err := json.Marshal(map[string]any{
+		"critical": map[string]any{
+			"identity": map[string]string{"docker-reference": ref.Context().String()},
+			"image":    map[string]string{"docker-manifest-digest": ref.DigestStr()},
+			"type":     "cosign container image signature",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(payload)
+	if err != nil {
+		return err
+	}
+	annotations, err := s.sigAnnotations(sig)
+	if err != nil {
+		return err
+	}
+	annotations["dev.cosignproject.cosign/signature"] = base64.StdEncoding.EncodeToString(sig)
+	if s.Rekor != nil {
+		verifier, err := s.verifierPEM()
+		if err != nil {
+			return err
+		}
+		bundle, err := s.bundle(map[string]any{
+			"apiVersion": "0.0.1",
+			"kind":       "hashedrekord",
+			"spec": map[string]any{
+				"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", sha256.Sum256(payload))}},
+				"signature": map[string]any{"content": base64.StdEncoding.EncodeToString(sig), "publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString([]byte(verifier))}},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		annotations["dev.sigstore.cosign/bundle"] = bundle
+	}
+	return s.write(ref, "sig", payload, "application/vnd.dev.cosign.simplesigning.v1+json", annotations)
+}
+
+// Attest attaches a signed in-toto statement about ref with the given
+// predicate.
+func (s Signer) Attest(ref name.Digest, predicateType string, predicate any) error {
+	algo, hex, _ := strings.Cut(ref.DigestStr(), ":")
+	statement, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": predicateType,
+		"subject":       []map[string]any{{"name": ref.Context().String(), "digest": map[string]string{algo: hex}}},
+		"predicate":     predicate,
+	})
+	if err != nil {
+		return err
+	}
+	const payloadType = "application/vnd.in-toto+json"
+	sig, err := s.sign(fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(statement), statement))
+	if err != nil {
+		return err
+	}
+	envelope, err := json.Marshal(map[string]any{
+		"payloadType": payloadType,
+		"payload":     base64.StdEncoding.EncodeToString(statement),
+		"signatures":  []map[string]string{{"sig": base64.StdEncoding.EncodeToString(sig)}},
+	})
+	if err != nil {
+		return err
+	}
+	annotations, err := s.sigAnnotations(sig)
+	if err != nil {
+		return err
+	}
+	annotations["predicateType"] = predicateType
+	if s.Rekor != nil {
+		verifier, err := s.verifierPEM()
+		if err != nil {
+			return err
+		}
+		// Rekor base64-encodes the envelope's signature again.
+		loggedSig := base64.StdEncoding.EncodeToString([]byte(base64.StdEncoding.EncodeToString(sig)))
+		bundle, err := s.bundle(map[string]any{
+			"apiVersion": "0.0.2",
+			"kind":       "intoto",
+			"spec": map[string]any{
+				"content": map[string]any{
+					"envelope": map[string]any{
+						"payloadType": payloadType,
+						"signatures":  []map[string]string{{"sig": loggedSig, "publicKey": base64.StdEncoding.EncodeToString([]byte(verifier))}},
+					},
+					"hash":        map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", sha256.Sum256(envelope))},
+					"payloadHash": map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", sha256.Sum256(statement))},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		annotations["dev.sigstore.cosign/bundle"] = bundle
+	}
+	return s.write(ref, "att", envelope, "application/vnd.dsse.envelope.v1+json", annotations)
+}
+
+func (s Signer) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, s.Key, digest[:])
+}
+
+// verifierPEM returns the signer's certificate, or if it has none its public
+// key, PEM-encoded, as log entries name it.
+func (s Signer) verifierPEM() (string, error) {
+	if s.LoggedAs != nil {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.LoggedAs.Raw})), nil
+	}
+	if s.Cert != nil {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Cert.Raw})), nil
+	}
+	return s.PublicKeyPEM()
+}
+
+// bundle returns the offline bundle cosign would attach for entry once
+// logged: the entry and its signed entry timestamp from the log.
+func (s Signer) bundle(entry any) (string, error) {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	// Marshalled from a map, the payload is in canonical key order.
+	payload := map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": s.LoggedAt.Unix(),
+		"logID":          fmt.Sprintf("%x", sha256.Sum256([]byte("testkit"))),
+		"logIndex":       1,
+	}
+	signed, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(signed)
+	set, err := ecdsa.SignASN1(rand.Reader, s.Rekor, digest[:])
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(map[string]any{"SignedEntryTimestamp": set, "Payload": payload})
+	return string(out), err
+}
+
+// sigAnnotations returns the annotations for sig's certificate and
+// timestamp, if the signer has them.
+func (s Signer) sigAnnotations(sig []byte) (map[string]string, error) {
+	annotations := s.certAnnotations()
+	if s.TSA != nil {
+		ts, err := s.timestamp(sig)
+		if err != nil {
+			return nil, err
+		}
+		annotations["dev.sigstore.cosign/rfc3161timestamp"] = ts
+	}
+	return annotations, nil
+}
+
+func (s Signer) certAnnotations() map[string]string {
+	annotations := map[string]string{}
+	if s.Cert == nil {
+		return annotations
+	}
+	annotations["dev.sigstore.cosign/certificate"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Cert.Raw}))
+	var chain []byte
+	for _, c := range s.Chain {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	annotations["dev.sigstore.cosign/chain"] = string(chain)
+	return annotations
+}
+
+// write pushes a single-layer cosign image for ref under the given suffix.
+func (s Signer) write(ref name.Digest, suffix string, payload []byte, mediaType types.MediaType, annotations map[string]string) error {
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer:       static.NewLayer(payload, mediaType),
+		Annotations: annotations,
+	})
+	if err != nil {
+		return err
+	}
+	tag := ref.Context().Tag(strings.Replace(ref.DigestStr(), ":", "-", 1) + "." + suffix)
+	return remote.Write(tag, img)
+}
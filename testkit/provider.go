@@ -0,0 +1,20 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit
+
+import (
+	"github.com/chainguard-dev/terraform-provider-helm/internal/provider"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+)
+
+// ProtoV6ProviderFactories returns provider factories for use with
+// terraform-plugin-testing's resource.TestCase, registering this provider as "helm".
+func ProtoV6ProviderFactories() map[string]func() (tfprotov6.ProviderServer, error) {
+	return map[string]func() (tfprotov6.ProviderServer, error){
+		"helm": providerserver.NewProtocol6WithError(provider.New("dev")()),
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package testkit provides helpers for writing acceptance tests against the
+// helm provider: an in-memory OCI registry, a builder for signed APK
+// repositories containing chart fixtures, and utilities to pull and template
+// the charts the provider publishes.
+package testkit
+
+import (
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+// Registry is an in-memory OCI registry served over plain HTTP.
+type Registry struct {
+	server *httptest.Server
+}
+
+// NewRegistry starts a new in-memory OCI registry. Callers must Close it when done.
+func NewRegistry() *Registry {
+	return &Registry{
+		server: httptest.NewServer(registry.New()),
+	}
+}
+
+// Host returns the registry host in the form "localhost:<port>". The localhost
+// name is used so go-containerregistry and Helm both talk plain HTTP to it.
+func (r *Registry) Host() string {
+	_, port, _ := strings.Cut(strings.TrimPrefix(r.server.URL, "http://"), ":")
+	return "localhost:" + port
+}
+
+// Repo returns a repository reference within the registry, suitable for the
+// helm_chart resource's repo attribute.
+func (r *Registry) Repo(repo string) string {
+	return r.Host() + "/" + repo
+}
+
+// Close shuts down the registry.
+func (r *Registry) Close() {
+	r.server.Close()
+}
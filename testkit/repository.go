@@ -0,0 +1,341 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // APK control checksums are SHA-1 by definition.
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultArch is the architecture packages are added under when ChartPackage.Arch is empty.
+const DefaultArch = "x86_64"
+
+// keyName is the name of the signing key; APK matches index signatures to
+// keyring entries by file name, so the public key is written under this name.
+const keyName = "testkit.rsa.pub"
+
+// ChartPackage describes a chart fixture to package as an APK.
+type ChartPackage struct {
+	// Name is the APK package name, e.g. "chart-basic".
+	Name string
+	// Version is the full APK version including the revision, e.g. "0.0.1-r0".
+	Version string
+	// Arch is the package architecture. Defaults to DefaultArch.
+	Arch string
+	// Chart is the chart directory, rooted at the directory holding Chart.yaml.
+	Chart fs.FS
+	// Provides are the virtual packages the package provides, e.g.
+	// "chart-virtual=1.0.0".
+	Provides []string
+	// Depends are the packages the package depends on, e.g. "chart-crds".
+	Depends []string
+	// BuildTime is when the package claims to have been built. It is
+	// omitted when zero.
+	BuildTime time.Time
+	// Dir is the directory the chart is put in within the package, e.g.
+	// "usr/share/charts/basic". Defaults to the chart's name.
+	Dir string
+	// Symlinks are symbolic links added to the chart after its files, by
+	// their path in the chart to their target, as the link stores it.
+	Symlinks map[string]string
+	// Hardlinks are hard links added to the chart after its files, by
+	// their path in the chart to the path in the chart they link to.
+	Hardlinks map[string]string
+	// Modes override the modes of the chart's files and directories, by
+	// their path in the chart, which are otherwise 0644 and 0755.
+	Modes map[string]fs.FileMode
+}
+
+// Repository builds a signed APK repository on disk from chart fixtures.
+//
+// The layout matches what melange produces, so the repository can be handed
+// to the provider's extra_repositories and extra_keyrings settings.
+type Repository struct {
+	dir      string
+	key      *rsa.PrivateKey
+	packages map[string][]*apk.Package
+}
+
+// NewRepository creates an empty repository rooted at dir and generates a
+// throwaway signing key for it.
+func NewRepository(dir string) (*Repository, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating signing key: %w", err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling public key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating repository directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, keyName), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o644); err != nil {
+		return nil, fmt.Errorf("writing public key: %w", err)
+	}
+
+	return &Repository{
+		dir:      dir,
+		key:      key,
+		packages: make(map[string][]*apk.Package),
+	}, nil
+}
+
+// Path returns the repository root, for use in extra_repositories.
+func (r *Repository) Path() string {
+	return r.dir
+}
+
+// KeyPath returns the path of the repository's public key, for use in extra_keyrings.
+func (r *Repository) KeyPath() string {
+	return filepath.Join(r.dir, keyName)
+}
+
+// AddChart packages a chart fixture as an APK and adds it to the repository.
+// Adding a package with the same name, version and arch as an existing one
+// replaces it, simulating a rebuild in place. Call Write after adding all
+// packages to (re)generate the signed indexes.
+func (r *Repository) AddChart(p ChartPackage) error {
+	arch := p.Arch
+	if arch == "" {
+		arch = DefaultArch
+	}
+
+	raw, err := fs.ReadFile(p.Chart, "Chart.yaml")
+	if err != nil {
+		return fmt.Errorf("reading Chart.yaml: %w", err)
+	}
+	var md helmchart.Metadata
+	if err := yaml.Unmarshal(raw, &md); err != nil {
+		return fmt.Errorf("parsing Chart.yaml: %w", err)
+	}
+	if md.Name == "" {
+		return fmt.Errorf("chart is missing a name")
+	}
+
+	dir := p.Dir
+	if dir == "" {
+		dir = md.Name
+	}
+	data, err := dataSection(dir, p)
+	if err != nil {
+		return fmt.Errorf("building data section: %w", err)
+	}
+	datahash := sha256.Sum256(data)
+
+	pkginfo := strings.Join([]string{
+		"pkgname = " + p.Name,
+		"pkgver = " + p.Version,
+		"arch = " + arch,
+		"pkgdesc = " + md.Description,
+		"size = " + fmt.Sprint(len(data)),
+		"datahash = " + hex.EncodeToString(datahash[:]),
+	}, "\n") + "\n"
+	for _, p := range p.Provides {
+		pkginfo += "provides = " + p + "\n"
+	}
+	for _, d := range p.Depends {
+		pkginfo += "depend = " + d + "\n"
+	}
+	if !p.BuildTime.IsZero() {
+		pkginfo += fmt.Sprintf("builddate = %d\n", p.BuildTime.Unix())
+	}
+
+	control, err := gzipTar(false, file{name: ".PKGINFO", content: []byte(pkginfo)})
+	if err != nil {
+		return fmt.Errorf("building control section: %w", err)
+	}
+	checksum := sha1.Sum(control) //nolint:gosec
+
+	archDir := filepath.Join(r.dir, arch)
+	if err := os.MkdirAll(archDir, 0o755); err != nil {
+		return fmt.Errorf("creating arch directory: %w", err)
+	}
+
+	pkg := &apk.Package{
+		Name:          p.Name,
+		Version:       p.Version,
+		Arch:          arch,
+		Description:   md.Description,
+		Checksum:      checksum[:],
+		Size:          uint64(len(control) + len(data)),
+		InstalledSize: uint64(len(data)),
+		DataHash:      hex.EncodeToString(datahash[:]),
+		Provides:      p.Provides,
+		Dependencies:  p.Depends,
+		BuildTime:     p.BuildTime,
+	}
+
+	if err := os.WriteFile(filepath.Join(archDir, pkg.Filename()), append(control, data...), 0o644); err != nil {
+		return fmt.Errorf("writing package: %w", err)
+	}
+
+	for i, existing := range r.packages[arch] {
+		if existing.Name == pkg.Name && existing.Version == pkg.Version {
+			r.packages[arch][i] = pkg
+			return nil
+		}
+	}
+	r.packages[arch] = append(r.packages[arch], pkg)
+	return nil
+}
+
+// Write generates a signed APKINDEX.tar.gz for every architecture with packages.
+func (r *Repository) Write() error {
+	for arch, pkgs := range r.packages {
+		archive, err := apk.ArchiveFromIndex(&apk.APKIndex{
+			Description: "testkit",
+			Packages:    pkgs,
+		})
+		if err != nil {
+			return fmt.Errorf("building index for %s: %w", arch, err)
+		}
+		index, err := io.ReadAll(archive)
+		if err != nil {
+			return fmt.Errorf("reading index for %s: %w", arch, err)
+		}
+
+		digest := sha256.Sum256(index)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, r.key, crypto.SHA256, digest[:])
+		if err != nil {
+			return fmt.Errorf("signing index for %s: %w", arch, err)
+		}
+
+		sigSection, err := gzipTar(false, file{name: ".SIGN.RSA256." + keyName, content: sig})
+		if err != nil {
+			return fmt.Errorf("building index signature for %s: %w", arch, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(r.dir, arch, "APKINDEX.tar.gz"), append(sigSection, index...), 0o644); err != nil {
+			return fmt.Errorf("writing index for %s: %w", arch, err)
+		}
+	}
+	return nil
+}
+
+type file struct {
+	name    string
+	content []byte
+	dir     bool
+	// symlink and hardlink are the target of a link.
+	symlink  string
+	hardlink string
+	// mode, if set, overrides the default mode.
+	mode fs.FileMode
+}
+
+// dataSection builds the APK data section, placing the chart under dir,
+// usually a top-level directory named after the chart the way `helm package`
+// lays it out, followed by the package's symlinks and hardlinks.
+func dataSection(dir string, pkg ChartPackage) ([]byte, error) {
+	files := []file{{name: dir, dir: true, mode: pkg.Modes["."]}}
+	err := fs.WalkDir(pkg.Chart, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		if d.IsDir() {
+			files = append(files, file{name: path.Join(dir, p), dir: true, mode: pkg.Modes[p]})
+			return nil
+		}
+		content, err := fs.ReadFile(pkg.Chart, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, file{name: path.Join(dir, p), content: content, mode: pkg.Modes[p]})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range slices.Sorted(maps.Keys(pkg.Symlinks)) {
+		files = append(files, file{name: path.Join(dir, p), symlink: pkg.Symlinks[p]})
+	}
+	for _, p := range slices.Sorted(maps.Keys(pkg.Hardlinks)) {
+		files = append(files, file{name: path.Join(dir, p), hardlink: path.Join(dir, pkg.Hardlinks[p])})
+	}
+	return gzipTar(true, files...)
+}
+
+// gzipTar writes files into a gzipped tar stream. APK signature and control
+// sections are concatenated with the following stream, so they must omit the
+// tar end-of-archive marker; pass terminate=false for those.
+func gzipTar(terminate bool, files ...file) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    0o644,
+			Size:    int64(len(f.content)),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		switch {
+		case f.dir:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0o755
+			hdr.Size = 0
+		case f.symlink != "":
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = f.symlink
+			hdr.Mode = 0o777
+		case f.hardlink != "":
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = f.hardlink
+		}
+		if f.mode != 0 {
+			hdr.Mode = int64(f.mode)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if terminate {
+		err = tw.Close()
+	} else {
+		err = tw.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
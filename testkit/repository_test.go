@@ -0,0 +1,77 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chainguard-dev/terraform-provider-helm/internal/pkg/chart"
+	"github.com/chainguard-dev/terraform-provider-helm/testkit"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRepository(t *testing.T) {
+	repo, err := testkit.NewRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	for _, p := range []testkit.ChartPackage{
+		{Name: "chart-basic", Version: "0.0.1-r0", Chart: os.DirFS("../testdata/charts/basic")},
+		{Name: "chart-basiclibrary", Version: "0.0.1-r0", Chart: os.DirFS("../testdata/charts/basiclibrary")},
+	} {
+		if err := repo.AddChart(p); err != nil {
+			t.Fatalf("failed to add %s: %v", p.Name, err)
+		}
+	}
+	if err := repo.Write(); err != nil {
+		t.Fatalf("failed to write repository: %v", err)
+	}
+
+	reg := testkit.NewRegistry()
+	defer reg.Close()
+
+	tests := []struct {
+		packageName string
+		chartName   string
+	}{
+		{packageName: "chart-basic", chartName: "basic"},
+		{packageName: "chart-basiclibrary", chartName: "basiclib"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.packageName, func(t *testing.T) {
+			artifact, err := chart.Build(t.Context(), tc.packageName, &chart.BuildConfig{
+				RuntimeRepos: []string{repo.Path()},
+				Keys:         []string{repo.KeyPath()},
+				Arch:         testkit.DefaultArch,
+			})
+			if err != nil {
+				t.Fatalf("failed to build chart: %v", err)
+			}
+
+			digest, err := artifact.Digest()
+			if err != nil {
+				t.Fatalf("failed to get chart digest: %v", err)
+			}
+
+			ref, err := name.ParseReference(reg.Repo(tc.chartName) + "@" + digest.String())
+			if err != nil {
+				t.Fatalf("failed to parse reference: %v", err)
+			}
+			if err := remote.Write(ref, artifact); err != nil {
+				t.Fatalf("failed to push chart: %v", err)
+			}
+
+			if _, _, err := testkit.TestPullAndTemplateChart(t, fmt.Sprintf("oci://%s", ref), tc.chartName, false); err != nil {
+				t.Fatalf("failed to pull and template chart: %v", err)
+			}
+		})
+	}
+}
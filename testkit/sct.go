@@ -0,0 +1,83 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"slices"
+	"time"
+)
+
+// LoggedCertificate issues a certificate from tmpl, as x509.CreateCertificate
+// does, with a signed certificate timestamp embedded from the certificate
+// transparency log whose key is log, as Fulcio issues them.
+func LoggedCertificate(tmpl, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer, log *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	// The certificate without the timestamp has the TBSCertificate the log
+	// signs, since the timestamp extension is added last.
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		return nil, err
+	}
+	precert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	logDER, err := x509.MarshalPKIXPublicKey(&log.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	logID := sha256.Sum256(logDER)
+	issuerKeyHash := sha256.Sum256(parent.RawSubjectPublicKeyInfo)
+	timestamp := uint64(time.Now().UnixMilli())
+
+	var signed bytes.Buffer
+	signed.Write([]byte{0, 0}) // v1, certificate_timestamp
+	binary.Write(&signed, binary.BigEndian, timestamp)
+	binary.Write(&signed, binary.BigEndian, uint16(1)) // precert_entry
+	signed.Write(issuerKeyHash[:])
+	tbs := precert.RawTBSCertificate
+	signed.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	signed.Write(tbs)
+	signed.Write([]byte{0, 0}) // no extensions
+	digest := sha256.Sum256(signed.Bytes())
+	sig, err := ecdsa.SignASN1(rand.Reader, log, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var sct bytes.Buffer
+	sct.WriteByte(0) // v1
+	sct.Write(logID[:])
+	binary.Write(&sct, binary.BigEndian, timestamp)
+	sct.Write([]byte{0, 0}) // no extensions
+	sct.Write([]byte{4, 3}) // SHA-256, ECDSA
+	binary.Write(&sct, binary.BigEndian, uint16(len(sig)))
+	sct.Write(sig)
+
+	var list bytes.Buffer
+	binary.Write(&list, binary.BigEndian, uint16(2+sct.Len()))
+	binary.Write(&list, binary.BigEndian, uint16(sct.Len()))
+	list.Write(sct.Bytes())
+	value, err := asn1.Marshal(list.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	logged := *tmpl
+	logged.ExtraExtensions = append(slices.Clip(tmpl.ExtraExtensions), pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, Value: value})
+	if der, err = x509.CreateCertificate(rand.Reader, &logged, parent, pub, priv); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2025 Chainguard, Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testkit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"time"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSAWithSHA  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidRSASSAPSS     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSigningCertV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// timestamp returns the annotation cosign records an RFC 3161 timestamp of
+// sig under, as issued by the signer's TSA for TimestampedAt.
+func (s Signer) timestamp(sig []byte) (string, error) {
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	imprint := sha256.Sum256(sig)
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 2},
+		MessageImprint: messageImprint{sha256Alg, imprint[:]},
+		SerialNumber:   big.NewInt(1),
+		GenTime:        s.TimestampedAt.UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	type attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values []any `asn1:"set"`
+	}
+	// The ESS attribute binds the signature to the TSA's certificate, by
+	// its SHA-256 hash, the default.
+	type essCertIDv2 struct {
+		CertHash []byte
+	}
+	type signingCertificateV2 struct {
+		Certs []essCertIDv2
+	}
+	infoDigest := sha256.Sum256(info)
+	certDigest := sha256.Sum256(s.TSACert.Raw)
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: []any{oidTSTInfo}},
+		{Type: oidMessageDigest, Values: []any{infoDigest[:]}},
+		{Type: oidSigningCertV2, Values: []any{signingCertificateV2{Certs: []essCertIDv2{{certDigest[:]}}}}},
+	}, "set")
+	if err != nil {
+		return "", err
+	}
+	attrsDigest := sha256.Sum256(attrs)
+	// RSA keys sign with RSASSA-PSS, and ECDSA keys as usual.
+	var opts crypto.SignerOpts = crypto.SHA256
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA}
+	if _, ok := s.TSA.Public().(*rsa.PublicKey); ok {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		sha256DER, err := asn1.Marshal(sha256Alg)
+		if err != nil {
+			return "", err
+		}
+		params, err := asn1.Marshal(struct {
+			Hash       pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+			MGF        pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+			SaltLength int                      `asn1:"explicit,tag:2"`
+		}{sha256Alg, pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: sha256DER}}, sha256.Size})
+		if err != nil {
+			return "", err
+		}
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidRSASSAPSS, Parameters: asn1.RawValue{FullBytes: params}}
+	}
+	signature, err := s.TSA.Sign(rand.Reader, attrsDigest[:], opts)
+	if err != nil {
+		return "", err
+	}
+
+	sid, err := asn1.Marshal(struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}{asn1.RawValue{FullBytes: s.TSACert.RawIssuer}, s.TSACert.SerialNumber})
+	if err != nil {
+		return "", err
+	}
+	// Signed attributes are sent implicitly tagged [0] rather than as a SET.
+	tagged := append([]byte{0xa0}, attrs[1:]...)
+	signerInfos, err := asn1.MarshalWithParams([]struct {
+		Version            int
+		SID                asn1.RawValue
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}{{1, asn1.RawValue{FullBytes: sid}, sha256Alg, asn1.RawValue{FullBytes: tagged}, sigAlg, signature}}, "set")
+	if err != nil {
+		return "", err
+	}
+	digestAlgorithms, err := asn1.MarshalWithParams([]pkix.AlgorithmIdentifier{sha256Alg}, "set")
+	if err != nil {
+		return "", err
+	}
+	eContent, err := asn1.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+
+	type encapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     asn1.RawValue
+	}
+	var certificates asn1.RawValue
+	if !s.TSAOmitsCert {
+		certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.TSACert.Raw}
+	}
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo encapContentInfo
+		Certificates     asn1.RawValue `asn1:"optional"`
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{FullBytes: digestAlgorithms},
+		EncapContentInfo: encapContentInfo{oidTSTInfo, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent}},
+		Certificates:     certificates,
+		SignerInfos:      asn1.RawValue{FullBytes: signerInfos},
+	})
+	if err != nil {
+		return "", err
+	}
+	token, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		return "", err
+	}
+	resp, err := asn1.Marshal(struct {
+		Status struct{ Status int }
+		Token  asn1.RawValue
+	}{Token: asn1.RawValue{FullBytes: token}})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string][]byte{"SignedRFC3161Timestamp": resp})
+	return string(out), err
+}